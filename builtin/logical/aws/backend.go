@@ -81,8 +81,15 @@ the "roles/" endpoints before any access keys can be generated.
 `
 
 // clientIAM returns the configured IAM client. If nil, it constructs a new one
-// and returns it, setting it the internal variable
-func (b *backend) clientIAM(ctx context.Context, s logical.Storage) (iamiface.IAMAPI, error) {
+// and returns it, setting it the internal variable. Clients for roles that
+// override the region or endpoint are constructed on every call instead.
+func (b *backend) clientIAM(ctx context.Context, s logical.Storage, override clientOverride) (iamiface.IAMAPI, error) {
+	if override != (clientOverride{}) {
+		b.clientMutex.RLock()
+		defer b.clientMutex.RUnlock()
+		return nonCachedClientIAM(ctx, s, override)
+	}
+
 	b.clientMutex.RLock()
 	if b.iamClient != nil {
 		b.clientMutex.RUnlock()
@@ -100,7 +107,7 @@ func (b *backend) clientIAM(ctx context.Context, s logical.Storage) (iamiface.IA
 		return b.iamClient, nil
 	}
 
-	iamClient, err := nonCachedClientIAM(ctx, s)
+	iamClient, err := nonCachedClientIAM(ctx, s, override)
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +116,13 @@ func (b *backend) clientIAM(ctx context.Context, s logical.Storage) (iamiface.IA
 	return b.iamClient, nil
 }
 
-func (b *backend) clientSTS(ctx context.Context, s logical.Storage) (stsiface.STSAPI, error) {
+func (b *backend) clientSTS(ctx context.Context, s logical.Storage, override clientOverride) (stsiface.STSAPI, error) {
+	if override != (clientOverride{}) {
+		b.clientMutex.RLock()
+		defer b.clientMutex.RUnlock()
+		return nonCachedClientSTS(ctx, s, override)
+	}
+
 	b.clientMutex.RLock()
 	if b.stsClient != nil {
 		b.clientMutex.RUnlock()
@@ -127,7 +140,7 @@ func (b *backend) clientSTS(ctx context.Context, s logical.Storage) (stsiface.ST
 		return b.stsClient, nil
 	}
 
-	stsClient, err := nonCachedClientSTS(ctx, s)
+	stsClient, err := nonCachedClientSTS(ctx, s, override)
 	if err != nil {
 		return nil, err
 	}
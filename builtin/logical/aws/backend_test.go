@@ -20,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
 	"github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/vault/helper/testhelpers"
 	"github.com/hashicorp/vault/logical"
@@ -37,6 +38,121 @@ func (m *mockIAMClient) CreateUser(input *iam.CreateUserInput) (*iam.CreateUserO
 	return nil, awserr.New("Throttling", "", nil)
 }
 
+// mockIAMUserClient records the IAM calls made while creating and deleting a
+// user so that their order can be checked.
+type mockIAMUserClient struct {
+	iamiface.IAMAPI
+
+	calls    []string
+	attached []*iam.AttachedPolicy
+	path     string
+}
+
+func (m *mockIAMUserClient) CreateUser(input *iam.CreateUserInput) (*iam.CreateUserOutput, error) {
+	m.calls = append(m.calls, "CreateUser")
+	m.path = aws.StringValue(input.Path)
+	return &iam.CreateUserOutput{}, nil
+}
+
+func (m *mockIAMUserClient) AttachUserPolicy(input *iam.AttachUserPolicyInput) (*iam.AttachUserPolicyOutput, error) {
+	m.calls = append(m.calls, "AttachUserPolicy "+*input.PolicyArn)
+	m.attached = append(m.attached, &iam.AttachedPolicy{PolicyArn: input.PolicyArn})
+	return &iam.AttachUserPolicyOutput{}, nil
+}
+
+func (m *mockIAMUserClient) PutUserPolicy(input *iam.PutUserPolicyInput) (*iam.PutUserPolicyOutput, error) {
+	m.calls = append(m.calls, "PutUserPolicy")
+	return &iam.PutUserPolicyOutput{}, nil
+}
+
+func (m *mockIAMUserClient) CreateAccessKey(input *iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error) {
+	m.calls = append(m.calls, "CreateAccessKey")
+	return &iam.CreateAccessKeyOutput{
+		AccessKey: &iam.AccessKey{
+			AccessKeyId:     aws.String("AKIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+		},
+	}, nil
+}
+
+func (m *mockIAMUserClient) ListGroupsForUser(input *iam.ListGroupsForUserInput) (*iam.ListGroupsForUserOutput, error) {
+	return &iam.ListGroupsForUserOutput{}, nil
+}
+
+func (m *mockIAMUserClient) ListUserPolicies(input *iam.ListUserPoliciesInput) (*iam.ListUserPoliciesOutput, error) {
+	return &iam.ListUserPoliciesOutput{}, nil
+}
+
+func (m *mockIAMUserClient) ListAttachedUserPolicies(input *iam.ListAttachedUserPoliciesInput) (*iam.ListAttachedUserPoliciesOutput, error) {
+	return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: m.attached}, nil
+}
+
+func (m *mockIAMUserClient) ListAccessKeys(input *iam.ListAccessKeysInput) (*iam.ListAccessKeysOutput, error) {
+	return &iam.ListAccessKeysOutput{}, nil
+}
+
+func (m *mockIAMUserClient) DetachUserPolicy(input *iam.DetachUserPolicyInput) (*iam.DetachUserPolicyOutput, error) {
+	m.calls = append(m.calls, "DetachUserPolicy "+*input.PolicyArn)
+	return &iam.DetachUserPolicyOutput{}, nil
+}
+
+func (m *mockIAMUserClient) GetUser(input *iam.GetUserInput) (*iam.GetUserOutput, error) {
+	return &iam.GetUserOutput{
+		User: &iam.User{UserName: aws.String("vault-root"), Path: aws.String(m.path)},
+	}, nil
+}
+
+func (m *mockIAMUserClient) DeleteAccessKey(input *iam.DeleteAccessKeyInput) (*iam.DeleteAccessKeyOutput, error) {
+	m.calls = append(m.calls, "DeleteAccessKey "+*input.AccessKeyId)
+	return &iam.DeleteAccessKeyOutput{}, nil
+}
+
+func (m *mockIAMUserClient) DeleteUser(input *iam.DeleteUserInput) (*iam.DeleteUserOutput, error) {
+	m.calls = append(m.calls, "DeleteUser")
+	return &iam.DeleteUserOutput{}, nil
+}
+
+type mockSTSClient struct {
+	stsiface.STSAPI
+
+	arn      string
+	duration int64
+	roleArn  string
+	policy   string
+}
+
+func (m *mockSTSClient) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Arn: aws.String(m.arn),
+	}, nil
+}
+
+func (m *mockSTSClient) GetFederationToken(input *sts.GetFederationTokenInput) (*sts.GetFederationTokenOutput, error) {
+	m.duration = *input.DurationSeconds
+	return &sts.GetFederationTokenOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Duration(m.duration) * time.Second)),
+		},
+	}, nil
+}
+
+func (m *mockSTSClient) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	m.duration = *input.DurationSeconds
+	m.roleArn = *input.RoleArn
+	m.policy = aws.StringValue(input.Policy)
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Duration(m.duration) * time.Second)),
+		},
+	}, nil
+}
+
 func getBackend(t *testing.T) logical.Backend {
 	be, _ := Factory(context.Background(), logical.TestBackendConfig())
 	return be
@@ -170,6 +286,465 @@ func TestBackend_throttled(t *testing.T) {
 	}
 }
 
+func TestBackend_federationTokenMocked(t *testing.T) {
+	t.Parallel()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"credential_type": federationTokenCred,
+			"policy_document": testDynamoPolicy,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	stsRequest := func(data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "sts/test",
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	// Federation tokens can't be created with the credentials of an assumed role
+	client := &mockSTSClient{arn: "arn:aws:sts::123456789012:assumed-role/vault/session"}
+	b.stsClient = client
+	resp, err = stsRequest(nil)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for assumed role credentials: resp:%#v err:%s", resp, err)
+	}
+
+	client.arn = "arn:aws:iam::123456789012:user/vault"
+	for _, tc := range []struct {
+		ttl      int
+		expected int64
+	}{
+		{3600, 3600},
+		{60, minFederationTokenTTL},
+		{200000, maxFederationTokenTTL},
+	} {
+		resp, err = stsRequest(map[string]interface{}{
+			"ttl": tc.ttl,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to create federation token: resp:%#v err:%s", resp, err)
+		}
+		if client.duration != tc.expected {
+			t.Fatalf("ttl %d: expected a duration of %d, got %d", tc.ttl, tc.expected, client.duration)
+		}
+		if (tc.ttl != int(tc.expected)) != (len(resp.Warnings) > 0) {
+			t.Fatalf("ttl %d: unexpected warnings: %v", tc.ttl, resp.Warnings)
+		}
+		if resp.Data["security_token"] != "token" || resp.Secret.Renewable {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+
+	// Revoking is a no-op since the token expires on its own
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   config.StorageView,
+		Secret:    resp.Secret,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("failed to revoke federation token: resp:%#v err:%s", resp, err)
+	}
+}
+
+func TestBackend_assumedRoleMocked(t *testing.T) {
+	t.Parallel()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	client := &mockSTSClient{}
+	b.stsClient = client
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	roleArns := []string{
+		"arn:aws:iam::123456789012:role/first",
+		"arn:aws:iam::123456789012:role/second",
+	}
+	for name, data := range map[string]map[string]interface{}{
+		"assumed": {
+			"credential_type": assumedRoleCred,
+			"role_arns":       roleArns,
+		},
+		"assumed_with_policy": {
+			"credential_type": assumedRoleCred,
+			"role_arns":       roleArns[:1],
+			"policy_document": testDynamoPolicy,
+		},
+		"federation": {
+			"credential_type": federationTokenCred,
+		},
+	} {
+		resp, err := request("roles/"+name, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+		}
+	}
+
+	for _, invalid := range []struct {
+		role string
+		data map[string]interface{}
+	}{
+		{"assumed", nil},
+		{"assumed", map[string]interface{}{"role_arn": "arn:aws:iam::123456789012:role/other"}},
+		{"assumed", map[string]interface{}{"role_arn": roleArns[0], "policy_document": "{"}},
+		{"assumed_with_policy", map[string]interface{}{"policy_document": testDynamoPolicy}},
+		{"federation", map[string]interface{}{"policy_document": testDynamoPolicy}},
+	} {
+		resp, err := request("creds/"+invalid.role, invalid.data)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for role %q with %v: resp:%#v err:%s", invalid.role, invalid.data, resp, err)
+		}
+	}
+
+	resp, err := request("creds/assumed", map[string]interface{}{
+		"role_arn":        roleArns[1],
+		"ttl":             "20m",
+		"policy_document": testDynamoPolicy,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to assume role: resp:%#v err:%s", resp, err)
+	}
+	compacted, err := compactJSON(testDynamoPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.roleArn != roleArns[1] || client.duration != 1200 || client.policy != compacted {
+		t.Fatalf("bad AssumeRole input: role ARN %q, duration %d, policy %q", client.roleArn, client.duration, client.policy)
+	}
+	if resp.Data["security_token"] != "token" || resp.Secret.Renewable {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The role's policy document is used as the session policy otherwise
+	resp, err = request("creds/assumed_with_policy", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to assume role: resp:%#v err:%s", resp, err)
+	}
+	if client.roleArn != roleArns[0] || client.duration != 3600 || client.policy != compacted {
+		t.Fatalf("bad AssumeRole input: role ARN %q, duration %d, policy %q", client.roleArn, client.duration, client.policy)
+	}
+
+	resp, err = request("creds/assumed", map[string]interface{}{
+		"role_arn": roleArns[0],
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to assume role: resp:%#v err:%s", resp, err)
+	}
+	if client.policy != "" {
+		t.Fatalf("expected no session policy, got %q", client.policy)
+	}
+}
+
+func TestBackend_iamUserManagedPoliciesMocked(t *testing.T) {
+	t.Parallel()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	client := &mockIAMUserClient{}
+	b.iamClient = client
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/managed",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"credential_type": iamUserCred,
+			"policy_arns":     []string{ec2PolicyArn, iamPolicyArn},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/managed",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["iam_user_policy_mode"] != iamUserPolicyModeManaged {
+		t.Fatalf("bad iam_user_policy_mode: %#v", resp.Data["iam_user_policy_mode"])
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/managed",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to create user: resp:%#v err:%s", resp, err)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   config.StorageView,
+		Secret:    resp.Secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No inline policy is put, and the managed policies are detached before
+	// the user is deleted
+	expected := []string{
+		"CreateUser",
+		"AttachUserPolicy " + ec2PolicyArn,
+		"AttachUserPolicy " + iamPolicyArn,
+		"CreateAccessKey",
+		"DetachUserPolicy " + ec2PolicyArn,
+		"DetachUserPolicy " + iamPolicyArn,
+		"DeleteUser",
+	}
+	if !reflect.DeepEqual(client.calls, expected) {
+		t.Fatalf("bad IAM calls: got %v, expected %v", client.calls, expected)
+	}
+}
+
+func TestBackend_iamPathMocked(t *testing.T) {
+	t.Parallel()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	client := &mockIAMUserClient{}
+	b.iamClient = client
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{"credential_type": iamUserCred, "iam_path": "vault/"},
+		{"credential_type": iamUserCred, "iam_path": "/vault"},
+		{"credential_type": iamUserCred, "iam_path": "/vault ephemeral/"},
+		{"credential_type": federationTokenCred, "iam_path": "/vault/"},
+	} {
+		resp, err := request(logical.UpdateOperation, "roles/test", invalid)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v: resp:%#v err:%s", invalid, resp, err)
+		}
+	}
+
+	resp, err := request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"credential_type": iamUserCred,
+		"iam_path":        "/vault/ephemeral/",
+		"policy_arns":     ec2PolicyArn,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write role: resp:%#v err:%s", resp, err)
+	}
+
+	createAndRevoke := func(pathAtRevocation string) error {
+		resp, err := request(logical.ReadOperation, "creds/test", nil)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("failed to create user: resp:%#v err:%s", resp, err)
+		}
+		if client.path != "/vault/ephemeral/" {
+			t.Fatalf("expected user to be created under /vault/ephemeral/, got %q", client.path)
+		}
+		client.path = pathAtRevocation
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   config.StorageView,
+			Secret:    resp.Secret,
+		})
+		return err
+	}
+
+	if err := createAndRevoke("/vault/ephemeral/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createAndRevoke("/"); err == nil {
+		t.Fatal("expected revocation of a user outside the IAM path to fail")
+	}
+}
+
+func TestBackend_rotateRootMocked(t *testing.T) {
+	t.Parallel()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/root",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"access_key": "AKIAOLD",
+			"secret_key": "old",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to write configuration: resp:%#v err:%s", resp, err)
+	}
+
+	rotate := func(arn string) (*logical.Response, *mockIAMUserClient, error) {
+		iamClient := &mockIAMUserClient{}
+		b.iamClient = iamClient
+		b.stsClient = &mockSTSClient{arn: arn}
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/rotate-root",
+			Storage:   config.StorageView,
+		})
+		return resp, iamClient, err
+	}
+
+	for _, arn := range []string{
+		"arn:aws:sts::123456789012:assumed-role/vault/session",
+		"arn:aws:sts::123456789012:federated-user/vault",
+		"arn:aws:iam::123456789012:root",
+	} {
+		resp, iamClient, err := rotate(arn)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected rotation to be refused for %q: resp:%#v err:%s", arn, resp, err)
+		}
+		if len(iamClient.calls) != 0 {
+			t.Fatalf("expected no IAM calls for %q, got %v", arn, iamClient.calls)
+		}
+	}
+
+	resp, iamClient, err := rotate("arn:aws:iam::123456789012:user/vault-root")
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to rotate root: resp:%#v err:%s", resp, err)
+	}
+	if _, ok := resp.Data["secret_key"]; ok || resp.Data["access_key"] != "AKIAEXAMPLE" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if !reflect.DeepEqual(iamClient.calls, []string{"CreateAccessKey", "DeleteAccessKey AKIAOLD"}) {
+		t.Fatalf("bad IAM calls: %v", iamClient.calls)
+	}
+	if b.iamClient != nil || b.stsClient != nil {
+		t.Fatal("expected cached clients to be cleared")
+	}
+
+	entry, err := config.StorageView.Get(context.Background(), "config/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root rootConfig
+	if err := entry.DecodeJSON(&root); err != nil {
+		t.Fatal(err)
+	}
+	if root.AccessKey != "AKIAEXAMPLE" || root.SecretKey != "secret" {
+		t.Fatalf("bad stored credentials: %#v", root)
+	}
+}
+
+func TestBackend_roleClientOverride(t *testing.T) {
+	t.Parallel()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp:%#v err:%s", resp, err)
+		}
+		return resp
+	}
+
+	request(logical.UpdateOperation, "config/root", map[string]interface{}{
+		"access_key":   "AKIAEXAMPLE",
+		"secret_key":   "secret",
+		"region":       "us-east-1",
+		"iam_endpoint": "https://iam.amazonaws.com",
+		"sts_endpoint": "https://sts.amazonaws.com",
+	})
+	request(logical.UpdateOperation, "roles/gov", map[string]interface{}{
+		"credential_type": assumedRoleCred,
+		"role_arns":       "arn:aws-us-gov:iam::123456789012:role/example",
+		"region":          "us-gov-west-1",
+		"sts_endpoint":    "https://sts.us-gov-west-1.amazonaws.com",
+	})
+
+	resp := request(logical.ReadOperation, "roles/gov", nil)
+	if resp.Data["region"] != "us-gov-west-1" || resp.Data["iam_endpoint"] != "" || resp.Data["sts_endpoint"] != "https://sts.us-gov-west-1.amazonaws.com" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	role, err := b.roleRead(context.Background(), config.StorageView, "gov", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		clientType string
+		override   clientOverride
+		region     string
+		endpoint   string
+	}{
+		{"sts", role.clientOverride(), "us-gov-west-1", "https://sts.us-gov-west-1.amazonaws.com"},
+		{"iam", role.clientOverride(), "us-gov-west-1", "https://iam.amazonaws.com"},
+		{"sts", clientOverride{}, "us-east-1", "https://sts.amazonaws.com"},
+		{"iam", clientOverride{IAMEndpoint: "https://iam.us-gov.amazonaws.com"}, "us-east-1", "https://iam.us-gov.amazonaws.com"},
+	} {
+		awsConfig, err := getRootConfig(context.Background(), config.StorageView, tc.clientType, tc.override)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *awsConfig.Region != tc.region || *awsConfig.Endpoint != tc.endpoint {
+			t.Fatalf("bad %s config for %#v: region %q, endpoint %q", tc.clientType, tc.override, *awsConfig.Region, *awsConfig.Endpoint)
+		}
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
 	initSetup.Do(func() {
 		if v := os.Getenv("AWS_DEFAULT_REGION"); v == "" {
@@ -647,12 +1222,17 @@ func testAccStepReadPolicy(t *testing.T, name string, value string) logicaltest.
 			}
 
 			expected := map[string]interface{}{
-				"policy_arns":      []string(nil),
-				"role_arns":        []string(nil),
-				"policy_document":  value,
-				"credential_types": []string{iamUserCred, federationTokenCred},
-				"default_sts_ttl":  int64(0),
-				"max_sts_ttl":      int64(0),
+				"policy_arns":          []string(nil),
+				"role_arns":            []string(nil),
+				"policy_document":      value,
+				"credential_types":     []string{iamUserCred, federationTokenCred},
+				"default_sts_ttl":      int64(0),
+				"max_sts_ttl":          int64(0),
+				"iam_user_policy_mode": iamUserPolicyModeInline,
+				"iam_path":             "",
+				"region":               "",
+				"iam_endpoint":         "",
+				"sts_endpoint":         "",
 			}
 			if !reflect.DeepEqual(resp.Data, expected) {
 				return fmt.Errorf("bad: got: %#v\nexpected: %#v", resp.Data, expected)
@@ -745,12 +1325,17 @@ func TestBackend_iamUserManagedInlinePolicies(t *testing.T) {
 		"credential_type": iamUserCred,
 	}
 	expectedRoleData := map[string]interface{}{
-		"policy_document":  compacted,
-		"policy_arns":      []string{ec2PolicyArn, iamPolicyArn},
-		"credential_types": []string{iamUserCred},
-		"role_arns":        []string(nil),
-		"default_sts_ttl":  int64(0),
-		"max_sts_ttl":      int64(0),
+		"policy_document":      compacted,
+		"policy_arns":          []string{ec2PolicyArn, iamPolicyArn},
+		"credential_types":     []string{iamUserCred},
+		"role_arns":            []string(nil),
+		"default_sts_ttl":      int64(0),
+		"max_sts_ttl":          int64(0),
+		"iam_user_policy_mode": iamUserPolicyModeBoth,
+		"iam_path":             "",
+		"region":               "",
+		"iam_endpoint":         "",
+		"sts_endpoint":         "",
 	}
 	logicaltest.Test(t, logicaltest.TestCase{
 		AcceptanceTest: true,
@@ -881,12 +1466,17 @@ func testAccStepReadArnPolicy(t *testing.T, name string, value string) logicalte
 			}
 
 			expected := map[string]interface{}{
-				"policy_arns":      []string{value},
-				"role_arns":        []string(nil),
-				"policy_document":  "",
-				"credential_types": []string{iamUserCred},
-				"default_sts_ttl":  int64(0),
-				"max_sts_ttl":      int64(0),
+				"policy_arns":          []string{value},
+				"role_arns":            []string(nil),
+				"policy_document":      "",
+				"credential_types":     []string{iamUserCred},
+				"default_sts_ttl":      int64(0),
+				"max_sts_ttl":          int64(0),
+				"iam_user_policy_mode": iamUserPolicyModeManaged,
+				"iam_path":             "",
+				"region":               "",
+				"iam_endpoint":         "",
+				"sts_endpoint":         "",
 			}
 			if !reflect.DeepEqual(resp.Data, expected) {
 				return fmt.Errorf("bad: got: %#v\nexpected: %#v", resp.Data, expected)
@@ -15,8 +15,16 @@ import (
 	"github.com/hashicorp/vault/logical"
 )
 
+// clientOverride holds the per-role settings that take precedence over
+// config/root when constructing IAM and STS clients.
+type clientOverride struct {
+	Region      string
+	IAMEndpoint string
+	STSEndpoint string
+}
+
 // NOTE: The caller is required to ensure that b.clientMutex is at least read locked
-func getRootConfig(ctx context.Context, s logical.Storage, clientType string) (*aws.Config, error) {
+func getRootConfig(ctx context.Context, s logical.Storage, clientType string, override clientOverride) (*aws.Config, error) {
 	credsConfig := &awsutil.CredentialsConfig{}
 	var endpoint string
 	var maxRetries int = aws.UseServiceDefaultRetries
@@ -43,6 +51,16 @@ func getRootConfig(ctx context.Context, s logical.Storage, clientType string) (*
 		}
 	}
 
+	if override.Region != "" {
+		credsConfig.Region = override.Region
+	}
+	switch {
+	case clientType == "iam" && override.IAMEndpoint != "":
+		endpoint = override.IAMEndpoint
+	case clientType == "sts" && override.STSEndpoint != "":
+		endpoint = override.STSEndpoint
+	}
+
 	if credsConfig.Region == "" {
 		credsConfig.Region = os.Getenv("AWS_REGION")
 		if credsConfig.Region == "" {
@@ -69,8 +87,8 @@ func getRootConfig(ctx context.Context, s logical.Storage, clientType string) (*
 	}, nil
 }
 
-func nonCachedClientIAM(ctx context.Context, s logical.Storage) (*iam.IAM, error) {
-	awsConfig, err := getRootConfig(ctx, s, "iam")
+func nonCachedClientIAM(ctx context.Context, s logical.Storage, override clientOverride) (*iam.IAM, error) {
+	awsConfig, err := getRootConfig(ctx, s, "iam", override)
 	if err != nil {
 		return nil, err
 	}
@@ -83,8 +101,8 @@ func nonCachedClientIAM(ctx context.Context, s logical.Storage) (*iam.IAM, error
 	return client, nil
 }
 
-func nonCachedClientSTS(ctx context.Context, s logical.Storage) (*sts.STS, error) {
-	awsConfig, err := getRootConfig(ctx, s, "sts")
+func nonCachedClientSTS(ctx context.Context, s logical.Storage, override clientOverride) (*sts.STS, error) {
+	awsConfig, err := getRootConfig(ctx, s, "sts", override)
 	if err != nil {
 		return nil, err
 	}
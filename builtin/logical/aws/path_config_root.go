@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -39,6 +40,13 @@ func pathConfigRoot(b *backend) *framework.Path {
 				Default:     aws.UseServiceDefaultRetries,
 				Description: "Maximum number of retries for recoverable exceptions of AWS APIs",
 			},
+			"username_template": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Template for the names of generated IAM users, federation tokens and
+role sessions. Supports the {{display_name}}, {{role_name}} and {{unix_time}}
+placeholders; a random suffix is always appended. If unset, names are
+generated as vault-<display_name>-<role_name>-<unix_time>-<random>.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -55,6 +63,10 @@ func (b *backend) pathConfigRootWrite(ctx context.Context, req *logical.Request,
 	iamendpoint := data.Get("iam_endpoint").(string)
 	stsendpoint := data.Get("sts_endpoint").(string)
 	maxretries := data.Get("max_retries").(int)
+	usernameTemplate := data.Get("username_template").(string)
+	if err := validateUsernameTemplate(usernameTemplate); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
 
 	b.clientMutex.Lock()
 	defer b.clientMutex.Unlock()
@@ -66,6 +78,8 @@ func (b *backend) pathConfigRootWrite(ctx context.Context, req *logical.Request,
 		STSEndpoint: stsendpoint,
 		Region:      region,
 		MaxRetries:  maxretries,
+
+		UsernameTemplate: usernameTemplate,
 	})
 	if err != nil {
 		return nil, err
@@ -90,6 +104,25 @@ type rootConfig struct {
 	STSEndpoint string `json:"sts_endpoint"`
 	Region      string `json:"region"`
 	MaxRetries  int    `json:"max_retries"`
+
+	UsernameTemplate string `json:"username_template"`
+}
+
+// usernameTemplate returns the configured username_template, or an empty
+// string if none is configured.
+func (b *backend) usernameTemplate(ctx context.Context, s logical.Storage) (string, error) {
+	entry, err := s.Get(ctx, "config/root")
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", nil
+	}
+	var config rootConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return "", errwrap.Wrapf("error reading root configuration: {{err}}", err)
+	}
+	return config.UsernameTemplate, nil
 }
 
 const pathConfigRootHelpSyn = `
@@ -3,9 +3,11 @@ package aws
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -25,14 +27,24 @@ func pathConfigRotateRoot(b *backend) *framework.Path {
 
 func (b *backend) pathConfigRotateRootUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	// have to get the client config first because that takes out a read lock
-	client, err := b.clientIAM(ctx, req.Storage)
+	client, err := b.clientIAM(ctx, req.Storage, clientOverride{})
 	if err != nil {
 		return nil, err
 	}
 	if client == nil {
 		return nil, fmt.Errorf("nil IAM client")
 	}
+	stsClient, err := b.clientSTS(ctx, req.Storage, clientOverride{})
+	if err != nil {
+		return nil, err
+	}
+	if stsClient == nil {
+		return nil, fmt.Errorf("nil STS client")
+	}
 
+	// Holding the write lock for the whole rotation blocks credential
+	// issuance from picking up clients until the new key has been persisted
+	// and the cached clients have been cleared
 	b.clientMutex.Lock()
 	defer b.clientMutex.Unlock()
 
@@ -52,6 +64,18 @@ func (b *backend) pathConfigRotateRootUpdate(ctx context.Context, req *logical.R
 		return logical.ErrorResponse("Cannot call config/rotate-root when either access_key or secret_key is empty"), nil
 	}
 
+	// Only the access keys of IAM users can be rotated; credentials of an
+	// assumed role or a federated user are temporary, and the account root
+	// user has no IAM user to create keys for
+	callerIdentity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, errwrap.Wrapf("error calling GetCallerIdentity: {{err}}", err)
+	}
+	callerArn := aws.StringValue(callerIdentity.Arn)
+	if !isIAMUserArn(callerArn) || strings.HasSuffix(callerArn, ":root") {
+		return logical.ErrorResponse(fmt.Sprintf("Cannot call config/rotate-root when the configured credentials do not belong to an IAM user: %q", callerArn)), nil
+	}
+
 	var getUserInput iam.GetUserInput // empty input means get current user
 	getUserRes, err := client.GetUser(&getUserInput)
 	if err != nil {
@@ -72,6 +72,26 @@ GetFederationToken API call, acting as a filter on permissions available.`,
 				Description: fmt.Sprintf("Max allowed TTL for %s and %s credential types", assumedRoleCred, federationTokenCred),
 			},
 
+			"iam_path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "IAM path for generated IAM users. Must begin and end with a slash. Only valid when credential_type is " + iamUserCred,
+			},
+
+			"region": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Region for API calls made for this role. Overrides the region of config/root.",
+			},
+
+			"iam_endpoint": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Endpoint to custom IAM server URL for this role. Overrides the iam_endpoint of config/root.",
+			},
+
+			"sts_endpoint": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Endpoint to custom STS server URL for this role. Overrides the sts_endpoint of config/root.",
+			},
+
 			"arn": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `Deprecated; use role_arns or policy_arns instead. ARN Reference to a managed policy
@@ -238,6 +258,29 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		roleEntry.MaxSTSTTL = time.Duration(maxSTSTTLRaw.(int)) * time.Second
 	}
 
+	if iamPathRaw, ok := d.GetOk("iam_path"); ok {
+		if legacyRole != "" {
+			return logical.ErrorResponse("cannot supply deprecated role or policy parameters with iam_path"), nil
+		}
+		roleEntry.IAMPath = iamPathRaw.(string)
+		if err := validateIAMPath(roleEntry.IAMPath); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	for field, value := range map[string]*string{
+		"region":       &roleEntry.Region,
+		"iam_endpoint": &roleEntry.IAMEndpoint,
+		"sts_endpoint": &roleEntry.STSEndpoint,
+	} {
+		if raw, ok := d.GetOk(field); ok {
+			if legacyRole != "" {
+				return logical.ErrorResponse(fmt.Sprintf("cannot supply deprecated role or policy parameters with %s", field)), nil
+			}
+			*value = strings.TrimSpace(raw.(string))
+		}
+	}
+
 	if roleEntry.MaxSTSTTL > 0 &&
 		roleEntry.DefaultSTSTTL > 0 &&
 		roleEntry.DefaultSTSTTL > roleEntry.MaxSTSTTL {
@@ -264,6 +307,9 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 	if len(roleEntry.PolicyArns) > 0 && !strutil.StrListContains(roleEntry.CredentialTypes, iamUserCred) {
 		return logical.ErrorResponse(fmt.Sprintf("cannot supply policy_arns when credential_type isn't %s", iamUserCred)), nil
 	}
+	if roleEntry.IAMPath != "" && !strutil.StrListContains(roleEntry.CredentialTypes, iamUserCred) {
+		return logical.ErrorResponse(fmt.Sprintf("cannot supply iam_path when credential_type isn't %s", iamUserCred)), nil
+	}
 
 	err = setAwsRole(ctx, req.Storage, roleName, roleEntry)
 	if err != nil {
@@ -425,6 +471,10 @@ type awsRoleEntry struct {
 	Version                  int           `json:"version"`                               // Version number of the role format
 	DefaultSTSTTL            time.Duration `json:"default_sts_ttl"`                       // Default TTL for STS credentials
 	MaxSTSTTL                time.Duration `json:"max_sts_ttl"`                           // Max allowed TTL for STS credentials
+	IAMPath                  string        `json:"iam_path,omitempty"`                    // IAM path of generated IAM users
+	Region                   string        `json:"region,omitempty"`                      // Region overriding that of config/root
+	IAMEndpoint              string        `json:"iam_endpoint,omitempty"`                // IAM endpoint overriding that of config/root
+	STSEndpoint              string        `json:"sts_endpoint,omitempty"`                // STS endpoint overriding that of config/root
 }
 
 func (r *awsRoleEntry) toResponseData() map[string]interface{} {
@@ -435,6 +485,13 @@ func (r *awsRoleEntry) toResponseData() map[string]interface{} {
 		"policy_document":  r.PolicyDocument,
 		"default_sts_ttl":  int64(r.DefaultSTSTTL.Seconds()),
 		"max_sts_ttl":      int64(r.MaxSTSTTL.Seconds()),
+		"iam_path":         r.IAMPath,
+		"region":           r.Region,
+		"iam_endpoint":     r.IAMEndpoint,
+		"sts_endpoint":     r.STSEndpoint,
+	}
+	if strutil.StrListContains(r.CredentialTypes, iamUserCred) {
+		respData["iam_user_policy_mode"] = r.iamUserPolicyMode()
 	}
 	if r.InvalidData != "" {
 		respData["invalid_data"] = r.InvalidData
@@ -442,6 +499,48 @@ func (r *awsRoleEntry) toResponseData() map[string]interface{} {
 	return respData
 }
 
+// clientOverride returns the settings of the role that take precedence over
+// config/root when constructing AWS clients.
+func (r *awsRoleEntry) clientOverride() clientOverride {
+	return clientOverride{
+		Region:      r.Region,
+		IAMEndpoint: r.IAMEndpoint,
+		STSEndpoint: r.STSEndpoint,
+	}
+}
+
+// iamUserPolicyMode reports how policies are granted to IAM users generated
+// for this role: through attached managed policies, an inline policy, or both.
+func (r *awsRoleEntry) iamUserPolicyMode() string {
+	switch {
+	case len(r.PolicyArns) > 0 && r.PolicyDocument != "":
+		return iamUserPolicyModeBoth
+	case len(r.PolicyArns) > 0:
+		return iamUserPolicyModeManaged
+	case r.PolicyDocument != "":
+		return iamUserPolicyModeInline
+	default:
+		return iamUserPolicyModeNone
+	}
+}
+
+// validateIAMPath checks that an IAM path is acceptable to AWS: at most 512
+// printable ASCII characters, beginning and ending with a slash.
+func validateIAMPath(path string) error {
+	if len(path) > 512 {
+		return fmt.Errorf("iam_path must be at most 512 characters")
+	}
+	if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") {
+		return fmt.Errorf("iam_path must begin and end with a slash, e.g. /vault/")
+	}
+	for _, c := range path {
+		if c < 0x21 || c > 0x7e {
+			return fmt.Errorf("iam_path may only contain printable ASCII characters other than spaces")
+		}
+	}
+	return nil
+}
+
 func compactJSON(input string) (string, error) {
 	var compacted bytes.Buffer
 	err := json.Compact(&compacted, []byte(input))
@@ -454,6 +553,13 @@ const (
 	federationTokenCred = "federation_token"
 )
 
+const (
+	iamUserPolicyModeManaged = "managed"
+	iamUserPolicyModeInline  = "inline"
+	iamUserPolicyModeBoth    = "managed_and_inline"
+	iamUserPolicyModeNone    = "none"
+)
+
 const pathListRolesHelpSyn = `List the existing roles in this backend`
 
 const pathListRolesHelpDesc = `Roles will be listed by the role name.`
@@ -33,6 +33,11 @@ func pathUser(b *backend) *framework.Path {
 				Description: "Lifetime of the returned credentials in seconds",
 				Default:     3600,
 			},
+			"policy_document": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: "JSON-encoded IAM policy document to use as the session policy when credential_type is " + assumedRoleCred +
+					". Not allowed when the role has a policy_document of its own.",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -82,6 +87,22 @@ func (b *backend) pathCredsRead(ctx context.Context, req *logical.Request, d *fr
 
 	roleArn := d.Get("role_arn").(string)
 
+	policyDocument := d.Get("policy_document").(string)
+	if policyDocument != "" {
+		if len(role.CredentialTypes) != 1 || role.CredentialTypes[0] != assumedRoleCred {
+			return logical.ErrorResponse(fmt.Sprintf("policy_document can only be supplied for roles with credential_type %s", assumedRoleCred)), nil
+		}
+		if role.PolicyDocument != "" {
+			return logical.ErrorResponse(fmt.Sprintf("role %q already specifies the session policy; policy_document cannot be supplied", roleName)), nil
+		}
+		policyDocument, err = compactJSON(policyDocument)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("cannot parse policy document: %q", d.Get("policy_document").(string))), nil
+		}
+	} else {
+		policyDocument = role.PolicyDocument
+	}
+
 	var credentialType string
 	switch {
 	case len(role.CredentialTypes) == 1:
@@ -126,9 +147,9 @@ func (b *backend) pathCredsRead(ctx context.Context, req *logical.Request, d *fr
 		case !strutil.StrListContains(role.RoleArns, roleArn):
 			return logical.ErrorResponse(fmt.Sprintf("role_arn %q not in allowed role arns for Vault role %q", roleArn, roleName)), nil
 		}
-		return b.assumeRole(ctx, req.Storage, req.DisplayName, roleName, roleArn, role.PolicyDocument, ttl)
+		return b.assumeRole(ctx, req.Storage, req.DisplayName, roleName, roleArn, policyDocument, ttl, role.clientOverride())
 	case federationTokenCred:
-		return b.secretTokenCreate(ctx, req.Storage, req.DisplayName, roleName, role.PolicyDocument, ttl)
+		return b.secretTokenCreate(ctx, req.Storage, req.DisplayName, roleName, role.PolicyDocument, ttl, role.clientOverride())
 	default:
 		return logical.ErrorResponse(fmt.Sprintf("unknown credential_type: %q", credentialType)), nil
 	}
@@ -142,7 +163,10 @@ func (b *backend) pathUserRollback(ctx context.Context, req *logical.Request, _k
 	username := entry.UserName
 
 	// Get the client
-	client, err := b.clientIAM(ctx, req.Storage)
+	client, err := b.clientIAM(ctx, req.Storage, clientOverride{
+		Region:      entry.Region,
+		IAMEndpoint: entry.IAMEndpoint,
+	})
 	if err != nil {
 		return err
 	}
@@ -186,6 +210,20 @@ func (b *backend) pathUserRollback(ctx context.Context, req *logical.Request, _k
 	}
 	groups := groupsResp.Groups
 
+	// Refuse to clean up a user of the same name that lives outside the
+	// IAM path the user was created under
+	if entry.Path != "" {
+		userResp, err := client.GetUser(&iam.GetUserInput{
+			UserName: aws.String(username),
+		})
+		if err != nil {
+			return err
+		}
+		if userPath := aws.StringValue(userResp.User.Path); userPath != entry.Path {
+			return fmt.Errorf("IAM user %q has path %q rather than the expected %q", username, userPath, entry.Path)
+		}
+	}
+
 	// Inline (user) policies
 	policiesResp, err := client.ListUserPolicies(&iam.ListUserPoliciesInput{
 		UserName: aws.String(username),
@@ -272,6 +310,11 @@ func (b *backend) pathUserRollback(ctx context.Context, req *logical.Request, _k
 
 type walUser struct {
 	UserName string
+
+	// IAM path, region and IAM endpoint of the role the user was created for
+	Path        string `json:"iam_path,omitempty" mapstructure:"iam_path"`
+	Region      string `json:"region,omitempty" mapstructure:"region"`
+	IAMEndpoint string `json:"iam_endpoint,omitempty" mapstructure:"iam_endpoint"`
 }
 
 const pathUserHelpSyn = `
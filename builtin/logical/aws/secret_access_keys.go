@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math/rand"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -12,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/awsutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -42,7 +45,43 @@ func secretAccessKeys(b *backend) *framework.Secret {
 	}
 }
 
-func genUsername(displayName, policyName, userType string) (ret string, warning string) {
+const (
+	// Length limits AWS places on the names of IAM users and role sessions,
+	// and on the names of federation tokens
+	maxIAMUsernameLength = 64
+	maxSTSUsernameLength = 32
+)
+
+var (
+	usernameTemplatePlaceholderRe = regexp.MustCompile(`{{[^}]*}}`)
+	usernameTemplateLiteralRe     = regexp.MustCompile(`^[a-zA-Z0-9+=,.@_-]*$`)
+)
+
+var usernameTemplatePlaceholders = []string{"{{display_name}}", "{{role_name}}", "{{unix_time}}"}
+
+// validateUsernameTemplate checks that a username_template only contains
+// known placeholders and characters that are valid in IAM names.
+func validateUsernameTemplate(tmpl string) error {
+	for _, placeholder := range usernameTemplatePlaceholderRe.FindAllString(tmpl, -1) {
+		if !strutil.StrListContains(usernameTemplatePlaceholders, placeholder) {
+			return fmt.Errorf("unknown placeholder %q in username_template", placeholder)
+		}
+	}
+	if !usernameTemplateLiteralRe.MatchString(usernameTemplatePlaceholderRe.ReplaceAllString(tmpl, "")) {
+		return fmt.Errorf("username_template may only contain alphanumeric characters and +=,.@_- outside of placeholders")
+	}
+	return nil
+}
+
+func genUsername(displayName, policyName, userType, usernameTemplate string) (ret string, warning string) {
+	if usernameTemplate != "" {
+		maxLength := maxIAMUsernameLength
+		if userType == "sts" {
+			maxLength = maxSTSUsernameLength
+		}
+		return genTemplatedUsername(usernameTemplate, displayName, policyName, maxLength)
+	}
+
 	var midString string
 
 	switch userType {
@@ -65,15 +104,66 @@ func genUsername(displayName, policyName, userType string) (ret string, warning
 	return
 }
 
+// genTemplatedUsername renders a username_template and appends a random
+// suffix. The rendered template is truncated so that the suffix, which keeps
+// names unique, always fits within maxLength.
+func genTemplatedUsername(usernameTemplate, displayName, policyName string, maxLength int) (ret string, warning string) {
+	prefix := strings.NewReplacer(
+		"{{display_name}}", normalizeDisplayName(displayName),
+		"{{role_name}}", normalizeDisplayName(policyName),
+		"{{unix_time}}", strconv.FormatInt(time.Now().Unix(), 10),
+	).Replace(usernameTemplate)
+	suffix := fmt.Sprintf("-%08d", rand.Int31n(100000000))
+
+	if len(prefix)+len(suffix) > maxLength {
+		prefix = prefix[:maxLength-len(suffix)]
+		warning = "the username generated from username_template was truncated to fit into length limits"
+	}
+
+	return prefix + suffix, warning
+}
+
+const (
+	// Limits AWS places on the lifetime of federation tokens
+	minFederationTokenTTL = 900
+	maxFederationTokenTTL = 129600
+)
+
 func (b *backend) secretTokenCreate(ctx context.Context, s logical.Storage,
 	displayName, policyName, policy string,
-	lifeTimeInSeconds int64) (*logical.Response, error) {
-	stsClient, err := b.clientSTS(ctx, s)
+	lifeTimeInSeconds int64, override clientOverride) (*logical.Response, error) {
+	stsClient, err := b.clientSTS(ctx, s, override)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	username, usernameWarning := genUsername(displayName, policyName, "sts")
+	// GetFederationToken can only be called with the long-term credentials
+	// of an IAM user, not with the temporary credentials of an assumed role
+	identity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Error looking up the configured credentials: %s", err)), awsutil.CheckAWSError(err)
+	}
+	if identity.Arn != nil && !isIAMUserArn(*identity.Arn) {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"federation tokens require the configured credentials to belong to an IAM user, not %q", *identity.Arn)), nil
+	}
+
+	var warnings []string
+	switch {
+	case lifeTimeInSeconds < minFederationTokenTTL:
+		lifeTimeInSeconds = minFederationTokenTTL
+		warnings = append(warnings, fmt.Sprintf("ttl raised to the %d second minimum of federation tokens", minFederationTokenTTL))
+	case lifeTimeInSeconds > maxFederationTokenTTL:
+		lifeTimeInSeconds = maxFederationTokenTTL
+		warnings = append(warnings, fmt.Sprintf("ttl capped to the %d second maximum of federation tokens", maxFederationTokenTTL))
+	}
+
+	usernameTemplate, err := b.usernameTemplate(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	username, usernameWarning := genUsername(displayName, policyName, "sts", usernameTemplate)
 
 	tokenResp, err := stsClient.GetFederationToken(
 		&sts.GetFederationTokenInput{
@@ -106,19 +196,37 @@ func (b *backend) secretTokenCreate(ctx context.Context, s logical.Storage,
 	if usernameWarning != "" {
 		resp.AddWarning(usernameWarning)
 	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
 
 	return resp, nil
 }
 
+// isIAMUserArn returns whether the ARN returned by GetCallerIdentity belongs
+// to an IAM user or the account root user, rather than to temporary
+// credentials such as those of an assumed role or a federated user.
+func isIAMUserArn(arn string) bool {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 {
+		return false
+	}
+	return parts[5] == "root" || strings.HasPrefix(parts[5], "user/")
+}
+
 func (b *backend) assumeRole(ctx context.Context, s logical.Storage,
 	displayName, roleName, roleArn, policy string,
-	lifeTimeInSeconds int64) (*logical.Response, error) {
-	stsClient, err := b.clientSTS(ctx, s)
+	lifeTimeInSeconds int64, override clientOverride) (*logical.Response, error) {
+	stsClient, err := b.clientSTS(ctx, s, override)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	username, usernameWarning := genUsername(displayName, roleName, "iam_user")
+	usernameTemplate, err := b.usernameTemplate(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	username, usernameWarning := genUsername(displayName, roleName, "iam_user", usernameTemplate)
 
 	assumeRoleInput := &sts.AssumeRoleInput{
 		RoleSessionName: aws.String(username),
@@ -162,28 +270,40 @@ func (b *backend) secretAccessKeysCreate(
 	ctx context.Context,
 	s logical.Storage,
 	displayName, policyName string, role *awsRoleEntry) (*logical.Response, error) {
-	iamClient, err := b.clientIAM(ctx, s)
+	override := role.clientOverride()
+	iamClient, err := b.clientIAM(ctx, s, override)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	username, usernameWarning := genUsername(displayName, policyName, "iam_user")
+	usernameTemplate, err := b.usernameTemplate(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	username, usernameWarning := genUsername(displayName, policyName, "iam_user", usernameTemplate)
 
 	// Write to the WAL that this user will be created. We do this before
 	// the user is created because if switch the order then the WAL put
 	// can fail, which would put us in an awkward position: we have a user
 	// we need to rollback but can't put the WAL entry to do the rollback.
 	walID, err := framework.PutWAL(ctx, s, "user", &walUser{
-		UserName: username,
+		UserName:    username,
+		Path:        role.IAMPath,
+		Region:      override.Region,
+		IAMEndpoint: override.IAMEndpoint,
 	})
 	if err != nil {
 		return nil, errwrap.Wrapf("error writing WAL entry: {{err}}", err)
 	}
 
 	// Create the user
-	_, err = iamClient.CreateUser(&iam.CreateUserInput{
+	createUserInput := &iam.CreateUserInput{
 		UserName: aws.String(username),
-	})
+	}
+	if role.IAMPath != "" {
+		createUserInput.Path = aws.String(role.IAMPath)
+	}
+	_, err = iamClient.CreateUser(createUserInput)
 	if err != nil {
 		if walErr := framework.DeleteWAL(ctx, s, walID); walErr != nil {
 			iamErr := errwrap.Wrapf("error creating IAM user: {{err}}", err)
@@ -240,9 +360,12 @@ func (b *backend) secretAccessKeysCreate(
 		"secret_key":     *keyResp.AccessKey.SecretAccessKey,
 		"security_token": nil,
 	}, map[string]interface{}{
-		"username": username,
-		"policy":   role,
-		"is_sts":   false,
+		"username":     username,
+		"policy":       role,
+		"is_sts":       false,
+		"region":       override.Region,
+		"iam_endpoint": override.IAMEndpoint,
+		"iam_path":     role.IAMPath,
 	})
 
 	lease, err := b.Lease(ctx, s)
@@ -313,10 +436,20 @@ func (b *backend) secretAccessKeysRevoke(ctx context.Context, req *logical.Reque
 		return nil, fmt.Errorf("secret is missing username internal data")
 	}
 
-	// Use the user rollback mechanism to delete this user
-	err := b.pathUserRollback(ctx, req, "user", map[string]interface{}{
+	// Secrets issued for roles that override the region or IAM endpoint
+	// have to be revoked against the same region and endpoint, and users
+	// created under an IAM path are only deleted from that path
+	walData := map[string]interface{}{
 		"username": username,
-	})
+	}
+	for _, field := range []string{"region", "iam_endpoint", "iam_path"} {
+		if value, ok := req.Secret.InternalData[field].(string); ok {
+			walData[field] = value
+		}
+	}
+
+	// Use the user rollback mechanism to delete this user
+	err := b.pathUserRollback(ctx, req, "user", walData)
 	if err != nil {
 		return nil, err
 	}
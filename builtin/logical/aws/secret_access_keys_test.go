@@ -1,6 +1,8 @@
 package aws
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +44,53 @@ func TestNormalizeDisplayName_NormNotRequired(t *testing.T) {
 		}
 	}
 }
+
+func TestGenUsername(t *testing.T) {
+	// Without a template the legacy naming is kept
+	username, warning := genUsername("token-name", "role", "iam_user", "")
+	if !regexp.MustCompile(`^vault-token-name-role-[0-9]+-[0-9]+$`).MatchString(username) || warning != "" {
+		t.Fatalf("bad: username %q, warning %q", username, warning)
+	}
+	username, _ = genUsername("token-name", "role", "sts", "")
+	if !regexp.MustCompile(`^vault-[0-9]+-[0-9]+$`).MatchString(username) {
+		t.Fatalf("bad: username %q", username)
+	}
+
+	username, warning = genUsername("token name", "role", "iam_user", "vault.{{role_name}}.{{display_name}}.{{unix_time}}")
+	if !regexp.MustCompile(`^vault\.role\.token_name\.[0-9]+-[0-9]{8}$`).MatchString(username) || warning != "" {
+		t.Fatalf("bad: username %q, warning %q", username, warning)
+	}
+
+	// Long names are truncated, but keep the random suffix
+	for userType, maxLength := range map[string]int{"iam_user": maxIAMUsernameLength, "sts": maxSTSUsernameLength} {
+		username, warning = genUsername(strings.Repeat("a", 100), "role", userType, "{{display_name}}")
+		if len(username) != maxLength || warning == "" {
+			t.Fatalf("bad: username %q, warning %q", username, warning)
+		}
+		if !regexp.MustCompile(`^a+-[0-9]{8}$`).MatchString(username) {
+			t.Fatalf("bad: username %q", username)
+		}
+	}
+}
+
+func TestValidateUsernameTemplate(t *testing.T) {
+	for _, valid := range []string{
+		"",
+		"vault-{{display_name}}-{{role_name}}-{{unix_time}}",
+		"{{role_name}}@example.com",
+	} {
+		if err := validateUsernameTemplate(valid); err != nil {
+			t.Fatalf("expected %q to be valid: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{
+		"vault-{{policy}}",
+		"vault {{role_name}}",
+		"vault/{{role_name}}",
+		"vault-{{role_name}",
+	} {
+		if err := validateUsernameTemplate(invalid); err == nil {
+			t.Fatalf("expected %q to be invalid", invalid)
+		}
+	}
+}
@@ -37,8 +37,8 @@ set, this is automatically set to true`,
 
 			"insecure_tls": &framework.FieldSchema{
 				Type: framework.TypeBool,
-				Description: `Whether to use TLS but skip verification; has no
-effect if a CA certificate is provided`,
+				Description: `Whether to use TLS but skip verification of the
+server certificate`,
 			},
 
 			"tls_min_version": &framework.FieldSchema{
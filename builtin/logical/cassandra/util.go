@@ -3,6 +3,8 @@ package cassandra
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,7 +39,7 @@ func createSession(cfg *sessionConfig, s logical.Storage) (*gocql.Session, error
 	clusterConfig.Timeout = time.Duration(cfg.ConnectTimeout) * time.Second
 
 	if cfg.TLS {
-		var tlsConfig *tls.Config
+		tlsConfig := &tls.Config{}
 		if len(cfg.Certificate) > 0 || len(cfg.IssuingCA) > 0 {
 			if len(cfg.Certificate) > 0 && len(cfg.PrivateKey) == 0 {
 				return nil, fmt.Errorf("found certificate for TLS authentication but no private key")
@@ -61,23 +63,33 @@ func createSession(cfg *sessionConfig, s logical.Storage) (*gocql.Session, error
 			if err != nil || tlsConfig == nil {
 				return nil, errwrap.Wrapf(fmt.Sprintf("failed to get TLS configuration: tlsConfig: %#v; {{err}}", tlsConfig), err)
 			}
-			tlsConfig.InsecureSkipVerify = cfg.InsecureTLS
-
-			if cfg.TLSMinVersion != "" {
-				var ok bool
-				tlsConfig.MinVersion, ok = tlsutil.TLSLookup[cfg.TLSMinVersion]
-				if !ok {
-					return nil, fmt.Errorf("invalid 'tls_min_version' in config")
-				}
-			} else {
-				// MinVersion was not being set earlier. Reset it to
-				// zero to gracefully handle upgrades.
-				tlsConfig.MinVersion = 0
+		}
+		tlsConfig.InsecureSkipVerify = cfg.InsecureTLS
+
+		if cfg.TLSMinVersion != "" {
+			var ok bool
+			tlsConfig.MinVersion, ok = tlsutil.TLSLookup[cfg.TLSMinVersion]
+			if !ok {
+				return nil, fmt.Errorf("invalid 'tls_min_version' in config")
 			}
+		} else {
+			// MinVersion was not being set earlier. Reset it to
+			// zero to gracefully handle upgrades.
+			tlsConfig.MinVersion = 0
 		}
 
+		// gocql overwrites InsecureSkipVerify with the inverse of
+		// EnableHostVerification, so both must agree.
 		clusterConfig.SslOpts = &gocql.SslOptions{
-			Config: tlsConfig,
+			Config:                 tlsConfig,
+			EnableHostVerification: !cfg.InsecureTLS,
+		}
+
+		// gocql reports every connection failure the same way, so perform
+		// the handshake ourselves first to tell TLS problems apart from
+		// authentication ones.
+		if err := checkTLSHandshake(clusterConfig.Hosts, clusterConfig.Port, tlsConfig, clusterConfig.Timeout); err != nil {
+			return nil, err
 		}
 	}
 
@@ -94,3 +106,43 @@ func createSession(cfg *sessionConfig, s logical.Storage) (*gocql.Session, error
 
 	return session, nil
 }
+
+// checkTLSHandshake attempts a TLS handshake with each of the given hosts
+// and returns nil as soon as one succeeds. A host that cannot be reached
+// at all is not considered a TLS failure; that is left for the driver to
+// report. An error is returned only if a handshake was attempted and none
+// succeeded.
+func checkTLSHandshake(hosts []string, port int, tlsConfig *tls.Config, timeout time.Duration) error {
+	var handshakeErr error
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		addr := host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			addr = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+
+		dialer := &net.Dialer{Timeout: timeout}
+		conn, err := dialer.Dial("tcp", addr)
+		if err != nil {
+			continue
+		}
+
+		config := tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+
+		tlsConn := tls.Client(conn, config)
+		if timeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(timeout))
+		}
+		err = tlsConn.Handshake()
+		tlsConn.Close()
+		if err == nil {
+			return nil
+		}
+		handshakeErr = errwrap.Wrapf(fmt.Sprintf("TLS handshake with %s failed: {{err}}", addr), err)
+	}
+
+	return handshakeErr
+}
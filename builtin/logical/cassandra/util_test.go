@@ -0,0 +1,67 @@
+package cassandra
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTLSHandshake(t *testing.T) {
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+	plainServer := httptest.NewServer(handler)
+	defer plainServer.Close()
+
+	tlsAddr := tlsServer.Listener.Addr().String()
+	plainAddr := plainServer.Listener.Addr().String()
+
+	// Grab a port that nothing is listening on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	timeout := 5 * time.Second
+
+	// Self-signed certificate is accepted when verification is skipped
+	if err := checkTLSHandshake([]string{tlsAddr}, 9042, &tls.Config{InsecureSkipVerify: true}, timeout); err != nil {
+		t.Fatalf("expected handshake to succeed: %v", err)
+	}
+
+	// ...and rejected otherwise
+	err = checkTLSHandshake([]string{tlsAddr}, 9042, &tls.Config{}, timeout)
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake with "+tlsAddr+" failed") {
+		t.Fatalf("expected handshake error, got: %v", err)
+	}
+
+	// A plaintext server fails the handshake
+	err = checkTLSHandshake([]string{plainAddr}, 9042, &tls.Config{InsecureSkipVerify: true}, timeout)
+	if err == nil || !strings.Contains(err.Error(), "TLS handshake with "+plainAddr+" failed") {
+		t.Fatalf("expected handshake error, got: %v", err)
+	}
+
+	// One good host is enough
+	if err := checkTLSHandshake([]string{plainAddr, tlsAddr}, 9042, &tls.Config{InsecureSkipVerify: true}, timeout); err != nil {
+		t.Fatalf("expected handshake to succeed: %v", err)
+	}
+
+	// Unreachable hosts are left for the driver to report
+	if err := checkTLSHandshake([]string{closedAddr}, 9042, &tls.Config{}, timeout); err != nil {
+		t.Fatalf("expected no error for unreachable host, got: %v", err)
+	}
+
+	// The configured port is used when the host has none
+	host, _, _ := net.SplitHostPort(tlsAddr)
+	port := tlsServer.Listener.Addr().(*net.TCPAddr).Port
+	if err := checkTLSHandshake([]string{host}, port, &tls.Config{InsecureSkipVerify: true}, timeout); err != nil {
+		t.Fatalf("expected handshake to succeed: %v", err)
+	}
+}
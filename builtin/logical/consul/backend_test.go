@@ -406,6 +406,79 @@ func testBackendRenewRevoke14(t *testing.T, version string) {
 	}
 }
 
+func TestBackend_RenewDeletedToken(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, connURL, connToken := prepareTestContainer(t, "1.4.0-rc1")
+	defer cleanup()
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]interface{}{
+			"address": connURL,
+			"token":   connToken,
+		},
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "roles/test"
+	req.Data = map[string]interface{}{
+		"policies": []string{"test"},
+		"ttl":      "1h",
+		"max_ttl":  "6h",
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "creds/test"
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Secret.MaxTTL != 6*time.Hour {
+		t.Fatalf("expected max TTL of the role, got %s", resp.Secret.MaxTTL)
+	}
+	generatedSecret := resp.Secret
+
+	req.Operation = logical.RenewOperation
+	req.Secret = generatedSecret
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Delete the token behind Vault's back
+	consulmgmtConfig := consulapi.DefaultNonPooledConfig()
+	consulmgmtConfig.Address = connURL
+	consulmgmtConfig.Token = connToken
+	mgmtclient, err := consulapi.NewClient(consulmgmtConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgmtclient.ACL().TokenDelete(generatedSecret.InternalData["token"].(string), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected renewal of a deleted token to fail, got: %#v", resp)
+	}
+}
+
 func TestBackend_LocalToken(t *testing.T) {
 	config := logical.TestBackendConfig()
 	config.StorageView = &logical.InmemStorage{}
@@ -644,6 +717,129 @@ func TestBackend_role_lease(t *testing.T) {
 	})
 }
 
+func TestBackend_rolePolicies(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      "roles/test",
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, map[string]interface{}{
+		"policies": "web,db",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, nil)
+	if resp.Data["mode"] != "policies" || !reflect.DeepEqual(resp.Data["policies"], []string{"web", "db"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["policy"]; ok {
+		t.Fatalf("expected no policy document, got: %#v", resp.Data)
+	}
+
+	resp = request(logical.UpdateOperation, map[string]interface{}{
+		"policy": base64.StdEncoding.EncodeToString([]byte(testPolicy)),
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, nil)
+	if resp.Data["mode"] != "policy" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{
+			"policy":   base64.StdEncoding.EncodeToString([]byte(testPolicy)),
+			"policies": "web",
+		},
+		{
+			"policies":   "web",
+			"token_type": "bogus",
+		},
+	} {
+		resp = request(logical.UpdateOperation, data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %#v, got: %#v", data, resp)
+		}
+	}
+}
+
+func TestBackend_roleTokenType(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: operation,
+			Path:      "roles/test",
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, map[string]interface{}{
+		"policies": "web",
+		"local":    true,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, nil)
+	if resp.Data["local"] != true || resp.Data["token_type"] != "client" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{
+			"token_type": "management",
+			"policy":     base64.StdEncoding.EncodeToString([]byte(testPolicy)),
+		},
+		{
+			"token_type": "management",
+			"policies":   "web",
+		},
+		{
+			"token_type": "management",
+			"local":      true,
+		},
+		{
+			"policy": base64.StdEncoding.EncodeToString([]byte(testPolicy)),
+			"local":  true,
+		},
+	} {
+		resp = request(logical.UpdateOperation, data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %#v, got: %#v", data, resp)
+		}
+	}
+}
+
 func testAccStepConfig(
 	t *testing.T, config map[string]interface{}) logicaltest.TestStep {
 	return logicaltest.TestStep{
@@ -43,16 +43,17 @@ for Consul 1.4 or above.`,
 
 			"local": &framework.FieldSchema{
 				Type: framework.TypeBool,
-				Description: `Indicates that the token should not be replicated globally 
-and instead be local to the current datacenter.  Available in Consul 1.4 and above.`,
+				Description: `Indicates that the token should not be replicated globally
+and instead be local to the current datacenter. Requires "policies".
+Available in Consul 1.4 and above.`,
 			},
 
 			"token_type": &framework.FieldSchema{
 				Type:    framework.TypeString,
 				Default: "client",
 				Description: `Which type of token to create: 'client'
-or 'management'. If a 'management' token,
-the "policy" parameter is not required.
+or 'management'. The "policy" and "policies"
+parameters cannot be set for 'management' tokens.
 Defaults to 'client'.`,
 			},
 
@@ -117,6 +118,7 @@ func (b *backend) pathRolesRead(ctx context.Context, req *logical.Request, d *fr
 			"max_ttl":    int64(result.MaxTTL.Seconds()),
 			"token_type": result.TokenType,
 			"local":      result.Local,
+			"mode":       result.mode(),
 		},
 	}
 	if result.Policy != "" {
@@ -135,18 +137,28 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 	policies := d.Get("policies").([]string)
 	local := d.Get("local").(bool)
 
-	if len(policies) == 0 {
-		switch tokenType {
-		case "client":
-			if policy == "" {
-				return logical.ErrorResponse(
-					"Use either a policy document, or a list of policies, depending on your Consul version"), nil
-			}
-		case "management":
-		default:
+	switch tokenType {
+	case "client":
+		if policy == "" && len(policies) == 0 {
 			return logical.ErrorResponse(
-				"token_type must be \"client\" or \"management\""), nil
+				"Use either a policy document, or a list of policies, depending on your Consul version"), nil
 		}
+	case "management":
+		if policy != "" || len(policies) > 0 {
+			return logical.ErrorResponse(
+				"policy and policies cannot be set on management roles, since management tokens are not restricted by ACL rules"), nil
+		}
+	default:
+		return logical.ErrorResponse(
+			"token_type must be \"client\" or \"management\""), nil
+	}
+	if policy != "" && len(policies) > 0 {
+		return logical.ErrorResponse(
+			"only one of policy or policies may be given"), nil
+	}
+	if local && len(policies) == 0 {
+		return logical.ErrorResponse(
+			"local tokens require a list of policies, which is only available in Consul 1.4 and above"), nil
 	}
 
 	policyRaw, err := base64.StdEncoding.DecodeString(policy)
@@ -171,6 +183,9 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 	if ok {
 		maxTTL = time.Second * time.Duration(maxTTLRaw.(int))
 	}
+	if maxTTL > 0 && ttl > maxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
 
 	entry, err := logical.StorageEntryJSON("policy/"+name, roleConfig{
 		Policy:    string(policyRaw),
@@ -207,3 +222,13 @@ type roleConfig struct {
 	TokenType string        `json:"token_type"`
 	Local     bool          `json:"local"`
 }
+
+// mode returns "policy" if tokens are created from the role's policy document
+// using the legacy ACL API, or "policies" if they are created from its list of
+// Consul ACL policies.
+func (r roleConfig) mode() string {
+	if (r.Policy != "" && r.TokenType == "client") || (r.Policy == "" && r.TokenType == "management") {
+		return "policy"
+	}
+	return "policies"
+}
@@ -67,8 +67,7 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 	writeOpts = writeOpts.WithContext(ctx)
 
 	// Create an ACLEntry for Consul pre 1.4
-	if (result.Policy != "" && result.TokenType == "client") ||
-		(result.Policy == "" && result.TokenType == "management") {
+	if result.mode() == "policy" {
 		token, _, err := c.ACL().Create(&api.ACLEntry{
 			Name:  tokenName,
 			Type:  result.TokenType,
@@ -80,7 +79,9 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 
 		// Use the helper to create the secret
 		s := b.Secret(SecretTokenType).Response(map[string]interface{}{
-			"token": token,
+			"token":      token,
+			"token_type": result.TokenType,
+			"local":      false,
 		}, map[string]interface{}{
 			"token": token,
 			"role":  role,
@@ -108,9 +109,10 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 
 	// Use the helper to create the secret
 	s := b.Secret(SecretTokenType).Response(map[string]interface{}{
-		"token":    token.SecretID,
-		"accessor": token.AccessorID,
-		"local":    token.Local,
+		"token":      token.SecretID,
+		"accessor":   token.AccessorID,
+		"token_type": result.TokenType,
+		"local":      token.Local,
 	}, map[string]interface{}{
 		"token":   token.AccessorID,
 		"role":    role,
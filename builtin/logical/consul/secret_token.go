@@ -3,7 +3,9 @@ package consul
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -29,6 +31,30 @@ func secretToken(b *backend) *framework.Secret {
 }
 
 func (b *backend) secretTokenRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// Refuse to extend the lease of a token that was deleted from Consul
+	c, userErr, intErr := b.client(ctx, req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	if tokenRaw, ok := req.Secret.InternalData["token"]; ok {
+		var version string
+		if versionRaw, ok := req.Secret.InternalData["version"]; ok {
+			version = versionRaw.(string)
+		}
+
+		exists, err := tokenExists(ctx, c, version, tokenRaw.(string))
+		if err != nil {
+			return nil, errwrap.Wrapf("error looking up token: {{err}}", err)
+		}
+		if !exists {
+			return logical.ErrorResponse("token no longer exists in Consul"), nil
+		}
+	}
+
 	resp := &logical.Response{Secret: req.Secret}
 	roleRaw, ok := req.Secret.InternalData["role"]
 	if !ok {
@@ -100,3 +126,30 @@ func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d
 
 	return nil, nil
 }
+
+// tokenExists returns whether the token of a lease still exists in Consul.
+// For tokens created with the legacy ACL API the token is its ID; otherwise it
+// is the token's accessor.
+func tokenExists(ctx context.Context, c *api.Client, version, token string) (bool, error) {
+	q := (&api.QueryOptions{}).WithContext(ctx)
+
+	switch version {
+	case "":
+		entry, _, err := c.ACL().Info(token, q)
+		if err != nil {
+			return false, err
+		}
+		return entry != nil, nil
+	case tokenPolicyType:
+		_, _, err := c.ACL().TokenRead(token, q)
+		if err != nil {
+			if strings.Contains(err.Error(), "ACL not found") || strings.Contains(err.Error(), "404") {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("Invalid version string in data: %s", version)
+	}
+}
@@ -6,20 +6,32 @@ import (
 	"net/rpc"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/hashicorp/go-hclog"
 
 	"github.com/hashicorp/errwrap"
 	uuid "github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
 	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
 )
 
 const databaseConfigPath = "database/config/"
 
+const (
+	// staticRoleRetryMinBackoff and staticRoleRetryMaxBackoff bound the time
+	// the periodic function waits before retrying a static role whose
+	// rotation failed. The wait doubles with every consecutive failure.
+	staticRoleRetryMinBackoff = time.Minute
+	staticRoleRetryMaxBackoff = time.Hour
+)
+
 type dbPluginInstance struct {
 	sync.RWMutex
 	dbplugin.Database
@@ -57,6 +69,7 @@ func Backend(conf *logical.BackendConfig) *databaseBackend {
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"config/*",
+				"static-role/*",
 			},
 		},
 
@@ -65,21 +78,29 @@ func Backend(conf *logical.BackendConfig) *databaseBackend {
 			pathConfigurePluginConnection(&b),
 			pathListRoles(&b),
 			pathRoles(&b),
+			pathListStaticRoles(&b),
+			pathStaticRoles(&b),
 			pathCredsCreate(&b),
+			pathStaticCredsRead(&b),
 			pathResetConnection(&b),
 			pathRotateCredentials(&b),
+			pathRotateRoleCredentials(&b),
 		},
 
 		Secrets: []*framework.Secret{
 			secretCreds(&b),
 		},
-		Clean:       b.closeAllDBs,
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Clean:        b.closeAllDBs,
+		Invalidate:   b.invalidate,
+		PeriodicFunc: b.periodicFunc,
+		WALRollback:  b.walRollback,
+		BackendType:  logical.TypeLogical,
 	}
 
 	b.logger = conf.Logger
 	b.connections = make(map[string]*dbPluginInstance)
+	b.staticRoleLocks = locksutil.CreateLocks()
+	b.staticRoleRetries = make(map[string]*staticRoleRetry)
 	return &b
 }
 
@@ -87,10 +108,25 @@ type databaseBackend struct {
 	connections map[string]*dbPluginInstance
 	logger      log.Logger
 
+	// staticRoleLocks serialize changes to a static role and the rotation
+	// of its password
+	staticRoleLocks []*locksutil.LockEntry
+
+	// staticRoleRetries holds the static roles whose last periodic rotation
+	// failed, so that they are retried with a backoff
+	staticRoleRetries     map[string]*staticRoleRetry
+	staticRoleRetriesLock sync.Mutex
+
 	*framework.Backend
 	sync.RWMutex
 }
 
+// staticRoleRetry tracks the consecutive failed rotations of a static role
+type staticRoleRetry struct {
+	failures int
+	next     time.Time
+}
+
 func (b *databaseBackend) DatabaseConfig(ctx context.Context, s logical.Storage, name string) (*DatabaseConfig, error) {
 	entry, err := s.Get(ctx, fmt.Sprintf("config/%s", name))
 	if err != nil {
@@ -169,6 +205,173 @@ func (b *databaseBackend) Role(ctx context.Context, s logical.Storage, roleName
 	return &result, nil
 }
 
+func (b *databaseBackend) StaticRole(ctx context.Context, s logical.Storage, roleName string) (*staticRoleEntry, error) {
+	entry, err := s.Get(ctx, "static-role/"+roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result staticRoleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// setStaticRoleCredentials rotates the password of the static role's database
+// user and stores the role with the new password. The caller must hold the
+// role's lock.
+//
+// The new password is written to a WAL entry before it is set in the
+// database. If storing the role then fails, the WAL rollback sets the same
+// password again and stores the role, so that the password in the database is
+// never one Vault has lost.
+func (b *databaseBackend) setStaticRoleCredentials(ctx context.Context, s logical.Storage, name string, role *staticRoleEntry) error {
+	db, err := b.GetConnection(ctx, s, role.DBName)
+	if err != nil {
+		return err
+	}
+
+	password, err := credsutil.RandomAlphaNumeric(20, true)
+	if err != nil {
+		return err
+	}
+
+	updated := *role
+	updated.Password = password
+	updated.LastVaultRotation = time.Now()
+
+	walID, err := framework.PutWAL(ctx, s, staticRoleWALKind, &walStaticRole{
+		Name:             name,
+		PreviousRotation: role.LastVaultRotation,
+		Role:             &updated,
+	})
+	if err != nil {
+		return errwrap.Wrapf("failed to write WAL entry: {{err}}", err)
+	}
+
+	db.RLock()
+	err = dbplugin.SetCredentials(ctx, db.Database, role.RotationStatements, role.Username, password)
+	db.RUnlock()
+	if err != nil {
+		b.CloseIfShutdown(db, err)
+
+		// The database rolled back the change, so the old password is
+		// still the current one
+		if walErr := framework.DeleteWAL(ctx, s, walID); walErr != nil {
+			b.Logger().Error("failed to delete WAL entry", "name", name, "error", walErr)
+		}
+		return errwrap.Wrapf(fmt.Sprintf("failed to rotate password of %q: {{err}}", role.Username), err)
+	}
+
+	entry, err := logical.StorageEntryJSON("static-role/"+name, &updated)
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return err
+	}
+	*role = updated
+
+	// A leftover entry is harmless: the rollback ignores it once the role
+	// has been stored with a newer rotation time
+	if err := framework.DeleteWAL(ctx, s, walID); err != nil {
+		b.Logger().Error("failed to delete WAL entry", "name", name, "error", err)
+	}
+
+	return nil
+}
+
+// periodicFunc is invoked by the RollbackManager roughly once a minute. It
+// rotates the password of every static role whose rotation period has
+// elapsed. Roles whose rotation fails are retried with an exponential
+// backoff. Their errors are logged rather than returned, since an error would
+// keep the WAL rollback from running.
+func (b *databaseBackend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	// Only the node that owns the storage should rotate passwords
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	names, err := req.Storage.List(ctx, "static-role/")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !b.staticRoleRetryDue(name) {
+			continue
+		}
+
+		err := b.rotateStaticRoleIfDue(ctx, req.Storage, name)
+		if retryIn := b.recordStaticRoleRotation(name, err); err != nil {
+			b.Logger().Error("failed to rotate static role", "name", name, "error", err, "retry_in", retryIn)
+		}
+	}
+
+	return nil
+}
+
+// staticRoleRetryDue reports whether the backoff of a static role whose
+// rotation failed has elapsed.
+func (b *databaseBackend) staticRoleRetryDue(name string) bool {
+	b.staticRoleRetriesLock.Lock()
+	defer b.staticRoleRetriesLock.Unlock()
+
+	retry, ok := b.staticRoleRetries[name]
+	return !ok || !time.Now().Before(retry.next)
+}
+
+// recordStaticRoleRotation records the outcome of a periodic rotation of a
+// static role and returns how long to wait before retrying it.
+func (b *databaseBackend) recordStaticRoleRotation(name string, err error) time.Duration {
+	b.staticRoleRetriesLock.Lock()
+	defer b.staticRoleRetriesLock.Unlock()
+
+	if err == nil {
+		delete(b.staticRoleRetries, name)
+		return 0
+	}
+
+	retry, ok := b.staticRoleRetries[name]
+	if !ok {
+		retry = &staticRoleRetry{}
+		b.staticRoleRetries[name] = retry
+	}
+	retry.failures++
+
+	backoff := staticRoleRetryMaxBackoff
+	if shift := uint(retry.failures - 1); shift < 32 && staticRoleRetryMinBackoff<<shift < staticRoleRetryMaxBackoff {
+		backoff = staticRoleRetryMinBackoff << shift
+	}
+	retry.next = time.Now().Add(backoff)
+
+	return backoff
+}
+
+func (b *databaseBackend) rotateStaticRoleIfDue(ctx context.Context, s logical.Storage, name string) error {
+	lock := locksutil.LockForKey(b.staticRoleLocks, name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	role, err := b.StaticRole(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	if role == nil || time.Now().Before(role.NextVaultRotation()) {
+		return nil
+	}
+
+	return b.setStaticRoleCredentials(ctx, s, name, role)
+}
+
 func (b *databaseBackend) invalidate(ctx context.Context, key string) {
 	switch {
 	case strings.HasPrefix(key, databaseConfigPath):
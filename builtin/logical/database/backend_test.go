@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -1438,3 +1439,419 @@ REVOKE USAGE ON SCHEMA public FROM {{name}};
 
 DROP ROLE IF EXISTS {{name}};
 `
+
+// mockStaticDatabase is an in-memory dbplugin.Database that records the
+// passwords set for static roles.
+type mockStaticDatabase struct {
+	sync.Mutex
+	passwords map[string]string
+	count     int
+
+	// fail makes SetCredentials fail without changing the password
+	fail bool
+}
+
+func (m *mockStaticDatabase) Type() (string, error) { return "mock", nil }
+
+func (m *mockStaticDatabase) CreateUser(context.Context, dbplugin.Statements, dbplugin.UsernameConfig, time.Time) (string, string, error) {
+	return "", "", errors.New("not implemented")
+}
+
+func (m *mockStaticDatabase) RenewUser(context.Context, dbplugin.Statements, string, time.Time) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockStaticDatabase) RevokeUser(context.Context, dbplugin.Statements, string) error {
+	return errors.New("not implemented")
+}
+
+func (m *mockStaticDatabase) RotateRootCredentials(context.Context, []string) (map[string]interface{}, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockStaticDatabase) Init(_ context.Context, config map[string]interface{}, _ bool) (map[string]interface{}, error) {
+	return config, nil
+}
+
+func (m *mockStaticDatabase) Initialize(context.Context, map[string]interface{}, bool) error {
+	return nil
+}
+
+func (m *mockStaticDatabase) Close() error { return nil }
+
+func (m *mockStaticDatabase) SetCredentials(_ context.Context, _ []string, username, password string) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.fail {
+		return errors.New("set credentials failed")
+	}
+	m.count++
+	m.passwords[username] = password
+	return nil
+}
+
+func (m *mockStaticDatabase) password(username string) string {
+	m.Lock()
+	defer m.Unlock()
+	return m.passwords[username]
+}
+
+// mockPluginSystemView serves the given factories as builtin database plugins.
+type mockPluginSystemView struct {
+	logical.StaticSystemView
+	factories map[string]func() (interface{}, error)
+}
+
+func (s mockPluginSystemView) LookupPlugin(_ context.Context, name string, pluginType consts.PluginType) (*pluginutil.PluginRunner, error) {
+	factory, ok := s.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("no plugin found with name %q", name)
+	}
+	return &pluginutil.PluginRunner{
+		Name:           name,
+		Type:           pluginType,
+		Builtin:        true,
+		BuiltinFactory: factory,
+	}, nil
+}
+
+// unsupportedStaticDatabase hides SetCredentials from the wrapped database.
+type unsupportedStaticDatabase struct {
+	dbplugin.Database
+}
+
+func TestBackend_staticRoles(t *testing.T) {
+	mock := &mockStaticDatabase{passwords: make(map[string]string)}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = mockPluginSystemView{
+		StaticSystemView: logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+		factories: map[string]func() (interface{}, error){
+			"mock-database-plugin": func() (interface{}, error) {
+				return mock, nil
+			},
+			"unsupported-database-plugin": func() (interface{}, error) {
+				return unsupportedStaticDatabase{mock}, nil
+			},
+		},
+	}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup(context.Background())
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(namespace.RootContext(nil), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatalf("%s %s: err: %v resp: %#v", op, path, err, resp)
+		}
+		return resp
+	}
+	expectError := func(op logical.Operation, path string, data map[string]interface{}, contains string) {
+		t.Helper()
+		resp := request(op, path, data)
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), contains) {
+			t.Fatalf("expected error containing %q, got: %#v", contains, resp)
+		}
+	}
+
+	for name, plugin := range map[string]string{"mockdb": "mock-database-plugin", "unsupported": "unsupported-database-plugin"} {
+		resp := request(logical.UpdateOperation, "config/"+name, map[string]interface{}{
+			"plugin_name":   plugin,
+			"allowed_roles": []string{"app", "other"},
+		})
+		if resp != nil && resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+
+	expectError(logical.CreateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":         "mockdb",
+		"rotation_period": 3600,
+	}, "empty username")
+	expectError(logical.CreateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":         "mockdb",
+		"username":        "app-user",
+		"rotation_period": 30,
+	}, "rotation_period must be at least")
+	expectError(logical.CreateOperation, "static-roles/denied", map[string]interface{}{
+		"db_name":         "mockdb",
+		"username":        "app-user",
+		"rotation_period": 3600,
+	}, "is not an allowed role")
+	expectError(logical.CreateOperation, "static-roles/other", map[string]interface{}{
+		"db_name":         "unsupported",
+		"username":        "other-user",
+		"rotation_period": 3600,
+	}, "does not support static roles")
+	if resp := request(logical.ReadOperation, "static-roles/other", nil); resp != nil {
+		t.Fatalf("expected failed role not to be stored, got: %#v", resp)
+	}
+
+	// Creating the role takes ownership of the password
+	request(logical.CreateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":         "mockdb",
+		"username":        "app-user",
+		"rotation_period": 3600,
+	})
+	first := mock.password("app-user")
+	if first == "" {
+		t.Fatal("expected password to be set on create")
+	}
+
+	readCreds := func() *logical.Response {
+		t.Helper()
+		resp := request(logical.ReadOperation, "static-creds/app", nil)
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		if resp.Data["username"] != "app-user" || resp.Data["password"] != mock.password("app-user") {
+			t.Fatalf("bad creds: %#v", resp.Data)
+		}
+		return resp
+	}
+	resp := readCreds()
+	if ttl := resp.Data["ttl"].(int64); ttl < 3500 || ttl > 3600 {
+		t.Fatalf("bad ttl: %d", ttl)
+	}
+
+	resp = request(logical.ReadOperation, "static-roles/app", nil)
+	if _, ok := resp.Data["password"]; ok {
+		t.Fatal("role read must not return the password")
+	}
+	if resp.Data["rotation_period"] != float64(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	expectError(logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"username": "someone-else",
+	}, "cannot change the username")
+
+	// Updating the role does not rotate the password
+	request(logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"rotation_period": 7200,
+	})
+	if mock.password("app-user") != first {
+		t.Fatal("expected update not to rotate the password")
+	}
+
+	// Manual rotation
+	request(logical.UpdateOperation, "rotate-role/app", nil)
+	second := mock.password("app-user")
+	if second == first {
+		t.Fatal("expected password to be rotated")
+	}
+	readCreds()
+
+	// The periodic function leaves the password alone until it is due
+	periodic := func() {
+		t.Helper()
+		if err := b.(*databaseBackend).periodicFunc(context.Background(), &logical.Request{Storage: config.StorageView}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	periodic()
+	if mock.password("app-user") != second {
+		t.Fatal("expected password not to be rotated before it is due")
+	}
+
+	role, err := b.(*databaseBackend).StaticRole(context.Background(), config.StorageView, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.LastVaultRotation = time.Now().Add(-3 * time.Hour)
+	entry, err := logical.StorageEntryJSON("static-role/app", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.StorageView.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	periodic()
+	if mock.password("app-user") == second {
+		t.Fatal("expected password to be rotated once due")
+	}
+	readCreds()
+
+	resp = request(logical.ListOperation, "static-roles/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "app" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	request(logical.DeleteOperation, "static-roles/app", nil)
+	expectError(logical.ReadOperation, "static-creds/app", nil, "unknown static role")
+}
+
+// failingRoleStorage fails writes of static roles while failPut is set.
+type failingRoleStorage struct {
+	logical.Storage
+	failPut bool
+}
+
+func (s *failingRoleStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if s.failPut && strings.HasPrefix(entry.Key, "static-role/") {
+		return errors.New("put failed")
+	}
+	return s.Storage.Put(ctx, entry)
+}
+
+func TestBackend_staticRoleRecovery(t *testing.T) {
+	mock := &mockStaticDatabase{passwords: make(map[string]string)}
+	storage := &failingRoleStorage{Storage: &logical.InmemStorage{}}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+	config.System = mockPluginSystemView{
+		StaticSystemView: logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+		factories: map[string]func() (interface{}, error){
+			"mock-database-plugin": func() (interface{}, error) {
+				return mock, nil
+			},
+		},
+	}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup(context.Background())
+	db := b.(*databaseBackend)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(namespace.RootContext(nil), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	storedPassword := func() string {
+		t.Helper()
+		role, err := db.StaticRole(context.Background(), storage, "app")
+		if err != nil || role == nil {
+			t.Fatalf("err: %v role: %#v", err, role)
+		}
+		return role.Password
+	}
+
+	if resp, err := request(logical.UpdateOperation, "config/mockdb", map[string]interface{}{
+		"plugin_name":   "mock-database-plugin",
+		"allowed_roles": []string{"app"},
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	if resp, err := request(logical.CreateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":         "mockdb",
+		"username":        "app-user",
+		"rotation_period": 3600,
+	}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// The password is set in the database but storing the role fails
+	storage.failPut = true
+	if _, err := request(logical.UpdateOperation, "rotate-role/app", nil); err == nil {
+		t.Fatal("expected rotation to fail")
+	}
+	storage.failPut = false
+	if storedPassword() == mock.password("app-user") {
+		t.Fatal("expected the stored password to be out of date")
+	}
+
+	// The WAL rollback stores the password that was set
+	if _, err := request(logical.RollbackOperation, "", map[string]interface{}{"immediate": true}); err != nil {
+		t.Fatal(err)
+	}
+	if storedPassword() != mock.password("app-user") {
+		t.Fatal("expected the rollback to store the password set in the database")
+	}
+	if keys, err := framework.ListWAL(context.Background(), storage); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no WAL entries, got %v: %v", keys, err)
+	}
+
+	// A rotation the database rejects leaves no WAL entry behind
+	mock.Lock()
+	mock.fail = true
+	mock.Unlock()
+	if _, err := request(logical.UpdateOperation, "rotate-role/app", nil); err == nil {
+		t.Fatal("expected rotation to fail")
+	}
+	if keys, err := framework.ListWAL(context.Background(), storage); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no WAL entries, got %v: %v", keys, err)
+	}
+
+	// Periodic rotations that fail are retried with a backoff
+	role, err := db.StaticRole(context.Background(), storage, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.LastVaultRotation = time.Now().Add(-2 * time.Hour)
+	entry, err := logical.StorageEntryJSON("static-role/app", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	periodic := func() {
+		t.Helper()
+		if err := db.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRetry := func(failures int, backoff time.Duration) {
+		t.Helper()
+		db.staticRoleRetriesLock.Lock()
+		defer db.staticRoleRetriesLock.Unlock()
+		retry := db.staticRoleRetries["app"]
+		if retry == nil || retry.failures != failures || time.Until(retry.next) > backoff || time.Until(retry.next) < backoff-time.Minute {
+			t.Fatalf("expected %d failures with a %s backoff, got %#v", failures, backoff, retry)
+		}
+	}
+
+	periodic()
+	checkRetry(1, time.Minute)
+
+	// Nothing is attempted until the backoff has elapsed
+	periodic()
+	checkRetry(1, time.Minute)
+
+	db.staticRoleRetriesLock.Lock()
+	db.staticRoleRetries["app"].next = time.Now()
+	db.staticRoleRetriesLock.Unlock()
+	periodic()
+	checkRetry(2, 2*time.Minute)
+
+	mock.Lock()
+	mock.fail = false
+	mock.Unlock()
+	db.staticRoleRetriesLock.Lock()
+	db.staticRoleRetries["app"].next = time.Now()
+	db.staticRoleRetriesLock.Unlock()
+	periodic()
+	if storedPassword() != mock.password("app-user") {
+		t.Fatal("expected the retried rotation to succeed")
+	}
+	db.staticRoleRetriesLock.Lock()
+	defer db.staticRoleRetriesLock.Unlock()
+	if len(db.staticRoleRetries) != 0 {
+		t.Fatalf("expected the backoff to be reset, got %#v", db.staticRoleRetries)
+	}
+}
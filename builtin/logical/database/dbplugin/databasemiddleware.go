@@ -63,6 +63,15 @@ func (mw *databaseTracingMiddleware) RotateRootCredentials(ctx context.Context,
 	return mw.next.RotateRootCredentials(ctx, statements)
 }
 
+func (mw *databaseTracingMiddleware) SetCredentials(ctx context.Context, statements []string, username, password string) (err error) {
+	defer func(then time.Time) {
+		mw.logger.Trace("set credentials", "status", "finished", "err", err, "took", time.Since(then))
+	}(time.Now())
+
+	mw.logger.Trace("set credentials", "status", "started")
+	return SetCredentials(ctx, mw.next, statements, username, password)
+}
+
 func (mw *databaseTracingMiddleware) Initialize(ctx context.Context, conf map[string]interface{}, verifyConnection bool) error {
 	_, err := mw.Init(ctx, conf, verifyConnection)
 	return err
@@ -164,6 +173,22 @@ func (mw *databaseMetricsMiddleware) RotateRootCredentials(ctx context.Context,
 	return mw.next.RotateRootCredentials(ctx, statements)
 }
 
+func (mw *databaseMetricsMiddleware) SetCredentials(ctx context.Context, statements []string, username, password string) (err error) {
+	defer func(now time.Time) {
+		metrics.MeasureSince([]string{"database", "SetCredentials"}, now)
+		metrics.MeasureSince([]string{"database", mw.typeStr, "SetCredentials"}, now)
+
+		if err != nil {
+			metrics.IncrCounter([]string{"database", "SetCredentials", "error"}, 1)
+			metrics.IncrCounter([]string{"database", mw.typeStr, "SetCredentials", "error"}, 1)
+		}
+	}(time.Now())
+
+	metrics.IncrCounter([]string{"database", "SetCredentials"}, 1)
+	metrics.IncrCounter([]string{"database", mw.typeStr, "SetCredentials"}, 1)
+	return SetCredentials(ctx, mw.next, statements, username, password)
+}
+
 func (mw *databaseMetricsMiddleware) Initialize(ctx context.Context, conf map[string]interface{}, verifyConnection bool) error {
 	_, err := mw.Init(ctx, conf, verifyConnection)
 	return err
@@ -241,6 +266,10 @@ func (mw *DatabaseErrorSanitizerMiddleware) RotateRootCredentials(ctx context.Co
 	return conf, mw.sanitize(err)
 }
 
+func (mw *DatabaseErrorSanitizerMiddleware) SetCredentials(ctx context.Context, statements []string, username, password string) error {
+	return mw.sanitize(SetCredentials(ctx, mw.next, statements, username, password))
+}
+
 func (mw *DatabaseErrorSanitizerMiddleware) Initialize(ctx context.Context, conf map[string]interface{}, verifyConnection bool) error {
 	_, err := mw.Init(ctx, conf, verifyConnection)
 	return err
@@ -2,6 +2,7 @@ package dbplugin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/rpc"
 	"time"
@@ -31,6 +32,28 @@ type Database interface {
 	Initialize(ctx context.Context, config map[string]interface{}, verifyConnection bool) (err error)
 }
 
+// StaticUserDatabase is implemented by databases that can rotate the password
+// of an existing user, which is required by static roles. It is optional;
+// plugins that run out of process do not support it.
+type StaticUserDatabase interface {
+	SetCredentials(ctx context.Context, statements []string, username, password string) error
+}
+
+// ErrStaticUsersUnsupported is returned by SetCredentials when the database
+// does not implement StaticUserDatabase.
+var ErrStaticUsersUnsupported = errors.New("database plugin does not support static roles")
+
+// SetCredentials sets the password of an existing user if the database
+// supports it. The password is generated by the caller, so that it can be
+// recorded before the database is changed.
+func SetCredentials(ctx context.Context, db Database, statements []string, username, password string) error {
+	sdb, ok := db.(StaticUserDatabase)
+	if !ok {
+		return ErrStaticUsersUnsupported
+	}
+	return sdb.SetCredentials(ctx, statements, username, password)
+}
+
 // PluginFactory is used to build plugin database types. It wraps the database
 // object in a logging and metrics middleware.
 func PluginFactory(ctx context.Context, pluginName string, sys pluginutil.LookRunnerUtil, logger log.Logger) (Database, error) {
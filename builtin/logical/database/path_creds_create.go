@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -99,6 +100,69 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 	}
 }
 
+func pathStaticCredsRead(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead(),
+		},
+
+		HelpSynopsis:    pathStaticCredsReadHelpSyn,
+		HelpDescription: pathStaticCredsReadHelpDesc,
+	}
+}
+
+func (b *databaseBackend) pathStaticCredsRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+
+		lock := locksutil.LockForKey(b.staticRoleLocks, name)
+		lock.RLock()
+		defer lock.RUnlock()
+
+		role, err := b.StaticRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown static role: %s", name)), nil
+		}
+
+		dbConfig, err := b.DatabaseConfig(ctx, req.Storage, role.DBName)
+		if err != nil {
+			return nil, err
+		}
+
+		// If role name isn't in the database's allowed roles, send back a
+		// permission denied.
+		if !strutil.StrListContains(dbConfig.AllowedRoles, "*") && !strutil.StrListContainsGlob(dbConfig.AllowedRoles, name) {
+			return nil, logical.ErrPermissionDenied
+		}
+
+		ttl := time.Until(role.NextVaultRotation())
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"username":            role.Username,
+				"password":            role.Password,
+				"last_vault_rotation": role.LastVaultRotation,
+				"rotation_period":     role.RotationPeriod.Seconds(),
+				"ttl":                 int64(ttl.Seconds()),
+			},
+		}, nil
+	}
+}
+
 const pathCredsCreateReadHelpSyn = `
 Request database credentials for a certain role.
 `
@@ -108,3 +172,13 @@ This path reads database credentials for a certain role. The
 database credentials will be generated on demand and will be automatically
 revoked when the lease is up.
 `
+
+const pathStaticCredsReadHelpSyn = `
+Request the current database credentials of a static role.
+`
+
+const pathStaticCredsReadHelpDesc = `
+This path reads the username and current password of the database user managed
+by a static role, along with the number of seconds until the password is next
+rotated. No lease is created; the password stays valid until it is rotated.
+`
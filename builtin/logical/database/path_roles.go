@@ -2,9 +2,11 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -255,6 +257,233 @@ type roleEntry struct {
 	MaxTTL     time.Duration       `json:"max_ttl"`
 }
 
+// minRotationPeriod is the shortest rotation period accepted for a static
+// role; passwords are rotated by the periodic function, which only runs about
+// once a minute.
+const minRotationPeriod = time.Minute
+
+func pathListStaticRoles(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRoleList(),
+		},
+
+		HelpSynopsis:    pathStaticRoleHelpSyn,
+		HelpDescription: pathStaticRoleHelpDesc,
+	}
+}
+
+func pathStaticRoles(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+
+			"db_name": {
+				Type:        framework.TypeString,
+				Description: "Name of the database this role acts on.",
+			},
+			"username": {
+				Type: framework.TypeString,
+				Description: `Name of the existing database user whose password
+				is managed by this role. Cannot be changed once set.`,
+			},
+			"rotation_period": {
+				Type: framework.TypeDurationSecond,
+				Description: `Period after which the password is rotated. Must
+				be at least one minute.`,
+			},
+			"rotation_statements": {
+				Type: framework.TypeStringSlice,
+				Description: `Specifies the database statements to be executed
+				to change the user's password. If empty, the plugin's default
+				is used. See the plugin's API page for more information on
+				support and formatting for this parameter.`,
+			},
+		},
+
+		ExistenceCheck: b.pathStaticRoleExistenceCheck(),
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticRoleRead(),
+			logical.CreateOperation: b.pathStaticRoleCreateUpdate(),
+			logical.UpdateOperation: b.pathStaticRoleCreateUpdate(),
+			logical.DeleteOperation: b.pathStaticRoleDelete(),
+		},
+
+		HelpSynopsis:    pathStaticRoleHelpSyn,
+		HelpDescription: pathStaticRoleHelpDesc,
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleExistenceCheck() framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+		role, err := b.StaticRole(ctx, req.Storage, data.Get("name").(string))
+		if err != nil {
+			return false, err
+		}
+
+		return role != nil, nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+
+		lock := locksutil.LockForKey(b.staticRoleLocks, name)
+		lock.Lock()
+		defer lock.Unlock()
+
+		err := req.Storage.Delete(ctx, "static-role/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		lock := locksutil.LockForKey(b.staticRoleLocks, name)
+		lock.RLock()
+		defer lock.RUnlock()
+
+		role, err := b.StaticRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, nil
+		}
+
+		data := map[string]interface{}{
+			"db_name":             role.DBName,
+			"username":            role.Username,
+			"rotation_period":     role.RotationPeriod.Seconds(),
+			"rotation_statements": role.RotationStatements,
+			"last_vault_rotation": role.LastVaultRotation,
+		}
+		if len(role.RotationStatements) == 0 {
+			data["rotation_statements"] = []string{}
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		entries, err := req.Storage.List(ctx, "static-role/")
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(entries), nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleCreateUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+		if name == "" {
+			return logical.ErrorResponse("empty role name attribute given"), nil
+		}
+
+		lock := locksutil.LockForKey(b.staticRoleLocks, name)
+		lock.Lock()
+		defer lock.Unlock()
+
+		role, err := b.StaticRole(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			role = &staticRoleEntry{}
+		}
+
+		if dbNameRaw, ok := data.GetOk("db_name"); ok {
+			role.DBName = dbNameRaw.(string)
+		}
+		if role.DBName == "" {
+			return logical.ErrorResponse("empty database name attribute"), nil
+		}
+
+		if usernameRaw, ok := data.GetOk("username"); ok {
+			username := usernameRaw.(string)
+			if role.Username != "" && role.Username != username {
+				return logical.ErrorResponse("cannot change the username of a static role"), nil
+			}
+			role.Username = username
+		}
+		if role.Username == "" {
+			return logical.ErrorResponse("empty username attribute"), nil
+		}
+
+		if rotationPeriodRaw, ok := data.GetOk("rotation_period"); ok {
+			role.RotationPeriod = time.Duration(rotationPeriodRaw.(int)) * time.Second
+		}
+		if role.RotationPeriod < minRotationPeriod {
+			return logical.ErrorResponse(fmt.Sprintf("rotation_period must be at least %d seconds", int(minRotationPeriod.Seconds()))), nil
+		}
+
+		if rotationStmtsRaw, ok := data.GetOk("rotation_statements"); ok {
+			role.RotationStatements = strutil.RemoveEmpty(rotationStmtsRaw.([]string))
+		}
+
+		dbConfig, err := b.DatabaseConfig(ctx, req.Storage, role.DBName)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if !strutil.StrListContains(dbConfig.AllowedRoles, "*") && !strutil.StrListContainsGlob(dbConfig.AllowedRoles, name) {
+			return logical.ErrorResponse(fmt.Sprintf("%q is not an allowed role for database %q", name, role.DBName)), nil
+		}
+
+		// Take ownership of the password right away so that Vault always
+		// knows the current one
+		if req.Operation == logical.CreateOperation {
+			if err := b.setStaticRoleCredentials(ctx, req.Storage, name, role); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			return nil, nil
+		}
+
+		entry, err := logical.StorageEntryJSON("static-role/"+name, role)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+type staticRoleEntry struct {
+	DBName             string        `json:"db_name"`
+	Username           string        `json:"username"`
+	RotationPeriod     time.Duration `json:"rotation_period"`
+	RotationStatements []string      `json:"rotation_statements"`
+	Password           string        `json:"password"`
+	LastVaultRotation  time.Time     `json:"last_vault_rotation"`
+}
+
+// NextVaultRotation returns the time at which the password is due to be
+// rotated.
+func (r *staticRoleEntry) NextVaultRotation() time.Time {
+	return r.LastVaultRotation.Add(r.RotationPeriod)
+}
+
 const pathRoleHelpSyn = `
 Manage the roles that can be created with this backend.
 `
@@ -299,3 +528,38 @@ user.
 The "rollback_statements' parameter customizes the statement string used to
 rollback a change if needed.
 `
+
+const pathStaticRoleHelpSyn = `
+Manage the static roles that can be created with this backend.
+`
+
+const pathStaticRoleHelpDesc = `
+This path lets you manage the static roles of this backend. A static role binds
+an existing database user to Vault, which then rotates the user's password on a
+schedule instead of creating a new user for every lease.
+
+The "db_name" parameter is required and configures the name of the database
+connection to use. The connection must list the role in its allowed roles.
+
+The "username" parameter is required and names the existing database user. It
+cannot be changed after the role is created.
+
+The "rotation_period" parameter is required and sets how often the password is
+rotated. It must be at least one minute. The password is also rotated as soon
+as the role is created, and can be rotated on demand with the "rotate-role/"
+endpoint.
+
+The "rotation_statements" parameter customizes the statements used to change
+the password. The names of the variables must be surrounded by "{{" and "}}" to
+be replaced.
+
+  * "name" - The username of the database user.
+
+  * "password" - The new password.
+
+Example of a decent rotation_statements for a postgresql database plugin:
+
+	ALTER ROLE "{{name}}" WITH PASSWORD '{{password}}';
+
+Static roles are only supported by the builtin database plugins.
+`
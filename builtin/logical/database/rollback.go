@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// staticRoleWALKind is the kind of the WAL entries written while the password
+// of a static role is rotated
+const staticRoleWALKind = "staticRole"
+
+// walStaticRole records a password that is being set on the database user of
+// a static role, along with the role as it is stored once the rotation
+// succeeds.
+type walStaticRole struct {
+	Name string `json:"name"`
+
+	// PreviousRotation is the rotation time of the role before this
+	// rotation; it is zero if the role was being created
+	PreviousRotation time.Time `json:"previous_rotation"`
+
+	Role *staticRoleEntry `json:"role"`
+}
+
+func (b *databaseBackend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	switch kind {
+	case staticRoleWALKind:
+		return b.staticRoleRollback(ctx, req.Storage, data)
+	default:
+		return fmt.Errorf("unknown type to rollback")
+	}
+}
+
+// staticRoleRollback completes a rotation whose new password may have been set
+// in the database without the role being stored. It sets the password from
+// the WAL entry again, since the database may or may not have it, and then
+// stores the role.
+func (b *databaseBackend) staticRoleRollback(ctx context.Context, s logical.Storage, data interface{}) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var entry walStaticRole
+	if err := jsonutil.DecodeJSON(buf, &entry); err != nil {
+		return err
+	}
+	if entry.Role == nil {
+		return nil
+	}
+
+	lock := locksutil.LockForKey(b.staticRoleLocks, entry.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Leave the role alone if it has been rotated, changed or deleted since
+	// the entry was written; the password it holds is then the current one
+	role, err := b.StaticRole(ctx, s, entry.Name)
+	if err != nil {
+		return err
+	}
+	var lastRotation time.Time
+	if role != nil {
+		if role.Username != entry.Role.Username {
+			return nil
+		}
+		lastRotation = role.LastVaultRotation
+	}
+	if !lastRotation.Equal(entry.PreviousRotation) {
+		return nil
+	}
+
+	db, err := b.GetConnection(ctx, s, entry.Role.DBName)
+	if err != nil {
+		return err
+	}
+
+	db.RLock()
+	err = dbplugin.SetCredentials(ctx, db.Database, entry.Role.RotationStatements, entry.Role.Username, entry.Role.Password)
+	db.RUnlock()
+	if err != nil {
+		b.CloseIfShutdown(db, err)
+		return errwrap.Wrapf(fmt.Sprintf("failed to restore password of %q: {{err}}", entry.Role.Username), err)
+	}
+
+	storageEntry, err := logical.StorageEntryJSON("static-role/"+entry.Name, entry.Role)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, storageEntry)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"gopkg.in/mgo.v2"
 )
 
 func pathCredsCreate(b *backend) *framework.Path {
@@ -55,35 +56,38 @@ func (b *backend) pathCredsCreateRead(ctx context.Context, req *logical.Request,
 		displayName += "-"
 	}
 
-	userUUID, err := uuid.GenerateUUID()
-	if err != nil {
-		return nil, err
-	}
-
-	username := fmt.Sprintf("vault-%s%s", displayName, userUUID)
-
 	password, err := uuid.GenerateUUID()
 	if err != nil {
 		return nil, err
 	}
 
-	// Build the user creation command
-	createUserCmd := createUserCommand{
-		Username: username,
-		Password: password,
-		Roles:    role.MongoDBRoles.toStandardRolesArray(),
-	}
-
 	// Get our connection
 	session, err := b.Session(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create the user
-	err = session.DB(role.DB).Run(createUserCmd, nil)
-	if err != nil {
-		return nil, err
+	// Create the user, generating a new username should it already exist
+	var username string
+	for attempt := 1; ; attempt++ {
+		userUUID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		username = fmt.Sprintf("vault-%s%s", displayName, userUUID)
+
+		createUserCmd := createUserCommand{
+			Username: username,
+			Password: password,
+			Roles:    role.MongoDBRoles.toStandardRolesArray(),
+		}
+		err = session.DB(role.DB).Run(createUserCmd, nil)
+		if err == nil {
+			break
+		}
+		if !isUserExistsError(err) || attempt == maxCreateUserAttempts {
+			return nil, err
+		}
 	}
 
 	// Return the secret
@@ -101,6 +105,17 @@ func (b *backend) pathCredsCreateRead(ctx context.Context, req *logical.Request,
 	return resp, nil
 }
 
+// maxCreateUserAttempts is the number of usernames tried before giving up on
+// creating a user
+const maxCreateUserAttempts = 3
+
+// isUserExistsError returns whether the error is MongoDB's response to
+// creating a user that already exists.
+func isUserExistsError(err error) bool {
+	queryErr, ok := err.(*mgo.QueryError)
+	return ok && queryErr.Code == 51003
+}
+
 type createUserCommand struct {
 	Username string        `bson:"createUser"`
 	Password string        `bson:"pwd"`
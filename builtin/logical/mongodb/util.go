@@ -2,7 +2,10 @@ package mongodb
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/url"
 	"strconv"
@@ -31,6 +34,9 @@ func parseMongoURI(rawUri string) (*mgo.DialInfo, error) {
 		info.Password, _ = uri.User.Password()
 	}
 
+	var useTLS bool
+	tlsConfig := &tls.Config{}
+
 	query := uri.Query()
 	for key, values := range query {
 		var value string
@@ -53,16 +59,44 @@ func parseMongoURI(rawUri string) (*mgo.DialInfo, error) {
 				return nil, errors.New("bad value for maxPoolSize: " + value)
 			}
 			info.PoolLimit = poolLimit
-		case "ssl":
+		case "connectTimeoutMS":
+			timeout, err := strconv.Atoi(value)
+			if err != nil || timeout <= 0 {
+				return nil, errors.New("bad value for connectTimeoutMS: " + value)
+			}
+			info.Timeout = time.Duration(timeout) * time.Millisecond
+		case "ssl", "tls":
 			ssl, err := strconv.ParseBool(value)
 			if err != nil {
-				return nil, errors.New("bad value for ssl: " + value)
+				return nil, errors.New("bad value for " + key + ": " + value)
+			}
+			useTLS = useTLS || ssl
+		case "tlsInsecure", "tlsAllowInvalidCertificates":
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.New("bad value for " + key + ": " + value)
+			}
+			tlsConfig.InsecureSkipVerify = tlsConfig.InsecureSkipVerify || insecure
+		case "tlsCAFile":
+			caPEM, err := ioutil.ReadFile(value)
+			if err != nil {
+				return nil, fmt.Errorf("error reading tlsCAFile: %v", err)
 			}
-			if ssl {
-				info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
-					return tls.Dial("tcp", addr.String(), &tls.Config{})
-				}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+				return nil, errors.New("no certificates found in tlsCAFile: " + value)
 			}
+		case "tlsCertificateKeyFile":
+			// The file holds both the PEM-encoded client certificate and its key
+			cert, err := tls.LoadX509KeyPair(value, value)
+			if err != nil {
+				return nil, fmt.Errorf("error reading tlsCertificateKeyFile: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		case "readPreference", "w", "journal", "wtimeoutMS", "retryWrites":
+			// User management commands always run against the primary with
+			// the default write concern, so these options of replica set
+			// connection strings have no effect here
 		case "connect":
 			if value == "direct" {
 				info.Direct = true
@@ -77,5 +111,14 @@ func parseMongoURI(rawUri string) (*mgo.DialInfo, error) {
 		}
 	}
 
+	if !useTLS && (tlsConfig.InsecureSkipVerify || tlsConfig.RootCAs != nil || len(tlsConfig.Certificates) > 0) {
+		return nil, errors.New("TLS options require ssl=true or tls=true")
+	}
+	if useTLS {
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.Dial("tcp", addr.String(), tlsConfig)
+		}
+	}
+
 	return &info, nil
 }
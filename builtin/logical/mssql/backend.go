@@ -33,6 +33,7 @@ func Backend() *backend {
 
 		Paths: []*framework.Path{
 			pathConfigConnection(&b),
+			pathResetConnection(&b),
 			pathConfigLease(&b),
 			pathListRoles(&b),
 			pathRoles(&b),
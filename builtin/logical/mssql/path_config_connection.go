@@ -7,6 +7,7 @@ import (
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
 )
 
 func pathConfigConnection(b *backend) *framework.Path {
@@ -77,12 +78,12 @@ func (b *backend) pathConnectionWrite(ctx context.Context, req *logical.Request,
 
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
-				"Error validating connection info: %s", err)), nil
+				"Error validating connection info: %s", dbutil.SanitizeConnectionError(err, connString))), nil
 		}
 		defer db.Close()
 		if err := db.Ping(); err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
-				"Error validating connection info: %s", err)), nil
+				"Error validating connection info: %s", dbutil.SanitizeConnectionError(err, connString))), nil
 		}
 	}
 
@@ -125,3 +126,57 @@ When configuring the connection string, the backend will verify its validity.
 If the database is not available when setting the connection string, set the
 "verify_connection" option to false.
 `
+
+func pathResetConnection(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "reset",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathResetConnectionWrite,
+		},
+
+		HelpSynopsis:    pathResetConnectionHelpSyn,
+		HelpDescription: pathResetConnectionHelpDesc,
+	}
+}
+
+// pathResetConnectionWrite closes the cached connection pool and opens a new
+// one, verifying that the database can still be reached
+func (b *backend) pathResetConnectionWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entry, err := req.Storage.Get(ctx, "config/connection")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection configuration")
+	}
+	if entry == nil {
+		return logical.ErrorResponse("configure the DB connection with config/connection first"), nil
+	}
+
+	var config connectionConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	connURL := config.ConnectionString
+
+	b.ResetDB(ctx)
+
+	db, err := b.DB(ctx, req.Storage)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Error validating connection info: %s", dbutil.SanitizeConnectionError(err, connURL))), nil
+	}
+
+	return nil, nil
+}
+
+const pathResetConnectionHelpSyn = `
+Close and re-establish the connection to MSSQL.
+`
+
+const pathResetConnectionHelpDesc = `
+This path closes the cached connection pool and opens a new one from the stored
+connection configuration, verifying that the database can be reached. Use it
+after the database has been restarted or its address has changed.
+`
@@ -167,6 +167,13 @@ Example SQL query to use:
   CREATE USER [{{name}}] FROM LOGIN [{{name}}];
   GRANT SELECT, UPDATE, DELETE, INSERT on SCHEMA::dbo TO [{{name}}];
 
+Users of a contained database, which authenticate against the database
+rather than through a server login, can be created in the default database of
+the connection with:
+
+  CREATE USER [{{name}}] WITH PASSWORD = '{{password}}';
+  GRANT SELECT ON SCHEMA::dbo TO [{{name}}];
+
 Please see the Microsoft SQL Server manual on the GRANT command to learn how to
 do more fine grained access.
 `
@@ -63,14 +63,23 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 		return nil, err
 	}
 
-	// First disable server login
-	disableStmt, err := db.Prepare(fmt.Sprintf("ALTER LOGIN [%s] DISABLE;", username))
-	if err != nil {
+	// Users of contained databases authenticate against the database itself
+	// and have no server login to disable, map or drop
+	var loginExists bool
+	if err := db.QueryRow(fmt.Sprintf(loginExistsSQL, username)).Scan(&loginExists); err != nil {
 		return nil, err
 	}
-	defer disableStmt.Close()
-	if _, err := disableStmt.Exec(); err != nil {
-		return nil, err
+
+	// First disable server login
+	if loginExists {
+		disableStmt, err := db.Prepare(fmt.Sprintf("ALTER LOGIN [%s] DISABLE;", username))
+		if err != nil {
+			return nil, err
+		}
+		defer disableStmt.Close()
+		if _, err := disableStmt.Exec(); err != nil {
+			return nil, err
+		}
 	}
 
 	// Query for sessions for the login so that we can kill any outstanding
@@ -100,6 +109,17 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 		revokeStmts = append(revokeStmts, fmt.Sprintf("KILL %d;", sessionID))
 	}
 
+	if err := sessionRows.Err(); err != nil {
+		return nil, errwrap.Wrapf("could not list all sessions: {{err}}", err)
+	}
+
+	if !loginExists {
+		// The contained database user lives in the default database of the
+		// connection, which is where it was created
+		revokeStmts = append(revokeStmts, fmt.Sprintf(dropUserSQL, b.defaultDb, username, username))
+		return nil, b.executeRevokeStatements(ctx, db, revokeStmts)
+	}
+
 	// Query for database users using undocumented stored procedure for now since
 	// it is the easiest way to get this information;
 	// we need to drop the database users before we can drop the login and the role
@@ -127,24 +147,13 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 		revokeStmts = append(revokeStmts, fmt.Sprintf(dropUserSQL, dbName, username, username))
 	}
 
-	// we do not stop on error, as we want to remove as
-	// many permissions as possible right now
-	var lastStmtError error
-	for _, query := range revokeStmts {
-
-		if err := dbtxn.ExecuteDBQuery(ctx, db, nil, query); err != nil {
-			lastStmtError = err
-			continue
-		}
-	}
-
 	// can't drop if not all database users are dropped
+	if err := b.executeRevokeStatements(ctx, db, revokeStmts); err != nil {
+		return nil, err
+	}
 	if rows.Err() != nil {
 		return nil, errwrap.Wrapf("could not generate sql statements for all rows: {{err}}", rows.Err())
 	}
-	if lastStmtError != nil {
-		return nil, errwrap.Wrapf("could not perform all sql statements: {{err}}", lastStmtError)
-	}
 
 	// Drop this login
 	stmt, err = db.Prepare(fmt.Sprintf(dropLoginSQL, username, username))
@@ -153,12 +162,29 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 	}
 	defer stmt.Close()
 	if _, err := stmt.Exec(); err != nil {
-		return nil, err
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to drop login %q: {{err}}", username), err)
 	}
 
 	return nil, nil
 }
 
+// executeRevokeStatements executes the statements that kill the sessions of a
+// user and drop its database users. It does not stop on error, as we want to
+// remove as many permissions as possible right now, and returns the last error
+// encountered.
+func (b *backend) executeRevokeStatements(ctx context.Context, db *sql.DB, revokeStmts []string) error {
+	var lastStmtError error
+	for _, query := range revokeStmts {
+		if err := dbtxn.ExecuteDBQuery(ctx, db, nil, query); err != nil {
+			lastStmtError = err
+		}
+	}
+	if lastStmtError != nil {
+		return errwrap.Wrapf("could not perform all sql statements: {{err}}", lastStmtError)
+	}
+	return nil
+}
+
 const dropUserSQL = `
 USE [%s]
 IF EXISTS
@@ -170,6 +196,12 @@ BEGIN
 END
 `
 
+const loginExistsSQL = `
+SELECT CAST(COUNT(*) AS BIT)
+FROM master.sys.server_principals
+WHERE name = N'%s'
+`
+
 const dropLoginSQL = `
 IF EXISTS
   (SELECT name
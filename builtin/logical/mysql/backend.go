@@ -33,6 +33,8 @@ func Backend() *backend {
 
 		Paths: []*framework.Path{
 			pathConfigConnection(&b),
+			pathResetConnection(&b),
+			pathRotateRoot(&b),
 			pathConfigLease(&b),
 			pathListRoles(&b),
 			pathRoles(&b),
@@ -56,6 +58,9 @@ type backend struct {
 
 	db   *sql.DB
 	lock sync.Mutex
+
+	// rotateRootLock serializes rotations of the root password
+	rotateRootLock sync.Mutex
 }
 
 // DB returns the database connection.
@@ -102,6 +107,7 @@ func (b *backend) DB(ctx context.Context, s logical.Storage) (*sql.DB, error) {
 	// since the request rate shouldn't be high.
 	b.db.SetMaxOpenConns(connConfig.MaxOpenConnections)
 	b.db.SetMaxIdleConns(connConfig.MaxIdleConnections)
+	b.db.SetConnMaxLifetime(connConfig.MaxConnectionLifetime)
 
 	return b.db, nil
 }
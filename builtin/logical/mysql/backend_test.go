@@ -7,7 +7,9 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
@@ -68,10 +70,11 @@ func TestBackend_config_connection(t *testing.T) {
 	}
 
 	configData := map[string]interface{}{
-		"connection_url":       "sample_connection_url",
-		"max_open_connections": 9,
-		"max_idle_connections": 7,
-		"verify_connection":    false,
+		"connection_url":          "sample_connection_url",
+		"max_open_connections":    9,
+		"max_idle_connections":    7,
+		"max_connection_lifetime": "30s",
+		"verify_connection":       false,
 	}
 
 	configReq := &logical.Request{
@@ -93,6 +96,7 @@ func TestBackend_config_connection(t *testing.T) {
 
 	delete(configData, "verify_connection")
 	delete(configData, "connection_url")
+	configData["max_connection_lifetime"] = int64(30)
 	if !reflect.DeepEqual(configData, resp.Data) {
 		t.Fatalf("bad: expected:%#v\nactual:%#v\n", configData, resp.Data)
 	}
@@ -207,6 +211,259 @@ func TestBackend_leaseWriteRead(t *testing.T) {
 
 }
 
+func TestBackend_roleRevocationStatements(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, connURL := prepareTestContainer(t)
+	defer cleanup()
+
+	connData := map[string]interface{}{
+		"connection_url": connURL,
+	}
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			testAccStepConfig(t, connData, false),
+			logicaltest.TestStep{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/web",
+				Data: map[string]interface{}{
+					"sql":                  testRoleHost,
+					"max_user_connections": -1,
+				},
+				ErrorOk: true,
+				Check: func(resp *logical.Response) error {
+					if resp == nil || !resp.IsError() {
+						return fmt.Errorf("expected error for negative max_user_connections, got: %#v", resp)
+					}
+					return nil
+				},
+			},
+			logicaltest.TestStep{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/web",
+				Data: map[string]interface{}{
+					"sql":                   testRoleWildCard,
+					"revocation_statements": testRevocationStatements,
+					"max_user_connections":  5,
+				},
+			},
+			logicaltest.TestStep{
+				Operation: logical.ReadOperation,
+				Path:      "roles/web",
+				Check: func(resp *logical.Response) error {
+					if !reflect.DeepEqual(resp.Data["revocation_statements"], testRevocationStatements) {
+						return fmt.Errorf("bad revocation_statements: %#v", resp.Data["revocation_statements"])
+					}
+					if resp.Data["max_user_connections"] != 5 {
+						return fmt.Errorf("bad max_user_connections: %#v", resp.Data["max_user_connections"])
+					}
+					return nil
+				},
+			},
+			// The lease is revoked with the revocation statements at the end of
+			// the test
+			testAccStepReadCreds(t, "web"),
+		},
+	})
+}
+
+func TestBackend_rotateRoot(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cleanup, connURL := prepareTestContainer(t)
+	defer cleanup()
+
+	connData := map[string]interface{}{
+		"connection_url": connURL,
+	}
+	logicaltest.Test(t, logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			testAccStepConfig(t, connData, false),
+			testAccStepRole(t, true),
+			logicaltest.TestStep{
+				Operation: logical.UpdateOperation,
+				Path:      "rotate-root",
+				Check: func(resp *logical.Response) error {
+					if resp != nil {
+						return fmt.Errorf("expected no response, got: %#v", resp)
+					}
+					return nil
+				},
+			},
+			testAccStepReadCreds(t, "web"),
+		},
+	})
+
+	entry, err := config.StorageView.Get(context.Background(), "config/connection")
+	if err != nil || entry == nil {
+		t.Fatalf("err: %v, entry: %#v", err, entry)
+	}
+	var connConfig connectionConfig
+	if err := entry.DecodeJSON(&connConfig); err != nil {
+		t.Fatal(err)
+	}
+	if connConfig.ConnectionURL == connURL {
+		t.Fatal("expected the stored connection URL to change")
+	}
+
+	// The old password no longer works, the stored one does
+	for connStr, works := range map[string]bool{connURL: false, connConfig.ConnectionURL: true} {
+		db, err := sql.Open("mysql", connStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.Ping()
+		db.Close()
+		if works != (err == nil) {
+			t.Fatalf("unexpected ping result for rotated=%t: %v", works, err)
+		}
+	}
+}
+
+func TestApplyMaxUserConnections(t *testing.T) {
+	cases := []struct {
+		query    string
+		max      int
+		expected string
+	}{
+		{
+			"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';",
+			10,
+			"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' WITH MAX_USER_CONNECTIONS 10",
+		},
+		{
+			"create user '{{name}}'@'%' identified by '{{password}}'",
+			3,
+			"create user '{{name}}'@'%' identified by '{{password}}' WITH MAX_USER_CONNECTIONS 3",
+		},
+		{
+			"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'",
+			0,
+			"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'",
+		},
+		{
+			"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' WITH MAX_USER_CONNECTIONS 2",
+			10,
+			"CREATE USER '{{name}}'@'%' IDENTIFIED BY '{{password}}' WITH MAX_USER_CONNECTIONS 2",
+		},
+		{
+			"GRANT SELECT ON *.* TO '{{name}}'@'%'",
+			10,
+			"GRANT SELECT ON *.* TO '{{name}}'@'%'",
+		},
+	}
+
+	for _, c := range cases {
+		if actual := applyMaxUserConnections(c.query, c.max); actual != c.expected {
+			t.Fatalf("bad: query %q with limit %d: expected %q, got %q", c.query, c.max, c.expected, actual)
+		}
+	}
+}
+
+func TestGenerateUsername(t *testing.T) {
+	cases := []struct {
+		name        string
+		role        *roleEntry
+		displayName string
+		prefix      string
+	}{
+		{
+			name:        "default format",
+			role:        &roleEntry{UsernameLength: 16, RolenameLength: 4, DisplaynameLength: 4},
+			displayName: "token-someone",
+			prefix:      "read-toke-",
+		},
+		{
+			name:        "multi-byte display name",
+			role:        &roleEntry{UsernameLength: 16, RolenameLength: 4, DisplaynameLength: 5},
+			displayName: "tökén",
+			prefix:      "read-tök-",
+		},
+		{
+			name:        "long lengths",
+			role:        &roleEntry{UsernameLength: 16, RolenameLength: 32, DisplaynameLength: 32},
+			displayName: "token-someone",
+			prefix:      "readonly-token-s",
+		},
+		{
+			name:        "prefix",
+			role:        &roleEntry{UsernameLength: 16, UsernamePrefix: "v_app_"},
+			displayName: "token-someone",
+			prefix:      "v_app_",
+		},
+	}
+
+	for _, c := range cases {
+		username, err := generateUsername(c.role, "readonly", c.displayName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(username) > 16 {
+			t.Fatalf("%s: username %q is longer than 16 characters", c.name, username)
+		}
+		if !utf8.ValidString(username) {
+			t.Fatalf("%s: username %q is not valid UTF-8", c.name, username)
+		}
+		if !strings.HasPrefix(username, c.prefix) {
+			t.Fatalf("%s: expected username %q to start with %q", c.name, username, c.prefix)
+		}
+	}
+}
+
+func TestBackend_roleUsernameOptions(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]map[string]interface{}{
+		"username_length must be positive": {
+			"username_length": 0,
+		},
+		"cannot be negative": {
+			"rolename_length": -1,
+		},
+		"may only contain": {
+			"username_prefix": "v'app",
+		},
+		"must leave at least 8 characters": {
+			"username_length": 16,
+			"username_prefix": "vault_app_",
+		},
+	}
+
+	for expected, d := range cases {
+		d["sql"] = testRoleWildCard
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/web",
+			Storage:   config.StorageView,
+			Data:      d,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), expected) {
+			t.Fatalf("expected error containing %q, got: %#v", expected, resp)
+		}
+	}
+}
+
 func testAccStepConfig(t *testing.T, d map[string]interface{}, expectError bool) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
@@ -350,3 +607,8 @@ const testRevocationSQL = `
 REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'10.1.1.2'; 
 DROP USER '{{name}}'@'10.1.1.2';
 `
+
+var testRevocationStatements = []string{
+	"REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'%'",
+	"DROP USER '{{name}}'@'%'",
+}
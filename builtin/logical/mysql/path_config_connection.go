@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
 )
 
 func pathConfigConnection(b *backend) *framework.Path {
@@ -31,6 +33,10 @@ This name is deprecated.`,
 				Type:        framework.TypeInt,
 				Description: "Maximum number of idle connections to the database; a zero uses the value of max_open_connections and a negative value disables idle connections. If larger than max_open_connections it will be reduced to the same size.",
 			},
+			"max_connection_lifetime": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum amount of time a connection may be reused; a zero means connections are reused forever",
+			},
 			"verify_connection": &framework.FieldSchema{
 				Type:        framework.TypeBool,
 				Default:     true,
@@ -65,8 +71,9 @@ func (b *backend) pathConnectionRead(ctx context.Context, req *logical.Request,
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"max_open_connections": config.MaxOpenConnections,
-			"max_idle_connections": config.MaxIdleConnections,
+			"max_open_connections":    config.MaxOpenConnections,
+			"max_idle_connections":    config.MaxIdleConnections,
+			"max_connection_lifetime": int64(config.MaxConnectionLifetime.Seconds()),
 		},
 	}, nil
 }
@@ -95,6 +102,8 @@ func (b *backend) pathConnectionWrite(ctx context.Context, req *logical.Request,
 		maxIdleConns = maxOpenConns
 	}
 
+	maxConnLifetime := time.Duration(data.Get("max_connection_lifetime").(int)) * time.Second
+
 	// Don't check the connection_url if verification is disabled
 	verifyConnection := data.Get("verify_connection").(bool)
 	if verifyConnection {
@@ -103,20 +112,21 @@ func (b *backend) pathConnectionWrite(ctx context.Context, req *logical.Request,
 
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
-				"error validating connection info: %s", err)), nil
+				"error validating connection info: %s", dbutil.SanitizeConnectionError(err, connURL))), nil
 		}
 		defer db.Close()
 		if err := db.Ping(); err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
-				"error validating connection info: %s", err)), nil
+				"error validating connection info: %s", dbutil.SanitizeConnectionError(err, connURL))), nil
 		}
 	}
 
 	// Store it
 	entry, err := logical.StorageEntryJSON("config/connection", connectionConfig{
-		ConnectionURL:      connURL,
-		MaxOpenConnections: maxOpenConns,
-		MaxIdleConnections: maxIdleConns,
+		ConnectionURL:         connURL,
+		MaxOpenConnections:    maxOpenConns,
+		MaxIdleConnections:    maxIdleConns,
+		MaxConnectionLifetime: maxConnLifetime,
 	})
 	if err != nil {
 		return nil, err
@@ -137,9 +147,10 @@ func (b *backend) pathConnectionWrite(ctx context.Context, req *logical.Request,
 type connectionConfig struct {
 	ConnectionURL string `json:"connection_url" structs:"connection_url" mapstructure:"connection_url"`
 	// Deprecate "value" in coming releases
-	ConnectionString   string `json:"value" structs:"value" mapstructure:"value"`
-	MaxOpenConnections int    `json:"max_open_connections" structs:"max_open_connections" mapstructure:"max_open_connections"`
-	MaxIdleConnections int    `json:"max_idle_connections" structs:"max_idle_connections" mapstructure:"max_idle_connections"`
+	ConnectionString      string        `json:"value" structs:"value" mapstructure:"value"`
+	MaxOpenConnections    int           `json:"max_open_connections" structs:"max_open_connections" mapstructure:"max_open_connections"`
+	MaxIdleConnections    int           `json:"max_idle_connections" structs:"max_idle_connections" mapstructure:"max_idle_connections"`
+	MaxConnectionLifetime time.Duration `json:"max_connection_lifetime" structs:"max_connection_lifetime" mapstructure:"max_connection_lifetime"`
 }
 
 const pathConfigConnectionHelpSyn = `
@@ -157,4 +168,66 @@ For example, RDS may look like:
 When configuring the connection string, the backend will verify its validity.
 If the database is not available when setting the connection URL, set the
 "verify_connection" option to false.
+
+The "max_open_connections", "max_idle_connections" and
+"max_connection_lifetime" parameters bound the connection pool. They take
+effect when the pool is next opened, which happens immediately after this path
+is written or the connection is reset.
+`
+
+func pathResetConnection(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "reset",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathResetConnectionWrite,
+		},
+
+		HelpSynopsis:    pathResetConnectionHelpSyn,
+		HelpDescription: pathResetConnectionHelpDesc,
+	}
+}
+
+// pathResetConnectionWrite closes the cached connection pool and opens a new
+// one, verifying that the database can still be reached
+func (b *backend) pathResetConnectionWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entry, err := req.Storage.Get(ctx, "config/connection")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection configuration")
+	}
+	if entry == nil {
+		return logical.ErrorResponse("configure the DB connection with config/connection first"), nil
+	}
+
+	var config connectionConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	connURL := config.ConnectionURL
+	if connURL == "" {
+		connURL = config.ConnectionString
+	}
+
+	b.ResetDB(ctx)
+
+	db, err := b.DB(ctx, req.Storage)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"error validating connection info: %s", dbutil.SanitizeConnectionError(err, connURL))), nil
+	}
+
+	return nil, nil
+}
+
+const pathResetConnectionHelpSyn = `
+Close and re-establish the connection to MySQL.
+`
+
+const pathResetConnectionHelpDesc = `
+This path closes the cached connection pool and opens a new one from the stored
+connection configuration, verifying that the database can be reached. Use it
+after the database has been restarted or its address has changed.
 `
@@ -53,32 +53,11 @@ func (b *backend) pathRoleCreateRead(ctx context.Context, req *logical.Request,
 		lease = &configLease{}
 	}
 
-	// Generate our username and password. The username will be a
-	// concatenation of:
-	//
-	// - the role name, truncated to role.rolenameLength (default 4)
-	// - the token display name, truncated to role.displaynameLength (default 4)
-	// - a UUID
-	//
-	// the entire concatenated string is then truncated to role.usernameLength,
-	// which by default is 16 due to limitations in older but still-prevalent
-	// versions of MySQL.
-	roleName := name
-	if len(roleName) > role.RolenameLength {
-		roleName = roleName[:role.RolenameLength]
-	}
-	displayName := req.DisplayName
-	if len(displayName) > role.DisplaynameLength {
-		displayName = displayName[:role.DisplaynameLength]
-	}
-	userUUID, err := uuid.GenerateUUID()
+	// Generate our username and password
+	username, err := generateUsername(role, name, req.DisplayName)
 	if err != nil {
 		return nil, err
 	}
-	username := fmt.Sprintf("%s-%s-%s", roleName, displayName, userUUID)
-	if len(username) > role.UsernameLength {
-		username = username[:role.UsernameLength]
-	}
 	password, err := uuid.GenerateUUID()
 	if err != nil {
 		return nil, err
@@ -108,6 +87,7 @@ func (b *backend) pathRoleCreateRead(ctx context.Context, req *logical.Request,
 			"name":     username,
 			"password": password,
 		}
+		query = applyMaxUserConnections(query, role.MaxUserConnections)
 		if err := dbtxn.ExecuteTxQuery(ctx, tx, m, query); err != nil {
 			return nil, err
 		}
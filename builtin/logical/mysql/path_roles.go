@@ -43,6 +43,16 @@ func pathRoles(b *backend) *framework.Path {
 				Description: "SQL string to revoke a user. See help for more info.",
 			},
 
+			"revocation_statements": {
+				Type:        framework.TypeStringSlice,
+				Description: "SQL statements executed in order to revoke a user. Takes precedence over revocation_sql. See help for more info.",
+			},
+
+			"max_user_connections": {
+				Type:        framework.TypeInt,
+				Description: "Maximum number of simultaneous connections for generated users, applied to the CREATE USER statement. 0 means no limit is set.",
+			},
+
 			"username_length": {
 				Type:        framework.TypeInt,
 				Description: "number of characters to truncate generated mysql usernames to (default 16)",
@@ -60,6 +70,11 @@ func pathRoles(b *backend) *framework.Path {
 				Description: "number of characters to truncate the displayname portion of generated mysql usernames to (default 4)",
 				Default:     4,
 			},
+
+			"username_prefix": {
+				Type:        framework.TypeString,
+				Description: "prefix of generated mysql usernames. If set, usernames are the prefix followed by random characters, and the role and display names are not included",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -116,8 +131,14 @@ func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"sql":            role.SQL,
-			"revocation_sql": role.RevocationSQL,
+			"sql":                   role.SQL,
+			"revocation_sql":        role.RevocationSQL,
+			"revocation_statements": role.RevocationStatements,
+			"max_user_connections":  role.MaxUserConnections,
+			"username_length":       role.UsernameLength,
+			"rolename_length":       role.RolenameLength,
+			"displayname_length":    role.DisplaynameLength,
+			"username_prefix":       role.UsernamePrefix,
 		},
 	}, nil
 }
@@ -134,19 +155,46 @@ func (b *backend) pathRoleList(ctx context.Context, req *logical.Request, d *fra
 func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	name := data.Get("name").(string)
 
+	usernameLength := data.Get("username_length").(int)
+	rolenameLength := data.Get("rolename_length").(int)
+	displaynameLength := data.Get("displayname_length").(int)
+	usernamePrefix := data.Get("username_prefix").(string)
+	if usernameLength < 1 {
+		return logical.ErrorResponse("username_length must be positive"), nil
+	}
+	if rolenameLength < 0 || displaynameLength < 0 {
+		return logical.ErrorResponse("rolename_length and displayname_length cannot be negative"), nil
+	}
+	if !usernamePrefixRe.MatchString(usernamePrefix) {
+		return logical.ErrorResponse("username_prefix may only contain letters, digits, underscores and dashes"), nil
+	}
+	if usernamePrefix != "" && len(usernamePrefix)+minUsernameRandomLength > usernameLength {
+		return logical.ErrorResponse(fmt.Sprintf("username_prefix must leave at least %d characters of username_length for random characters", minUsernameRandomLength)), nil
+	}
+
 	// Get our connection
 	db, err := b.DB(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
+	maxUserConnections := data.Get("max_user_connections").(int)
+	if maxUserConnections < 0 {
+		return logical.ErrorResponse("max_user_connections cannot be negative"), nil
+	}
+
 	// Test the query by trying to prepare it
 	sql := data.Get("sql").(string)
+	var hasCreateUser bool
 	for _, query := range strutil.ParseArbitraryStringSlice(sql, ";") {
 		query = strings.TrimSpace(query)
 		if len(query) == 0 {
 			continue
 		}
+		if isCreateUser(query) {
+			hasCreateUser = true
+		}
+		query = applyMaxUserConnections(query, maxUserConnections)
 
 		stmt, err := db.Prepare(Query(query, map[string]string{
 			"name":     "foo",
@@ -158,14 +206,27 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		}
 		stmt.Close()
 	}
+	if maxUserConnections > 0 && !hasCreateUser {
+		return logical.ErrorResponse("max_user_connections requires sql to contain a CREATE USER statement"), nil
+	}
+
+	var revocationStatements []string
+	for _, stmt := range data.Get("revocation_statements").([]string) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			revocationStatements = append(revocationStatements, stmt)
+		}
+	}
 
 	// Store it
 	entry, err := logical.StorageEntryJSON("role/"+name, &roleEntry{
-		SQL:               sql,
-		RevocationSQL:     data.Get("revocation_sql").(string),
-		UsernameLength:    data.Get("username_length").(int),
-		DisplaynameLength: data.Get("displayname_length").(int),
-		RolenameLength:    data.Get("rolename_length").(int),
+		SQL:                  sql,
+		RevocationSQL:        data.Get("revocation_sql").(string),
+		RevocationStatements: revocationStatements,
+		MaxUserConnections:   maxUserConnections,
+		UsernameLength:       usernameLength,
+		DisplaynameLength:    displaynameLength,
+		RolenameLength:       rolenameLength,
+		UsernamePrefix:       usernamePrefix,
 	})
 	if err != nil {
 		return nil, err
@@ -177,11 +238,14 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 }
 
 type roleEntry struct {
-	SQL               string `json:"sql" mapstructure:"sql" structs:"sql"`
-	RevocationSQL     string `json:"revocation_sql" mapstructure:"revocation_sql" structs:"revocation_sql"`
-	UsernameLength    int    `json:"username_length" mapstructure:"username_length" structs:"username_length"`
-	DisplaynameLength int    `json:"displayname_length" mapstructure:"displayname_length" structs:"displayname_length"`
-	RolenameLength    int    `json:"rolename_length" mapstructure:"rolename_length" structs:"rolename_length"`
+	SQL                  string   `json:"sql" mapstructure:"sql" structs:"sql"`
+	RevocationSQL        string   `json:"revocation_sql" mapstructure:"revocation_sql" structs:"revocation_sql"`
+	RevocationStatements []string `json:"revocation_statements" mapstructure:"revocation_statements" structs:"revocation_statements"`
+	MaxUserConnections   int      `json:"max_user_connections" mapstructure:"max_user_connections" structs:"max_user_connections"`
+	UsernameLength       int      `json:"username_length" mapstructure:"username_length" structs:"username_length"`
+	DisplaynameLength    int      `json:"displayname_length" mapstructure:"displayname_length" structs:"displayname_length"`
+	RolenameLength       int      `json:"rolename_length" mapstructure:"rolename_length" structs:"rolename_length"`
+	UsernamePrefix       string   `json:"username_prefix" mapstructure:"username_prefix" structs:"username_prefix"`
 }
 
 const pathRoleHelpSyn = `
@@ -208,6 +272,23 @@ Example of a decent SQL query to use:
 Note the above user would be able to access anything in db1. Please see the MySQL
 manual on the GRANT command to learn how to do more fine grained access.
 
+The "revocation_sql" parameter customizes the SQL string used to revoke a
+user. If it is not set, the user's privileges are revoked before it is
+dropped:
+
+  REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'%';
+  DROP USER '{{name}}'@'%';
+
+The "revocation_statements" parameter takes precedence over "revocation_sql"
+and is a list of SQL statements that are executed in order when a user is
+revoked, for example to revoke grants on specific schemas first. The "name"
+value will be substituted.
+
+The "max_user_connections" parameter limits the number of simultaneous
+connections of generated users. It is applied by adding a
+MAX_USER_CONNECTIONS resource limit to the CREATE USER statement of "sql",
+which requires MySQL 5.7 or later.
+
 The "rolename_length" parameter determines how many characters of the role name
 will be used in creating the generated mysql username; the default is 4.
 
@@ -222,6 +303,11 @@ portion) will be truncated to.  Versions of MySQL prior to 5.7.8 are limited to
 http://dev.mysql.com/doc/refman/5.7/en/user-names.html) so that is the default;
 for versions >=5.7.8 it is safe to increase this to 32.
 
+The "username_prefix" parameter replaces the role name and token display name
+portions of generated usernames, which then consist of the prefix followed by
+the uuid portion, truncated to "username_length". The prefix must leave at
+least 8 characters for the uuid portion.
+
 For best readability in MySQL process lists, we recommend using MySQL 5.7.8 or
 later, setting "username_length" to 32 and setting both "rolename_length" and
 "displayname_length" to 8.  However due the the prevalence of older versions of
@@ -0,0 +1,136 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	stdmysql "github.com/go-sql-driver/mysql"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// rotateRootGracePeriod is how long the connection pool using the old root
+// password is kept open after a rotation, so that requests which already
+// obtained it can finish.
+const rotateRootGracePeriod = time.Minute
+
+func pathRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-root",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootUpdate,
+		},
+
+		HelpSynopsis:    pathRotateRootHelpSyn,
+		HelpDescription: pathRotateRootHelpDesc,
+	}
+}
+
+func (b *backend) pathRotateRootUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+
+	origEntry, err := req.Storage.Get(ctx, "config/connection")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection configuration")
+	}
+	if origEntry == nil {
+		return logical.ErrorResponse("configure the DB connection with config/connection first"), nil
+	}
+
+	var config connectionConfig
+	if err := origEntry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	connURL := config.ConnectionURL
+	if connURL == "" {
+		connURL = config.ConnectionString
+	}
+
+	dsn, err := stdmysql.ParseDSN(connURL)
+	if err != nil {
+		return logical.ErrorResponse("unable to parse connection url"), nil
+	}
+	if dsn.User == "" {
+		return logical.ErrorResponse("connection url does not contain a username"), nil
+	}
+	if dsn.Passwd == "" {
+		return logical.ErrorResponse("connection url does not contain a password"), nil
+	}
+	oldPassword := dsn.Passwd
+
+	password, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	dsn.Passwd = password
+
+	db, err := b.DB(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold the lock until the new configuration is stored so that no
+	// connection is opened with a password that is no longer valid
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// Use a single connection throughout, since a new one could not be
+	// opened while the stored password is out of date
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, setPasswordQuery(password)); err != nil {
+		return nil, fmt.Errorf("failed to change the password of %q: %s", dsn.User, err)
+	}
+
+	config.ConnectionURL = dsn.FormatDSN()
+	config.ConnectionString = ""
+	entry, err := logical.StorageEntryJSON("config/connection", config)
+	if err == nil {
+		err = req.Storage.Put(ctx, entry)
+	}
+	if err != nil {
+		// MySQL cannot roll back ALTER USER, so put the old password back
+		if _, revertErr := conn.ExecContext(ctx, setPasswordQuery(oldPassword)); revertErr != nil {
+			b.Logger().Error("failed to restore the root password after a failed rotation", "error", revertErr)
+		}
+		return nil, err
+	}
+
+	// Connections that are already open stay authenticated; let requests
+	// using the old pool finish before closing it
+	if b.db != nil {
+		oldDB := b.db
+		time.AfterFunc(rotateRootGracePeriod, func() { oldDB.Close() })
+		b.db = nil
+	}
+
+	return nil, nil
+}
+
+// setPasswordQuery returns the statement that changes the password of the
+// connected user.
+func setPasswordQuery(password string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+	return fmt.Sprintf("ALTER USER CURRENT_USER() IDENTIFIED BY '%s'", escaped)
+}
+
+const pathRotateRootHelpSyn = `
+Rotate the password of the user Vault connects to MySQL with.
+`
+
+const pathRotateRootHelpDesc = `
+This path generates a new password for the user in the connection URL, changes
+it in the database using the current connection, and stores the updated
+connection URL. The new password is never returned. The user must be allowed
+to change its own password; this requires MySQL 5.7.6 or MariaDB 10.2 or newer.
+`
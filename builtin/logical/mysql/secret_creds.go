@@ -92,15 +92,16 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 	}
 
 	// Use a default SQL statement for revocation if one cannot be fetched from the role
-	revocationSQL := defaultRevocationSQL
+	revocationStmts := strutil.ParseArbitraryStringSlice(defaultRevocationSQL, ";")
 
-	if role != nil && role.RevocationSQL != "" {
-		revocationSQL = role.RevocationSQL
-	} else {
-		if resp == nil {
-			resp = &logical.Response{}
-		}
+	switch {
+	case role == nil:
+		resp = &logical.Response{}
 		resp.AddWarning(fmt.Sprintf("Role %q cannot be found. Using default SQL for revoking user.", roleName))
+	case len(role.RevocationStatements) > 0:
+		revocationStmts = role.RevocationStatements
+	case role.RevocationSQL != "":
+		revocationStmts = strutil.ParseArbitraryStringSlice(role.RevocationSQL, ";")
 	}
 
 	// Start a transaction
@@ -110,7 +111,7 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 	}
 	defer tx.Rollback()
 
-	for _, query := range strutil.ParseArbitraryStringSlice(revocationSQL, ";") {
+	for _, query := range revocationStmts {
 		query = strings.TrimSpace(query)
 		if len(query) == 0 {
 			continue
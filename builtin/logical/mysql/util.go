@@ -2,7 +2,21 @@ package mysql
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+	"unicode/utf8"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// minUsernameRandomLength is the number of characters of a generated username
+// that must be left for the random suffix when a username prefix is used.
+const minUsernameRandomLength = 8
+
+var (
+	createUserRe         = regexp.MustCompile(`(?i)^\s*CREATE\s+USER\b`)
+	maxUserConnectionsRe = regexp.MustCompile(`(?i)\bMAX_USER_CONNECTIONS\b`)
+	usernamePrefixRe     = regexp.MustCompile(`^[a-zA-Z0-9_-]*$`)
 )
 
 // Query templates a query for us.
@@ -13,3 +27,60 @@ func Query(tpl string, data map[string]string) string {
 
 	return tpl
 }
+
+// isCreateUser returns whether the query is a CREATE USER statement.
+func isCreateUser(query string) bool {
+	return createUserRe.MatchString(query)
+}
+
+// applyMaxUserConnections adds a MAX_USER_CONNECTIONS resource limit to a
+// CREATE USER statement that doesn't already set one. Other statements are
+// returned unchanged.
+func applyMaxUserConnections(query string, maxUserConnections int) string {
+	if maxUserConnections <= 0 || !isCreateUser(query) || maxUserConnectionsRe.MatchString(query) {
+		return query
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	return fmt.Sprintf("%s WITH MAX_USER_CONNECTIONS %d", query, maxUserConnections)
+}
+
+// generateUsername returns a new username for the role. If the role has a
+// username prefix, the name is the prefix followed by a UUID. Otherwise it is
+// a concatenation of:
+//
+// - the role name, truncated to role.RolenameLength
+// - the token display name, truncated to role.DisplaynameLength
+// - a UUID
+//
+// The result is truncated to role.UsernameLength so that MySQL never has to
+// shorten it; revocation relies on the stored name matching the user exactly.
+func generateUsername(role *roleEntry, roleName, displayName string) (string, error) {
+	userUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	var username string
+	if role.UsernamePrefix != "" {
+		username = role.UsernamePrefix + userUUID
+	} else {
+		username = fmt.Sprintf("%s-%s-%s",
+			truncate(roleName, role.RolenameLength),
+			truncate(displayName, role.DisplaynameLength),
+			userUUID)
+	}
+
+	return truncate(username, role.UsernameLength), nil
+}
+
+// truncate shortens s to at most n bytes without splitting a multi-byte
+// character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
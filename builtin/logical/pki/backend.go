@@ -33,6 +33,8 @@ func Backend(conf *logical.BackendConfig) *backend {
 				"ca",
 				"crl/pem",
 				"crl",
+				"ocsp",
+				"ocsp/*",
 			},
 
 			LocalStorage: []string{
@@ -48,6 +50,8 @@ func Backend(conf *logical.BackendConfig) *backend {
 
 			SealWrapStorage: []string{
 				"config/ca_bundle",
+				pendingCABundlePath,
+				"config/ocsp",
 			},
 		},
 
@@ -63,6 +67,7 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathConfigCA(&b),
 			pathConfigCRL(&b),
 			pathConfigURLs(&b),
+			pathConfigOCSP(&b),
 			pathSignVerbatim(&b),
 			pathSign(&b),
 			pathIssue(&b),
@@ -73,8 +78,11 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathFetchCRLViaCertPath(&b),
 			pathFetchValid(&b),
 			pathFetchListCerts(&b),
+			pathOCSP(&b),
+			pathOCSPGet(&b),
 			pathRevoke(&b),
 			pathTidy(&b),
+			pathTidyStatus(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -98,6 +106,35 @@ type backend struct {
 	crlLifetime       time.Duration
 	revokeStorageLock sync.RWMutex
 	tidyCASGuard      *uint32
+
+	tidyStatusLock sync.RWMutex
+	tidyStatus     *tidyStatus
+}
+
+type tidyStatusState int
+
+const (
+	tidyStatusInactive tidyStatusState = iota
+	tidyStatusStarted
+	tidyStatusFinished
+	tidyStatusError
+)
+
+// tidyStatus holds the parameters and the outcome of the last tidy operation
+type tidyStatus struct {
+	// Parameters used to initiate the operation
+	safetyBuffer     int
+	tidyCertStore    bool
+	tidyRevokedCerts bool
+
+	// Status
+	state                   tidyStatusState
+	err                     error
+	timeStarted             time.Time
+	timeFinished            time.Time
+	message                 string
+	certStoreDeletedCount   uint
+	revokedCertDeletedCount uint
 }
 
 const backendHelp = `
@@ -10,6 +10,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
@@ -20,6 +21,7 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -482,6 +484,24 @@ func generateURLSteps(t *testing.T, caCert, caKey string, intdata, reqdata map[s
 			},
 		},
 
+		logicaltest.TestStep{
+			Operation: logical.ReadOperation,
+			Path:      "config/urls",
+			Check: func(resp *logical.Response) error {
+				if resp == nil || resp.Data == nil {
+					return fmt.Errorf("no data returned")
+				}
+				var entries urlEntries
+				if err := mapstructure.Decode(resp.Data, &entries); err != nil {
+					return err
+				}
+				if len(entries.IssuingCertificates) != 0 || len(entries.CRLDistributionPoints) != 0 || len(entries.OCSPServers) != 0 {
+					return fmt.Errorf("expected no urls, got\n%#v\n", entries)
+				}
+				return nil
+			},
+		},
+
 		logicaltest.TestStep{
 			Operation: logical.UpdateOperation,
 			Path:      "config/urls",
@@ -617,6 +637,71 @@ func generateURLSteps(t *testing.T, caCert, caKey string, intdata, reqdata map[s
 				return nil
 			},
 		},
+
+		logicaltest.TestStep{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/test",
+			Data: map[string]interface{}{
+				"allow_any_name": true,
+			},
+		},
+
+		logicaltest.TestStep{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/test",
+			Data: map[string]interface{}{
+				"common_name": "leaf.cert.com",
+			},
+			Check: func(resp *logical.Response) error {
+				parsedBundle, err := certutil.ParsePEMBundle(resp.Data["certificate"].(string))
+				if err != nil {
+					return err
+				}
+				cert := parsedBundle.Certificate
+
+				switch {
+				case !reflect.DeepEqual(expected.IssuingCertificates, cert.IssuingCertificateURL):
+					return fmt.Errorf("expected\n%#v\ngot\n%#v\n", expected.IssuingCertificates, cert.IssuingCertificateURL)
+				case !reflect.DeepEqual(expected.CRLDistributionPoints, cert.CRLDistributionPoints):
+					return fmt.Errorf("expected\n%#v\ngot\n%#v\n", expected.CRLDistributionPoints, cert.CRLDistributionPoints)
+				case !reflect.DeepEqual(expected.OCSPServers, cert.OCSPServer):
+					return fmt.Errorf("expected\n%#v\ngot\n%#v\n", expected.OCSPServers, cert.OCSPServer)
+				}
+
+				return nil
+			},
+		},
+
+		// Empty values remove the extensions from newly issued certificates
+		logicaltest.TestStep{
+			Operation: logical.UpdateOperation,
+			Path:      "config/urls",
+			Data: map[string]interface{}{
+				"issuing_certificates":    "",
+				"crl_distribution_points": []string{},
+				"ocsp_servers":            "",
+			},
+		},
+
+		logicaltest.TestStep{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/test",
+			Data: map[string]interface{}{
+				"common_name": "leaf.cert.com",
+			},
+			Check: func(resp *logical.Response) error {
+				parsedBundle, err := certutil.ParsePEMBundle(resp.Data["certificate"].(string))
+				if err != nil {
+					return err
+				}
+				cert := parsedBundle.Certificate
+				if len(cert.IssuingCertificateURL) != 0 || len(cert.CRLDistributionPoints) != 0 || len(cert.OCSPServer) != 0 {
+					return fmt.Errorf("expected no urls, got %#v, %#v, %#v", cert.IssuingCertificateURL, cert.CRLDistributionPoints, cert.OCSPServer)
+				}
+
+				return nil
+			},
+		},
 	}
 	return ret
 }
@@ -1453,6 +1538,7 @@ func TestBackend_PathFetchCertList(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	rootSerial := resp.Data["serial_number"].(string)
 
 	// config urls
 	urlsData := map[string]interface{}{
@@ -1494,6 +1580,7 @@ func TestBackend_PathFetchCertList(t *testing.T) {
 	}
 
 	// issue some certs
+	serials := []string{rootSerial}
 	i := 1
 	for i < 10 {
 		certData := map[string]interface{}{
@@ -1511,6 +1598,7 @@ func TestBackend_PathFetchCertList(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		serials = append(serials, resp.Data["serial_number"].(string))
 
 		i = i + 1
 	}
@@ -1548,6 +1636,125 @@ func TestBackend_PathFetchCertList(t *testing.T) {
 	if len(resp.Data["keys"].([]string)) != 10 {
 		t.Fatalf("failed to list all 10 certs")
 	}
+
+	// check that serials are listed in the colon-separated form
+	keys := resp.Data["keys"].([]string)
+	sort.Strings(keys)
+	sort.Strings(serials)
+	if !reflect.DeepEqual(keys, serials) {
+		t.Fatalf("bad: expected serials %v, got %v", serials, keys)
+	}
+
+	// and that they can be read back
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/" + keys[0],
+		Storage:   storage,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to read cert, %#v", resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["certificate"] == "" {
+		t.Fatal("expected a certificate")
+	}
+}
+
+func TestBackend_PathFetchCert(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+
+	doReq(logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "40h",
+	})
+	doReq(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+	resp := doReq(logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "test.myvault.com",
+	})
+	serial := resp.Data["serial_number"].(string)
+	certPEM := resp.Data["certificate"].(string)
+	parsedBundle, err := certutil.ParsePEMBundle(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plainHex := strings.Replace(serial, ":", "", -1)
+	for _, s := range []string{
+		serial,
+		strings.ToUpper(serial),
+		strings.Replace(serial, ":", "-", -1),
+		plainHex,
+		strings.ToUpper(plainHex),
+		"00" + plainHex,
+	} {
+		resp = doReq(logical.ReadOperation, "cert/"+s, nil)
+		if resp == nil || resp.Data["certificate"] != certPEM {
+			t.Fatalf("serial %q: bad: %#v", s, resp)
+		}
+		if resp.Data["revocation_time"] != int64(0) {
+			t.Fatalf("serial %q: expected no revocation time, got %v", s, resp.Data["revocation_time"])
+		}
+	}
+
+	resp = doReq(logical.ReadOperation, "cert/"+plainHex, map[string]interface{}{
+		"format": "der",
+	})
+	if resp.Data["certificate"] != base64.StdEncoding.EncodeToString(parsedBundle.CertificateBytes) {
+		t.Fatalf("bad DER certificate: %#v", resp.Data)
+	}
+	if chain, ok := resp.Data["ca_chain"].([]string); !ok || len(chain) != 1 {
+		t.Fatalf("expected a DER CA chain: %#v", resp.Data)
+	} else if _, err := base64.StdEncoding.DecodeString(chain[0]); err != nil {
+		t.Fatalf("expected base64 CA chain: %v", err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "cert/" + serial,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"format": "pkcs7",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unknown format, got resp: %#v, err: %v", resp, err)
+	}
+
+	// Revoked certificates are still returned
+	doReq(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	resp = doReq(logical.ReadOperation, "cert/"+plainHex, nil)
+	if resp == nil || resp.Data["certificate"] != certPEM {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if revocationTime, ok := resp.Data["revocation_time"].(int64); !ok || revocationTime <= 0 {
+		t.Fatalf("expected a revocation time, got %v", resp.Data["revocation_time"])
+	}
+
+	// Unknown serials aren't found
+	if resp = doReq(logical.ReadOperation, "cert/0102030405", nil); resp != nil {
+		t.Fatalf("expected no response for unknown serial, got %#v", resp)
+	}
 }
 
 func TestBackend_SignVerbatim(t *testing.T) {
@@ -1735,6 +1942,231 @@ func TestBackend_SignVerbatim(t *testing.T) {
 	}
 }
 
+func TestBackend_SignVerbatim_CSRValues(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b := Backend(config)
+	err := b.Setup(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parseCert := func(certPEM string) *x509.Certificate {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil {
+			t.Fatal("nil pem block")
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	// The root expires before the default TTL of the backend
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "test.com",
+			"ttl":         "10h",
+		},
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to generate root, %#v", *resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := parseCert(resp.Data["certificate"].(string))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createCSR := func(template *x509.CertificateRequest) string {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr,
+		}))
+	}
+	signVerbatim := func(data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "sign-verbatim",
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	customOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 21, 7}
+	customValue, err := asn1.Marshal("build-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemCSR := createCSR(&x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   "build.example.org",
+			Organization: []string{"Builders"},
+			SerialNumber: "1234",
+		},
+		DNSNames:    []string{"build.example.org", "build"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		ExtraExtensions: []pkix.Extension{
+			{Id: customOID, Value: customValue},
+		},
+	})
+
+	resp, err = signVerbatim(map[string]interface{}{
+		"csr": pemCSR,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to sign-verbatim CSR: %#v", *resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := parseCert(resp.Data["certificate"].(string))
+	if cert.Subject.CommonName != "build.example.org" ||
+		!reflect.DeepEqual(cert.Subject.Organization, []string{"Builders"}) ||
+		cert.Subject.SerialNumber != "1234" {
+		t.Fatalf("subject not taken from CSR: %#v", cert.Subject)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, []string{"build.example.org", "build"}) {
+		t.Fatalf("bad DNS names: %v", cert.DNSNames)
+	}
+	if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("bad IP addresses: %v", cert.IPAddresses)
+	}
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(customOID) && bytes.Equal(ext.Value, customValue) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("extension not taken from CSR")
+	}
+
+	if !reflect.DeepEqual(resp.Data["csr_fields"], []string{"subject", "alt_names", "ip_sans"}) {
+		t.Fatalf("bad csr_fields: %#v", resp.Data["csr_fields"])
+	}
+	if !reflect.DeepEqual(resp.Data["csr_extensions"], []string{"2.5.29.17", customOID.String()}) {
+		t.Fatalf("bad csr_extensions: %#v", resp.Data["csr_extensions"])
+	}
+
+	// The subject fields of a role don't apply to verbatim signing
+	roleResp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/subject",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"organization": "RoleOrg",
+			"ou":           "RoleOU",
+			"country":      "US",
+			"ttl":          "1h",
+		},
+	})
+	if err != nil || (roleResp != nil && roleResp.IsError()) {
+		t.Fatalf("failed to create role: err: %v resp: %#v", err, roleResp)
+	}
+	roleResp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sign-verbatim/subject",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"csr": pemCSR,
+		},
+	})
+	if err != nil || (roleResp != nil && roleResp.IsError()) {
+		t.Fatalf("failed to sign-verbatim CSR with role: err: %v resp: %#v", err, roleResp)
+	}
+	roleCert := parseCert(roleResp.Data["certificate"].(string))
+	if !reflect.DeepEqual(roleCert.Subject.Organization, []string{"Builders"}) ||
+		len(roleCert.Subject.OrganizationalUnit) != 0 || len(roleCert.Subject.Country) != 0 {
+		t.Fatalf("role subject fields applied to verbatim signing: %#v", roleCert.Subject)
+	}
+
+	// The validity is capped to the CA rather than refused
+	if !cert.NotAfter.Equal(caCert.NotAfter) {
+		t.Fatalf("expected notAfter %s to be capped to %s", cert.NotAfter, caCert.NotAfter)
+	}
+	if len(resp.Warnings) == 0 {
+		t.Fatal("expected a warning about the capped validity")
+	}
+
+	// CA certificates are only signed when explicitly allowed
+	caConstraints, err := asn1.Marshal(struct {
+		IsCA       bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}{IsCA: true, MaxPathLen: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCSR := createCSR(&x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName: "intermediate.example.org",
+		},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionBasicConstraints, Value: caConstraints, Critical: true},
+		},
+	})
+
+	resp, err = signVerbatim(map[string]interface{}{
+		"csr": caCSR,
+		"ttl": "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "allow_ca") {
+		t.Fatalf("expected CA CSR to be refused, got %#v", resp)
+	}
+
+	resp, err = signVerbatim(map[string]interface{}{
+		"csr":      caCSR,
+		"ttl":      "1h",
+		"allow_ca": true,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to sign-verbatim CA CSR: %#v", *resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert = parseCert(resp.Data["certificate"].(string))
+	if !cert.IsCA || !cert.BasicConstraintsValid || cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatalf("bad basic constraints: isCA %v, maxPathLen %d, maxPathLenZero %v", cert.IsCA, cert.MaxPathLen, cert.MaxPathLenZero)
+	}
+	if len(resp.Warnings) != 0 {
+		t.Fatalf("unexpected warnings: %v", resp.Warnings)
+	}
+
+	// Without basic constraints the certificate is a leaf
+	resp, err = signVerbatim(map[string]interface{}{
+		"csr":      pemCSR,
+		"ttl":      "1h",
+		"allow_ca": true,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to sign-verbatim CSR: %#v", *resp)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert = parseCert(resp.Data["certificate"].(string)); cert.IsCA {
+		t.Fatal("leaf CSR was signed as a CA certificate")
+	}
+}
+
 func TestBackend_Root_Idempotency(t *testing.T) {
 	coreConfig := &vault.CoreConfig{
 		LogicalBackends: map[string]logical.Factory{
@@ -1835,7 +2267,7 @@ func TestBackend_Root_Idempotency(t *testing.T) {
 	}
 }
 
-func TestBackend_SignIntermediate_AllowedPastCA(t *testing.T) {
+func TestBackend_SignIntermediate_PastCA(t *testing.T) {
 	coreConfig := &vault.CoreConfig{
 		LogicalBackends: map[string]logical.Factory{
 			"pki": Factory,
@@ -1905,30 +2337,462 @@ func TestBackend_SignIntermediate_AllowedPastCA(t *testing.T) {
 		t.Fatal("expected error")
 	}
 
-	_, err = client.Logical().Write("root/sign-verbatim/test", map[string]interface{}{
+	// sign-verbatim caps the validity to that of the root instead
+	resp, err = client.Logical().Write("root/sign-verbatim/test", map[string]interface{}{
 		"common_name": "myint.com",
 		"csr":         csr,
 		"ttl":         "60h",
 	})
-	if err == nil {
-		t.Fatal("expected error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Warnings) == 0 {
+		t.Fatal("expected a warning about the capped validity")
+	}
+	verbatimBundle, err := certutil.ParsePEMBundle(resp.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootBundle, err := certutil.ParsePEMBundle(resp.Data["issuing_ca"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verbatimBundle.Certificate.NotAfter.Equal(rootBundle.Certificate.NotAfter) {
+		t.Fatalf("expected notAfter %s to be capped to %s", verbatimBundle.Certificate.NotAfter, rootBundle.Certificate.NotAfter)
 	}
 
-	resp, err = client.Logical().Write("root/root/sign-intermediate", map[string]interface{}{
+	// Intermediates cannot outlive the root either
+	_, err = client.Logical().Write("root/root/sign-intermediate", map[string]interface{}{
 		"common_name": "myint.com",
 		"csr":         csr,
 		"ttl":         "60h",
 	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	resp, err = client.Logical().Write("root/root/sign-intermediate", map[string]interface{}{
+		"common_name":           "myint.com",
+		"csr":                   csr,
+		"ttl":                   "20h",
+		"max_path_length":       1,
+		"permitted_dns_domains": "myint.com",
+	})
 	if err != nil {
 		t.Fatalf("got error: %v", err)
 	}
 	if resp == nil {
 		t.Fatal("got nil response")
 	}
-	if len(resp.Warnings) == 0 {
-		t.Fatalf("expected warnings, got %#v", *resp)
+	if resp.Data["issuing_ca"] == nil {
+		t.Fatalf("expected the issuing CA, got %#v", resp.Data)
 	}
-}
+
+	block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	if block == nil {
+		t.Fatal("failed to decode certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		t.Fatal("expected a CA certificate")
+	}
+	if cert.MaxPathLen != 1 {
+		t.Fatalf("expected a max path length of 1, got %d", cert.MaxPathLen)
+	}
+	if !reflect.DeepEqual(cert.PermittedDNSDomains, []string{"myint.com"}) {
+		t.Fatalf("bad permitted DNS domains: %v", cert.PermittedDNSDomains)
+	}
+}
+
+func TestBackend_Intermediate_SetSigned(t *testing.T) {
+	rootB, rootStorage := createBackendWithStorage(t)
+	intB, intStorage := createBackendWithStorage(t)
+
+	doReq := func(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+
+	parseCert := func(pemCert string) *x509.Certificate {
+		t.Helper()
+		block, _ := pem.Decode([]byte(pemCert))
+		if block == nil {
+			t.Fatalf("failed to decode certificate: %q", pemCert)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	resp := doReq(rootB, rootStorage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "40h",
+	})
+	rootCert := resp.Data["certificate"].(string)
+
+	// signIntermediate generates a CSR on the intermediate mount, has the
+	// root sign it and returns the signed certificate along with its chain
+	signIntermediate := func(commonName, exported string) string {
+		t.Helper()
+		resp := doReq(intB, intStorage, logical.UpdateOperation, "intermediate/generate/"+exported, map[string]interface{}{
+			"common_name": commonName,
+		})
+		if _, ok := resp.Data["private_key"]; ok != (exported == "exported") {
+			t.Fatalf("unexpected private key presence for %s generation: %#v", exported, resp.Data)
+		}
+		resp = doReq(rootB, rootStorage, logical.UpdateOperation, "root/sign-intermediate", map[string]interface{}{
+			"common_name": commonName,
+			"csr":         resp.Data["csr"],
+			"ttl":         "20h",
+		})
+		return resp.Data["certificate"].(string) + "\n" + resp.Data["issuing_ca"].(string)
+	}
+
+	checkActiveCA := func(commonName string) {
+		t.Helper()
+		resp := doReq(intB, intStorage, logical.ReadOperation, "cert/ca", nil)
+		if cert := parseCert(resp.Data["certificate"].(string)); cert.Subject.CommonName != commonName {
+			t.Fatalf("expected active CA %q, got %q", commonName, cert.Subject.CommonName)
+		}
+
+		// Issued certificates chain to the external root
+		resp = doReq(intB, intStorage, logical.UpdateOperation, "issue/test", map[string]interface{}{
+			"common_name": "foo.example.com",
+		})
+		leaf := parseCert(resp.Data["certificate"].(string))
+		if leaf.Issuer.CommonName != commonName {
+			t.Fatalf("expected certificate issued by %q, got %q", commonName, leaf.Issuer.CommonName)
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(parseCert(rootCert))
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(parseCert(resp.Data["issuing_ca"].(string)))
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates}); err != nil {
+			t.Fatalf("failed to verify issued certificate: %v", err)
+		}
+
+		// The chain holds the intermediate followed by the root
+		resp = doReq(intB, intStorage, logical.ReadOperation, "cert/ca_chain", nil)
+		chain := resp.Data["certificate"].(string)
+		if n := strings.Count(chain, "BEGIN CERTIFICATE"); n != 2 {
+			t.Fatalf("expected 2 certificates in the CA chain, got %d", n)
+		}
+		if !strings.Contains(chain, strings.TrimSpace(rootCert)) {
+			t.Fatal("expected the CA chain to contain the root certificate")
+		}
+	}
+
+	doReq(intB, intStorage, logical.UpdateOperation, "intermediate/set-signed", map[string]interface{}{
+		"certificate": signIntermediate("int1.example.com", "internal"),
+	})
+	doReq(intB, intStorage, logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+	checkActiveCA("int1.example.com")
+
+	// Generating a new CSR leaves the active CA in place until the signed
+	// certificate is set
+	signed := signIntermediate("int2.example.com", "exported")
+	checkActiveCA("int1.example.com")
+
+	doReq(intB, intStorage, logical.UpdateOperation, "intermediate/set-signed", map[string]interface{}{
+		"certificate": signed,
+	})
+	checkActiveCA("int2.example.com")
+
+	entry, err := intStorage.Get(context.Background(), pendingCABundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatal("expected the pending key to be removed once the certificate is set")
+	}
+}
+
+func TestBackend_IssueCAChain(t *testing.T) {
+	rootB, rootStorage := createBackendWithStorage(t)
+	intB, intStorage := createBackendWithStorage(t)
+
+	doReq := func(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+
+	checkChain := func(resp *logical.Response, expected ...string) {
+		t.Helper()
+		chain, ok := resp.Data["ca_chain"].([]string)
+		if !ok {
+			t.Fatalf("expected a CA chain: %#v", resp.Data)
+		}
+		for i := range expected {
+			expected[i] = strings.TrimSpace(expected[i])
+		}
+		if !reflect.DeepEqual(chain, expected) {
+			t.Fatalf("bad CA chain: expected %q, got %q", expected, chain)
+		}
+		if resp.Data["issuing_ca"] != nil && resp.Data["issuing_ca"] != chain[0] {
+			t.Fatalf("expected the chain to start with the issuing CA")
+		}
+	}
+
+	resp := doReq(rootB, rootStorage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "40h",
+	})
+	rootCert := resp.Data["certificate"].(string)
+
+	resp = doReq(intB, intStorage, logical.UpdateOperation, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int.example.com",
+	})
+	resp = doReq(rootB, rootStorage, logical.UpdateOperation, "root/sign-intermediate", map[string]interface{}{
+		"common_name": "int.example.com",
+		"csr":         resp.Data["csr"],
+		"ttl":         "20h",
+	})
+	intCert := resp.Data["certificate"].(string)
+	doReq(intB, intStorage, logical.UpdateOperation, "intermediate/set-signed", map[string]interface{}{
+		"certificate": intCert + "\n" + rootCert,
+	})
+
+	roleData := map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	}
+	doReq(rootB, rootStorage, logical.UpdateOperation, "roles/test", roleData)
+	doReq(intB, intStorage, logical.UpdateOperation, "roles/test", roleData)
+
+	// Certificates issued by a root carry the root as their chain
+	resp = doReq(rootB, rootStorage, logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.com",
+	})
+	checkChain(resp, rootCert)
+	resp = doReq(rootB, rootStorage, logical.ReadOperation, "cert/"+resp.Data["serial_number"].(string), nil)
+	checkChain(resp, rootCert)
+
+	// Certificates issued by an intermediate carry it followed by the root
+	resp = doReq(intB, intStorage, logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.com",
+	})
+	checkChain(resp, intCert, rootCert)
+	serial := resp.Data["serial_number"].(string)
+
+	resp = doReq(intB, intStorage, logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.com",
+		"format":      "pem_bundle",
+	})
+	checkChain(resp, intCert, rootCert)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "bar.example.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = doReq(intB, intStorage, logical.UpdateOperation, "sign/test", map[string]interface{}{
+		"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	})
+	checkChain(resp, intCert, rootCert)
+
+	resp = doReq(intB, intStorage, logical.ReadOperation, "cert/"+serial, nil)
+	checkChain(resp, intCert, rootCert)
+
+	// The DER format returns the chain base64 encoded
+	resp = doReq(intB, intStorage, logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.com",
+		"format":      "der",
+	})
+	chain := resp.Data["ca_chain"].([]string)
+	if len(chain) != 2 || chain[0] != resp.Data["issuing_ca"] {
+		t.Fatalf("bad CA chain: %q", chain)
+	}
+
+	// The CA itself is returned without a chain
+	resp = doReq(intB, intStorage, logical.ReadOperation, "cert/ca", nil)
+	if _, ok := resp.Data["ca_chain"]; ok {
+		t.Fatalf("unexpected CA chain for the CA certificate: %#v", resp.Data)
+	}
+}
+
+func TestBackend_IntermediateConstraints(t *testing.T) {
+	rootB, rootStorage := createBackendWithStorage(t)
+	intB, intStorage := createBackendWithStorage(t)
+
+	doReq := func(b *backend, s logical.Storage, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+	mustReq := func(b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := doReq(b, s, path, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+	expectError := func(b *backend, s logical.Storage, path string, data map[string]interface{}, contains string) {
+		t.Helper()
+		resp, err := doReq(b, s, path, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), contains) {
+			t.Fatalf("%s: expected error containing %q, got: %#v", path, contains, resp)
+		}
+	}
+
+	resp := mustReq(rootB, rootStorage, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.example.com",
+		"ttl":         "40h",
+	})
+	rootCert := resp.Data["certificate"].(string)
+
+	// The constraints are requested in the CSR
+	resp = mustReq(intB, intStorage, "intermediate/generate/internal", map[string]interface{}{
+		"common_name":           "int.example.com",
+		"max_path_length":       1,
+		"permitted_dns_domains": "example.com",
+		"excluded_dns_domains":  "bad.example.com",
+	})
+	csrPEM := resp.Data["csr"].(string)
+	block, _ := pem.Decode([]byte(csrPEM))
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isCA, maxPathLen, err := csrBasicConstraints(csr); err != nil || !isCA || maxPathLen != 1 {
+		t.Fatalf("bad CSR basic constraints: %t, %d, %v", isCA, maxPathLen, err)
+	}
+	permitted, excluded, err := csrNameConstraints(csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(permitted, []string{"example.com"}) || !reflect.DeepEqual(excluded, []string{"bad.example.com"}) {
+		t.Fatalf("bad CSR name constraints: %q, %q", permitted, excluded)
+	}
+
+	// The stricter constraints of the CSR win over those given to the root
+	resp = mustReq(rootB, rootStorage, "root/sign-intermediate", map[string]interface{}{
+		"common_name":          "int.example.com",
+		"csr":                  csrPEM,
+		"ttl":                  "20h",
+		"max_path_length":      3,
+		"excluded_dns_domains": "worse.example.com",
+	})
+	intCert := resp.Data["certificate"].(string)
+	parsedBundle, err := certutil.ParsePEMBundle(intCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := parsedBundle.Certificate
+	switch {
+	case cert.MaxPathLen != 1:
+		t.Fatalf("expected max path length of 1, got %d", cert.MaxPathLen)
+	case !reflect.DeepEqual(cert.PermittedDNSDomains, []string{"example.com"}):
+		t.Fatalf("bad permitted DNS domains %q", cert.PermittedDNSDomains)
+	case !reflect.DeepEqual(cert.ExcludedDNSDomains, []string{"bad.example.com", "worse.example.com"}):
+		t.Fatalf("bad excluded DNS domains %q", cert.ExcludedDNSDomains)
+	case !cert.PermittedDNSDomainsCritical:
+		t.Fatal("expected name constraints to be critical")
+	}
+
+	mustReq(intB, intStorage, "intermediate/set-signed", map[string]interface{}{
+		"certificate": intCert + "\n" + rootCert,
+	})
+	mustReq(intB, intStorage, "roles/test", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "1h",
+	})
+
+	// Names outside of the constraints are refused before signing
+	mustReq(intB, intStorage, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.com",
+	})
+	expectError(intB, intStorage, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.org",
+	}, "not permitted")
+	expectError(intB, intStorage, "issue/test", map[string]interface{}{
+		"common_name": "foo.example.com",
+		"alt_names":   "foo.bad.example.com",
+	}, "excluded")
+
+	// Sub-CAs must have a shorter path length than the intermediate
+	subKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subCSR, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "sub.example.com"},
+	}, subKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subCSRPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: subCSR}))
+	expectError(intB, intStorage, "root/sign-intermediate", map[string]interface{}{
+		"common_name":     "sub.example.com",
+		"csr":             subCSRPEM,
+		"ttl":             "1h",
+		"max_path_length": 1,
+	}, "max path length of 1")
+	resp = mustReq(intB, intStorage, "root/sign-intermediate", map[string]interface{}{
+		"common_name": "sub.example.com",
+		"csr":         subCSRPEM,
+		"ttl":         "1h",
+	})
+	parsedBundle, err = certutil.ParsePEMBundle(resp.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedBundle.Certificate.MaxPathLen != 0 || !parsedBundle.Certificate.MaxPathLenZero {
+		t.Fatalf("expected max path length of 0, got %d", parsedBundle.Certificate.MaxPathLen)
+	}
+
+	// Without a requested path length the longest one allowed is used
+	resp = mustReq(intB, intStorage, "root/sign-intermediate", map[string]interface{}{
+		"common_name":     "sub.example.com",
+		"csr":             subCSRPEM,
+		"ttl":             "1h",
+		"max_path_length": -1,
+	})
+	parsedBundle, err = certutil.ParsePEMBundle(resp.Data["certificate"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedBundle.Certificate.MaxPathLen != 0 || !parsedBundle.Certificate.MaxPathLenZero {
+		t.Fatalf("expected max path length of 0, got %d", parsedBundle.Certificate.MaxPathLen)
+	}
+}
 
 func TestBackend_SignSelfIssued(t *testing.T) {
 	// create the backend
@@ -2568,7 +3432,252 @@ func TestBackend_URI_SANs(t *testing.T) {
 			"expected URIs SANs %v to equal provided values spiffe://host.com/something, http://someuri/abc",
 			cert.URIs)
 	}
+
+	// Roles that don't set allowed_uri_sans don't allow any
+	_, err = client.Logical().Write("root/roles/nouris", map[string]interface{}{
+		"allowed_domains":  []string{"foobar.com"},
+		"allow_subdomains": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Logical().Write("root/issue/nouris", map[string]interface{}{
+		"common_name": "foo.foobar.com",
+		"uri_sans":    "spiffe://host.com/something",
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Signing takes the URIs from the CSR, or from the API when the role
+	// doesn't use the SANs of the CSR
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createCSR := func(uri string) string {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "foobar.com"},
+			URIs:    []*url.URL{parsed},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	}
+	signedURIs := func(path string, data map[string]interface{}) []string {
+		resp, err := client.Logical().Write(path, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var uris []string
+		for _, uri := range cert.URIs {
+			uris = append(uris, uri.String())
+		}
+		return uris
+	}
+
+	uris := signedURIs("root/sign/test", map[string]interface{}{
+		"csr": createCSR("spiffe://host.com/fromcsr"),
+	})
+	if !reflect.DeepEqual(uris, []string{"spiffe://host.com/fromcsr"}) {
+		t.Fatalf("bad URIs: %v", uris)
+	}
+	_, err = client.Logical().Write("root/sign/test", map[string]interface{}{
+		"csr": createCSR("spiffe://other.com/fromcsr"),
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	_, err = client.Logical().Write("root/roles/api", map[string]interface{}{
+		"allowed_domains":    []string{"foobar.com"},
+		"allow_bare_domains": true,
+		"allowed_uri_sans":   []string{"spiffe://host.com/*"},
+		"use_csr_sans":       false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uris = signedURIs("root/sign/api", map[string]interface{}{
+		"csr":      createCSR("spiffe://other.com/fromcsr"),
+		"uri_sans": "spiffe://host.com/fromapi",
+	})
+	if !reflect.DeepEqual(uris, []string{"spiffe://host.com/fromapi"}) {
+		t.Fatalf("bad URIs: %v", uris)
+	}
+}
+
+func TestBackend_IP_SANs(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	var err error
+	err = client.Sys().Mount("root", &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: "16h",
+			MaxLeaseTTL:     "60h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("root/root/generate/internal", map[string]interface{}{
+		"ttl":         "40h",
+		"common_name": "myvault.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, role := range []string{"allowed", "denied"} {
+		_, err = client.Logical().Write("root/roles/"+role, map[string]interface{}{
+			"allowed_domains":  "foobar.com",
+			"allow_subdomains": true,
+			"allow_ip_sans":    role == "allowed",
+			"key_type":         "ec",
+			"key_bits":         256,
+			"use_csr_sans":     false,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "foo.foobar.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPem := strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csr,
+	})))
+
+	expected := []net.IP{
+		net.ParseIP("10.0.0.1").To4(),
+		net.ParseIP("2001:db8::1"),
+	}
+
+	for _, path := range []string{"issue", "sign"} {
+		data := map[string]interface{}{
+			"common_name": "foo.foobar.com",
+			"ip_sans":     "10.0.0.1, 2001:db8::1",
+		}
+		if path == "sign" {
+			data["csr"] = csrPem
+		}
+
+		resp, err := client.Logical().Write("root/"+path+"/allowed", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// IPv4 addresses must be encoded in 4 bytes and IPv6 addresses in 16
+		if !reflect.DeepEqual(cert.IPAddresses, expected) {
+			t.Fatalf("%s: expected IP SANs %v, got %#v", path, expected, cert.IPAddresses)
+		}
+
+		_, err = client.Logical().Write("root/"+path+"/denied", data)
+		if err == nil || !strings.Contains(err.Error(), "IP Subject Alternative Names are not allowed") {
+			t.Fatalf("%s: expected error for role not allowing IP SANs, got %v", path, err)
+		}
+
+		for _, invalid := range []string{"10.0.0.256", "2001:db8::g", "foobar.com"} {
+			data["ip_sans"] = invalid
+			_, err = client.Logical().Write("root/"+path+"/allowed", data)
+			if err == nil || !strings.Contains(err.Error(), "is not a valid IP address") {
+				t.Fatalf("%s: expected error for IP SAN %q, got %v", path, invalid, err)
+			}
+		}
+	}
+
+	// IP SANs requested in the CSR are subject to the same role flag
+	_, err = client.Logical().Write("root/roles/csr", map[string]interface{}{
+		"allowed_domains":  "foobar.com",
+		"allow_subdomains": true,
+		"allow_ip_sans":    true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"use_csr_sans":     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: "foo.foobar.com"},
+		IPAddresses: expected,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPem = strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csr,
+	})))
+	resp, err := client.Logical().Write("root/sign/csr", map[string]interface{}{
+		"csr": csrPem,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert.IPAddresses, expected) {
+		t.Fatalf("expected IP SANs %v from CSR, got %#v", expected, cert.IPAddresses)
+	}
+
+	_, err = client.Logical().Write("root/roles/csr", map[string]interface{}{
+		"allowed_domains":  "foobar.com",
+		"allow_subdomains": true,
+		"allow_ip_sans":    false,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"use_csr_sans":     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Logical().Write("root/sign/csr", map[string]interface{}{
+		"csr": csrPem,
+	})
+	if err == nil || !strings.Contains(err.Error(), "IP Subject Alternative Names are not allowed") {
+		t.Fatalf("expected error for CSR IP SANs, got %v", err)
+	}
 }
+
 func setCerts() {
 	cak, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -48,6 +48,10 @@ func (b *backend) getGenerationParams(
 		PostalCode:           data.Get("postal_code").([]string),
 	}
 
+	if _, ok := data.GetOk("key_bits"); !ok {
+		role.KeyBits = defaultKeyBits(role.KeyType)
+	}
+
 	if role.KeyType == "rsa" && role.KeyBits < 2048 {
 		errorResp = logical.ErrorResponse("RSA keys < 2048 bits are unsafe and not supported")
 		return
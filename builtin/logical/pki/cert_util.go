@@ -59,6 +59,10 @@ type dataBundle struct {
 	role          *roleEntry
 	req           *logical.Request
 	apiData       *framework.FieldData
+
+	// capToCA caps the validity of the certificate to that of the CA
+	// instead of refusing to issue it
+	capToCA bool
 }
 
 type creationParameters struct {
@@ -81,6 +85,7 @@ type creationParameters struct {
 	// Only used when signing a CA cert
 	UseCSRValues        bool
 	PermittedDNSDomains []string
+	ExcludedDNSDomains  []string
 
 	// URLs to encode into the certificate
 	URLs *urlEntries
@@ -118,6 +123,34 @@ func (b *caInfoBundle) GetCAChain() []*certutil.CertBlock {
 	return chain
 }
 
+// issuerChain returns the chain of certificates issued by the CA, ordered
+// from the CA upward. Unlike GetCAChain, it includes a self-signed CA.
+func (b *caInfoBundle) issuerChain() []*certutil.CertBlock {
+	chain := b.GetCAChain()
+	if len(chain) == 0 {
+		chain = append(chain, &certutil.CertBlock{
+			Certificate: b.Certificate,
+			Bytes:       b.CertificateBytes,
+		})
+	}
+
+	return chain
+}
+
+// pemChain encodes each certificate of the chain in PEM format
+func pemChain(chain []*certutil.CertBlock) []string {
+	var result []string
+	for _, cert := range chain {
+		block := pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Bytes,
+		}
+		result = append(result, strings.TrimSpace(string(pem.EncodeToMemory(&block))))
+	}
+
+	return result
+}
+
 var (
 	// A note on hostnameRegex: although we set the StrictDomainName option
 	// when doing the idna conversion, this appears to only affect output, not
@@ -125,6 +158,7 @@ var (
 	// we still need to use this to check the output.
 	hostnameRegex                = regexp.MustCompile(`^(\*\.)?(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]*[a-zA-Z0-9])\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\-]*[A-Za-z0-9])$`)
 	oidExtensionBasicConstraints = []int{2, 5, 29, 19}
+	oidExtensionNameConstraints  = []int{2, 5, 29, 30}
 )
 
 func oidInExtensions(oid asn1.ObjectIdentifier, extensions []pkix.Extension) bool {
@@ -178,6 +212,15 @@ func validateKeyTypeLength(keyType string, keyBits int) *logical.Response {
 	return nil
 }
 
+// defaultKeyBits returns the number of bits used for keys of the given type
+// when none is specified
+func defaultKeyBits(keyType string) int {
+	if keyType == "ec" {
+		return 256
+	}
+	return 2048
+}
+
 // Fetches the CA info. Unlike other certificates, the CA info is stored
 // in the backend as a CertBundle, because we are storing its private key
 func fetchCAInfo(ctx context.Context, req *logical.Request) (*caInfoBundle, error) {
@@ -442,9 +485,12 @@ func validateNames(data *dataBundle, names []string) string {
 					}
 				}
 
+				// A wildcard certificate is valid for the subdomains of its
+				// base domain, so it needs subdomains to be allowed as well
 				if data.role.AllowGlobDomains &&
 					strings.Contains(currDomain, "*") &&
-					glob.Glob(currDomain, name) {
+					(!isWildcard || data.role.AllowSubdomains) &&
+					matchGlobDomain(currDomain, sanitizedName, data.role.AllowSubdomains) {
 					valid = true
 					break
 				}
@@ -460,6 +506,55 @@ func validateNames(data *dataBundle, names []string) string {
 	return ""
 }
 
+// matchGlobDomain returns whether the host name matches the allowed domain
+// glob. A "*" only matches within a single label, so a glob never matches the
+// subdomains of the names it allows unless allowSubdomains is set.
+func matchGlobDomain(pattern, host string, allowSubdomains bool) bool {
+	// Literal asterisks in the requested name must not be matched by the
+	// glob, as they would turn the name into a wildcard
+	if strings.Contains(host, "*") {
+		return false
+	}
+
+	patternLabels := strings.Split(pattern, ".")
+	hostLabels := strings.Split(host, ".")
+	switch {
+	case len(hostLabels) < len(patternLabels):
+		return false
+	case len(hostLabels) > len(patternLabels):
+		if !allowSubdomains {
+			return false
+		}
+	}
+
+	for _, label := range hostLabels {
+		if label == "" {
+			return false
+		}
+	}
+
+	hostLabels = hostLabels[len(hostLabels)-len(patternLabels):]
+	for i, label := range patternLabels {
+		if !glob.Glob(label, hostLabels[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isWildcardOnlyGlob returns whether the allowed domain glob consists of
+// nothing but wildcards, such as "*" or "*.*", and would therefore allow any
+// name
+func isWildcardOnlyGlob(pattern string) bool {
+	for _, label := range strings.Split(pattern, ".") {
+		if strings.Trim(label, "*") != "" {
+			return false
+		}
+	}
+	return true
+}
+
 // validateOtherSANs checks if the values requested are allowed. If an OID
 // isn't allowed, it will be returned as the first string. If a value isn't
 // allowed, it will be returned as the second string. Empty strings + error
@@ -569,6 +664,7 @@ func generateCert(ctx context.Context,
 	if isCA {
 		data.params.IsCA = isCA
 		data.params.PermittedDNSDomains = data.apiData.Get("permitted_dns_domains").([]string)
+		data.params.ExcludedDNSDomains = data.apiData.Get("excluded_dns_domains").([]string)
 
 		if data.signingBundle == nil {
 			// Generating a self-signed root certificate
@@ -644,14 +740,10 @@ func signCert(b *backend,
 		return nil, errutil.UserError{Err: fmt.Sprintf("certificate request could not be parsed: %v", err)}
 	}
 
-	switch data.role.KeyType {
-	case "rsa":
-		// Verify that the key matches the role type
-		if csr.PublicKeyAlgorithm != x509.RSA {
-			return nil, errutil.UserError{Err: fmt.Sprintf(
-				"role requires keys of type %s",
-				data.role.KeyType)}
-		}
+	// The key of a CSR already exists, so its type is not constrained by the
+	// role; the key size of the role only applies to keys of the same type
+	switch csr.PublicKeyAlgorithm {
+	case x509.RSA:
 		pubKey, ok := csr.PublicKey.(*rsa.PublicKey)
 		if !ok {
 			return nil, errutil.UserError{Err: "could not parse CSR's public key"}
@@ -663,49 +755,26 @@ func signCert(b *backend,
 		}
 
 		// Verify that the bit size is at least the size specified in the role
-		if pubKey.N.BitLen() < data.role.KeyBits {
+		if data.role.KeyType == "rsa" && pubKey.N.BitLen() < data.role.KeyBits {
 			return nil, errutil.UserError{Err: fmt.Sprintf(
 				"role requires a minimum of a %d-bit key, but CSR's key is %d bits",
 				data.role.KeyBits,
 				pubKey.N.BitLen())}
 		}
 
-	case "ec":
-		// Verify that the key matches the role type
-		if csr.PublicKeyAlgorithm != x509.ECDSA {
-			return nil, errutil.UserError{Err: fmt.Sprintf(
-				"role requires keys of type %s",
-				data.role.KeyType)}
-		}
+	case x509.ECDSA:
 		pubKey, ok := csr.PublicKey.(*ecdsa.PublicKey)
 		if !ok {
 			return nil, errutil.UserError{Err: "could not parse CSR's public key"}
 		}
 
 		// Verify that the bit size is at least the size specified in the role
-		if pubKey.Params().BitSize < data.role.KeyBits {
+		if data.role.KeyType == "ec" && pubKey.Params().BitSize < data.role.KeyBits {
 			return nil, errutil.UserError{Err: fmt.Sprintf(
 				"role requires a minimum of a %d-bit key, but CSR's key is %d bits",
 				data.role.KeyBits,
 				pubKey.Params().BitSize)}
 		}
-
-	case "any":
-		// We only care about running RSA < 2048 bit checks, so if not RSA
-		// break out
-		if csr.PublicKeyAlgorithm != x509.RSA {
-			break
-		}
-
-		// Run RSA < 2048 bit checks
-		pubKey, ok := csr.PublicKey.(*rsa.PublicKey)
-		if !ok {
-			return nil, errutil.UserError{Err: "could not parse CSR's public key"}
-		}
-		if pubKey.N.BitLen() < 2048 {
-			return nil, errutil.UserError{Err: "RSA keys < 2048 bits are unsafe and not supported"}
-		}
-
 	}
 
 	data.csr = csr
@@ -723,6 +792,28 @@ func signCert(b *backend,
 
 	if isCA {
 		data.params.PermittedDNSDomains = data.apiData.Get("permitted_dns_domains").([]string)
+		data.params.ExcludedDNSDomains = data.apiData.Get("excluded_dns_domains").([]string)
+	}
+
+	// A CSR signed verbatim may only request a CA certificate when this has
+	// been explicitly allowed
+	if useCSRValues && !isCA {
+		csrIsCA, _, err := csrBasicConstraints(csr)
+		if err != nil {
+			return nil, err
+		}
+		if csrIsCA {
+			if !data.apiData.Get("allow_ca").(bool) {
+				return nil, errutil.UserError{Err: "the CSR requests a CA certificate, which requires \"allow_ca\" to be set"}
+			}
+			data.params.IsCA = true
+		}
+	}
+
+	if data.params.IsCA {
+		if err := applyCSRConstraints(data.params, csr); err != nil {
+			return nil, err
+		}
 	}
 
 	parsedBundle, err := signCertificate(data)
@@ -733,6 +824,144 @@ func signCert(b *backend,
 	return parsedBundle, nil
 }
 
+// csrBasicConstraints returns whether the CSR requests a CA certificate, and
+// the maximum path length it requests, or -1 if it sets none
+func csrBasicConstraints(csr *x509.CertificateRequest) (bool, int, error) {
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidExtensionBasicConstraints) {
+			continue
+		}
+		var constraints struct {
+			IsCA       bool `asn1:"optional"`
+			MaxPathLen int  `asn1:"optional,default:-1"`
+		}
+		if _, err := asn1.Unmarshal(ext.Value, &constraints); err != nil {
+			return false, 0, errutil.UserError{Err: fmt.Sprintf("basic constraints of the CSR could not be parsed: %v", err)}
+		}
+		if !constraints.IsCA {
+			return false, -1, nil
+		}
+		return true, constraints.MaxPathLen, nil
+	}
+
+	return false, -1, nil
+}
+
+// nameConstraints is the ASN.1 structure of the name constraints extension,
+// limited to DNS names
+type nameConstraints struct {
+	Permitted []generalSubtree `asn1:"optional,tag:0"`
+	Excluded  []generalSubtree `asn1:"optional,tag:1"`
+}
+
+type generalSubtree struct {
+	Name string `asn1:"tag:2,optional,ia5"`
+}
+
+// csrNameConstraints returns the DNS domains permitted and excluded by the
+// name constraints requested in the CSR, if any
+func csrNameConstraints(csr *x509.CertificateRequest) ([]string, []string, error) {
+	for _, ext := range csr.Extensions {
+		if !ext.Id.Equal(oidExtensionNameConstraints) {
+			continue
+		}
+		var constraints nameConstraints
+		if _, err := asn1.Unmarshal(ext.Value, &constraints); err != nil {
+			return nil, nil, errutil.UserError{Err: fmt.Sprintf("name constraints of the CSR could not be parsed: %v", err)}
+		}
+		var permitted, excluded []string
+		for _, subtree := range constraints.Permitted {
+			if subtree.Name != "" {
+				permitted = append(permitted, subtree.Name)
+			}
+		}
+		for _, subtree := range constraints.Excluded {
+			if subtree.Name != "" {
+				excluded = append(excluded, subtree.Name)
+			}
+		}
+		return permitted, excluded, nil
+	}
+
+	return nil, nil, nil
+}
+
+// applyCSRConstraints keeps the path length and name constraints requested in
+// the CSR of a CA certificate where they are stricter than the ones given to
+// the endpoint
+func applyCSRConstraints(params *creationParameters, csr *x509.CertificateRequest) error {
+	_, csrMaxPathLen, err := csrBasicConstraints(csr)
+	if err != nil {
+		return err
+	}
+	if csrMaxPathLen >= 0 && (params.MaxPathLength < 0 || csrMaxPathLen < params.MaxPathLength) {
+		params.MaxPathLength = csrMaxPathLen
+	}
+
+	csrPermitted, csrExcluded, err := csrNameConstraints(csr)
+	if err != nil {
+		return err
+	}
+	if len(params.PermittedDNSDomains) == 0 {
+		params.PermittedDNSDomains = csrPermitted
+	}
+	if len(csrExcluded) > 0 {
+		params.ExcludedDNSDomains = strutil.RemoveDuplicates(append(params.ExcludedDNSDomains, csrExcluded...), false)
+	}
+
+	return nil
+}
+
+// dnsNameMatchesConstraint reports whether the DNS name falls within the
+// domain of a name constraint; a constraint starting with a period only
+// matches subdomains
+func dnsNameMatchesConstraint(name, constraint string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// checkNameConstraints makes sure the DNS names of the certificate are allowed
+// by the name constraints of the issuing CA, as clients would reject the
+// certificate otherwise
+func checkNameConstraints(caCert *x509.Certificate, template *x509.Certificate) error {
+	if len(caCert.PermittedDNSDomains) == 0 && len(caCert.ExcludedDNSDomains) == 0 {
+		return nil
+	}
+
+	names := template.DNSNames
+	cn := template.Subject.CommonName
+	if hostnameRegex.MatchString(cn) && !strutil.StrListContains(names, cn) {
+		names = append([]string{cn}, names...)
+	}
+
+	for _, name := range names {
+		for _, excluded := range caCert.ExcludedDNSDomains {
+			if dnsNameMatchesConstraint(name, excluded) {
+				return errutil.UserError{Err: fmt.Sprintf("DNS name %q is excluded by the name constraints of the CA certificate (excluded: %s)", name, strings.Join(caCert.ExcludedDNSDomains, ", "))}
+			}
+		}
+		if len(caCert.PermittedDNSDomains) == 0 {
+			continue
+		}
+		permitted := false
+		for _, domain := range caCert.PermittedDNSDomains {
+			if dnsNameMatchesConstraint(name, domain) {
+				permitted = true
+				break
+			}
+		}
+		if !permitted {
+			return errutil.UserError{Err: fmt.Sprintf("DNS name %q is not permitted by the name constraints of the CA certificate (permitted: %s)", name, strings.Join(caCert.PermittedDNSDomains, ", "))}
+		}
+	}
+
+	return nil
+}
+
 // generateCreationBundle is a shared function that reads parameters supplied
 // from the various endpoints and generates a creationParameters with the
 // parameters that can be used to issue or sign
@@ -950,7 +1179,7 @@ func generateCreationBundle(b *backend, data *dataBundle) error {
 
 					if !valid {
 						return errutil.UserError{Err: fmt.Sprintf(
-							"URI Subject Alternative Names were provided via CSR which are not valid for this role"),
+							"URI Subject Alternative Names were provided via the API which are not valid for this role"),
 						}
 					}
 
@@ -1011,8 +1240,11 @@ func generateCreationBundle(b *backend, data *dataBundle) error {
 		if data.signingBundle != nil &&
 			notAfter.After(data.signingBundle.Certificate.NotAfter) && !data.role.AllowExpirationPastCA {
 
-			return errutil.UserError{Err: fmt.Sprintf(
-				"cannot satisfy request, as TTL would result in notAfter %s that is beyond the expiration of the CA certificate at %s", notAfter.Format(time.RFC3339Nano), data.signingBundle.Certificate.NotAfter.Format(time.RFC3339Nano))}
+			if !data.capToCA {
+				return errutil.UserError{Err: fmt.Sprintf(
+					"cannot satisfy request, as TTL would result in notAfter %s that is beyond the expiration of the CA certificate at %s", notAfter.Format(time.RFC3339Nano), data.signingBundle.Certificate.NotAfter.Format(time.RFC3339Nano))}
+			}
+			notAfter = data.signingBundle.Certificate.NotAfter
 		}
 	}
 
@@ -1205,8 +1437,9 @@ func createCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 	}
 
 	// This will only be filled in from the generation paths
-	if len(data.params.PermittedDNSDomains) > 0 {
+	if len(data.params.PermittedDNSDomains) > 0 || len(data.params.ExcludedDNSDomains) > 0 {
 		certTemplate.PermittedDNSDomains = data.params.PermittedDNSDomains
+		certTemplate.ExcludedDNSDomains = data.params.ExcludedDNSDomains
 		certTemplate.PermittedDNSDomainsCritical = true
 	}
 
@@ -1232,6 +1465,10 @@ func createCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		caCert := data.signingBundle.Certificate
 		certTemplate.AuthorityKeyId = caCert.SubjectKeyId
 
+		if err := checkNameConstraints(caCert, certTemplate); err != nil {
+			return nil, err
+		}
+
 		certBytes, err = x509.CreateCertificate(rand.Reader, certTemplate, caCert, result.PrivateKey.Public(), data.signingBundle.PrivateKey)
 	} else {
 		// Creating a self-signed root
@@ -1306,12 +1543,24 @@ func createCSR(data *dataBundle) (*certutil.ParsedCSRBundle, error) {
 		return nil, errutil.InternalError{Err: errwrap.Wrapf("error marshaling other SANs: {{err}}", err).Error()}
 	}
 
-	if data.apiData != nil && data.apiData.Get("add_basic_constraints").(bool) {
+	maxPathLength := -1
+	var permittedDNSDomains, excludedDNSDomains []string
+	if data.apiData != nil {
+		maxPathLength = data.apiData.Get("max_path_length").(int)
+		permittedDNSDomains = data.apiData.Get("permitted_dns_domains").([]string)
+		excludedDNSDomains = data.apiData.Get("excluded_dns_domains").([]string)
+	}
+
+	// A requested path length can only be carried in basic constraints
+	if data.apiData != nil && (data.apiData.Get("add_basic_constraints").(bool) || maxPathLength >= 0) {
 		type basicConstraints struct {
 			IsCA       bool `asn1:"optional"`
 			MaxPathLen int  `asn1:"optional,default:-1"`
 		}
-		val, err := asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: -1})
+		if maxPathLength < 0 {
+			maxPathLength = -1
+		}
+		val, err := asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: maxPathLength})
 		if err != nil {
 			return nil, errutil.InternalError{Err: errwrap.Wrapf("error marshaling basic constraints: {{err}}", err).Error()}
 		}
@@ -1323,6 +1572,25 @@ func createCSR(data *dataBundle) (*certutil.ParsedCSRBundle, error) {
 		csrTemplate.ExtraExtensions = append(csrTemplate.ExtraExtensions, ext)
 	}
 
+	if len(permittedDNSDomains) > 0 || len(excludedDNSDomains) > 0 {
+		var constraints nameConstraints
+		for _, domain := range permittedDNSDomains {
+			constraints.Permitted = append(constraints.Permitted, generalSubtree{Name: domain})
+		}
+		for _, domain := range excludedDNSDomains {
+			constraints.Excluded = append(constraints.Excluded, generalSubtree{Name: domain})
+		}
+		val, err := asn1.Marshal(constraints)
+		if err != nil {
+			return nil, errutil.InternalError{Err: errwrap.Wrapf("error marshaling name constraints: {{err}}", err).Error()}
+		}
+		csrTemplate.ExtraExtensions = append(csrTemplate.ExtraExtensions, pkix.Extension{
+			Id:       oidExtensionNameConstraints,
+			Value:    val,
+			Critical: true,
+		})
+	}
+
 	switch data.params.KeyType {
 	case "rsa":
 		csrTemplate.SignatureAlgorithm = x509.SHA256WithRSA
@@ -1407,7 +1675,11 @@ func signCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		certTemplate.URIs = data.csr.URIs
 
 		for _, name := range data.csr.Extensions {
-			if !name.Id.Equal(oidExtensionBasicConstraints) {
+			switch {
+			case name.Id.Equal(oidExtensionBasicConstraints):
+			case name.Id.Equal(oidExtensionNameConstraints) && data.params.IsCA:
+				// Already merged into the parameters
+			default:
 				certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, name)
 			}
 		}
@@ -1416,7 +1688,7 @@ func signCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		certTemplate.DNSNames = data.params.DNSNames
 		certTemplate.EmailAddresses = data.params.EmailAddresses
 		certTemplate.IPAddresses = data.params.IPAddresses
-		certTemplate.URIs = data.csr.URIs
+		certTemplate.URIs = data.params.URIs
 	}
 
 	if err := handleOtherSANs(certTemplate, data.params.OtherSANs); err != nil {
@@ -1443,6 +1715,16 @@ func signCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 			data.signingBundle.Certificate.MaxPathLenZero {
 			return nil, errutil.UserError{Err: "signing certificate has a max path length of zero, and cannot issue further CA certificates"}
 		}
+		if caMaxPathLen := data.signingBundle.Certificate.MaxPathLen; caMaxPathLen > 0 {
+			switch {
+			case data.params.MaxPathLength < 0:
+				// No path length was requested, so take the longest one the
+				// signing certificate allows
+				data.params.MaxPathLength = caMaxPathLen - 1
+			case data.params.MaxPathLength >= caMaxPathLen:
+				return nil, errutil.UserError{Err: fmt.Sprintf("signing certificate has a max path length of %d; the max path length of the new CA certificate must be lower", caMaxPathLen)}
+			}
+		}
 
 		certTemplate.MaxPathLen = data.params.MaxPathLength
 		if certTemplate.MaxPathLen == 0 {
@@ -1453,11 +1735,16 @@ func signCertificate(data *dataBundle) (*certutil.ParsedCertBundle, error) {
 		certTemplate.IsCA = false
 	}
 
-	if len(data.params.PermittedDNSDomains) > 0 {
+	if len(data.params.PermittedDNSDomains) > 0 || len(data.params.ExcludedDNSDomains) > 0 {
 		certTemplate.PermittedDNSDomains = data.params.PermittedDNSDomains
+		certTemplate.ExcludedDNSDomains = data.params.ExcludedDNSDomains
 		certTemplate.PermittedDNSDomainsCritical = true
 	}
 
+	if err := checkNameConstraints(caCert, certTemplate); err != nil {
+		return nil, err
+	}
+
 	certBytes, err = x509.CreateCertificate(rand.Reader, certTemplate, caCert, data.csr.PublicKey, data.signingBundle.PrivateKey)
 
 	if err != nil {
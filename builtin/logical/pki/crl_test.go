@@ -2,7 +2,9 @@ package pki
 
 import (
 	"crypto/x509"
+	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	vaulthttp "github.com/hashicorp/vault/http"
@@ -122,3 +124,128 @@ func TestBackend_CRL_EnableDisable(t *testing.T) {
 	toggle(false)
 	test(6)
 }
+
+func TestBackend_CRL_Expiry(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	err := client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: "16h",
+			MaxLeaseTTL:     "60h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"ttl":         "40h",
+		"common_name": "myvault.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("pki/roles/test", map[string]interface{}{
+		"allowed_domains":  "foobar.com",
+		"allow_subdomains": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Logical().Write("pki/issue/test", map[string]interface{}{
+		"common_name": "test.foobar.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Logical().Write("pki/revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The CRL is served without authentication
+	unauthClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthClient.ClearToken()
+
+	fetch := func(path string) []byte {
+		rawResp, err := unauthClient.RawRequest(unauthClient.NewRequest("GET", "/v1/pki/"+path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rawResp.Body.Close()
+		body, err := ioutil.ReadAll(rawResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	checkExpiry := func(expected time.Duration) {
+		certList, err := x509.ParseCRL(fetch("crl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(certList.TBSCertList.RevokedCertificates) != 1 {
+			t.Fatalf("expected 1 revoked certificate, found %d", len(certList.TBSCertList.RevokedCertificates))
+		}
+		tbs := certList.TBSCertList
+		if actual := tbs.NextUpdate.Sub(tbs.ThisUpdate); actual < expected-time.Minute || actual > expected+time.Minute {
+			t.Fatalf("expected CRL to be valid for %s, got %s", expected, actual)
+		}
+
+		pemList, err := x509.ParseCRL(fetch("crl/pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pemList.TBSCertList.NextUpdate.Equal(tbs.NextUpdate) {
+			t.Fatalf("DER and PEM CRLs differ")
+		}
+	}
+
+	checkExpiry(72 * time.Hour)
+
+	// Changing the expiry rebuilds the CRL right away
+	_, err = client.Logical().Write("pki/config/crl", map[string]interface{}{
+		"expiry": "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExpiry(time.Hour)
+
+	for _, expiry := range []string{"-1h", "0s"} {
+		_, err = client.Logical().Write("pki/config/crl", map[string]interface{}{
+			"expiry": expiry,
+		})
+		if err == nil {
+			t.Fatalf("expected error setting expiry to %s", expiry)
+		}
+	}
+
+	resp, err = client.Logical().Read("pki/crl/rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.Data["success"] != true {
+		t.Fatalf("bad: %#v", resp)
+	}
+	checkExpiry(time.Hour)
+}
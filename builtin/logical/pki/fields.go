@@ -199,9 +199,8 @@ the private key!`,
 	fields["key_bits"] = &framework.FieldSchema{
 		Type:    framework.TypeInt,
 		Default: 2048,
-		Description: `The number of bits to use. You will almost
-certainly want to change this if you adjust
-the key_type.`,
+		Description: `The number of bits to use. Defaults to 2048
+for RSA keys and 256 for EC keys.`,
 	}
 
 	fields["key_type"] = &framework.FieldSchema{
@@ -228,5 +227,10 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 		Description: `Domains for which this certificate is allowed to sign or issue child certificates. If set, all DNS names (subject and alt) on child certs must be exact matches or subsets of the given domains (see https://tools.ietf.org/html/rfc5280#section-4.2.1.10).`,
 	}
 
+	fields["excluded_dns_domains"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Domains for which this certificate is not allowed to sign or issue child certificates. If set, no DNS names (subject and alt) on child certs may be exact matches or subsets of the given domains (see https://tools.ietf.org/html/rfc5280#section-4.2.1.10).`,
+	}
+
 	return fields
 }
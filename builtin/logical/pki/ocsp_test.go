@@ -0,0 +1,260 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/certutil"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestBackend_OCSP(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	err := client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: "16h",
+			MaxLeaseTTL:     "60h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Logical().Write("pki/root/generate/exported", map[string]interface{}{
+		"ttl":         "40h",
+		"common_name": "myvault.com",
+		"key_type":    "rsa",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caBundle, err := certutil.ParsePEMBundle(resp.Data["certificate"].(string) + "\n" + resp.Data["private_key"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := caBundle.Certificate
+
+	_, err = client.Logical().Write("pki/roles/test", map[string]interface{}{
+		"allowed_domains":  "foobar.com",
+		"allow_subdomains": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func() (*x509.Certificate, string) {
+		resp, err := client.Logical().Write("pki/issue/test", map[string]interface{}{
+			"common_name": "test.foobar.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bundle := resp.Data["certificate"].(string) + "\n" + resp.Data["private_key"].(string)
+		parsed, err := certutil.ParsePEMBundle(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed.Certificate, bundle
+	}
+	goodCert, goodBundle := issue()
+	revokedCert, _ := issue()
+
+	_, err = client.Logical().Write("pki/revoke", map[string]interface{}{
+		"serial_number": certutil.GetHexFormatted(revokedCert.SerialNumber.Bytes(), ":"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The responder is reachable without authentication
+	unauthClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unauthClient.ClearToken()
+
+	post := func(body []byte) (*api.Response, error) {
+		req := unauthClient.NewRequest("POST", "/v1/pki/ocsp")
+		req.Headers = http.Header{"Content-Type": []string{"application/ocsp-request"}}
+		req.BodyBytes = body
+		return unauthClient.RawRequest(req)
+	}
+	get := func(body []byte) (*api.Response, error) {
+		return unauthClient.RawRequest(unauthClient.NewRequest("GET", "/v1/pki/ocsp/"+base64.StdEncoding.EncodeToString(body)))
+	}
+
+	query := func(send func([]byte) (*api.Response, error), ocspReq []byte) *ocsp.Response {
+		rawResp, err := send(ocspReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rawResp.Body.Close()
+		if ct := rawResp.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+			t.Fatalf("bad content type %q", ct)
+		}
+		body, err := ioutil.ReadAll(rawResp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ocspResp, err := ocsp.ParseResponse(body, caCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ocspResp
+	}
+
+	checkValidity := func(ocspResp *ocsp.Response, expected time.Duration) {
+		actual := ocspResp.NextUpdate.Sub(ocspResp.ThisUpdate)
+		if actual < expected-time.Minute || actual > expected+time.Minute {
+			t.Fatalf("expected response to be valid for %s, got %s", expected, actual)
+		}
+	}
+
+	goodReq, err := ocsp.CreateRequest(goodCert, caCert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedReq, err := ocsp.CreateRequest(revokedCert, caCert, &ocsp.RequestOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, send := range []func([]byte) (*api.Response, error){post, get} {
+		ocspResp := query(send, goodReq)
+		if ocspResp.Status != ocsp.Good {
+			t.Fatalf("expected good status, got %d", ocspResp.Status)
+		}
+		if ocspResp.SerialNumber.Cmp(goodCert.SerialNumber) != 0 {
+			t.Fatalf("bad serial number %s", ocspResp.SerialNumber)
+		}
+		checkValidity(ocspResp, 12*time.Hour)
+
+		ocspResp = query(send, revokedReq)
+		if ocspResp.Status != ocsp.Revoked {
+			t.Fatalf("expected revoked status, got %d", ocspResp.Status)
+		}
+		if ocspResp.RevokedAt.IsZero() || time.Since(ocspResp.RevokedAt) > time.Minute {
+			t.Fatalf("bad revocation time %s", ocspResp.RevokedAt)
+		}
+	}
+
+	// Serials the backend doesn't know about are reported as unknown
+	parsedReq, err := ocsp.ParseRequest(goodReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedReq.SerialNumber = big.NewInt(42)
+	unknownReq, err := parsedReq.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ocspResp := query(post, unknownReq); ocspResp.Status != ocsp.Unknown {
+		t.Fatalf("expected unknown status, got %d", ocspResp.Status)
+	}
+
+	rawResp, err := post([]byte("not an ocsp request"))
+	if err == nil || rawResp == nil || rawResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+
+	// A delegated responder must be allowed to sign OCSP responses
+	_, err = client.Logical().Write("pki/config/ocsp", map[string]interface{}{
+		"pem_bundle": goodBundle,
+	})
+	if err == nil || !strings.Contains(err.Error(), "OCSP signing") {
+		t.Fatalf("expected error configuring responder without OCSP signing usage, got %v", err)
+	}
+
+	_, err = client.Logical().Write("pki/config/ocsp", map[string]interface{}{
+		"response_validity": "-1h",
+	})
+	if err == nil {
+		t.Fatal("expected error setting negative response validity")
+	}
+
+	responderKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ocsp.myvault.com"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+	responderDER, err := x509.CreateCertificate(rand.Reader, responderTemplate, caCert, responderKey.Public(), caBundle.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: responderDER})
+	responderKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(responderKey)})
+
+	_, err = client.Logical().Write("pki/config/ocsp", map[string]interface{}{
+		"pem_bundle":        string(responderPEM) + string(responderKeyPEM),
+		"response_validity": "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = client.Logical().Read("pki/config/ocsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["response_validity"] != "1h" || !strings.Contains(resp.Data["responder_certificate"].(string), "BEGIN CERTIFICATE") {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatal("responder private key must not be returned")
+	}
+
+	// Responses are now signed by the responder, which is included so that
+	// clients can verify it was issued by the CA
+	ocspResp := query(get, goodReq)
+	if ocspResp.Status != ocsp.Good {
+		t.Fatalf("expected good status, got %d", ocspResp.Status)
+	}
+	if ocspResp.Certificate == nil || string(ocspResp.Certificate.Raw) != string(responderDER) {
+		t.Fatal("expected response to be signed by the delegated responder")
+	}
+	checkValidity(ocspResp, time.Hour)
+
+	// Deleting the configuration reverts to the CA and default validity
+	if _, err := client.Logical().Delete("pki/config/ocsp"); err != nil {
+		t.Fatal(err)
+	}
+	ocspResp = query(post, revokedReq)
+	if ocspResp.Certificate != nil {
+		t.Fatal("expected response to be signed by the CA")
+	}
+	checkValidity(ocspResp, 12*time.Hour)
+}
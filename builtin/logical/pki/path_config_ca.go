@@ -1,7 +1,12 @@
 package pki
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/certutil"
@@ -37,6 +42,12 @@ func (b *backend) pathCAWrite(ctx context.Context, req *logical.Request, data *f
 		return logical.ErrorResponse("'pem_bundle' was empty"), nil
 	}
 
+	// The bundle parser skips blocks it doesn't understand, so check each of
+	// them first to be able to point out the one that is broken
+	if err := checkPEMBundleBlocks(pemBundle); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	parsedBundle, err := certutil.ParsePEMBundle(pemBundle)
 	if err != nil {
 		switch err.(type) {
@@ -60,32 +71,122 @@ func (b *backend) pathCAWrite(ctx context.Context, req *logical.Request, data *f
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
+	if parsedBundle.Certificate.KeyUsage != 0 &&
+		parsedBundle.Certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return logical.ErrorResponse("the given certificate's key usage does not allow signing certificates and cannot be used with this backend"), nil
+	}
+
 	cb, err := parsedBundle.ToCertBundle()
 	if err != nil {
 		return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
 	}
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
+	// Keep revocations and CRL rebuilds out while the CA is swapped
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	// Hold on to the current CA so that it can be put back if the new one
+	// can't be fully installed
+	oldBundleEntry, err := req.Storage.Get(ctx, "config/ca_bundle")
 	if err != nil {
 		return nil, err
 	}
-	err = req.Storage.Put(ctx, entry)
+	oldCAEntry, err := req.Storage.Get(ctx, "ca")
 	if err != nil {
 		return nil, err
 	}
 
+	if err := b.installCA(ctx, req, cb, parsedBundle.CertificateBytes); err != nil {
+		if restoreErr := restoreStorageEntry(ctx, req, "config/ca_bundle", oldBundleEntry); restoreErr != nil {
+			b.Logger().Error("failed to restore previous CA bundle", "error", restoreErr)
+		}
+		if restoreErr := restoreStorageEntry(ctx, req, "ca", oldCAEntry); restoreErr != nil {
+			b.Logger().Error("failed to restore previous CA certificate", "error", restoreErr)
+		}
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// installCA stores the given CA bundle as the mount's signing CA and builds a
+// fresh CRL signed by it
+func (b *backend) installCA(ctx context.Context, req *logical.Request, cb *certutil.CertBundle, certBytes []byte) error {
+	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
+	if err != nil {
+		return err
+	}
+	err = req.Storage.Put(ctx, entry)
+	if err != nil {
+		return err
+	}
+
 	// For ease of later use, also store just the certificate at a known
 	// location, plus a fresh CRL
 	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
+	entry.Value = certBytes
 	err = req.Storage.Put(ctx, entry)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	return buildCRL(ctx, b, req, true)
+}
+
+// restoreStorageEntry puts back a previously read entry, or removes the key if
+// there was none
+func restoreStorageEntry(ctx context.Context, req *logical.Request, key string, entry *logical.StorageEntry) error {
+	if entry == nil {
+		return req.Storage.Delete(ctx, key)
 	}
+	return req.Storage.Put(ctx, entry)
+}
+
+// checkPEMBundleBlocks makes sure every block of the bundle is a certificate
+// or private key that can be parsed, and returns an error naming the first
+// one that isn't
+func checkPEMBundleBlocks(pemBundle string) error {
+	rest := []byte(pemBundle)
+	for i := 1; len(bytes.TrimSpace(rest)) > 0; i++ {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			if i == 1 {
+				return fmt.Errorf("no PEM-encoded data found in the bundle")
+			}
+			return fmt.Errorf("data after PEM block %d of the bundle is not PEM-encoded", i-1)
+		}
 
-	err = buildCRL(ctx, b, req, true)
+		switch {
+		case block.Type == "CERTIFICATE":
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return fmt.Errorf("error parsing certificate in PEM block %d of the bundle: %s", i, err)
+			}
+
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if x509.IsEncryptedPEMBlock(block) {
+				return fmt.Errorf("private key in PEM block %d of the bundle is encrypted; provide an unencrypted key", i)
+			}
+			if _, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				continue
+			}
+			if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				continue
+			}
+			if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+				return fmt.Errorf("error parsing private key in PEM block %d of the bundle: %s", i, err)
+			}
+
+		case block.Type == "EC PARAMETERS":
+			// Emitted by OpenSSL ahead of EC keys; the key carries the curve
+			// as well
+
+		default:
+			return fmt.Errorf("PEM block %d of the bundle has unsupported type %q", i, block.Type)
+		}
+	}
 
-	return nil, err
+	return nil
 }
 
 const pathConfigCAHelpSyn = `
@@ -95,7 +196,9 @@ Set the CA certificate and private key used for generated credentials.
 const pathConfigCAHelpDesc = `
 This sets the CA information used for credentials generated by this
 by this mount. This must be a PEM-format, concatenated unencrypted
-secret key and certificate.
+secret key and certificate, optionally followed by the certificates of
+the issuing chain. The certificate must match the key and be marked for
+CA use. Writing a new bundle replaces the current CA.
 
 For security reasons, the secret key cannot be retrieved later.
 `
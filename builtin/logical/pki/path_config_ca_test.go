@@ -0,0 +1,151 @@
+package pki
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPki_ConfigCA(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	// Returns the PEM key and a self-signed certificate for it
+	generate := func(cn string, isCA bool) (string, string) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Now().Add(-time.Minute),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		}
+		certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+		return string(keyPEM), string(certPEM)
+	}
+
+	expectError := func(bundle, contains string) {
+		resp, err := write("config/ca", map[string]interface{}{
+			"pem_bundle": bundle,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), contains) {
+			t.Fatalf("expected error containing %q, got: %#v", contains, resp)
+		}
+	}
+
+	key1, cert1 := generate("ca1.myvault.com", true)
+	key2, cert2 := generate("ca2.myvault.com", true)
+	leafKey, leafCert := generate("leaf.myvault.com", false)
+
+	expectError(key1+cert2, "does not match")
+	expectError(leafKey+leafCert, "not marked for CA use")
+	expectError("garbage", "no PEM-encoded data")
+	expectError(key1+cert1+"garbage", "after PEM block 2")
+	expectError(key1+strings.Replace(cert1, "MII", "MIX", 1), "certificate in PEM block 2")
+	expectError(strings.Replace(key1, "MII", "MIX", 1)+cert1, "private key in PEM block 1")
+
+	// Nothing is installed by the failed attempts
+	entry, err := storage.Get(context.Background(), "config/ca_bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatal("expected no CA to be installed")
+	}
+
+	if _, err := write("roles/test", map[string]interface{}{
+		"allow_any_name": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each import replaces the signing CA
+	for _, ca := range [][2]string{{key1, cert1}, {key2, cert2}} {
+		resp, err := write("config/ca", map[string]interface{}{
+			"pem_bundle": ca[0] + ca[1],
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+		}
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "cert/ca",
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+		}
+		if resp.Data["certificate"] != strings.TrimSpace(ca[1]) {
+			t.Fatalf("expected CA %q, got %q", ca[1], resp.Data["certificate"])
+		}
+
+		caBundle, err := certutil.ParsePEMBundle(ca[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err = write("issue/test", map[string]interface{}{
+			"common_name": "test.myvault.com",
+			"ttl":         "10m",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+		}
+		issued, err := certutil.ParsePEMBundle(resp.Data["certificate"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := issued.Certificate.CheckSignatureFrom(caBundle.Certificate); err != nil {
+			t.Fatalf("expected certificate to be issued by %s: %v", caBundle.Certificate.Subject.CommonName, err)
+		}
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "cert/crl",
+			Storage:   storage,
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+		}
+		crlBlock, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+		crl, err := x509.ParseCRL(crlBlock.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := caBundle.Certificate.CheckCRLSignature(crl); err != nil {
+			t.Fatalf("expected CRL to be signed by %s: %v", caBundle.Certificate.Subject.CommonName, err)
+		}
+	}
+}
@@ -86,18 +86,21 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		config = &crlConfig{}
 	}
 
+	oldExpiry := config.Expiry
 	if expiryRaw, ok := d.GetOk("expiry"); ok {
 		expiry := expiryRaw.(string)
-		_, err := time.ParseDuration(expiry)
+		expiryDur, err := time.ParseDuration(expiry)
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf("given expiry could not be decoded: %s", err)), nil
 		}
+		if expiryDur <= 0 {
+			return logical.ErrorResponse("expiry must be a positive duration"), nil
+		}
 		config.Expiry = expiry
 	}
 
-	var oldDisable bool
+	oldDisable := config.Disable
 	if disableRaw, ok := d.GetOk("disable"); ok {
-		oldDisable = config.Disable
 		config.Disable = disableRaw.(bool)
 	}
 
@@ -110,8 +113,12 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		return nil, err
 	}
 
-	if oldDisable != config.Disable {
-		// It wasn't disabled but now it is, rotate
+	// Rebuild the CRL if it was enabled or disabled, or if its expiry changed
+	// so that the next update time reflects the new expiry right away
+	if oldDisable != config.Disable || oldExpiry != config.Expiry {
+		b.revokeStorageLock.RLock()
+		defer b.revokeStorageLock.RUnlock()
+
 		crlErr := buildCRL(ctx, b, req, true)
 		switch crlErr.(type) {
 		case errutil.UserError:
@@ -129,5 +136,6 @@ Configure the CRL expiration.
 `
 
 const pathConfigCRLHelpDesc = `
-This endpoint allows configuration of the CRL lifetime.
+This endpoint allows configuration of the CRL lifetime. Changing the lifetime
+rebuilds the CRL immediately.
 `
@@ -0,0 +1,193 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const defaultOCSPResponseValidity = 12 * time.Hour
+
+// ocspConfig holds the OCSP responder configuration
+type ocspConfig struct {
+	// ResponderBundle is the certificate and key of a delegated responder.
+	// When nil, responses are signed by the CA.
+	ResponderBundle  *certutil.CertBundle `json:"responder_bundle"`
+	ResponseValidity string               `json:"response_validity"`
+}
+
+func (c *ocspConfig) responseValidity() (time.Duration, error) {
+	if c == nil || c.ResponseValidity == "" {
+		return defaultOCSPResponseValidity, nil
+	}
+	return time.ParseDuration(c.ResponseValidity)
+}
+
+func pathConfigOCSP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/ocsp",
+		Fields: map[string]*framework.FieldSchema{
+			"pem_bundle": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `PEM-format, concatenated unencrypted
+certificate and private key of a delegated
+OCSP responder. The certificate must be issued
+by the CA and carry the OCSP signing extended
+key usage. If not set, responses are signed
+by the CA.`,
+			},
+			"response_validity": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The amount of time OCSP responses should
+be valid; defaults to 12 hours`,
+				Default: "12h",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathOCSPConfigRead,
+			logical.UpdateOperation: b.pathOCSPConfigWrite,
+			logical.DeleteOperation: b.pathOCSPConfigDelete,
+		},
+
+		HelpSynopsis:    pathConfigOCSPHelpSyn,
+		HelpDescription: pathConfigOCSPHelpDesc,
+	}
+}
+
+func (b *backend) OCSP(ctx context.Context, s logical.Storage) (*ocspConfig, error) {
+	entry, err := s.Get(ctx, "config/ocsp")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ocspConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathOCSPConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.OCSP(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"response_validity":     config.ResponseValidity,
+			"responder_certificate": "",
+		},
+	}
+	if config.ResponderBundle != nil {
+		resp.Data["responder_certificate"] = config.ResponderBundle.Certificate
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathOCSPConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.OCSP(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ocspConfig{}
+	}
+
+	if validityRaw, ok := d.GetOk("response_validity"); ok {
+		validity := validityRaw.(string)
+		validityDur, err := time.ParseDuration(validity)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given response_validity could not be decoded: %s", err)), nil
+		}
+		if validityDur <= 0 {
+			return logical.ErrorResponse("response_validity must be a positive duration"), nil
+		}
+		config.ResponseValidity = validity
+	}
+
+	if pemBundleRaw, ok := d.GetOk("pem_bundle"); ok {
+		parsedBundle, err := certutil.ParsePEMBundle(pemBundleRaw.(string))
+		if err != nil {
+			switch err.(type) {
+			case errutil.InternalError:
+				return nil, err
+			default:
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+		if parsedBundle.Certificate == nil || parsedBundle.PrivateKey == nil {
+			return logical.ErrorResponse("pem_bundle must contain both a certificate and a private key"), nil
+		}
+		if err := parsedBundle.Verify(); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("verification of parsed bundle failed: %s", err)), nil
+		}
+
+		caInfo, err := fetchCAInfo(ctx, req)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), nil
+			default:
+				return nil, err
+			}
+		}
+		if err := parsedBundle.Certificate.CheckSignatureFrom(caInfo.Certificate); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("responder certificate was not issued by the CA: %s", err)), nil
+		}
+
+		hasOCSPSigning := false
+		for _, usage := range parsedBundle.Certificate.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageOCSPSigning {
+				hasOCSPSigning = true
+			}
+		}
+		if !hasOCSPSigning {
+			return logical.ErrorResponse("responder certificate must have the OCSP signing extended key usage"), nil
+		}
+
+		config.ResponderBundle, err = parsedBundle.ToCertBundle()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config/ocsp", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathOCSPConfigDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, "config/ocsp")
+}
+
+const pathConfigOCSPHelpSyn = `
+Configure the OCSP responder.
+`
+
+const pathConfigOCSPHelpDesc = `
+This endpoint allows configuration of the validity of OCSP responses and of a
+delegated responder certificate to sign them with. Deleting the configuration
+reverts to signing responses with the CA and the default validity.
+`
@@ -93,7 +93,11 @@ func (b *backend) pathReadURL(ctx context.Context, req *logical.Request, data *f
 		return nil, err
 	}
 	if entries == nil {
-		return nil, nil
+		entries = &urlEntries{
+			IssuingCertificates:   []string{},
+			CRLDistributionPoints: []string{},
+			OCSPServers:           []string{},
+		}
 	}
 
 	resp := &logical.Response{
@@ -156,7 +160,8 @@ This path allows you to set the issuing CA, CRL distribution points, and
 OCSP server URLs that will be encoded into issued certificates. If these
 values are not set, no such information will be encoded in the issued
 certificates. To delete URLs, simply re-set the appropriate value with an
-empty string.
+empty string or list. Changes only apply to certificates issued or signed
+afterwards.
 
 Multiple URLs can be specified for each type; use commas to separate them.
 `
@@ -2,10 +2,14 @@ package pki
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"strings"
 
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -53,16 +57,23 @@ func pathFetchCRL(b *backend) *framework.Path {
 	}
 }
 
-// Returns any valid (non-revoked) cert. Since "ca" fits the pattern, this path
-// also handles returning the CA cert in a non-raw format.
+// Returns any stored cert, revoked or not. Since "ca" fits the pattern, this
+// path also handles returning the CA cert in a non-raw format.
 func pathFetchValid(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: `cert/(?P<serial>[0-9A-Fa-f-:]+)`,
 		Fields: map[string]*framework.FieldSchema{
 			"serial": &framework.FieldSchema{
 				Type: framework.TypeString,
-				Description: `Certificate serial number, in colon- or
-hyphen-separated octal`,
+				Description: `Certificate serial number, in hex with or
+without colon or hyphen separators`,
+			},
+			"format": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "pem",
+				Description: `Format for the returned certificate and
+CA chain; "pem" (the default) or "der". If
+"der", the values are base64 encoded.`,
 			},
 		},
 
@@ -104,10 +115,15 @@ func pathFetchListCerts(b *backend) *framework.Path {
 }
 
 func (b *backend) pathFetchCertList(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
+	// Only the storage keys are listed, which avoids loading every
+	// certificate; they are returned in the same form as revoke accepts
 	entries, err := req.Storage.List(ctx, "certs/")
 	if err != nil {
 		return nil, err
 	}
+	for i, entry := range entries {
+		entries[i] = denormalizeSerial(entry)
+	}
 
 	return logical.ListResponse(entries), nil
 }
@@ -117,6 +133,7 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	var certEntry, revokedEntry *logical.StorageEntry
 	var funcErr error
 	var certificate []byte
+	var der bool
 	var revocationTime int64
 	response = &logical.Response{
 		Data: map[string]interface{}{},
@@ -149,8 +166,17 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		serial = "crl"
 		pemType = "X509 CRL"
 	default:
-		serial = data.Get("serial").(string)
+		serial = canonicalSerial(data.Get("serial").(string))
 		pemType = "CERTIFICATE"
+		switch format := data.Get("format").(string); format {
+		case "pem":
+		case "der":
+			pemType = ""
+			der = true
+		default:
+			response = logical.ErrorResponse(fmt.Sprintf("unknown format %q; must be \"pem\" or \"der\"", format))
+			goto reply
+		}
 	}
 	if len(serial) == 0 {
 		response = logical.ErrorResponse("The serial number must be provided")
@@ -198,6 +224,29 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	}
 
 	certificate = certEntry.Value
+	if der {
+		certificate = []byte(base64.StdEncoding.EncodeToString(certEntry.Value))
+	}
+
+	// Certificates issued by the CA are returned with its chain
+	if len(contentType) == 0 && serial != "ca" && serial != "crl" {
+		caChain, err := issuedCertChain(ctx, req, certEntry.Value)
+		if err != nil {
+			retErr = err
+			goto reply
+		}
+		if len(caChain) > 0 {
+			if der {
+				var derChain []string
+				for _, caCert := range caChain {
+					derChain = append(derChain, base64.StdEncoding.EncodeToString(caCert.Bytes))
+				}
+				response.Data["ca_chain"] = derChain
+			} else {
+				response.Data["ca_chain"] = pemChain(caChain)
+			}
+		}
+	}
 
 	if len(pemType) != 0 {
 		block := pem.Block{
@@ -263,12 +312,36 @@ reply:
 	return
 }
 
+// issuedCertChain returns the chain of the CA if it issued the given
+// certificate
+func issuedCertChain(ctx context.Context, req *logical.Request, certBytes []byte) ([]*certutil.CertBlock, error) {
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, errwrap.Wrapf("unable to parse stored certificate: {{err}}", err)
+	}
+
+	caInfo, err := fetchCAInfo(ctx, req)
+	switch err.(type) {
+	case nil:
+	case errutil.UserError:
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	if cert.CheckSignatureFrom(caInfo.Certificate) != nil {
+		return nil, nil
+	}
+
+	return caInfo.issuerChain(), nil
+}
+
 const pathFetchHelpSyn = `
-Fetch a CA, CRL, CA Chain, or non-revoked certificate.
+Fetch a CA, CRL, CA Chain, or stored certificate.
 `
 
 const pathFetchHelpDesc = `
-This allows certificates to be fetched. If using the fetch/ prefix any non-revoked certificate can be fetched.
+This allows certificates to be fetched. Using "cert/<serial>" fetches any stored certificate, including revoked ones, along with its revocation time. The serial can be given in hex with or without colon or hyphen separators, and the "format" parameter selects PEM (the default) or base64-encoded DER output.
 
 Using "ca" or "crl" as the value fetches the appropriate information in DER encoding. Add "/pem" to either to get PEM encoding.
 
@@ -12,6 +12,11 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// pendingCABundlePath holds the private key of the most recently generated
+// intermediate CSR until the signed certificate is provided. Keeping it apart
+// from config/ca_bundle lets the current CA keep issuing in the meantime.
+const pendingCABundlePath = "config/pending_ca_bundle"
+
 func pathGenerateIntermediate(b *backend) *framework.Path {
 	ret := &framework.Path{
 		Pattern: "intermediate/generate/" + framework.GenericNameRegex("exported"),
@@ -26,6 +31,7 @@ func pathGenerateIntermediate(b *backend) *framework.Path {
 
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAKeyGenerationFields(ret.Fields)
+	ret.Fields = addCAIssueFields(ret.Fields)
 	ret.Fields["add_basic_constraints"] = &framework.FieldSchema{
 		Type: framework.TypeBool,
 		Description: `Whether to add a Basic Constraints
@@ -130,7 +136,7 @@ func (b *backend) pathGenerateIntermediate(ctx context.Context, req *logical.Req
 	cb.PrivateKey = csrb.PrivateKey
 	cb.PrivateKeyType = csrb.PrivateKeyType
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
+	entry, err := logical.StorageEntryJSON(pendingCABundlePath, cb)
 	if err != nil {
 		return nil, err
 	}
@@ -164,10 +170,18 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 	}
 
 	cb := &certutil.CertBundle{}
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
+	entry, err := req.Storage.Get(ctx, pendingCABundlePath)
 	if err != nil {
 		return nil, err
 	}
+	if entry == nil {
+		// Keys generated before pending keys were stored separately were
+		// written directly to the CA bundle
+		entry, err = req.Storage.Get(ctx, "config/ca_bundle")
+		if err != nil {
+			return nil, err
+		}
+	}
 	if entry == nil {
 		return logical.ErrorResponse("could not find any existing entry with a private key"), nil
 	}
@@ -231,6 +245,13 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 		return nil, err
 	}
 
+	// The signed certificate is now active, so the pending key is no longer
+	// needed
+	err = req.Storage.Delete(ctx, pendingCABundlePath)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build a fresh CRL
 	err = buildCRL(ctx, b, req, true)
 
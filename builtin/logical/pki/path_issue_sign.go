@@ -2,6 +2,7 @@ package pki
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"time"
@@ -60,8 +61,8 @@ func pathSignVerbatim(b *backend) *framework.Path {
 			logical.UpdateOperation: b.pathSignVerbatim,
 		},
 
-		HelpSynopsis:    pathSignHelpSyn,
-		HelpDescription: pathSignHelpDesc,
+		HelpSynopsis:    pathSignVerbatimHelpSyn,
+		HelpDescription: pathSignVerbatimHelpDesc,
 	}
 
 	ret.Fields = addNonCACommonFields(map[string]*framework.FieldSchema{})
@@ -100,6 +101,15 @@ this value to an empty list.`,
 		Description: `A comma-separated string or list of extended key usage oids.`,
 	}
 
+	ret.Fields["allow_ca"] = &framework.FieldSchema{
+		Type:    framework.TypeBool,
+		Default: false,
+		Description: `If set, a CSR requesting a CA certificate
+through its basic constraints will be signed
+as a CA certificate. Otherwise such CSRs are
+refused.`,
+	}
+
 	return ret
 }
 
@@ -182,6 +192,7 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 			*entry.GenerateLease = *role.GenerateLease
 		}
 		entry.NoStore = role.NoStore
+		entry.NotBeforeDuration = role.NotBeforeDuration
 	}
 
 	return b.pathIssueSignCert(ctx, req, data, entry, true, true)
@@ -210,6 +221,7 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		apiData:       data,
 		role:          role,
 		signingBundle: signingBundle,
+		capToCA:       useCSRValues,
 	}
 	var parsedBundle *certutil.ParsedCertBundle
 	var err error
@@ -242,13 +254,19 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		"serial_number": cb.SerialNumber,
 	}
 
+	if useCSRValues {
+		respData["csr_fields"], respData["csr_extensions"] = csrValuesUsed(input.csr)
+	}
+
+	// The chain always includes the issuing CA, even when it is a root, so
+	// that clients don't need to special case it
+	caChain := signingBundle.issuerChain()
+
 	switch format {
 	case "pem":
 		respData["issuing_ca"] = signingCB.Certificate
 		respData["certificate"] = cb.Certificate
-		if cb.CAChain != nil && len(cb.CAChain) > 0 {
-			respData["ca_chain"] = cb.CAChain
-		}
+		respData["ca_chain"] = pemChain(caChain)
 		if !useCSR {
 			respData["private_key"] = cb.PrivateKey
 			respData["private_key_type"] = cb.PrivateKeyType
@@ -257,9 +275,7 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 	case "pem_bundle":
 		respData["issuing_ca"] = signingCB.Certificate
 		respData["certificate"] = cb.ToPEMBundle()
-		if cb.CAChain != nil && len(cb.CAChain) > 0 {
-			respData["ca_chain"] = cb.CAChain
-		}
+		respData["ca_chain"] = pemChain(caChain)
 		if !useCSR {
 			respData["private_key"] = cb.PrivateKey
 			respData["private_key_type"] = cb.PrivateKeyType
@@ -269,13 +285,11 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		respData["certificate"] = base64.StdEncoding.EncodeToString(parsedBundle.CertificateBytes)
 		respData["issuing_ca"] = base64.StdEncoding.EncodeToString(signingBundle.CertificateBytes)
 
-		var caChain []string
-		for _, caCert := range parsedBundle.CAChain {
-			caChain = append(caChain, base64.StdEncoding.EncodeToString(caCert.Bytes))
-		}
-		if caChain != nil && len(caChain) > 0 {
-			respData["ca_chain"] = caChain
+		var derChain []string
+		for _, caCert := range caChain {
+			derChain = append(derChain, base64.StdEncoding.EncodeToString(caCert.Bytes))
 		}
+		respData["ca_chain"] = derChain
 
 		if !useCSR {
 			respData["private_key"] = base64.StdEncoding.EncodeToString(parsedBundle.PrivateKeyBytes)
@@ -328,9 +342,40 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	if useCSRValues && parsedBundle.Certificate.NotAfter.Equal(signingBundle.Certificate.NotAfter) {
+		resp.AddWarning("the validity period of the certificate was capped to the expiration of the CA certificate")
+	}
+
 	return resp, nil
 }
 
+// csrValuesUsed returns the names of the fields and the OIDs of the extensions
+// that are taken verbatim from the CSR
+func csrValuesUsed(csr *x509.CertificateRequest) ([]string, []string) {
+	fields := []string{"subject"}
+	if len(csr.DNSNames) > 0 || len(csr.EmailAddresses) > 0 {
+		fields = append(fields, "alt_names")
+	}
+	if len(csr.IPAddresses) > 0 {
+		fields = append(fields, "ip_sans")
+	}
+	if len(csr.URIs) > 0 {
+		fields = append(fields, "uri_sans")
+	}
+
+	extensions := []string{}
+	for _, ext := range csr.Extensions {
+		// Basic constraints are never copied; a CA certificate is only issued
+		// when allow_ca is set
+		if ext.Id.Equal(oidExtensionBasicConstraints) {
+			continue
+		}
+		extensions = append(extensions, ext.Id.String())
+	}
+
+	return fields, extensions
+}
+
 const pathIssueHelpSyn = `
 Request a certificate using a certain role with the provided details.
 `
@@ -357,3 +402,18 @@ requested common name is allowed by the role policy.
 This path requires a CSR; if you want Vault to generate a private key
 for you, use the issue path instead.
 `
+
+const pathSignVerbatimHelpSyn = `
+Request certificates with the subject and extensions of the provided CSR.
+`
+
+const pathSignVerbatimHelpDesc = `
+This path signs the provided CSR without applying role restrictions, keeping
+its subject and extensions. If a role is given, its TTLs, lease generation and
+storage settings are used. The validity period is capped to the expiration of
+the CA certificate.
+
+The response lists in "csr_fields" and "csr_extensions" which values were taken
+from the CSR. A CSR requesting a CA certificate is refused unless "allow_ca" is
+set.
+`
@@ -0,0 +1,215 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/ocsp"
+)
+
+// Answers OCSP requests sent with POST, with the DER encoded request as the
+// body
+func pathOCSP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOCSPRequest,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+// Answers OCSP requests sent with GET, with the base64 encoded request as the
+// last path segment
+func pathOCSPGet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp/(?P<request>.+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"request": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Base64 encoded DER OCSP request`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathOCSPRequest,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+func ocspResponse(status int, body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/ocsp-response",
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  status,
+		},
+	}
+}
+
+func (b *backend) pathOCSPRequest(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var der []byte
+	if req.Operation == logical.ReadOperation {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(data.Get("request").(string))
+		if err != nil {
+			return ocspResponse(http.StatusBadRequest, ocsp.MalformedRequestErrorResponse), nil
+		}
+	} else {
+		der, _ = req.Data[logical.HTTPRawBody].([]byte)
+	}
+
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return ocspResponse(http.StatusBadRequest, ocsp.MalformedRequestErrorResponse), nil
+	}
+
+	// Errors can't be returned as anything but an OCSP response, so they are
+	// logged instead
+	caInfo, err := fetchCAInfo(ctx, req)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return ocspResponse(http.StatusUnauthorized, ocsp.UnauthorizedErrorResponse), nil
+		default:
+			b.Logger().Error("failed to fetch CA for OCSP response", "error", err)
+			return ocspResponse(http.StatusInternalServerError, ocsp.InternalErrorErrorResponse), nil
+		}
+	}
+
+	// Only certificates issued by this CA can be answered for
+	if !ocspIssuerMatches(ocspReq, caInfo.Certificate) {
+		return ocspResponse(http.StatusUnauthorized, ocsp.UnauthorizedErrorResponse), nil
+	}
+
+	body, err := b.signOCSPResponse(ctx, req, ocspReq, caInfo)
+	if err != nil {
+		b.Logger().Error("failed to create OCSP response", "error", err)
+		return ocspResponse(http.StatusInternalServerError, ocsp.InternalErrorErrorResponse), nil
+	}
+
+	return ocspResponse(http.StatusOK, body), nil
+}
+
+// ocspIssuerMatches returns whether the request asks about a certificate
+// issued by the given issuer
+func ocspIssuerMatches(ocspReq *ocsp.Request, issuer *x509.Certificate) bool {
+	if !ocspReq.HashAlgorithm.Available() {
+		return false
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := ocspReq.HashAlgorithm.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(nameHash, ocspReq.IssuerNameHash) && bytes.Equal(keyHash, ocspReq.IssuerKeyHash)
+}
+
+// signOCSPResponse looks up the status of the requested certificate and
+// returns the signed response
+func (b *backend) signOCSPResponse(ctx context.Context, req *logical.Request, ocspReq *ocsp.Request, caInfo *caInfoBundle) ([]byte, error) {
+	config, err := b.OCSP(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	validity, err := config.responseValidity()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := ocsp.Response{
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(validity),
+		IssuerHash:   ocspReq.HashAlgorithm,
+	}
+
+	serial := certutil.GetHexFormatted(ocspReq.SerialNumber.Bytes(), ":")
+	revokedEntry, err := fetchCertBySerial(ctx, req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case revokedEntry != nil:
+		var revInfo revocationInfo
+		if err := revokedEntry.DecodeJSON(&revInfo); err != nil {
+			return nil, err
+		}
+		template.Status = ocsp.Revoked
+		template.RevocationReason = ocsp.Unspecified
+		if !revInfo.RevocationTimeUTC.IsZero() {
+			template.RevokedAt = revInfo.RevocationTimeUTC
+		} else {
+			template.RevokedAt = time.Unix(revInfo.RevocationTime, 0).UTC()
+		}
+
+	default:
+		certEntry, err := fetchCertBySerial(ctx, req, "certs/", serial)
+		if err != nil {
+			return nil, err
+		}
+		if certEntry != nil {
+			template.Status = ocsp.Good
+		} else {
+			template.Status = ocsp.Unknown
+		}
+	}
+
+	responderCert := caInfo.Certificate
+	var signer crypto.Signer = caInfo.PrivateKey
+	if config != nil && config.ResponderBundle != nil {
+		responder, err := config.ResponderBundle.ToParsedCertBundle()
+		if err != nil {
+			return nil, err
+		}
+		responderCert = responder.Certificate
+		signer = responder.PrivateKey
+
+		// Clients need the delegated responder's certificate to verify the
+		// response
+		template.Certificate = responderCert
+	}
+
+	return ocsp.CreateResponse(caInfo.Certificate, responderCert, template, signer)
+}
+
+const pathOCSPHelpSyn = `
+Answer OCSP requests for certificates issued by this backend.
+`
+
+const pathOCSPHelpDesc = `
+This endpoint answers standard OCSP requests, sent either with POST and the
+DER encoded request as the body, or with GET and the base64 encoded request as
+the last path segment. Certificates that are not known to the backend are
+reported with the "unknown" status.
+`
@@ -84,7 +84,9 @@ more information.`,
 			"allow_glob_domains": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `If set, domains specified in "allowed_domains"
-can include glob patterns, e.g. "ftp*.example.com". See
+can include glob patterns, e.g. "ftp*.example.com". A
+"*" only matches within a single label; subdomains of
+matching names also require "allow_subdomains". See
 the documentation for more information.`,
 			},
 
@@ -112,7 +114,8 @@ Any valid IP is accepted.`,
 			"allowed_uri_sans": &framework.FieldSchema{
 				Type: framework.TypeCommaStringSlice,
 				Description: `If set, an array of allowed URIs to put in the URI Subject Alternative Names.
-Any valid URI is accepted, these values support globbing.`,
+Any valid URI is accepted, these values support globbing. If not set, no URI
+Subject Alternative Names are allowed.`,
 			},
 
 			"allowed_other_sans": &framework.FieldSchema{
@@ -155,15 +158,16 @@ protection use. Defaults to false.`,
 				Type:    framework.TypeString,
 				Default: "rsa",
 				Description: `The type of key to use; defaults to RSA. "rsa"
-and "ec" are the only valid values.`,
+and "ec" are the only valid values for issuing;
+"any" is also allowed for signing. The key
+type of a CSR is not constrained by this.`,
 			},
 
 			"key_bits": &framework.FieldSchema{
 				Type:    framework.TypeInt,
 				Default: 2048,
-				Description: `The number of bits to use. You will almost
-certainly want to change this if you adjust
-the key_type.`,
+				Description: `The number of bits to use. Defaults to 2048
+for RSA keys and 256 for EC keys.`,
 			},
 
 			"key_usage": &framework.FieldSchema{
@@ -289,7 +293,10 @@ for "generate_lease".`,
 			"not_before_duration": &framework.FieldSchema{
 				Type:        framework.TypeDurationSecond,
 				Default:     30,
-				Description: `The duration before now the cert needs to be created / signed.`,
+				Description: `The duration before now the cert needs to be created / signed.
+This backdates the NotBefore of issued and signed certificates, including those
+signed with sign-verbatim, without extending their NotAfter. Zero uses the
+default of 30 seconds.`,
 			},
 		},
 
@@ -501,6 +508,10 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		NotBeforeDuration:             time.Duration(data.Get("not_before_duration").(int)) * time.Second,
 	}
 
+	if _, ok := data.GetOk("key_bits"); !ok {
+		entry.KeyBits = defaultKeyBits(entry.KeyType)
+	}
+
 	otherSANs := data.Get("allowed_other_sans").([]string)
 	if len(otherSANs) > 0 {
 		_, err := parseOtherSANs(otherSANs)
@@ -531,6 +542,26 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		return errResp, nil
 	}
 
+	for _, k := range entry.KeyUsage {
+		if _, ok := keyUsageNames[strings.ToLower(strings.TrimSpace(k))]; !ok {
+			return logical.ErrorResponse(fmt.Sprintf("%q is not a valid key usage", k)), nil
+		}
+	}
+
+	for _, k := range entry.ExtKeyUsage {
+		if _, ok := extKeyUsageNames[strings.ToLower(strings.TrimSpace(k))]; !ok {
+			return logical.ErrorResponse(fmt.Sprintf("%q is not a valid extended key usage", k)), nil
+		}
+	}
+
+	if entry.AllowGlobDomains {
+		for _, domain := range entry.AllowedDomains {
+			if domain != "" && isWildcardOnlyGlob(domain) {
+				return logical.ErrorResponse(fmt.Sprintf("allowed domain %q would match any name; use allow_any_name instead", domain)), nil
+			}
+		}
+	}
+
 	if len(entry.ExtKeyUsageOIDs) > 0 {
 		for _, oidstr := range entry.ExtKeyUsageOIDs {
 			_, err := stringToOid(oidstr)
@@ -561,29 +592,43 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 	return nil, nil
 }
 
+// keyUsageNames maps the lowercased names accepted in a role's key_usage to
+// the key usage they set
+var keyUsageNames = map[string]x509.KeyUsage{
+	"digitalsignature":  x509.KeyUsageDigitalSignature,
+	"contentcommitment": x509.KeyUsageContentCommitment,
+	"keyencipherment":   x509.KeyUsageKeyEncipherment,
+	"dataencipherment":  x509.KeyUsageDataEncipherment,
+	"keyagreement":      x509.KeyUsageKeyAgreement,
+	"certsign":          x509.KeyUsageCertSign,
+	"crlsign":           x509.KeyUsageCRLSign,
+	"encipheronly":      x509.KeyUsageEncipherOnly,
+	"decipheronly":      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsageNames maps the lowercased names accepted in a role's
+// ext_key_usage to the extended key usage they set
+var extKeyUsageNames = map[string]certExtKeyUsage{
+	"any":                            anyExtKeyUsage,
+	"serverauth":                     serverAuthExtKeyUsage,
+	"clientauth":                     clientAuthExtKeyUsage,
+	"codesigning":                    codeSigningExtKeyUsage,
+	"emailprotection":                emailProtectionExtKeyUsage,
+	"ipsecendsystem":                 ipsecEndSystemExtKeyUsage,
+	"ipsectunnel":                    ipsecTunnelExtKeyUsage,
+	"ipsecuser":                      ipsecUserExtKeyUsage,
+	"timestamping":                   timeStampingExtKeyUsage,
+	"ocspsigning":                    ocspSigningExtKeyUsage,
+	"microsoftservergatedcrypto":     microsoftServerGatedCryptoExtKeyUsage,
+	"netscapeservergatedcrypto":      netscapeServerGatedCryptoExtKeyUsage,
+	"microsoftcommercialcodesigning": microsoftCommercialCodeSigningExtKeyUsage,
+	"microsoftkernelcodesigning":     microsoftKernelCodeSigningExtKeyUsage,
+}
+
 func parseKeyUsages(input []string) int {
 	var parsedKeyUsages x509.KeyUsage
 	for _, k := range input {
-		switch strings.ToLower(strings.TrimSpace(k)) {
-		case "digitalsignature":
-			parsedKeyUsages |= x509.KeyUsageDigitalSignature
-		case "contentcommitment":
-			parsedKeyUsages |= x509.KeyUsageContentCommitment
-		case "keyencipherment":
-			parsedKeyUsages |= x509.KeyUsageKeyEncipherment
-		case "dataencipherment":
-			parsedKeyUsages |= x509.KeyUsageDataEncipherment
-		case "keyagreement":
-			parsedKeyUsages |= x509.KeyUsageKeyAgreement
-		case "certsign":
-			parsedKeyUsages |= x509.KeyUsageCertSign
-		case "crlsign":
-			parsedKeyUsages |= x509.KeyUsageCRLSign
-		case "encipheronly":
-			parsedKeyUsages |= x509.KeyUsageEncipherOnly
-		case "decipheronly":
-			parsedKeyUsages |= x509.KeyUsageDecipherOnly
-		}
+		parsedKeyUsages |= keyUsageNames[strings.ToLower(strings.TrimSpace(k))]
 	}
 
 	return int(parsedKeyUsages)
@@ -609,32 +654,7 @@ func parseExtKeyUsages(role *roleEntry) certExtKeyUsage {
 	}
 
 	for _, k := range role.ExtKeyUsage {
-		switch strings.ToLower(strings.TrimSpace(k)) {
-		case "any":
-			parsedKeyUsages |= anyExtKeyUsage
-		case "serverauth":
-			parsedKeyUsages |= serverAuthExtKeyUsage
-		case "clientauth":
-			parsedKeyUsages |= clientAuthExtKeyUsage
-		case "codesigning":
-			parsedKeyUsages |= codeSigningExtKeyUsage
-		case "emailprotection":
-			parsedKeyUsages |= emailProtectionExtKeyUsage
-		case "ipsecendsystem":
-			parsedKeyUsages |= ipsecEndSystemExtKeyUsage
-		case "ipsectunnel":
-			parsedKeyUsages |= ipsecTunnelExtKeyUsage
-		case "ipsecuser":
-			parsedKeyUsages |= ipsecUserExtKeyUsage
-		case "timestamping":
-			parsedKeyUsages |= timeStampingExtKeyUsage
-		case "ocspsigning":
-			parsedKeyUsages |= ocspSigningExtKeyUsage
-		case "microsoftservergatedcrypto":
-			parsedKeyUsages |= microsoftServerGatedCryptoExtKeyUsage
-		case "netscapeservergatedcrypto":
-			parsedKeyUsages |= netscapeServerGatedCryptoExtKeyUsage
-		}
+		parsedKeyUsages |= extKeyUsageNames[strings.ToLower(strings.TrimSpace(k))]
 	}
 
 	return parsedKeyUsages
@@ -2,9 +2,19 @@ package pki
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/mitchellh/mapstructure"
@@ -221,6 +231,337 @@ func TestPki_RoleKeyUsage(t *testing.T) {
 	}
 }
 
+func TestPki_RoleExtKeyUsage(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "myvault.com",
+			"ttl":         "40h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	writeRole := func(name string, data map[string]interface{}) *logical.Response {
+		data["allowed_domains"] = "myvault.com"
+		data["allow_subdomains"] = true
+		data["ttl"] = "1h"
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/" + name,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	issue := func(role string) *x509.Certificate {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/" + role,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"common_name": "cert.myvault.com",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	cases := []struct {
+		name        string
+		data        map[string]interface{}
+		keyUsage    x509.KeyUsage
+		extKeyUsage []x509.ExtKeyUsage
+	}{
+		{
+			// Roles that don't set the usages keep the defaults
+			name:        "default",
+			data:        map[string]interface{}{},
+			keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement | x509.KeyUsageKeyEncipherment,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		},
+		{
+			name: "client",
+			data: map[string]interface{}{
+				"key_usage":     "DigitalSignature",
+				"ext_key_usage": "ClientAuth",
+				"server_flag":   false,
+				"client_flag":   false,
+			},
+			keyUsage:    x509.KeyUsageDigitalSignature,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		},
+		{
+			name: "codesigning",
+			data: map[string]interface{}{
+				"key_usage":     []string{"DigitalSignature", "ContentCommitment"},
+				"ext_key_usage": []string{"codesigning", "MicrosoftCommercialCodeSigning"},
+				"server_flag":   false,
+				"client_flag":   false,
+			},
+			keyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+			extKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning, x509.ExtKeyUsageMicrosoftCommercialCodeSigning},
+		},
+	}
+	for _, tc := range cases {
+		if resp := writeRole(tc.name, tc.data); resp != nil && resp.IsError() {
+			t.Fatalf("%s: bad: %#v", tc.name, resp)
+		}
+
+		cert := issue(tc.name)
+		if cert.KeyUsage != tc.keyUsage {
+			t.Fatalf("%s: expected key usage %d, got %d", tc.name, tc.keyUsage, cert.KeyUsage)
+		}
+		if !reflect.DeepEqual(cert.ExtKeyUsage, tc.extKeyUsage) {
+			t.Fatalf("%s: expected extended key usage %v, got %v", tc.name, tc.extKeyUsage, cert.ExtKeyUsage)
+		}
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/client",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["key_usage"], []string{"DigitalSignature"}) ||
+		!reflect.DeepEqual(resp.Data["ext_key_usage"], []string{"ClientAuth"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"key_usage": "DigitalSignature,Bogus"},
+		{"ext_key_usage": "ServerAuth,Bogus"},
+	} {
+		if resp := writeRole("invalid", data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v, got %#v", data, resp)
+		}
+	}
+}
+
+func TestPki_RoleKeyType(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	handle := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	mustHandle := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := handle(path, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: path: %s, err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+	parseCert := func(certPEM string) *x509.Certificate {
+		block, _ := pem.Decode([]byte(certPEM))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	curveOf := func(cert *x509.Certificate) elliptic.Curve {
+		pubKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			t.Fatalf("expected an EC key, got %T", cert.PublicKey)
+		}
+		return pubKey.Curve
+	}
+
+	// EC keys default to 256 bits when no size is given
+	resp := mustHandle("root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "40h",
+		"key_type":    "ec",
+	})
+	if curve := curveOf(parseCert(resp.Data["certificate"].(string))); curve != elliptic.P256() {
+		t.Fatalf("bad curve: %s", curve.Params().Name)
+	}
+
+	writeRole := func(name string, data map[string]interface{}) (*logical.Response, error) {
+		data["allowed_domains"] = "myvault.com"
+		data["allow_subdomains"] = true
+		data["ttl"] = "1h"
+		return handle("roles/"+name, data)
+	}
+	for name, data := range map[string]map[string]interface{}{
+		"rsa":   {},
+		"ec":    {"key_type": "ec"},
+		"ec384": {"key_type": "ec", "key_bits": 384},
+		"ec521": {"key_type": "ec", "key_bits": 521},
+	} {
+		if resp, err := writeRole(name, data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: role: %s, err: %v resp: %#v", name, err, resp)
+		}
+	}
+
+	resp, err := writeRole("bad", map[string]interface{}{"key_type": "ec", "key_bits": 2048})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for EC role with 2048 bits, got err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/ec",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.Data["key_bits"] != 256 {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	for role, curve := range map[string]elliptic.Curve{
+		"ec":    elliptic.P256(),
+		"ec384": elliptic.P384(),
+		"ec521": elliptic.P521(),
+	} {
+		resp := mustHandle("issue/"+role, map[string]interface{}{
+			"common_name": "cert.myvault.com",
+		})
+		if resp.Data["private_key_type"] != certutil.ECPrivateKey {
+			t.Fatalf("bad private key type for role %s: %v", role, resp.Data["private_key_type"])
+		}
+		if actual := curveOf(parseCert(resp.Data["certificate"].(string))); actual != curve {
+			t.Fatalf("bad curve for role %s: %s", role, actual.Params().Name)
+		}
+	}
+
+	resp = mustHandle("issue/rsa", map[string]interface{}{
+		"common_name": "cert.myvault.com",
+	})
+	if resp.Data["private_key_type"] != certutil.RSAPrivateKey {
+		t.Fatalf("bad private key type: %v", resp.Data["private_key_type"])
+	}
+
+	// Signing isn't constrained by the key type of the role, only by its key
+	// size for keys of the same type
+	createCSR := func(key crypto.Signer) string {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "cert.myvault.com"},
+		}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecCSR := createCSR(ecKey)
+	rsaCSR := createCSR(rsaKey)
+
+	mustHandle("sign/rsa", map[string]interface{}{"csr": ecCSR})
+	mustHandle("sign/ec384", map[string]interface{}{"csr": rsaCSR})
+
+	resp, err = handle("sign/ec384", map[string]interface{}{"csr": ecCSR})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error signing a 256-bit EC key with a 384-bit role, got err: %v resp: %#v", err, resp)
+	}
+}
+
+func TestPki_RoleNotBeforeDuration(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	handle := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+	mustHandle := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := handle(path, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: path: %s, err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	mustHandle("root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "40h",
+	})
+
+	resp, err := handle("roles/test", map[string]interface{}{
+		"allow_any_name":      true,
+		"not_before_duration": "-10s",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error for negative not_before_duration, got resp: %#v", resp)
+	}
+
+	mustHandle("roles/test", map[string]interface{}{
+		"allow_any_name":      true,
+		"ttl":                 "1h",
+		"not_before_duration": "2m",
+	})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "test.myvault.com"},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+
+	// The backdating applies to every way of getting a certificate, and
+	// doesn't extend how long it is valid for
+	for _, req := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"issue/test", map[string]interface{}{"common_name": "test.myvault.com"}},
+		{"sign/test", map[string]interface{}{"common_name": "test.myvault.com", "csr": csrPEM}},
+		{"sign-verbatim/test", map[string]interface{}{"csr": csrPEM}},
+	} {
+		now := time.Now()
+		resp := mustHandle(req.path, req.data)
+		block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if backdate := now.Sub(cert.NotBefore); backdate < 2*time.Minute-5*time.Second || backdate > 2*time.Minute+5*time.Second {
+			t.Fatalf("%s: expected NotBefore to be backdated by 2m, got %s", req.path, backdate)
+		}
+		if validity := cert.NotAfter.Sub(now); validity < time.Hour-5*time.Second || validity > time.Hour+5*time.Second {
+			t.Fatalf("%s: expected NotAfter to be 1h after issuance, got %s", req.path, validity)
+		}
+	}
+}
+
 func TestPki_RoleOUOrganizationUpgrade(t *testing.T) {
 	var resp *logical.Response
 	var err error
@@ -426,6 +767,103 @@ func TestPki_RoleAllowedDomains(t *testing.T) {
 	}
 }
 
+func TestPki_RoleGlobDomains(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "myvault.com",
+			"ttl":         "40h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	writeRole := func(name string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/" + name,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	// Globs made of nothing but wildcards would allow any name
+	for _, domain := range []string{"*", "**", "*.*", "*."} {
+		resp, err = writeRole("hostile", map[string]interface{}{
+			"allowed_domains":    domain,
+			"allow_glob_domains": true,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for allowed domain %q, got err: %v resp: %#v", domain, err, resp)
+		}
+	}
+
+	for _, allowSubdomains := range []bool{false, true} {
+		name := "glob"
+		if allowSubdomains {
+			name = "glob_subdomains"
+		}
+		resp, err = writeRole(name, map[string]interface{}{
+			"allowed_domains":    "*-prod.internal.example.com",
+			"allow_glob_domains": true,
+			"allow_subdomains":   allowSubdomains,
+			"ttl":                "1h",
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+
+	issue := func(role, commonName, altNames string) bool {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/" + role,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"common_name": commonName,
+				"alt_names":   altNames,
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp != nil && !resp.IsError()
+	}
+
+	cases := []struct {
+		commonName string
+		altNames   string
+		glob       bool
+		subdomains bool
+	}{
+		{"svc-prod.internal.example.com", "", true, true},
+		{"svc-prod.internal.example.com", "other-prod.internal.example.com", true, true},
+		{"svc-dev.internal.example.com", "", false, false},
+		{"svc-prod.example.com", "", false, false},
+		{"svc-prod.internal.example.com.evil.com", "", false, false},
+		{"evil.svc-prod.internal.example.com", "", false, true},
+		{"svc-prod.internal.example.com", "evil.svc-prod.internal.example.com", false, true},
+		{"*.svc-prod.internal.example.com", "", false, true},
+		{"*-prod.internal.example.com", "", false, false},
+		{"*.internal.example.com", "", false, false},
+		{"*", "", false, false},
+		{"svc-prod.internal.example.com", "*.svc-prod.internal.example.com", false, true},
+	}
+	for _, tc := range cases {
+		if issued := issue("glob", tc.commonName, tc.altNames); issued != tc.glob {
+			t.Fatalf("%q (alt names %q): expected issued to be %t without subdomains", tc.commonName, tc.altNames, tc.glob)
+		}
+		if issued := issue("glob_subdomains", tc.commonName, tc.altNames); issued != tc.subdomains {
+			t.Fatalf("%q (alt names %q): expected issued to be %t with subdomains", tc.commonName, tc.altNames, tc.subdomains)
+		}
+	}
+}
+
 func TestPki_RoleAllowedURISANs(t *testing.T) {
 	var resp *logical.Response
 	var err error
@@ -644,6 +1082,10 @@ func TestPki_RoleNoStore(t *testing.T) {
 	if err != nil || (resp != nil && resp.IsError()) {
 		t.Fatalf("bad: err: %v resp: %#v", err, resp)
 	}
+	if resp.Secret != nil {
+		t.Fatal("no lease should be created for unstored certificates")
+	}
+	unstoredSerial := resp.Data["serial_number"].(string)
 
 	// list certs
 	resp, err = b.HandleRequest(context.Background(), &logical.Request{
@@ -657,6 +1099,79 @@ func TestPki_RoleNoStore(t *testing.T) {
 	if len(resp.Data["keys"].([]string)) != 1 {
 		t.Fatalf("Only the CA certificate should be stored: %#v", resp)
 	}
+
+	// Unstored certificates can't be revoked individually
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "revoke",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"serial_number": unstoredSerial,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error revoking an unstored certificate, got err: %v resp: %#v", err, resp)
+	}
+
+	// Stored certificates issued alongside are listed and tidied as usual
+	issueReq.Path = "issue/testrole_stored"
+	roleReq.Operation = logical.UpdateOperation
+	roleReq.Path = "roles/testrole_stored"
+	roleReq.Data["no_store"] = false
+	resp, err = b.HandleRequest(context.Background(), roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = b.HandleRequest(context.Background(), issueReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	storedSerial := resp.Data["serial_number"].(string)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "certs",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if !strutil.StrListContains(resp.Data["keys"].([]string), storedSerial) || len(resp.Data["keys"].([]string)) != 2 {
+		t.Fatalf("expected the CA and the stored certificate to be listed: %#v", resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"tidy_cert_store":    true,
+			"tidy_revoked_certs": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	for i := 0; ; i++ {
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "tidy-status",
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		if resp.Data["state"] != "Running" {
+			break
+		}
+		if i == 50 {
+			t.Fatal("tidy did not finish")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if resp.Data["state"] != "Finished" || resp.Data["cert_store_deleted_count"] != uint(0) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
 }
 
 func TestPki_CertsLease(t *testing.T) {
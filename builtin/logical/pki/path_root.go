@@ -112,6 +112,9 @@ func pathSignSelfIssued(b *backend) *framework.Path {
 }
 
 func (b *backend) pathCADeleteRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, pendingCABundlePath); err != nil {
+		return nil, err
+	}
 	return nil, req.Storage.Delete(ctx, "config/ca_bundle")
 }
 
@@ -255,22 +258,21 @@ func (b *backend) pathCASignIntermediate(ctx context.Context, req *logical.Reque
 	}
 
 	role := &roleEntry{
-		OU:                    data.Get("ou").([]string),
-		Organization:          data.Get("organization").([]string),
-		Country:               data.Get("country").([]string),
-		Locality:              data.Get("locality").([]string),
-		Province:              data.Get("province").([]string),
-		StreetAddress:         data.Get("street_address").([]string),
-		PostalCode:            data.Get("postal_code").([]string),
-		TTL:                   time.Duration(data.Get("ttl").(int)) * time.Second,
-		AllowLocalhost:        true,
-		AllowAnyName:          true,
-		AllowIPSANs:           true,
-		EnforceHostnames:      false,
-		KeyType:               "any",
-		AllowedURISANs:        []string{"*"},
-		AllowedSerialNumbers:  []string{"*"},
-		AllowExpirationPastCA: true,
+		OU:                   data.Get("ou").([]string),
+		Organization:         data.Get("organization").([]string),
+		Country:              data.Get("country").([]string),
+		Locality:             data.Get("locality").([]string),
+		Province:             data.Get("province").([]string),
+		StreetAddress:        data.Get("street_address").([]string),
+		PostalCode:           data.Get("postal_code").([]string),
+		TTL:                  time.Duration(data.Get("ttl").(int)) * time.Second,
+		AllowLocalhost:       true,
+		AllowAnyName:         true,
+		AllowIPSANs:          true,
+		EnforceHostnames:     false,
+		KeyType:              "any",
+		AllowedURISANs:       []string{"*"},
+		AllowedSerialNumbers: []string{"*"},
 	}
 
 	if cn := data.Get("common_name").(string); len(cn) == 0 {
@@ -333,10 +335,6 @@ func (b *backend) pathCASignIntermediate(ctx context.Context, req *logical.Reque
 		},
 	}
 
-	if signingBundle.Certificate.NotAfter.Before(parsedBundle.Certificate.NotAfter) {
-		resp.AddWarning("The expiration time for the signed certificate is after the CA's expiration time. If the new certificate is not treated as a root, validation paths with the certificate past the issuing CA's expiration time will fail.")
-	}
-
 	switch format {
 	case "pem":
 		resp.Data["certificate"] = cb.Certificate
@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -55,6 +57,19 @@ Defaults to 72 hours.`,
 	}
 }
 
+func pathTidyStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-status$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTidyStatusRead,
+		},
+
+		HelpSynopsis:    pathTidyStatusHelpSyn,
+		HelpDescription: pathTidyStatusHelpDesc,
+	}
+}
+
 func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	// If we are a performance standby forward the request to the active node
 	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
@@ -63,8 +78,7 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 
 	safetyBuffer := d.Get("safety_buffer").(int)
 	tidyCertStore := d.Get("tidy_cert_store").(bool)
-	tidyRevokedCerts := d.Get("tidy_revoked_certs").(bool)
-	tidyRevocationList := d.Get("tidy_revocation_list").(bool)
+	tidyRevokedCerts := d.Get("tidy_revoked_certs").(bool) || d.Get("tidy_revocation_list").(bool)
 
 	if safetyBuffer < 1 {
 		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
@@ -84,6 +98,8 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 		Storage: req.Storage,
 	}
 
+	b.tidyStatusStart(safetyBuffer, tidyCertStore, tidyRevokedCerts)
+
 	go func() {
 		defer atomic.StoreUint32(b.tidyCASGuard, 0)
 
@@ -93,13 +109,30 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 		logger := b.Logger().Named("tidy")
 
 		doTidy := func() error {
+			// The entry of the CA certificate is kept even once it expires
+			var caSerial string
+			caInfo, err := fetchCAInfo(ctx, req)
+			switch err.(type) {
+			case nil:
+				caSerial = normalizeSerial(certutil.GetHexFormatted(caInfo.Certificate.SerialNumber.Bytes(), ":"))
+			case errutil.UserError:
+			default:
+				return errwrap.Wrapf("error fetching CA certificate: {{err}}", err)
+			}
+
 			if tidyCertStore {
 				serials, err := req.Storage.List(ctx, "certs/")
 				if err != nil {
 					return errwrap.Wrapf("error fetching list of certs: {{err}}", err)
 				}
 
-				for _, serial := range serials {
+				for i, serial := range serials {
+					b.tidyStatusMessage(fmt.Sprintf("Tidying certificate store: checking entry %d of %d", i+1, len(serials)))
+
+					if serial == caSerial {
+						continue
+					}
+
 					certEntry, err := req.Storage.Get(ctx, "certs/"+serial)
 					if err != nil {
 						return errwrap.Wrapf(fmt.Sprintf("error fetching certificate %q: {{err}}", serial), err)
@@ -110,6 +143,7 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 							return errwrap.Wrapf(fmt.Sprintf("error deleting nil entry with serial %s: {{err}}", serial), err)
 						}
+						b.tidyStatusIncCertStoreCount()
 						continue
 					}
 
@@ -118,6 +152,8 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 							return errwrap.Wrapf(fmt.Sprintf("error deleting entry with nil value with serial %s: {{err}}", serial), err)
 						}
+						b.tidyStatusIncCertStoreCount()
+						continue
 					}
 
 					cert, err := x509.ParseCertificate(certEntry.Value)
@@ -129,11 +165,12 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 							return errwrap.Wrapf(fmt.Sprintf("error deleting serial %q from storage: {{err}}", serial), err)
 						}
+						b.tidyStatusIncCertStoreCount()
 					}
 				}
 			}
 
-			if tidyRevokedCerts || tidyRevocationList {
+			if tidyRevokedCerts {
 				b.revokeStorageLock.Lock()
 				defer b.revokeStorageLock.Unlock()
 
@@ -144,8 +181,13 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 					return errwrap.Wrapf("error fetching list of revoked certs: {{err}}", err)
 				}
 
-				var revInfo revocationInfo
-				for _, serial := range revokedSerials {
+				for i, serial := range revokedSerials {
+					b.tidyStatusMessage(fmt.Sprintf("Tidying revoked certificates: checking certificate %d of %d", i+1, len(revokedSerials)))
+
+					if serial == caSerial {
+						continue
+					}
+
 					revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
 					if err != nil {
 						return errwrap.Wrapf(fmt.Sprintf("unable to fetch revoked cert with serial %q: {{err}}", serial), err)
@@ -156,6 +198,8 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 						if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
 							return errwrap.Wrapf(fmt.Sprintf("error deleting nil revoked entry with serial %s: {{err}}", serial), err)
 						}
+						b.tidyStatusIncRevokedCertCount()
+						continue
 					}
 
 					if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
@@ -163,8 +207,11 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 						if err := req.Storage.Delete(ctx, "revoked/"+serial); err != nil {
 							return errwrap.Wrapf(fmt.Sprintf("error deleting revoked entry with nil value with serial %s: {{err}}", serial), err)
 						}
+						b.tidyStatusIncRevokedCertCount()
+						continue
 					}
 
+					var revInfo revocationInfo
 					err = revokedEntry.DecodeJSON(&revInfo)
 					if err != nil {
 						return errwrap.Wrapf(fmt.Sprintf("error decoding revocation entry for serial %q: {{err}}", serial), err)
@@ -182,11 +229,13 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 						if err := req.Storage.Delete(ctx, "certs/"+serial); err != nil {
 							return errwrap.Wrapf(fmt.Sprintf("error deleting serial %q from store when tidying revoked: {{err}}", serial), err)
 						}
+						b.tidyStatusIncRevokedCertCount()
 						tidiedRevoked = true
 					}
 				}
 
 				if tidiedRevoked {
+					b.tidyStatusMessage("Rebuilding the CRL")
 					if err := buildCRL(ctx, b, req, false); err != nil {
 						return err
 					}
@@ -198,15 +247,120 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 
 		if err := doTidy(); err != nil {
 			logger.Error("error running tidy", "error", err)
+			b.tidyStatusStop(err)
 			return
 		}
+
+		b.tidyStatusStop(nil)
 	}()
 
 	resp := &logical.Response{}
-	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs and its status can be read from the tidy-status endpoint.")
 	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
 }
 
+func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// If we are a performance standby forward the request to the active node
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil, logical.ErrReadOnly
+	}
+
+	b.tidyStatusLock.RLock()
+	defer b.tidyStatusLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"safety_buffer":              nil,
+			"tidy_cert_store":            nil,
+			"tidy_revoked_certs":         nil,
+			"state":                      "Inactive",
+			"error":                      nil,
+			"time_started":               nil,
+			"time_finished":              nil,
+			"message":                    nil,
+			"cert_store_deleted_count":   nil,
+			"revoked_cert_deleted_count": nil,
+		},
+	}
+
+	if b.tidyStatus == nil || b.tidyStatus.state == tidyStatusInactive {
+		return resp, nil
+	}
+
+	resp.Data["safety_buffer"] = b.tidyStatus.safetyBuffer
+	resp.Data["tidy_cert_store"] = b.tidyStatus.tidyCertStore
+	resp.Data["tidy_revoked_certs"] = b.tidyStatus.tidyRevokedCerts
+	resp.Data["time_started"] = b.tidyStatus.timeStarted.Format(time.RFC3339Nano)
+	resp.Data["message"] = b.tidyStatus.message
+	resp.Data["cert_store_deleted_count"] = b.tidyStatus.certStoreDeletedCount
+	resp.Data["revoked_cert_deleted_count"] = b.tidyStatus.revokedCertDeletedCount
+
+	switch b.tidyStatus.state {
+	case tidyStatusStarted:
+		resp.Data["state"] = "Running"
+	case tidyStatusFinished:
+		resp.Data["state"] = "Finished"
+		resp.Data["time_finished"] = b.tidyStatus.timeFinished.Format(time.RFC3339Nano)
+		resp.Data["message"] = nil
+	case tidyStatusError:
+		resp.Data["state"] = "Error"
+		resp.Data["time_finished"] = b.tidyStatus.timeFinished.Format(time.RFC3339Nano)
+		resp.Data["error"] = b.tidyStatus.err.Error()
+		// Don't clear the message so that it serves as a hint about when
+		// the error occurred
+	}
+
+	return resp, nil
+}
+
+func (b *backend) tidyStatusStart(safetyBuffer int, tidyCertStore, tidyRevokedCerts bool) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus = &tidyStatus{
+		safetyBuffer:     safetyBuffer,
+		tidyCertStore:    tidyCertStore,
+		tidyRevokedCerts: tidyRevokedCerts,
+
+		state:       tidyStatusStarted,
+		timeStarted: time.Now(),
+	}
+}
+
+func (b *backend) tidyStatusStop(err error) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.timeFinished = time.Now()
+	b.tidyStatus.err = err
+	if err == nil {
+		b.tidyStatus.state = tidyStatusFinished
+	} else {
+		b.tidyStatus.state = tidyStatusError
+	}
+}
+
+func (b *backend) tidyStatusMessage(msg string) {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.message = msg
+}
+
+func (b *backend) tidyStatusIncCertStoreCount() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.certStoreDeletedCount++
+}
+
+func (b *backend) tidyStatusIncRevokedCertCount() {
+	b.tidyStatusLock.Lock()
+	defer b.tidyStatusLock.Unlock()
+
+	b.tidyStatus.revokedCertDeletedCount++
+}
+
 const pathTidyHelpSyn = `
 Tidy up the backend by removing expired certificates, revocation information,
 or both.
@@ -218,7 +372,7 @@ removed from the backend, freeing up storage and shortening CRLs.
 
 For safety, this function is a noop if called without parameters; cleanup from
 normal certificate storage must be enabled with 'tidy_cert_store' and cleanup
-from revocation information must be enabled with 'tidy_revocation_list'.
+from revocation information must be enabled with 'tidy_revoked_certs'.
 
 The 'safety_buffer' parameter is useful to ensure that clock skew amongst your
 hosts cannot lead to a certificate being removed from the CRL while it is still
@@ -231,5 +385,32 @@ will be checked when this endpoint is hit. The expiration of the
 certificate/revocation information of each certificate being held in
 certificate storage or in revocation information will then be checked. If the
 current time, minus the value of 'safety_buffer', is greater than the
-expiration, it will be removed.
+expiration, it will be removed. The entry of the CA certificate is never
+removed.
+
+The operation runs in the background; its progress and outcome can be read
+from the 'tidy-status' endpoint.
+`
+
+const pathTidyStatusHelpSyn = `
+Returns the status of the tidy operation.
+`
+
+const pathTidyStatusHelpDesc = `
+This is a read only endpoint that returns information about the current tidy
+operation, or the most recent if none is currently running.
+
+The result includes the following fields:
+* 'safety_buffer': the value of this parameter when initiating the tidy operation
+* 'tidy_cert_store': the value of this parameter when initiating the tidy operation
+* 'tidy_revoked_certs': the value of this parameter when initiating the tidy operation
+* 'state': one of "Inactive", "Running", "Finished", "Error"
+* 'error': the error message, if the operation ran into an error
+* 'time_started': the time the operation started
+* 'time_finished': the time the operation finished
+* 'message': One of "Tidying certificate store: checking entry N of TOTAL",
+  "Tidying revoked certificates: checking certificate N of TOTAL" or
+  "Rebuilding the CRL"
+* 'cert_store_deleted_count': The number of certificate storage entries deleted
+* 'revoked_cert_deleted_count': The number of revoked certificate entries deleted
 `
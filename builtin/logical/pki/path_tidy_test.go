@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPki_Tidy(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	handle := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: path: %s, err: %v, resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	resp = handle(logical.ReadOperation, "tidy-status", nil)
+	if resp.Data["state"] != "Inactive" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The CA expires shortly after the certificates it issues so that its own
+	// entry is eligible for tidying as well
+	resp = handle(logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"ttl":         "8s",
+	})
+	caSerial := normalizeSerial(resp.Data["serial_number"].(string))
+
+	handle(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allow_any_name": true,
+		"ttl":            "2s",
+	})
+
+	resp = handle(logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "expired.myvault.com",
+	})
+	expiredSerial := normalizeSerial(resp.Data["serial_number"].(string))
+
+	resp = handle(logical.UpdateOperation, "issue/test", map[string]interface{}{
+		"common_name": "revoked.myvault.com",
+		"ttl":         "5s",
+	})
+	revokedSerial := normalizeSerial(resp.Data["serial_number"].(string))
+	handle(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+
+	// Wait for everything, including the CA, to expire
+	time.Sleep(10 * time.Second)
+
+	handle(logical.UpdateOperation, "tidy", map[string]interface{}{
+		"safety_buffer":        "1s",
+		"tidy_cert_store":      true,
+		"tidy_revocation_list": true,
+	})
+
+	for i := 0; ; i++ {
+		resp = handle(logical.ReadOperation, "tidy-status", nil)
+		if resp.Data["state"] != "Running" {
+			break
+		}
+		if i == 50 {
+			t.Fatal("tidy did not finish")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if resp.Data["state"] != "Finished" || resp.Data["error"] != nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["safety_buffer"] != 1 || resp.Data["tidy_cert_store"] != true || resp.Data["tidy_revoked_certs"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["cert_store_deleted_count"] != uint(2) || resp.Data["revoked_cert_deleted_count"] != uint(1) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["time_started"] == nil || resp.Data["time_finished"] == nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, key := range []string{"certs/" + expiredSerial, "certs/" + revokedSerial, "revoked/" + revokedSerial} {
+		entry, err := storage.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry != nil {
+			t.Fatalf("expected %s to be tidied", key)
+		}
+	}
+
+	// The CA entries are never removed
+	for _, key := range []string{"certs/" + caSerial, "config/ca_bundle"} {
+		entry, err := storage.Get(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			t.Fatalf("expected %s to be kept", key)
+		}
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"safety_buffer": "0s",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error with a zero safety buffer, got resp: %#v, err: %v", resp, err)
+	}
+}
@@ -1,7 +1,30 @@
 package pki
 
-import "strings"
+import (
+	"math/big"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/certutil"
+)
 
 func normalizeSerial(serial string) string {
 	return strings.Replace(strings.ToLower(serial), ":", "-", -1)
 }
+
+// canonicalSerial turns a serial given as hex, with or without colon or hyphen
+// separators and leading zeros, into the colon-separated form certificates are
+// stored under. Values that aren't hex, such as "crl", are returned unchanged.
+func canonicalSerial(serial string) string {
+	hexSerial := strings.NewReplacer(":", "", "-", "").Replace(serial)
+	n, ok := new(big.Int).SetString(hexSerial, 16)
+	if !ok || n.Sign() <= 0 {
+		return serial
+	}
+	return certutil.GetHexFormatted(n.Bytes(), ":")
+}
+
+// denormalizeSerial turns a serial as stored into the colon-separated form
+// used in API responses
+func denormalizeSerial(serial string) string {
+	return strings.Replace(strings.ToLower(serial), "-", ":", -1)
+}
@@ -34,6 +34,8 @@ func Backend(conf *logical.BackendConfig) *backend {
 
 		Paths: []*framework.Path{
 			pathConfigConnection(&b),
+			pathResetConnection(&b),
+			pathRotateRoot(&b),
 			pathConfigLease(&b),
 			pathListRoles(&b),
 			pathRoles(&b),
@@ -59,6 +61,9 @@ type backend struct {
 	db   *sql.DB
 	lock sync.Mutex
 
+	// rotateRootLock serializes rotations of the root password
+	rotateRootLock sync.Mutex
+
 	logger log.Logger
 }
 
@@ -120,6 +125,7 @@ func (b *backend) DB(ctx context.Context, s logical.Storage) (*sql.DB, error) {
 	// since the request rate shouldn't be high.
 	b.db.SetMaxOpenConns(connConfig.MaxOpenConnections)
 	b.db.SetMaxIdleConns(connConfig.MaxIdleConnections)
+	b.db.SetConnMaxLifetime(connConfig.MaxConnectionLifetime)
 
 	return b.db, nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/dbtxn"
@@ -59,19 +60,11 @@ func (b *backend) pathRoleCreateRead(ctx context.Context, req *logical.Request,
 		}
 	}
 
-	// Generate the username, password and expiration. PG limits user to 63 characters
-	displayName := req.DisplayName
-	if len(displayName) > 26 {
-		displayName = displayName[:26]
-	}
-	userUUID, err := uuid.GenerateUUID()
+	// Generate the username, password and expiration
+	username, err := generateUsername(role, req.DisplayName)
 	if err != nil {
 		return nil, err
 	}
-	username := fmt.Sprintf("%s-%s", displayName, userUUID)
-	if len(username) > 63 {
-		username = username[:63]
-	}
 	password, err := uuid.GenerateUUID()
 	if err != nil {
 		return nil, err
@@ -138,6 +131,39 @@ func (b *backend) pathRoleCreateRead(ctx context.Context, req *logical.Request,
 	return resp, nil
 }
 
+// generateUsername returns a new username for the role: the username prefix,
+// or the token display name truncated to role.DisplaynameLength, followed by a
+// UUID. The result is truncated to role.UsernameLength so that PostgreSQL
+// never has to shorten it; revocation relies on the stored name matching the
+// role exactly.
+func generateUsername(role *roleEntry, displayName string) (string, error) {
+	userUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	var username string
+	if role.UsernamePrefix != "" {
+		username = role.UsernamePrefix + userUUID
+	} else {
+		username = fmt.Sprintf("%s-%s", truncate(displayName, role.DisplaynameLength), userUUID)
+	}
+
+	return truncate(username, role.UsernameLength), nil
+}
+
+// truncate shortens s to at most n bytes without splitting a multi-byte
+// character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 const pathRoleCreateReadHelpSyn = `
 Request database credentials for a certain role.
 `
@@ -44,6 +44,31 @@ string, a base64-encoded semicolon-separated string, a serialized JSON string
 array, or a base64-encoded serialized JSON string array. The '{{name}}' value
 will be substituted.`,
 			},
+
+			"renew_sql": {
+				Type: framework.TypeString,
+				Description: `SQL statements to be executed to renew a user. Must be a semicolon-separated
+string, a base64-encoded semicolon-separated string, a serialized JSON string
+array, or a base64-encoded serialized JSON string array. The '{{name}}' and
+'{{expiration}}' values will be substituted.`,
+			},
+
+			"username_length": {
+				Type:        framework.TypeInt,
+				Description: "Number of characters to truncate generated usernames to. Cannot exceed 63, the PostgreSQL limit.",
+				Default:     maxUsernameLength,
+			},
+
+			"displayname_length": {
+				Type:        framework.TypeInt,
+				Description: "Number of characters to truncate the display name portion of generated usernames to.",
+				Default:     26,
+			},
+
+			"username_prefix": {
+				Type:        framework.TypeString,
+				Description: "Prefix of generated usernames. If set, usernames are the prefix followed by random characters, and the display name is not included.",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -66,7 +91,11 @@ func (b *backend) Role(ctx context.Context, s logical.Storage, n string) (*roleE
 		return nil, nil
 	}
 
-	var result roleEntry
+	// Set defaults to handle upgrade cases
+	result := roleEntry{
+		UsernameLength:    maxUsernameLength,
+		DisplaynameLength: 26,
+	}
 	if err := entry.DecodeJSON(&result); err != nil {
 		return nil, err
 	}
@@ -94,8 +123,12 @@ func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"sql":            role.SQL,
-			"revocation_sql": role.RevocationSQL,
+			"sql":                role.SQL,
+			"revocation_sql":     role.RevocationSQL,
+			"renew_sql":          role.RenewSQL,
+			"username_length":    role.UsernameLength,
+			"displayname_length": role.DisplaynameLength,
+			"username_prefix":    role.UsernamePrefix,
 		},
 	}, nil
 }
@@ -113,6 +146,22 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 	name := data.Get("name").(string)
 	sql := data.Get("sql").(string)
 
+	usernameLength := data.Get("username_length").(int)
+	displaynameLength := data.Get("displayname_length").(int)
+	usernamePrefix := data.Get("username_prefix").(string)
+	if usernameLength < 1 || usernameLength > maxUsernameLength {
+		return logical.ErrorResponse(fmt.Sprintf("username_length must be between 1 and %d", maxUsernameLength)), nil
+	}
+	if displaynameLength < 0 {
+		return logical.ErrorResponse("displayname_length cannot be negative"), nil
+	}
+	if !usernamePrefixRe.MatchString(usernamePrefix) {
+		return logical.ErrorResponse("username_prefix may only contain letters, digits, underscores and dashes"), nil
+	}
+	if usernamePrefix != "" && len(usernamePrefix)+minUsernameRandomLength > usernameLength {
+		return logical.ErrorResponse(fmt.Sprintf("username_prefix must leave at least %d characters of username_length for random characters", minUsernameRandomLength)), nil
+	}
+
 	// Get our connection
 	db, err := b.DB(ctx, req.Storage)
 	if err != nil {
@@ -140,8 +189,12 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 
 	// Store it
 	entry, err := logical.StorageEntryJSON("role/"+name, &roleEntry{
-		SQL:           sql,
-		RevocationSQL: data.Get("revocation_sql").(string),
+		SQL:               sql,
+		RevocationSQL:     data.Get("revocation_sql").(string),
+		RenewSQL:          data.Get("renew_sql").(string),
+		UsernameLength:    usernameLength,
+		DisplaynameLength: displaynameLength,
+		UsernamePrefix:    usernamePrefix,
 	})
 	if err != nil {
 		return nil, err
@@ -154,8 +207,12 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 }
 
 type roleEntry struct {
-	SQL           string `json:"sql" mapstructure:"sql" structs:"sql"`
-	RevocationSQL string `json:"revocation_sql" mapstructure:"revocation_sql" structs:"revocation_sql"`
+	SQL               string `json:"sql" mapstructure:"sql" structs:"sql"`
+	RevocationSQL     string `json:"revocation_sql" mapstructure:"revocation_sql" structs:"revocation_sql"`
+	RenewSQL          string `json:"renew_sql" mapstructure:"renew_sql" structs:"renew_sql"`
+	UsernameLength    int    `json:"username_length" mapstructure:"username_length" structs:"username_length"`
+	DisplaynameLength int    `json:"displayname_length" mapstructure:"displayname_length" structs:"displayname_length"`
+	UsernamePrefix    string `json:"username_prefix" mapstructure:"username_prefix" structs:"username_prefix"`
 }
 
 const pathRoleHelpSyn = `
@@ -194,4 +251,27 @@ Example of a decent revocation SQL query to use:
 	REVOKE ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public FROM {{name}};
 	REVOKE USAGE ON SCHEMA public FROM {{name}};
 	DROP ROLE IF EXISTS {{name}};
+
+The revocation statements are executed in a single transaction. If the user
+owns database objects, the statements must reassign or drop them before the
+role can be dropped, for example:
+
+	REASSIGN OWNED BY "{{name}}" TO "owner";
+	DROP OWNED BY "{{name}}";
+	DROP ROLE IF EXISTS "{{name}}";
+
+The "renew_sql" parameter customizes the SQL string used to renew a user.
+Both the "name" and "expiration" values are substituted, and the statements
+are executed in a single transaction. By default, renewal updates the VALID
+UNTIL attribute of the user:
+
+	ALTER ROLE "{{name}}" VALID UNTIL '{{expiration}}';
+
+Generated usernames consist of the token display name, truncated to
+"displayname_length" characters (default 26), followed by a uuid. The
+"username_prefix" parameter replaces the display name, in which case usernames
+are the prefix followed by the uuid. The whole name is truncated to
+"username_length" characters, which defaults to and cannot exceed 63, the
+longest name PostgreSQL accepts without truncating it. A prefix must leave at
+least 8 characters for the uuid.
 `
@@ -0,0 +1,175 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/lib/pq"
+)
+
+// rotateRootGracePeriod is how long the connection pool using the old root
+// password is kept open after a rotation, so that requests which already
+// obtained it can finish.
+const rotateRootGracePeriod = time.Minute
+
+var (
+	connUserRe     = regexp.MustCompile(`(?:^|\s)user\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+	connPasswordRe = regexp.MustCompile(`(?:^|\s)password\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+)
+
+func pathRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-root",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootUpdate,
+		},
+
+		HelpSynopsis:    pathRotateRootHelpSyn,
+		HelpDescription: pathRotateRootHelpDesc,
+	}
+}
+
+func (b *backend) pathRotateRootUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+
+	origEntry, err := req.Storage.Get(ctx, "config/connection")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connection configuration")
+	}
+	if origEntry == nil {
+		return logical.ErrorResponse("configure the DB connection with config/connection first"), nil
+	}
+
+	var config connectionConfig
+	if err := origEntry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+
+	connURL := config.ConnectionURL
+	if connURL == "" {
+		connURL = config.ConnectionString
+	}
+
+	password, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	username, newConnURL, err := setConnectionPassword(connURL, password)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	db, err := b.DB(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hold the lock until the new configuration is stored so that no
+	// connection is opened with a password that is no longer valid
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf("ALTER ROLE %s WITH PASSWORD '%s'", pq.QuoteIdentifier(username), strings.Replace(password, "'", "''", -1))
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return nil, fmt.Errorf("failed to change the password of %q: %s", username, err)
+	}
+
+	// Only commit once the new password is stored, so that a storage failure
+	// leaves the old password in place
+	config.ConnectionURL = newConnURL
+	config.ConnectionString = ""
+	entry, err := logical.StorageEntryJSON("config/connection", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// Restore the old configuration since the password was not changed
+		if putErr := req.Storage.Put(ctx, origEntry); putErr != nil {
+			b.logger.Error("failed to restore connection configuration", "error", putErr)
+		}
+		return nil, err
+	}
+
+	// Connections that are already open stay authenticated; let requests
+	// using the old pool finish before closing it
+	if b.db != nil {
+		oldDB := b.db
+		time.AfterFunc(rotateRootGracePeriod, func() { oldDB.Close() })
+		b.db = nil
+	}
+
+	return nil, nil
+}
+
+// setConnectionPassword replaces the password in a PostgreSQL connection URL
+// or key/value connection string. It returns the user the connection
+// authenticates as along with the rewritten connection string.
+func setConnectionPassword(connURL, password string) (string, string, error) {
+	if strings.HasPrefix(connURL, "postgres://") || strings.HasPrefix(connURL, "postgresql://") {
+		u, err := url.Parse(connURL)
+		if err != nil {
+			return "", "", fmt.Errorf("unable to parse connection url")
+		}
+		if u.User == nil || u.User.Username() == "" {
+			return "", "", fmt.Errorf("connection url does not contain a username")
+		}
+		if _, ok := u.User.Password(); !ok {
+			return "", "", fmt.Errorf("connection url does not contain a password")
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+		return u.User.Username(), u.String(), nil
+	}
+
+	userMatch := connUserRe.FindStringSubmatch(connURL)
+	if userMatch == nil {
+		return "", "", fmt.Errorf("connection string does not contain a user")
+	}
+	loc := connPasswordRe.FindStringSubmatchIndex(connURL)
+	if loc == nil {
+		return "", "", fmt.Errorf("connection string does not contain a password")
+	}
+
+	quoted := "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password) + "'"
+	newConnURL := connURL[:loc[2]] + quoted + connURL[loc[3]:]
+	return unquoteConnValue(userMatch[1]), newConnURL, nil
+}
+
+// unquoteConnValue removes the quoting from a key/value connection string
+// value.
+func unquoteConnValue(v string) string {
+	if len(v) < 2 || v[0] != '\'' || v[len(v)-1] != '\'' {
+		return v
+	}
+	return strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(v[1 : len(v)-1])
+}
+
+const pathRotateRootHelpSyn = `
+Rotate the password of the user Vault connects to PostgreSQL with.
+`
+
+const pathRotateRootHelpDesc = `
+This path generates a new password for the user in the connection URL, changes
+it in the database using the current connection, and stores the updated
+connection URL. The new password is never returned. The user must be allowed
+to change its own password.
+`
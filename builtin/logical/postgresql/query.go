@@ -2,9 +2,23 @@ package postgresql
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+const (
+	// maxUsernameLength is the longest identifier PostgreSQL stores without
+	// truncating it.
+	maxUsernameLength = 63
+
+	// minUsernameRandomLength is the number of characters of a generated
+	// username that must be left for the random suffix when a username prefix
+	// is used.
+	minUsernameRandomLength = 8
+)
+
+var usernamePrefixRe = regexp.MustCompile(`^[a-zA-Z0-9_-]*$`)
+
 // Query templates a query for us.
 func Query(tpl string, data map[string]string) string {
 	for k, v := range data {
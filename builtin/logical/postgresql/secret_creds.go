@@ -47,6 +47,17 @@ func (b *backend) secretCredsRenew(ctx context.Context, req *logical.Request, d
 	if !ok {
 		return nil, fmt.Errorf("usernameRaw is not a string")
 	}
+	var renewSQL string
+	if roleNameRaw, ok := req.Secret.InternalData["role"]; ok {
+		role, err := b.Role(ctx, req.Storage, roleNameRaw.(string))
+		if err != nil {
+			return nil, err
+		}
+		if role != nil {
+			renewSQL = role.RenewSQL
+		}
+	}
+
 	// Get our connection
 	db, err := b.DB(ctx, req.Storage)
 	if err != nil {
@@ -74,16 +85,44 @@ func (b *backend) secretCredsRenew(ctx context.Context, req *logical.Request, d
 		expireTime = expireTime.Add(5 * time.Second)
 		expiration := expireTime.Format("2006-01-02 15:04:05-0700")
 
-		query := fmt.Sprintf(
-			"ALTER ROLE %s VALID UNTIL '%s';",
-			pq.QuoteIdentifier(username),
-			expiration)
-		stmt, err := db.Prepare(query)
+		// Execute the statements within a transaction so that a failure
+		// leaves the user's expiration unchanged
+		tx, err := db.Begin()
 		if err != nil {
 			return nil, err
 		}
-		defer stmt.Close()
-		if _, err := stmt.Exec(); err != nil {
+		defer func() {
+			tx.Rollback()
+		}()
+
+		switch renewSQL {
+		case "":
+			query := fmt.Sprintf(
+				"ALTER ROLE %s VALID UNTIL '%s';",
+				pq.QuoteIdentifier(username),
+				expiration)
+			if _, err := tx.ExecContext(ctx, query); err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("failed to renew user %q: {{err}}", username), err)
+			}
+
+		default:
+			for _, query := range strutil.ParseArbitraryStringSlice(renewSQL, ";") {
+				query = strings.TrimSpace(query)
+				if len(query) == 0 {
+					continue
+				}
+
+				m := map[string]string{
+					"name":       username,
+					"expiration": expiration,
+				}
+				if err := dbtxn.ExecuteTxQuery(ctx, tx, m, query); err != nil {
+					return nil, errwrap.Wrapf(fmt.Sprintf("failed to renew user %q: {{err}}", username), err)
+				}
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
 			return nil, err
 		}
 	}
@@ -233,7 +272,7 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 		}
 		defer stmt.Close()
 		if _, err := stmt.Exec(); err != nil {
-			return nil, err
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to drop user %q: {{err}}", username), err)
 		}
 
 	// We have revocation SQL, execute directly, within a transaction
@@ -256,7 +295,7 @@ func (b *backend) secretCredsRevoke(ctx context.Context, req *logical.Request, d
 				"name": username,
 			}
 			if err := dbtxn.ExecuteTxQuery(ctx, tx, m, query); err != nil {
-				return nil, err
+				return nil, errwrap.Wrapf(fmt.Sprintf("failed to revoke user %q: {{err}}", username), err)
 			}
 		}
 
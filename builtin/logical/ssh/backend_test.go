@@ -214,6 +214,305 @@ func TestBackend_allowed_users(t *testing.T) {
 	}
 }
 
+func TestBackend_OTPFormat(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Setup(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	roleData := func(extra map[string]interface{}) map[string]interface{} {
+		data := map[string]interface{}{
+			"key_type":     "otp",
+			"default_user": "ubuntu",
+			"cidr_list":    "52.207.235.245/16",
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+		return data
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{"otp_length": 4},
+		{"otp_length": 129},
+		{"otp_charset": "0123456789"},
+		{"otp_length": 16, "otp_charset": "a"},
+		{"otp_length": 16, "otp_charset": "abca"},
+		{"otp_length": 16, "otp_charset": "ab c"},
+	} {
+		resp, err := write("roles/role1", roleData(invalid))
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v: resp:%#v err:%s", invalid, resp, err)
+		}
+	}
+
+	resp, err := write("roles/role1", roleData(map[string]interface{}{
+		"otp_length":  20,
+		"otp_charset": "0123456789",
+	}))
+	if err != nil || resp != nil {
+		t.Fatalf("failed to create role: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/role1",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || resp.Data["otp_length"] != 20 || resp.Data["otp_charset"] != "0123456789" {
+		t.Fatalf("bad: resp:%#v err:%s", resp, err)
+	}
+
+	resp, err = write("creds/role1", map[string]interface{}{
+		"ip":       "52.207.235.245",
+		"username": "ubuntu",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to create credential: resp:%#v err:%s", resp, err)
+	}
+	otp := resp.Data["key"].(string)
+	if len(otp) != 20 || strings.Trim(otp, "0123456789") != "" {
+		t.Fatalf("bad OTP: %q", otp)
+	}
+
+	resp, err = write("verify", map[string]interface{}{
+		"otp": otp,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to verify OTP: resp:%#v err:%s", resp, err)
+	}
+	if resp.Data["username"] != "ubuntu" || resp.Data["ip"] != "52.207.235.245" || resp.Data["role_name"] != "role1" {
+		t.Fatalf("bad: resp:%#v", resp)
+	}
+}
+
+func TestBackend_CredsIPValidation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Setup(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	writeRole := func(name string, extra map[string]interface{}) (*logical.Response, error) {
+		data := map[string]interface{}{
+			"key_type":     "otp",
+			"default_user": "ubuntu",
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+		return write("roles/"+name, data)
+	}
+
+	resp, err := writeRole("invalid", map[string]interface{}{
+		"cidr_list": "not-a-cidr",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for invalid cidr_list: resp:%#v err:%s", resp, err)
+	}
+
+	// Blocks covering every address are accepted with a warning pointing to
+	// allow_zero_address
+	for _, cidrList := range []string{"10.0.0.0/8,::/0", "0.0.0.0/0"} {
+		resp, err := writeRole("anyv4", map[string]interface{}{
+			"cidr_list": cidrList,
+		})
+		if err != nil || resp == nil || resp.IsError() || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "allow_zero_address") {
+			t.Fatalf("expected a warning for cidr_list %q: resp:%#v err:%s", cidrList, resp, err)
+		}
+	}
+
+
+	for name, data := range map[string]map[string]interface{}{
+		"v4": {
+			"cidr_list": "10.0.0.0/8, 192.168.0.0/16",
+		},
+		"v6": {
+			"cidr_list":         "2001:db8::/32,fd00::/8",
+			"exclude_cidr_list": "2001:db8:dead::/48",
+		},
+		"zero": {
+			"cidr_list":          "0.0.0.0/0",
+			"exclude_cidr_list":  "10.0.0.0/8",
+			"allow_zero_address": true,
+		},
+		"empty":        {},
+		"empty-listed": {},
+	} {
+		resp, err := writeRole(name, data)
+		if err != nil || resp != nil {
+			t.Fatalf("failed to create role %q: resp:%#v err:%s", name, resp, err)
+		}
+	}
+
+	// The global zero-address list still works, but is deprecated
+	resp, err = write("config/zeroaddress", map[string]interface{}{
+		"roles": "empty-listed",
+	})
+	if err != nil || resp == nil || resp.IsError() || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "deprecated") {
+		t.Fatalf("expected a deprecation warning: resp:%#v err:%s", resp, err)
+	}
+
+	for _, tc := range []struct {
+		role  string
+		ip    string
+		error string
+	}{
+		{"v4", "192.168.1.1", ""},
+		{"v4", "10.1.2.3", ""},
+		{"v4", "172.16.0.1", `IP "172.16.0.1" does not belong to any of the CIDR blocks of role "v4": 10.0.0.0/8, 192.168.0.0/16`},
+		{"v4", "2001:db8::1", "does not belong"},
+		{"v6", "2001:db8::1", ""},
+		{"v6", "2001:DB8:0:0::2", ""},
+		{"v6", "fd12:3456::1", ""},
+		{"v6", "2001:db8:dead::1", `IP "2001:db8:dead::1" belongs to the excluded CIDR block "2001:db8:dead::/48" of role "v6"`},
+		{"v6", "2001:db9::1", "2001:db8::/32, fd00::/8"},
+		{"v6", "10.1.2.3", "does not belong"},
+		{"zero", "8.8.8.8", ""},
+		{"zero", "2001:db8::1", ""},
+		{"zero", "10.1.2.3", "excluded CIDR block"},
+		{"empty", "10.1.2.3", "no CIDR blocks configured"},
+		{"empty-listed", "10.1.2.3", ""},
+		{"anyv4", "8.8.8.8", ""},
+		{"anyv4", "2001:db8::1", "does not belong"},
+	} {
+		resp, err := write("creds/"+tc.role, map[string]interface{}{
+			"ip": tc.ip,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.error == "" {
+			if resp == nil || resp.IsError() {
+				t.Fatalf("role %q, IP %q: failed to create credential: resp:%#v", tc.role, tc.ip, resp)
+			}
+			continue
+		}
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), tc.error) {
+			t.Fatalf("role %q, IP %q: expected error containing %q, got resp:%#v", tc.role, tc.ip, tc.error, resp)
+		}
+	}
+
+	resp, err = write("lookup", map[string]interface{}{
+		"ip": "2001:db8::1",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to look up roles: resp:%#v err:%s", resp, err)
+	}
+	if roles := resp.Data["roles"].([]string); !reflect.DeepEqual(roles, []string{"v6", "zero", "empty-listed"}) {
+		t.Fatalf("expected roles [v6 zero empty-listed], got %v", roles)
+	}
+}
+
+func TestBackend_DynamicRoleInstallScript(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Setup(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.UpdateOperation, "keys/"+testKeyName, map[string]interface{}{
+		"key": testSharedPrivateKey,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("failed to write key: resp:%#v err:%s", resp, err)
+	}
+
+	writeRole := func(script string) (*logical.Response, error) {
+		return request(logical.UpdateOperation, "roles/"+testDynamicRoleName, map[string]interface{}{
+			"key_type":       testDynamicKeyType,
+			"key":            testKeyName,
+			"admin_user":     testAdminUser,
+			"default_user":   testAdminUser,
+			"cidr_list":      testCIDRList,
+			"install_script": script,
+		})
+	}
+
+	checkCustom := func(script string, custom bool) {
+		resp, err := request(logical.ReadOperation, "roles/"+testDynamicRoleName, nil)
+		if err != nil || resp == nil {
+			t.Fatalf("failed to read role: resp:%#v err:%s", resp, err)
+		}
+		if resp.Data["install_script"] != script || resp.Data["install_script_custom"] != custom {
+			t.Fatalf("bad: resp:%#v", resp)
+		}
+	}
+
+	resp, err = writeRole("")
+	if err != nil || resp != nil {
+		t.Fatalf("failed to create role: resp:%#v err:%s", resp, err)
+	}
+	checkCustom(DefaultPublicKeyInstallScript, false)
+
+	for _, script := range []string{
+		"#!/bin/sh\ncat \"$2\" >> \"$3\"\n",
+		"#!/bin/sh\n[ \"$1\" = install ] && cat \"$2\" >> ~/.ssh/authorized_keys\n",
+	} {
+		resp, err = writeRole(script)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for script %q: resp:%#v err:%s", script, resp, err)
+		}
+	}
+
+	for _, script := range []string{
+		"#!/bin/sh\n[ \"${1}\" = install ] && sudo tee -a \"${3}\" < \"${2}\"\n",
+		"#!/bin/sh\nexec sudo /usr/local/bin/install-key \"$@\"\n",
+	} {
+		resp, err = writeRole(script)
+		if err != nil || resp != nil {
+			t.Fatalf("failed to create role with script %q: resp:%#v err:%s", script, resp, err)
+		}
+		checkCustom(script, true)
+	}
+}
+
 func testingFactory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	_, err := vault.StartSSHHostTestServer()
 	if err != nil {
@@ -643,6 +942,88 @@ func TestBackend_ValidPrincipalsValidatedForHostCertificates(t *testing.T) {
 	logicaltest.Test(t, testCase)
 }
 
+func TestBackend_HostMaxTTL(t *testing.T) {
+	config := logical.TestBackendConfig()
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	signStepExpectError := func(data map[string]interface{}) logicaltest.TestStep {
+		return logicaltest.TestStep{
+			Operation: logical.UpdateOperation,
+			Path:      "sign/testing",
+			Data:      data,
+			ErrorOk:   true,
+			Check: func(resp *logical.Response) error {
+				if resp == nil || !resp.IsError() {
+					return fmt.Errorf("expected error, got: %#v", resp)
+				}
+				return nil
+			},
+		}
+	}
+
+	testCase := logicaltest.TestCase{
+		LogicalBackend: b,
+		Steps: []logicaltest.TestStep{
+			configCaStep(),
+
+			createRoleStep("testing", map[string]interface{}{
+				"key_type":                "ca",
+				"allow_user_certificates": true,
+				"allow_host_certificates": true,
+				"allowed_users":           "tuber",
+				"allowed_domains":         "example.com",
+				"allow_subdomains":        true,
+				"max_ttl":                 "1h",
+				"host_max_ttl":            "72h",
+			}),
+
+			logicaltest.TestStep{
+				Operation: logical.ReadOperation,
+				Path:      "roles/testing",
+				Check: func(resp *logical.Response) error {
+					if resp.Data["max_ttl"] != int64(3600) || resp.Data["host_max_ttl"] != int64(259200) {
+						return fmt.Errorf("bad: %#v", resp)
+					}
+					return nil
+				},
+			},
+
+			signCertificateStep("testing", "vault-root-22608f5ef173aabf700797cb95c5641e792698ec6380e8e1eb55523e39aa5e51", ssh.HostCert, []string{"host.example.com"}, map[string]string{}, map[string]string{},
+				48*time.Hour, map[string]interface{}{
+					"public_key":       publicKey2,
+					"ttl":              "48h",
+					"cert_type":        "host",
+					"valid_principals": "host.example.com",
+				}),
+
+			signStepExpectError(map[string]interface{}{
+				"public_key":       publicKey2,
+				"ttl":              "96h",
+				"cert_type":        "host",
+				"valid_principals": "host.example.com",
+			}),
+
+			signStepExpectError(map[string]interface{}{
+				"public_key":       publicKey2,
+				"ttl":              "48h",
+				"valid_principals": "tuber",
+			}),
+
+			signStepExpectError(map[string]interface{}{
+				"public_key":       publicKey2,
+				"cert_type":        "host",
+				"valid_principals": "host.example.org",
+			}),
+		},
+	}
+
+	logicaltest.Test(t, testCase)
+}
+
 func TestBackend_OptionsOverrideDefaults(t *testing.T) {
 	config := logical.TestBackendConfig()
 
@@ -691,6 +1072,153 @@ func TestBackend_OptionsOverrideDefaults(t *testing.T) {
 	logicaltest.Test(t, testCase)
 }
 
+func TestBackend_AllowedOptions(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	resp, err := request("config/ca", map[string]interface{}{
+		"public_key":  publicKey,
+		"private_key": privateKey,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to configure CA: resp:%#v err:%s", resp, err)
+	}
+
+	for name, allowed := range map[string][2]string{
+		"defaults":  {"", ""},
+		"whitelist": {"source-address", "permit-pty,permit-X11-forwarding"},
+		"any":       {"*", "*"},
+	} {
+		resp, err = request("roles/"+name, map[string]interface{}{
+			"key_type":                 "ca",
+			"allow_user_certificates":  true,
+			"allowed_users":            "tuber",
+			"default_user":             "tuber",
+			"allowed_critical_options": allowed[0],
+			"allowed_extensions":       allowed[1],
+			"default_critical_options": map[string]interface{}{
+				"force-command": "/bin/bastion",
+			},
+			"default_extensions": map[string]interface{}{
+				"permit-pty": "",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to create role: resp:%#v err:%s", resp, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		role            string
+		criticalOptions map[string]string
+		extensions      map[string]string
+		notAllowed      string
+	}{
+		{"defaults", nil, nil, ""},
+		{"defaults", map[string]string{"force-command": "/bin/bastion"}, map[string]string{"permit-pty": ""}, ""},
+		{"defaults", map[string]string{"force-command": "/bin/sh"}, nil, "force-command"},
+		{"defaults", map[string]string{"source-address": "10.0.0.0/8"}, nil, "source-address"},
+		{"defaults", nil, map[string]string{"permit-pty": "", "permit-port-forwarding": ""}, "permit-port-forwarding"},
+		{"whitelist", map[string]string{"source-address": "10.0.0.0/8"}, map[string]string{"permit-X11-forwarding": ""}, ""},
+		{"whitelist", map[string]string{"force-command": "/bin/sh"}, nil, "force-command"},
+		{"whitelist", nil, map[string]string{"permit-user-rc": ""}, "permit-user-rc"},
+		{"any", map[string]string{"force-command": "/bin/sh"}, map[string]string{"permit-user-rc": ""}, ""},
+	} {
+		data := map[string]interface{}{
+			"public_key": publicKey2,
+		}
+		if tc.criticalOptions != nil {
+			data["critical_options"] = tc.criticalOptions
+		}
+		if tc.extensions != nil {
+			data["extensions"] = tc.extensions
+		}
+		resp, err = request("sign/"+tc.role, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if tc.notAllowed != "" {
+			if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), tc.notAllowed) {
+				t.Fatalf("role %q: expected error naming %q, got resp:%#v", tc.role, tc.notAllowed, resp)
+			}
+			continue
+		}
+		if resp == nil || resp.IsError() {
+			t.Fatalf("role %q: failed to sign key: resp:%#v", tc.role, resp)
+		}
+
+		criticalOptions, extensions := tc.criticalOptions, tc.extensions
+		if criticalOptions == nil {
+			criticalOptions = map[string]string{"force-command": "/bin/bastion"}
+		}
+		if extensions == nil {
+			extensions = map[string]string{"permit-pty": ""}
+		}
+		signedKey := strings.TrimSpace(resp.Data["signed_key"].(string))
+		key, _ := base64.StdEncoding.DecodeString(strings.Split(signedKey, " ")[1])
+		parsedKey, err := ssh.ParsePublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := parsedKey.(*ssh.Certificate)
+		if !reflect.DeepEqual(cert.CriticalOptions, criticalOptions) || !reflect.DeepEqual(cert.Extensions, extensions) {
+			t.Fatalf("role %q: expected %v and %v, got %v and %v", tc.role, criticalOptions, extensions, cert.CriticalOptions, cert.Extensions)
+		}
+	}
+
+	// Roles stored before the role version was recorded keep allowing any
+	// options when the allowed lists are empty
+	entry, err := logical.StorageEntryJSON("roles/legacy", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "tuber",
+		"default_user":            "tuber",
+		"ttl":                     "0s",
+		"max_ttl":                 "0s",
+		"host_max_ttl":            "0s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.StorageView.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request("sign/legacy", map[string]interface{}{
+		"public_key":       publicKey2,
+		"critical_options": map[string]string{"force-command": "/bin/sh"},
+		"extensions":       map[string]string{"permit-user-rc": ""},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to sign key with legacy role: resp:%#v err:%v", resp, err)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/legacy",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("failed to read legacy role: resp:%#v err:%v", resp, err)
+	}
+	if resp.Data["allowed_critical_options"] != "*" || resp.Data["allowed_extensions"] != "*" {
+		t.Fatalf("expected the legacy role to allow any options, got %#v", resp.Data)
+	}
+}
+
 func TestBackend_CustomKeyIDFormat(t *testing.T) {
 	config := logical.TestBackendConfig()
 
@@ -779,6 +1307,143 @@ func TestBackend_DisallowUserProvidedKeyIDs(t *testing.T) {
 	logicaltest.Test(t, testCase)
 }
 
+func TestBackend_AllowedUsersTemplate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	sysView := logical.TestSystemView()
+	sysView.EntityVal = &logical.Entity{
+		ID:   "entity-id",
+		Name: "entity-name",
+		Aliases: []*logical.Alias{
+			{
+				MountType:     "userpass",
+				MountAccessor: "auth_userpass_4fa1d2c8",
+				Name:          "alice",
+			},
+		},
+	}
+	config.System = sysView
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(path, entityID string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			EntityID:  entityID,
+			Data:      data,
+		})
+	}
+
+	resp, err := request("config/ca", "", map[string]interface{}{
+		"public_key":  publicKey,
+		"private_key": privateKey,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to configure CA: resp:%#v err:%s", resp, err)
+	}
+
+	allowedUsers := "{{identity.entity.aliases.auth_userpass_4fa1d2c8.name}},ops"
+	for name, template := range map[string]bool{"templated": true, "literal": false} {
+		resp, err = request("roles/"+name, "", map[string]interface{}{
+			"key_type":                "ca",
+			"allow_user_certificates": true,
+			"allowed_users":           allowedUsers,
+			"allowed_users_template":  template,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("failed to create role: resp:%#v err:%s", resp, err)
+		}
+	}
+
+	resp, err = request("roles/invalid", "", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "{{identity.entity.name",
+		"allowed_users_template":  true,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unbalanced template: resp:%#v err:%s", resp, err)
+	}
+
+	for _, tc := range []struct {
+		role      string
+		entityID  string
+		principal string
+		allowed   bool
+	}{
+		{"templated", "entity-id", "alice", true},
+		{"templated", "entity-id", "ops", true},
+		{"templated", "entity-id", "bob", false},
+		{"templated", "entity-id", allowedUsers[:strings.Index(allowedUsers, ",")], false},
+		{"templated", "", "alice", false},
+		{"templated", "", "ops", true},
+		{"literal", "entity-id", "alice", false},
+		{"literal", "entity-id", "ops", true},
+		{"literal", "entity-id", allowedUsers[:strings.Index(allowedUsers, ",")], true},
+	} {
+		resp, err = request("sign/"+tc.role, tc.entityID, map[string]interface{}{
+			"public_key":       publicKey2,
+			"valid_principals": tc.principal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.allowed != (resp != nil && !resp.IsError()) {
+			t.Fatalf("role %q, entity %q, principal %q: expected allowed=%t, got resp:%#v", tc.role, tc.entityID, tc.principal, tc.allowed, resp)
+		}
+		if !tc.allowed {
+			continue
+		}
+
+		signedKey := strings.TrimSpace(resp.Data["signed_key"].(string))
+		key, _ := base64.StdEncoding.DecodeString(strings.Split(signedKey, " ")[1])
+		parsedKey, err := ssh.ParsePublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if principals := parsedKey.(*ssh.Certificate).ValidPrincipals; !reflect.DeepEqual(principals, []string{tc.principal}) {
+			t.Fatalf("expected principals %v, got %v", []string{tc.principal}, principals)
+		}
+	}
+
+	// Entity names must not add principals or allow any of them
+	resp, err = request("roles/entity-name", "", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "{{identity.entity.name}}",
+		"allowed_users_template":  true,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("failed to create role: resp:%#v err:%s", resp, err)
+	}
+	for _, tc := range []struct {
+		entityName string
+		principal  string
+	}{
+		{"alice,root", "root"},
+		{"alice,root", "alice"},
+		{"*", "root"},
+		{" * ", "root"},
+	} {
+		sysView.EntityVal.Name = tc.entityName
+		resp, err = request("sign/entity-name", "entity-id", map[string]interface{}{
+			"public_key":       publicKey2,
+			"valid_principals": tc.principal,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("entity name %q, principal %q: expected an error, got resp:%#v", tc.entityName, tc.principal, resp)
+		}
+	}
+}
+
 func configCaStep() logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
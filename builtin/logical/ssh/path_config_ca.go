@@ -1,11 +1,8 @@
 package ssh
 
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 
 	"github.com/hashicorp/errwrap"
@@ -45,6 +42,16 @@ func pathConfigCA(b *backend) *framework.Path {
 				Description: `Generate SSH key pair internally rather than use the private_key and public_key fields.`,
 				Default:     true,
 			},
+			"key_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Type of the SSH key pair to generate; "rsa", "ecdsa" or "ed25519". Defaults to "rsa".`,
+				Default:     sshKeyTypeRSA,
+			},
+			"key_bits": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `Length of the SSH key pair to generate. For RSA keys, 2048 or 4096 bits, defaulting
+to 4096. For ECDSA keys, 256, 384 or 521 bits, defaulting to 256. Not applicable to ed25519 keys.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -171,16 +178,22 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 			return logical.ErrorResponse("missing private_key"), nil
 		}
 
-		_, err := ssh.ParsePrivateKey([]byte(privateKey))
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf("Unable to parse private_key as an SSH private key: %v", err)), nil
 		}
 
-		_, err = parsePublicSSHKey(publicKey)
+		parsedPublicKey, err := parsePublicSSHKey(publicKey)
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf("Unable to parse public_key as an SSH public key: %v", err)), nil
 		}
 
+		// Certificates signed with a mismatched pair would not verify against
+		// the public key handed out to hosts
+		if !bytes.Equal(signer.PublicKey().Marshal(), parsedPublicKey.Marshal()) {
+			return logical.ErrorResponse("public_key does not match private_key"), nil
+		}
+
 	// not set and no public/private key provided so generate
 	case publicKey == "" && privateKey == "":
 		generateSigningKey = true
@@ -191,10 +204,24 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 	}
 
 	if generateSigningKey {
-		publicKey, privateKey, err = generateSSHKeyPair()
+		keyType, keyBits, err := normalizeSSHKeyParams(data.Get("key_type").(string), data.Get("key_bits").(int), 4096)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if keyType == sshKeyTypeRSA && keyBits < 2048 {
+			return logical.ErrorResponse("invalid key_bits for RSA keys; must be 2048 or 4096"), nil
+		}
+
+		publicKey, privateKey, err = generateSSHKeyPair(keyType, keyBits)
 		if err != nil {
 			return nil, err
 		}
+	} else {
+		_, keyTypeSet := data.GetOk("key_type")
+		_, keyBitsSet := data.GetOk("key_bits")
+		if keyTypeSet || keyBitsSet {
+			return logical.ErrorResponse("key_type and key_bits only apply when generating the signing key"), nil
+		}
 	}
 
 	if publicKey == "" || privateKey == "" {
@@ -265,22 +292,11 @@ func (b *backend) pathConfigCAUpdate(ctx context.Context, req *logical.Request,
 	return nil, nil
 }
 
-func generateSSHKeyPair() (string, string, error) {
-	privateSeed, err := rsa.GenerateKey(rand.Reader, 4096)
-	if err != nil {
-		return "", "", err
-	}
-
-	privateBlock := &pem.Block{
-		Type:    "RSA PRIVATE KEY",
-		Headers: nil,
-		Bytes:   x509.MarshalPKCS1PrivateKey(privateSeed),
-	}
-
-	public, err := ssh.NewPublicKey(&privateSeed.PublicKey)
+func generateSSHKeyPair(keyType string, keyBits int) (string, string, error) {
+	public, private, err := generateSSHKey(keyType, keyBits)
 	if err != nil {
 		return "", "", err
 	}
 
-	return string(ssh.MarshalAuthorizedKey(public)), string(pem.EncodeToMemory(privateBlock)), nil
+	return string(ssh.MarshalAuthorizedKey(public)), private, nil
 }
@@ -1,10 +1,13 @@
 package ssh
 
 import (
+	"bytes"
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
+	"golang.org/x/crypto/ssh"
 )
 
 func TestSSH_ConfigCAStorageUpgrade(t *testing.T) {
@@ -132,6 +135,24 @@ func TestSSH_ConfigCAUpdateDelete(t *testing.T) {
 	}
 
 	caReq.Operation = logical.UpdateOperation
+
+	// Fail to use a public key that doesn't belong to the private key
+	otherPublicKey, _, err := generateSSHKeyPair(sshKeyTypeRSA, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caReq.Data = map[string]interface{}{
+		"public_key":  otherPublicKey,
+		"private_key": privateKey,
+	}
+	resp, err = b.HandleRequest(context.Background(), caReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for mismatched keys, got %#v", resp)
+	}
+
 	caReq.Data = map[string]interface{}{
 		"public_key":  publicKey,
 		"private_key": privateKey,
@@ -168,3 +189,139 @@ func TestSSH_ConfigCAUpdateDelete(t *testing.T) {
 		t.Fatalf("bad: err: %v, resp:%v", err, resp)
 	}
 }
+
+func TestSSH_ConfigCAKeyTypes(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{"key_type": "dsa"},
+		{"key_type": "rsa", "key_bits": 1024},
+		{"key_type": "ecdsa", "key_bits": 2048},
+		{"key_type": "ed25519", "key_bits": 256},
+		{"key_type": "ed25519", "public_key": publicKey, "private_key": privateKey},
+	} {
+		resp, err := request(logical.UpdateOperation, "config/ca", invalid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error for %v, got %#v", invalid, resp)
+		}
+	}
+
+	resp, err := request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "tuber",
+		"default_user":            "tuber",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v, resp:%v", err, resp)
+	}
+
+	for _, tc := range []struct {
+		keyType string
+		keyBits int
+		format  string
+	}{
+		{"", 0, ssh.KeyAlgoRSA},
+		{"rsa", 2048, ssh.KeyAlgoRSA},
+		{"ecdsa", 0, ssh.KeyAlgoECDSA256},
+		{"ecdsa", 384, ssh.KeyAlgoECDSA384},
+		{"ed25519", 0, ssh.KeyAlgoED25519},
+	} {
+		data := map[string]interface{}{}
+		if tc.keyType != "" {
+			data["key_type"] = tc.keyType
+		}
+		if tc.keyBits != 0 {
+			data["key_bits"] = tc.keyBits
+		}
+		resp, err := request(logical.UpdateOperation, "config/ca", data)
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v, resp:%v", err, resp)
+		}
+
+		resp, err = request(logical.ReadOperation, "public_key", nil)
+		if err != nil || resp == nil {
+			t.Fatalf("bad: err: %v, resp:%v", err, resp)
+		}
+		signingKey, err := parsePublicSSHKey(string(resp.Data[logical.HTTPRawBody].([]byte)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signingKey.Type() != tc.format {
+			t.Fatalf("expected a %s CA key, got %s", tc.format, signingKey.Type())
+		}
+
+		resp, err = request(logical.UpdateOperation, "sign/test", map[string]interface{}{
+			"public_key": publicKey2,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v, resp:%v", err, resp)
+		}
+		signedKey, err := parsePublicSSHKey(resp.Data["signed_key"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		certChecker := &ssh.CertChecker{
+			IsUserAuthority: func(auth ssh.PublicKey) bool {
+				return bytes.Equal(auth.Marshal(), signingKey.Marshal())
+			},
+		}
+		if err := certChecker.CheckCert("tuber", signedKey.(*ssh.Certificate)); err != nil {
+			t.Fatalf("%s CA: %v", tc.format, err)
+		}
+
+		resp, err = request(logical.DeleteOperation, "config/ca", nil)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v, resp:%v", err, resp)
+		}
+	}
+}
+
+func TestSSH_GenerateDynamicKeys(t *testing.T) {
+	for _, tc := range []struct {
+		keyType string
+		keyBits int
+		format  string
+	}{
+		{sshKeyTypeRSA, 1024, ssh.KeyAlgoRSA},
+		{sshKeyTypeECDSA, 521, ssh.KeyAlgoECDSA521},
+		{sshKeyTypeEd25519, 0, ssh.KeyAlgoED25519},
+	} {
+		publicKey, privateKey, err := generateDynamicKeys(tc.keyType, tc.keyBits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(publicKey, tc.format+" ") {
+			t.Fatalf("expected a %s public key, got %q", tc.format, publicKey)
+		}
+		parsedPublicKey, err := parsePublicSSHKey(publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			t.Fatalf("failed to parse %s private key: %v", tc.format, err)
+		}
+		if !bytes.Equal(signer.PublicKey().Marshal(), parsedPublicKey.Marshal()) {
+			t.Fatalf("%s public key does not match private key", tc.format)
+		}
+	}
+}
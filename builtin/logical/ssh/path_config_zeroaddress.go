@@ -80,7 +80,9 @@ func (b *backend) pathConfigZeroAddressWrite(ctx context.Context, req *logical.R
 		return nil, err
 	}
 
-	return nil, nil
+	resp := &logical.Response{}
+	resp.AddWarning(`config/zeroaddress is deprecated; set "allow_zero_address" on the roles instead`)
+	return resp, nil
 }
 
 // Stores the given list of roles at zeroaddress endpoint
@@ -179,4 +181,9 @@ of deny for unintended clients.
 This is a root authenticated endpoint. If backend is mounted at 'ssh' then use
 the endpoint 'ssh/config/zeroaddress' to provide the list of allowed roles.
 After mounting the backend, use 'path-help' for additional information.
+
+This endpoint is deprecated in favor of the per-role 'allow_zero_address'
+option. A role accepts any IP address if it is listed here or has
+'allow_zero_address' set. Roles listed here also ignore their
+'exclude_cidr_list', while roles with 'allow_zero_address' still honor it.
 `
@@ -8,6 +8,7 @@ import (
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -105,7 +106,7 @@ func (b *backend) pathCredsCreateWrite(ctx context.Context, req *logical.Request
 		zeroAddressRoles = zeroAddressEntry.Roles
 	}
 
-	err = validateIP(ip, roleName, role.CIDRList, role.ExcludeCIDRList, zeroAddressRoles)
+	err = validateIP(ip, roleName, role, zeroAddressRoles)
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf("Error validating IP: %v", err)), nil
 	}
@@ -113,7 +114,7 @@ func (b *backend) pathCredsCreateWrite(ctx context.Context, req *logical.Request
 	var result *logical.Response
 	if role.KeyType == KeyTypeOTP {
 		// Generate an OTP
-		otp, err := b.GenerateOTPCredential(ctx, req, &sshOTP{
+		otp, err := b.GenerateOTPCredential(ctx, req, role, &sshOTP{
 			Username: username,
 			IP:       ip,
 			RoleName: roleName,
@@ -184,8 +185,13 @@ func (b *backend) GenerateDynamicCredential(ctx context.Context, req *logical.Re
 		return "", "", errwrap.Wrapf("error reading the host key: {{err}}", err)
 	}
 
-	// Generate a new RSA key pair with the given key length.
-	dynamicPublicKey, dynamicPrivateKey, err := generateRSAKeys(role.KeyBits)
+	// Generate a new key pair with the given type and length. Roles created
+	// before the type was configurable have an empty type, meaning RSA.
+	keyType := role.DynamicKeyType
+	if keyType == "" {
+		keyType = sshKeyTypeRSA
+	}
+	dynamicPublicKey, dynamicPrivateKey, err := generateDynamicKeys(keyType, role.KeyBits)
 	if err != nil {
 		return "", "", errwrap.Wrapf("error generating key: {{err}}", err)
 	}
@@ -216,9 +222,32 @@ func (b *backend) GenerateSaltedOTP(ctx context.Context) (string, string, error)
 	return str, salt.SaltID(str), nil
 }
 
-// Generates an UUID OTP and creates an entry for the same in storage backend with its salted string.
-func (b *backend) GenerateOTPCredential(ctx context.Context, req *logical.Request, sshOTPEntry *sshOTP) (string, error) {
-	otp, otpSalted, err := b.GenerateSaltedOTP(ctx)
+// GenerateSaltedRoleOTP generates an OTP in the format configured on the role,
+// along with its salted form
+func (b *backend) GenerateSaltedRoleOTP(ctx context.Context, role *sshRole) (string, string, error) {
+	if role.OTPLength == 0 {
+		return b.GenerateSaltedOTP(ctx)
+	}
+
+	charset := role.OTPCharset
+	if charset == "" {
+		charset = defaultOTPCharset
+	}
+	str, err := generateOTP(role.OTPLength, charset)
+	if err != nil {
+		return "", "", err
+	}
+	salt, err := b.Salt(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	return str, salt.SaltID(str), nil
+}
+
+// Generates an OTP in the role's format and creates an entry for the same in storage backend with its salted string.
+func (b *backend) GenerateOTPCredential(ctx context.Context, req *logical.Request, role *sshRole, sshOTPEntry *sshOTP) (string, error) {
+	otp, otpSalted, err := b.GenerateSaltedRoleOTP(ctx, role)
 	if err != nil {
 		return "", err
 	}
@@ -231,7 +260,7 @@ func (b *backend) GenerateOTPCredential(ctx context.Context, req *logical.Reques
 	// OTP is generated. It is very unlikely that this is the case and this
 	// code is just for safety.
 	for err == nil && entry != nil {
-		otp, otpSalted, err = b.GenerateSaltedOTP(ctx)
+		otp, otpSalted, err = b.GenerateSaltedRoleOTP(ctx, role)
 		if err != nil {
 			return "", err
 		}
@@ -252,41 +281,43 @@ func (b *backend) GenerateOTPCredential(ctx context.Context, req *logical.Reques
 	return otp, nil
 }
 
-// ValidateIP first checks if the role belongs to the list of privileged
-// roles that could allow any IP address and if there is a match, IP is
-// accepted immediately. If not, IP is searched in the allowed CIDR blocks
-// registered with the role. If there is a match, then it is searched in the
-// excluded CIDR blocks and if IP is found there as well, an error is returned.
-// IP is valid only if it is encompassed by allowed CIDR blocks and not by
-// excluded CIDR blocks.
-func validateIP(ip, roleName, cidrList, excludeCidrList string, zeroAddressRoles []string) error {
-	// Search IP in the zero-address list
-	for _, role := range zeroAddressRoles {
-		if roleName == role {
+// Checks if the IP is accepted by the role: either the role accepts any IP
+// address or the IP belongs to one of its CIDR blocks, and the IP is not part
+// of its excluded CIDR blocks. Roles registered in the zero-address list
+// accept any IP address, regardless of their excluded CIDR blocks.
+func validateIP(ip, roleName string, role *sshRole, zeroAddressRoles []string) error {
+	// Search role in the zero-address list
+	for _, zeroAddressRole := range zeroAddressRoles {
+		if roleName == zeroAddressRole {
 			return nil
 		}
 	}
 
 	// Search IP in allowed CIDR blocks
-	ipMatched, err := cidrListContainsIP(ip, cidrList)
-	if err != nil {
-		return err
-	}
-	if !ipMatched {
-		return fmt.Errorf("IP does not belong to role")
+	if !role.AllowZeroAddress {
+		if role.CIDRList == "" {
+			return fmt.Errorf("role %q has no CIDR blocks configured and does not allow any IP address", roleName)
+		}
+		block, err := cidrListMatch(ip, role.CIDRList)
+		if err != nil {
+			return err
+		}
+		if block == "" {
+			return fmt.Errorf("IP %q does not belong to any of the CIDR blocks of role %q: %s", ip, roleName, strings.Join(strutil.ParseStringSlice(role.CIDRList, ","), ", "))
+		}
 	}
 
-	if len(excludeCidrList) == 0 {
+	if len(role.ExcludeCIDRList) == 0 {
 		return nil
 	}
 
 	// Search IP in exclude list
-	ipMatched, err = cidrListContainsIP(ip, excludeCidrList)
+	block, err := cidrListMatch(ip, role.ExcludeCIDRList)
 	if err != nil {
 		return err
 	}
-	if ipMatched {
-		return fmt.Errorf("IP does not belong to role")
+	if block != "" {
+		return fmt.Errorf("IP %q belongs to the excluded CIDR block %q of role %q", ip, block, roleName)
 	}
 
 	return nil
@@ -7,9 +7,10 @@ import (
 
 	"time"
 
-	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/cidrutil"
+	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -27,16 +28,20 @@ type sshRole struct {
 	KeyType                string            `mapstructure:"key_type" json:"key_type"`
 	KeyName                string            `mapstructure:"key" json:"key"`
 	KeyBits                int               `mapstructure:"key_bits" json:"key_bits"`
+	DynamicKeyType         string            `mapstructure:"dynamic_key_type" json:"dynamic_key_type"`
 	AdminUser              string            `mapstructure:"admin_user" json:"admin_user"`
 	DefaultUser            string            `mapstructure:"default_user" json:"default_user"`
 	CIDRList               string            `mapstructure:"cidr_list" json:"cidr_list"`
 	ExcludeCIDRList        string            `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
+	AllowZeroAddress       bool              `mapstructure:"allow_zero_address" json:"allow_zero_address"`
 	Port                   int               `mapstructure:"port" json:"port"`
 	InstallScript          string            `mapstructure:"install_script" json:"install_script"`
 	AllowedUsers           string            `mapstructure:"allowed_users" json:"allowed_users"`
+	AllowedUsersTemplate   bool              `mapstructure:"allowed_users_template" json:"allowed_users_template"`
 	AllowedDomains         string            `mapstructure:"allowed_domains" json:"allowed_domains"`
 	KeyOptionSpecs         string            `mapstructure:"key_option_specs" json:"key_option_specs"`
 	MaxTTL                 string            `mapstructure:"max_ttl" json:"max_ttl"`
+	HostMaxTTL             string            `mapstructure:"host_max_ttl" json:"host_max_ttl"`
 	TTL                    string            `mapstructure:"ttl" json:"ttl"`
 	DefaultCriticalOptions map[string]string `mapstructure:"default_critical_options" json:"default_critical_options"`
 	DefaultExtensions      map[string]string `mapstructure:"default_extensions" json:"default_extensions"`
@@ -48,8 +53,16 @@ type sshRole struct {
 	AllowSubdomains        bool              `mapstructure:"allow_subdomains" json:"allow_subdomains"`
 	AllowUserKeyIDs        bool              `mapstructure:"allow_user_key_ids" json:"allow_user_key_ids"`
 	KeyIDFormat            string            `mapstructure:"key_id_format" json:"key_id_format"`
+	OTPLength              int               `mapstructure:"otp_length" json:"otp_length"`
+	OTPCharset             string            `mapstructure:"otp_charset" json:"otp_charset"`
+	Version                int               `mapstructure:"version" json:"version"`
 }
 
+// roleEntryVersion is the version of CA roles written by this backend. Roles
+// stored before version 1 allowed any critical options or extensions when
+// allowed_critical_options or allowed_extensions was empty.
+const roleEntryVersion = 1
+
 func pathListRoles(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "roles/?$",
@@ -102,8 +115,19 @@ func pathRoles(b *backend) *framework.Path {
 				Type: framework.TypeString,
 				Description: `
 				[Optional for Dynamic type] [Optional for OTP type] [Not applicable for CA type]
-				Comma separated list of CIDR blocks for which the role is applicable for.
-				CIDR blocks can belong to more than one role.`,
+				Comma separated list of IPv4 or IPv6 CIDR blocks for which the role is applicable for.
+				CIDR blocks can belong to more than one role. Blocks covering every address, such as
+				0.0.0.0/0 or ::/0, are accepted with a warning; "allow_zero_address" is the clearer
+				way to accept any address.`,
+			},
+			"allow_zero_address": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for Dynamic type] [Optional for OTP type] [Not applicable for CA type]
+				If set, the role accepts any IPv4 or IPv6 address, other than those in
+				"exclude_cidr_list", and "cidr_list" is ignored. This replaces registering the
+				role under the deprecated "config/zeroaddress" endpoint, which also ignores
+				"exclude_cidr_list".`,
 			},
 			"exclude_cidr_list": &framework.FieldSchema{
 				Type: framework.TypeString,
@@ -133,15 +157,26 @@ func pathRoles(b *backend) *framework.Path {
 				Type: framework.TypeInt,
 				Description: `
 				[Optional for Dynamic type] [Not applicable for OTP type] [Not applicable for CA type]
-				Length of the RSA dynamic key in bits. It is 1024 by default or it can be 2048.`,
+				Length of the dynamic key in bits. For RSA keys, it is 2048 by default or it can be
+				1024 or 4096. For ECDSA keys, it is 256 by default or it can be 384 or 521. Not
+				applicable to ed25519 keys.`,
+			},
+			"dynamic_key_type": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Optional for Dynamic type] [Not applicable for OTP type] [Not applicable for CA type]
+				Type of the dynamic key. It is 'rsa' by default or it can be 'ecdsa' or 'ed25519'.`,
 			},
 			"install_script": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
 				[Optional for Dynamic type] [Not-applicable for OTP type] [Not applicable for CA type]
 				Script used to install and uninstall public keys in the target machine.
-				The inbuilt default install script will be for Linux hosts. For sample
-				script, refer the project documentation website.`,
+				The inbuilt default install script will be for Linux hosts. The script is
+				run with the install option ("install" or "uninstall"), the name of the
+				file containing the public key and the path of the authorized_keys file
+				as its arguments, and must reference all three. For sample script, refer
+				the project documentation website.`,
 			},
 			"allowed_users": &framework.FieldSchema{
 				Type: framework.TypeString,
@@ -159,6 +194,15 @@ func pathRoles(b *backend) *framework.Path {
 				allow any user.
 				`,
 			},
+			"allowed_users_template": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				If set, entries of "allowed_users" can contain identity template directives such as
+				'{{identity.entity.name}}' or '{{identity.entity.aliases.<mount accessor>.name}}',
+				which are rendered against the entity of the requesting token when signing.
+				`,
+			},
 			"allowed_domains": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
@@ -192,20 +236,30 @@ func pathRoles(b *backend) *framework.Path {
 				The maximum allowed lease duration
 				`,
 			},
+			"host_max_ttl": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				The maximum allowed lease duration of host certificates. If not set, "max_ttl"
+				applies to host certificates as well.
+				`,
+			},
 			"allowed_critical_options": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
 				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
 				A comma-separated list of critical options that certificates can have when signed.
- 				To allow any critical options, set this to an empty string.
- 				`,
+				To allow any critical options, set this to '*'. If empty, only the critical options
+				in "default_critical_options", with their default values, can be requested.
+				`,
 			},
 			"allowed_extensions": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
 				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
 				A comma-separated list of extensions that certificates can have when signed.
-				To allow any extensions, set this to an empty string.
+				To allow any extensions, set this to '*'. If empty, only the extensions in
+				"default_extensions", with their default values, can be requested.
 				`,
 			},
 			"default_critical_options": &framework.FieldSchema{
@@ -279,6 +333,23 @@ func pathRoles(b *backend) *framework.Path {
 				'{{public_key_hash}}' - A SHA256 checksum of the public key that is being signed.
 				`,
 			},
+			"otp_length": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `
+				[Not applicable for Dynamic type] [Optional for OTP type] [Not applicable for CA type]
+				Length of the generated OTPs, between 8 and 128 characters. If not set, OTPs are
+				UUIDs.
+				`,
+			},
+			"otp_charset": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Not applicable for Dynamic type] [Optional for OTP type] [Not applicable for CA type]
+				Characters to generate OTPs from, when "otp_length" is set. Must contain at least two
+				distinct printable ASCII characters, without spaces. Defaults to upper and lower case
+				letters and digits.
+				`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -301,16 +372,24 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 	// Allowed users is an optional field, applicable for both OTP and Dynamic types.
 	allowedUsers := d.Get("allowed_users").(string)
 
+	var warnings []string
+
 	// Validate the CIDR blocks
 	cidrList := d.Get("cidr_list").(string)
+	allowZeroAddress := d.Get("allow_zero_address").(bool)
 	if cidrList != "" {
 		valid, err := cidrutil.ValidateCIDRListString(cidrList, ",")
 		if err != nil {
-			return nil, errwrap.Wrapf("failed to validate cidr_list: {{err}}", err)
+			return logical.ErrorResponse(fmt.Sprintf("failed to validate cidr_list: %v", err)), nil
 		}
 		if !valid {
 			return logical.ErrorResponse("failed to validate cidr_list"), nil
 		}
+		if !allowZeroAddress {
+			if block := zeroAddressCIDR(cidrList); block != "" {
+				warnings = append(warnings, fmt.Sprintf(`cidr_list entry %q covers every address of its IP version; consider setting "allow_zero_address" instead`, block))
+			}
+		}
 	}
 
 	// Validate the excluded CIDR blocks
@@ -318,7 +397,7 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 	if excludeCidrList != "" {
 		valid, err := cidrutil.ValidateCIDRListString(excludeCidrList, ",")
 		if err != nil {
-			return nil, errwrap.Wrapf("failed to validate exclude_cidr_list entry: {{err}}", err)
+			return logical.ErrorResponse(fmt.Sprintf("failed to validate exclude_cidr_list entry: %v", err)), nil
 		}
 		if !valid {
 			return logical.ErrorResponse(fmt.Sprintf("failed to validate exclude_cidr_list entry: %v", err)), nil
@@ -350,14 +429,33 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 			return logical.ErrorResponse("admin user not required for OTP type"), nil
 		}
 
+		otpLength := d.Get("otp_length").(int)
+		otpCharset, otpCharsetSet := d.GetOk("otp_charset")
+		switch {
+		case otpLength == 0 && otpCharsetSet:
+			return logical.ErrorResponse(`"otp_charset" requires "otp_length" to be set`), nil
+		case otpLength != 0 && (otpLength < minOTPLength || otpLength > maxOTPLength):
+			return logical.ErrorResponse(fmt.Sprintf(`"otp_length" must be between %d and %d`, minOTPLength, maxOTPLength)), nil
+		}
+		if otpCharsetSet {
+			if err := validateOTPCharset(otpCharset.(string)); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+
 		// Below are the only fields used from the role structure for OTP type.
 		roleEntry = sshRole{
-			DefaultUser:     defaultUser,
-			CIDRList:        cidrList,
-			ExcludeCIDRList: excludeCidrList,
-			KeyType:         KeyTypeOTP,
-			Port:            port,
-			AllowedUsers:    allowedUsers,
+			DefaultUser:      defaultUser,
+			CIDRList:         cidrList,
+			ExcludeCIDRList:  excludeCidrList,
+			AllowZeroAddress: allowZeroAddress,
+			KeyType:          KeyTypeOTP,
+			Port:             port,
+			AllowedUsers:     allowedUsers,
+			OTPLength:        otpLength,
+		}
+		if otpCharsetSet {
+			roleEntry.OTPCharset = otpCharset.(string)
 		}
 	} else if keyType == KeyTypeDynamic {
 		defaultUser := d.Get("default_user").(string)
@@ -382,36 +480,36 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 		if installScript == "" {
 			installScript = DefaultPublicKeyInstallScript
 		}
+		if err := validateInstallScript(installScript); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 
 		adminUser := d.Get("admin_user").(string)
 		if adminUser == "" {
 			return logical.ErrorResponse("missing admin username"), nil
 		}
 
-		// This defaults to 1024 and it can also be 2048 and 4096.
-		keyBits := d.Get("key_bits").(int)
-		if keyBits != 0 && keyBits != 1024 && keyBits != 2048 && keyBits != 4096 {
-			return logical.ErrorResponse("invalid key_bits field"), nil
-		}
-
-		// If user has not set this field, default it to 2048
-		if keyBits == 0 {
-			keyBits = 2048
+		// RSA keys default to 2048 bits and can also be 1024 and 4096 bits.
+		dynamicKeyType, keyBits, err := normalizeSSHKeyParams(d.Get("dynamic_key_type").(string), d.Get("key_bits").(int), 2048)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
 		}
 
 		// Store all the fields required by dynamic key type
 		roleEntry = sshRole{
-			KeyName:         keyName,
-			AdminUser:       adminUser,
-			DefaultUser:     defaultUser,
-			CIDRList:        cidrList,
-			ExcludeCIDRList: excludeCidrList,
-			Port:            port,
-			KeyType:         KeyTypeDynamic,
-			KeyBits:         keyBits,
-			InstallScript:   installScript,
-			AllowedUsers:    allowedUsers,
-			KeyOptionSpecs:  keyOptionSpecs,
+			KeyName:          keyName,
+			AdminUser:        adminUser,
+			DefaultUser:      defaultUser,
+			CIDRList:         cidrList,
+			ExcludeCIDRList:  excludeCidrList,
+			AllowZeroAddress: allowZeroAddress,
+			Port:             port,
+			KeyType:          KeyTypeDynamic,
+			KeyBits:          keyBits,
+			DynamicKeyType:   dynamicKeyType,
+			InstallScript:    installScript,
+			AllowedUsers:     allowedUsers,
+			KeyOptionSpecs:   keyOptionSpecs,
 		}
 	} else if keyType == KeyTypeCA {
 		role, errorResponse := b.createCARole(allowedUsers, d.Get("default_user").(string), d)
@@ -431,18 +529,28 @@ func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, d *fr
 	if err := req.Storage.Put(ctx, entry); err != nil {
 		return nil, err
 	}
-	return nil, nil
+
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	resp := &logical.Response{}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
 }
 
 func (b *backend) createCARole(allowedUsers, defaultUser string, data *framework.FieldData) (*sshRole, *logical.Response) {
 	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
 	maxTTL := time.Duration(data.Get("max_ttl").(int)) * time.Second
+	hostMaxTTL := time.Duration(data.Get("host_max_ttl").(int)) * time.Second
 	role := &sshRole{
 		AllowedCriticalOptions: data.Get("allowed_critical_options").(string),
 		AllowedExtensions:      data.Get("allowed_extensions").(string),
 		AllowUserCertificates:  data.Get("allow_user_certificates").(bool),
 		AllowHostCertificates:  data.Get("allow_host_certificates").(bool),
 		AllowedUsers:           allowedUsers,
+		AllowedUsersTemplate:   data.Get("allowed_users_template").(bool),
 		AllowedDomains:         data.Get("allowed_domains").(string),
 		DefaultUser:            defaultUser,
 		AllowBareDomains:       data.Get("allow_bare_domains").(bool),
@@ -450,12 +558,24 @@ func (b *backend) createCARole(allowedUsers, defaultUser string, data *framework
 		AllowUserKeyIDs:        data.Get("allow_user_key_ids").(bool),
 		KeyIDFormat:            data.Get("key_id_format").(string),
 		KeyType:                KeyTypeCA,
+		Version:                roleEntryVersion,
 	}
 
 	if !role.AllowUserCertificates && !role.AllowHostCertificates {
 		return nil, logical.ErrorResponse("Either 'allow_user_certificates' or 'allow_host_certificates' must be set to 'true'")
 	}
 
+	if role.AllowedUsersTemplate {
+		for _, principal := range strutil.ParseStringSlice(role.AllowedUsers, ",") {
+			if _, _, err := identity.PopulateString(&identity.PopulateStringInput{
+				ValidityCheckOnly: true,
+				String:            principal,
+			}); err != nil {
+				return nil, logical.ErrorResponse(fmt.Sprintf("invalid template %q in 'allowed_users': %s", principal, err))
+			}
+		}
+	}
+
 	defaultCriticalOptions := convertMapToStringValue(data.Get("default_critical_options").(map[string]interface{}))
 	defaultExtensions := convertMapToStringValue(data.Get("default_extensions").(map[string]interface{}))
 
@@ -467,6 +587,7 @@ func (b *backend) createCARole(allowedUsers, defaultUser string, data *framework
 	// Persist TTLs
 	role.TTL = ttl.String()
 	role.MaxTTL = maxTTL.String()
+	role.HostMaxTTL = hostMaxTTL.String()
 	role.DefaultCriticalOptions = defaultCriticalOptions
 	role.DefaultExtensions = defaultExtensions
 
@@ -487,6 +608,18 @@ func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*ss
 		return nil, err
 	}
 
+	// Keep allowing anything on roles stored before an empty list was
+	// limited to the role's defaults
+	if result.KeyType == KeyTypeCA && result.Version < 1 {
+		if result.AllowedCriticalOptions == "" {
+			result.AllowedCriticalOptions = "*"
+		}
+		if result.AllowedExtensions == "" {
+			result.AllowedExtensions = "*"
+		}
+		result.Version = 1
+	}
+
 	return &result, nil
 }
 
@@ -499,12 +632,15 @@ func (b *backend) parseRole(role *sshRole) (map[string]interface{}, error) {
 	switch role.KeyType {
 	case KeyTypeOTP:
 		result = map[string]interface{}{
-			"default_user":      role.DefaultUser,
-			"cidr_list":         role.CIDRList,
-			"exclude_cidr_list": role.ExcludeCIDRList,
-			"key_type":          role.KeyType,
-			"port":              role.Port,
-			"allowed_users":     role.AllowedUsers,
+			"default_user":       role.DefaultUser,
+			"cidr_list":          role.CIDRList,
+			"exclude_cidr_list":  role.ExcludeCIDRList,
+			"allow_zero_address": role.AllowZeroAddress,
+			"key_type":           role.KeyType,
+			"port":               role.Port,
+			"allowed_users":      role.AllowedUsers,
+			"otp_length":         role.OTPLength,
+			"otp_charset":        role.OTPCharset,
 		}
 	case KeyTypeCA:
 		ttl, err := parseutil.ParseDurationSecond(role.TTL)
@@ -515,13 +651,19 @@ func (b *backend) parseRole(role *sshRole) (map[string]interface{}, error) {
 		if err != nil {
 			return nil, err
 		}
+		hostMaxTTL, err := parseutil.ParseDurationSecond(role.HostMaxTTL)
+		if err != nil {
+			return nil, err
+		}
 
 		result = map[string]interface{}{
 			"allowed_users":            role.AllowedUsers,
+			"allowed_users_template":   role.AllowedUsersTemplate,
 			"allowed_domains":          role.AllowedDomains,
 			"default_user":             role.DefaultUser,
 			"ttl":                      int64(ttl.Seconds()),
 			"max_ttl":                  int64(maxTTL.Seconds()),
+			"host_max_ttl":             int64(hostMaxTTL.Seconds()),
 			"allowed_critical_options": role.AllowedCriticalOptions,
 			"allowed_extensions":       role.AllowedExtensions,
 			"allow_user_certificates":  role.AllowUserCertificates,
@@ -536,22 +678,30 @@ func (b *backend) parseRole(role *sshRole) (map[string]interface{}, error) {
 			"default_extensions":       role.DefaultExtensions,
 		}
 	case KeyTypeDynamic:
+		dynamicKeyType := role.DynamicKeyType
+		if dynamicKeyType == "" {
+			dynamicKeyType = sshKeyTypeRSA
+		}
+
 		result = map[string]interface{}{
-			"key":               role.KeyName,
-			"admin_user":        role.AdminUser,
-			"default_user":      role.DefaultUser,
-			"cidr_list":         role.CIDRList,
-			"exclude_cidr_list": role.ExcludeCIDRList,
-			"port":              role.Port,
-			"key_type":          role.KeyType,
-			"key_bits":          role.KeyBits,
-			"allowed_users":     role.AllowedUsers,
-			"key_option_specs":  role.KeyOptionSpecs,
+			"key":                role.KeyName,
+			"admin_user":         role.AdminUser,
+			"default_user":       role.DefaultUser,
+			"cidr_list":          role.CIDRList,
+			"exclude_cidr_list":  role.ExcludeCIDRList,
+			"allow_zero_address": role.AllowZeroAddress,
+			"port":               role.Port,
+			"key_type":           role.KeyType,
+			"key_bits":           role.KeyBits,
+			"dynamic_key_type":   dynamicKeyType,
+			"allowed_users":      role.AllowedUsers,
+			"key_option_specs":   role.KeyOptionSpecs,
 			// Returning install script will make the output look messy.
 			// But this is one way for clients to see the script that is
 			// being used to install the key. If there is some problem,
 			// the script can be modified and configured by clients.
-			"install_script": role.InstallScript,
+			"install_script":        role.InstallScript,
+			"install_script_custom": role.InstallScript != DefaultPublicKeyInstallScript,
 		}
 	default:
 		return nil, fmt.Errorf("invalid key type: %v", role.KeyType)
@@ -6,12 +6,14 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/identity"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
@@ -124,18 +126,25 @@ func (b *backend) pathSignCertificate(ctx context.Context, req *logical.Request,
 
 	var parsedPrincipals []string
 	if certificateType == ssh.HostCert {
-		parsedPrincipals, err = b.calculateValidPrincipals(data, "", role.AllowedDomains, validateValidPrincipalForHosts(role))
+		parsedPrincipals, err = b.calculateValidPrincipals(data, "", strutil.ParseStringSlice(role.AllowedDomains, ","), validateValidPrincipalForHosts(role))
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), nil
 		}
 	} else {
-		parsedPrincipals, err = b.calculateValidPrincipals(data, role.DefaultUser, role.AllowedUsers, strutil.StrListContains)
+		allowedUsers := strutil.ParseStringSlice(role.AllowedUsers, ",")
+		if role.AllowedUsersTemplate {
+			allowedUsers, err = b.renderAllowedUsers(req, role.AllowedUsers)
+			if err != nil {
+				return nil, err
+			}
+		}
+		parsedPrincipals, err = b.calculateValidPrincipals(data, role.DefaultUser, allowedUsers, strutil.StrListContains)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), nil
 		}
 	}
 
-	ttl, err := b.calculateTTL(data, role)
+	ttl, err := b.calculateTTL(data, role, certificateType)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
@@ -195,7 +204,56 @@ func (b *backend) pathSignCertificate(ctx context.Context, req *logical.Request,
 	return response, nil
 }
 
-func (b *backend) calculateValidPrincipals(data *framework.FieldData, defaultPrincipal, principalsAllowedByRole string, validatePrincipal func([]string, string) bool) ([]string, error) {
+// renderAllowedUsers renders the identity templates in the comma separated
+// allowedUsers against the entity of the requesting token. Entries that cannot
+// be rendered for the requester, e.g. because the token has no entity or the
+// entity has no alias on the referenced mount, are dropped so that they never
+// match a requested principal. So are rendered values containing a comma or
+// equal to "*", as entity and alias names must not widen the allowed users.
+func (b *backend) renderAllowedUsers(req *logical.Request, allowedUsers string) ([]string, error) {
+	var entity *identity.Entity
+	if req.EntityID != "" {
+		entityInfo, err := b.System().EntityInfo(req.EntityID)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to look up entity: {{err}}", err)
+		}
+		if entityInfo != nil {
+			entity = &identity.Entity{
+				ID:       entityInfo.ID,
+				Name:     entityInfo.Name,
+				Metadata: entityInfo.Metadata,
+			}
+			for _, alias := range entityInfo.Aliases {
+				entity.Aliases = append(entity.Aliases, &identity.Alias{
+					MountType:     alias.MountType,
+					MountAccessor: alias.MountAccessor,
+					Name:          alias.Name,
+					Metadata:      alias.Metadata,
+				})
+			}
+		}
+	}
+
+	var rendered []string
+	for _, principal := range strutil.ParseStringSlice(allowedUsers, ",") {
+		_, result, err := identity.PopulateString(&identity.PopulateStringInput{
+			String: principal,
+			Entity: entity,
+		})
+		result = strings.TrimSpace(result)
+		if err != nil || result == "" {
+			continue
+		}
+		if result != principal && (result == "*" || strings.Contains(result, ",")) {
+			continue
+		}
+		rendered = append(rendered, result)
+	}
+
+	return rendered, nil
+}
+
+func (b *backend) calculateValidPrincipals(data *framework.FieldData, defaultPrincipal string, principalsAllowedByRole []string, validatePrincipal func([]string, string) bool) ([]string, error) {
 	validPrincipals := ""
 	validPrincipalsRaw, ok := data.GetOk("valid_principals")
 	if ok {
@@ -205,7 +263,7 @@ func (b *backend) calculateValidPrincipals(data *framework.FieldData, defaultPri
 	}
 
 	parsedPrincipals := strutil.RemoveDuplicates(strutil.ParseStringSlice(validPrincipals, ","), false)
-	allowedPrincipals := strutil.RemoveDuplicates(strutil.ParseStringSlice(principalsAllowedByRole, ","), false)
+	allowedPrincipals := strutil.RemoveDuplicates(principalsAllowedByRole, false)
 	switch {
 	case len(parsedPrincipals) == 0:
 		// There is nothing to process
@@ -216,7 +274,7 @@ func (b *backend) calculateValidPrincipals(data *framework.FieldData, defaultPri
 		return nil, fmt.Errorf("role is not configured to allow any principles")
 	default:
 		// Role was explicitly configured to allow any principal.
-		if principalsAllowedByRole == "*" {
+		if len(allowedPrincipals) == 1 && allowedPrincipals[0] == "*" {
 			return parsedPrincipals, nil
 		}
 
@@ -302,19 +360,13 @@ func (b *backend) calculateCriticalOptions(data *framework.FieldData, role *sshR
 
 	criticalOptions := convertMapToStringValue(unparsedCriticalOptions)
 
-	if role.AllowedCriticalOptions != "" {
-		notAllowedOptions := []string{}
-		allowedCriticalOptions := strings.Split(role.AllowedCriticalOptions, ",")
-
-		for option := range criticalOptions {
-			if !strutil.StrListContains(allowedCriticalOptions, option) {
-				notAllowedOptions = append(notAllowedOptions, option)
-			}
-		}
-
-		if len(notAllowedOptions) != 0 {
-			return nil, fmt.Errorf("critical options not on allowed list: %v", notAllowedOptions)
-		}
+	notAllowed := notAllowedOptions(criticalOptions, role.AllowedCriticalOptions, role.DefaultCriticalOptions)
+	switch {
+	case len(notAllowed) == 0:
+	case role.AllowedCriticalOptions == "":
+		return nil, fmt.Errorf("critical options not on the role's default critical options: %v", notAllowed)
+	default:
+		return nil, fmt.Errorf("critical options not on allowed list: %v", notAllowed)
 	}
 
 	return criticalOptions, nil
@@ -328,25 +380,46 @@ func (b *backend) calculateExtensions(data *framework.FieldData, role *sshRole)
 
 	extensions := convertMapToStringValue(unparsedExtensions)
 
-	if role.AllowedExtensions != "" {
-		notAllowed := []string{}
-		allowedExtensions := strings.Split(role.AllowedExtensions, ",")
+	notAllowed := notAllowedOptions(extensions, role.AllowedExtensions, role.DefaultExtensions)
+	switch {
+	case len(notAllowed) == 0:
+	case role.AllowedExtensions == "":
+		return nil, fmt.Errorf("extensions %v are not on the role's default extensions", notAllowed)
+	default:
+		return nil, fmt.Errorf("extensions %v are not on allowed list", notAllowed)
+	}
+
+	return extensions, nil
+}
 
-		for extension := range extensions {
-			if !strutil.StrListContains(allowedExtensions, extension) {
-				notAllowed = append(notAllowed, extension)
+// notAllowedOptions returns the sorted names of the requested critical options
+// or extensions that the role does not allow. An allowed list of "*" allows
+// anything, while an empty one only allows the role's defaults, with their
+// default values.
+func notAllowedOptions(requested map[string]string, allowed string, defaults map[string]string) []string {
+	if allowed == "*" {
+		return nil
+	}
+
+	allowedList := strutil.ParseStringSlice(allowed, ",")
+	notAllowed := []string{}
+	for name, value := range requested {
+		if len(allowedList) == 0 {
+			if defaultValue, ok := defaults[name]; !ok || defaultValue != value {
+				notAllowed = append(notAllowed, name)
 			}
+			continue
 		}
-
-		if len(notAllowed) != 0 {
-			return nil, fmt.Errorf("extensions %v are not on allowed list", notAllowed)
+		if !strutil.StrListContains(allowedList, name) {
+			notAllowed = append(notAllowed, name)
 		}
 	}
+	sort.Strings(notAllowed)
 
-	return extensions, nil
+	return notAllowed
 }
 
-func (b *backend) calculateTTL(data *framework.FieldData, role *sshRole) (time.Duration, error) {
+func (b *backend) calculateTTL(data *framework.FieldData, role *sshRole, certificateType uint32) (time.Duration, error) {
 	var ttl, maxTTL time.Duration
 	var err error
 
@@ -367,6 +440,15 @@ func (b *backend) calculateTTL(data *framework.FieldData, role *sshRole) (time.D
 	if err != nil {
 		return 0, err
 	}
+	if certificateType == ssh.HostCert {
+		hostMaxTTL, err := parseutil.ParseDurationSecond(role.HostMaxTTL)
+		if err != nil {
+			return 0, err
+		}
+		if hostMaxTTL != 0 {
+			maxTTL = hostMaxTTL
+		}
+	}
 	if maxTTL == 0 {
 		maxTTL = b.System().MaxLeaseTTL()
 	}
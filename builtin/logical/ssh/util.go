@@ -3,10 +3,14 @@ package ssh
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/pem"
 	"fmt"
 	"net"
@@ -14,30 +18,179 @@ import (
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 
 	log "github.com/hashicorp/go-hclog"
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/ssh"
 )
 
-// Creates a new RSA key pair with the given key length. The private key will be
-// of pem format and the public key will be of OpenSSH format.
-func generateRSAKeys(keyBits int) (publicKeyRsa string, privateKeyRsa string, err error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, keyBits)
+const (
+	sshKeyTypeRSA     = "rsa"
+	sshKeyTypeECDSA   = "ecdsa"
+	sshKeyTypeEd25519 = "ed25519"
+)
+
+// Checks the type and length of a key pair to be generated and returns them
+// with the defaults for the type filled in. RSA keys default to
+// defaultRSABits bits and ECDSA keys to the P-256 curve; ed25519 keys have no
+// length.
+func normalizeSSHKeyParams(keyType string, keyBits, defaultRSABits int) (string, int, error) {
+	switch keyType {
+	case "", sshKeyTypeRSA:
+		switch keyBits {
+		case 0:
+			return sshKeyTypeRSA, defaultRSABits, nil
+		case 1024, 2048, 4096:
+			return sshKeyTypeRSA, keyBits, nil
+		}
+		return "", 0, fmt.Errorf("invalid key_bits %d for RSA keys; must be 1024, 2048 or 4096", keyBits)
+	case sshKeyTypeECDSA:
+		switch keyBits {
+		case 0:
+			return sshKeyTypeECDSA, 256, nil
+		case 256, 384, 521:
+			return sshKeyTypeECDSA, keyBits, nil
+		}
+		return "", 0, fmt.Errorf("invalid key_bits %d for ECDSA keys; must be 256, 384 or 521", keyBits)
+	case sshKeyTypeEd25519:
+		if keyBits != 0 {
+			return "", 0, fmt.Errorf("key_bits is not applicable to ed25519 keys")
+		}
+		return sshKeyTypeEd25519, 0, nil
+	}
+	return "", 0, fmt.Errorf("invalid key type %q; must be %q, %q or %q", keyType, sshKeyTypeRSA, sshKeyTypeECDSA, sshKeyTypeEd25519)
+}
+
+// Creates a new key pair of the given type and length. The private key will
+// be of pem format: PKCS#1 for RSA keys, SEC 1 for ECDSA keys and the OpenSSH
+// format for ed25519 keys.
+func generateSSHKey(keyType string, keyBits int) (ssh.PublicKey, string, error) {
+	var publicKey crypto.PublicKey
+	var privateBlock *pem.Block
+	switch keyType {
+	case sshKeyTypeRSA:
+		privateKey, err := rsa.GenerateKey(rand.Reader, keyBits)
+		if err != nil {
+			return nil, "", errwrap.Wrapf("error generating RSA key-pair: {{err}}", err)
+		}
+		publicKey = privateKey.Public()
+		privateBlock = &pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		}
+	case sshKeyTypeECDSA:
+		var curve elliptic.Curve
+		switch keyBits {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, "", fmt.Errorf("unsupported ECDSA key length %d", keyBits)
+		}
+		privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, "", errwrap.Wrapf("error generating ECDSA key-pair: {{err}}", err)
+		}
+		der, err := x509.MarshalECPrivateKey(privateKey)
+		if err != nil {
+			return nil, "", errwrap.Wrapf("error marshaling ECDSA private key: {{err}}", err)
+		}
+		publicKey = privateKey.Public()
+		privateBlock = &pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: der,
+		}
+	case sshKeyTypeEd25519:
+		public, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, "", errwrap.Wrapf("error generating ed25519 key-pair: {{err}}", err)
+		}
+		der, err := marshalOpenSSHEd25519PrivateKey(privateKey)
+		if err != nil {
+			return nil, "", errwrap.Wrapf("error marshaling ed25519 private key: {{err}}", err)
+		}
+		publicKey = public
+		privateBlock = &pem.Block{
+			Type:  "OPENSSH PRIVATE KEY",
+			Bytes: der,
+		}
+	default:
+		return nil, "", fmt.Errorf("unsupported key type %q", keyType)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
 	if err != nil {
-		return "", "", errwrap.Wrapf("error generating RSA key-pair: {{err}}", err)
+		return nil, "", errwrap.Wrapf("error generating SSH public key: {{err}}", err)
 	}
 
-	privateKeyRsa = string(pem.EncodeToMemory(&pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}))
+	return sshPublicKey, string(pem.EncodeToMemory(privateBlock)), nil
+}
 
-	sshPublicKey, err := ssh.NewPublicKey(privateKey.Public())
+// Encodes an ed25519 private key in the unencrypted "openssh-key-v1" format
+// used by OpenSSH, which is the only format the ssh package parses them from.
+func marshalOpenSSHEd25519PrivateKey(privateKey ed25519.PrivateKey) ([]byte, error) {
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
 	if err != nil {
-		return "", "", errwrap.Wrapf("error generating RSA key-pair: {{err}}", err)
+		return nil, err
+	}
+
+	checkBytes := make([]byte, 4)
+	if _, err := rand.Read(checkBytes); err != nil {
+		return nil, err
 	}
-	publicKeyRsa = "ssh-rsa " + base64.StdEncoding.EncodeToString(sshPublicKey.Marshal())
+	check := binary.BigEndian.Uint32(checkBytes)
+
+	privateKeyBlock := ssh.Marshal(struct {
+		Check1  uint32
+		Check2  uint32
+		Keytype string
+		Pub     []byte
+		Priv    []byte
+		Comment string
+	}{
+		Check1:  check,
+		Check2:  check,
+		Keytype: ssh.KeyAlgoED25519,
+		Pub:     []byte(privateKey.Public().(ed25519.PublicKey)),
+		Priv:    []byte(privateKey),
+	})
+	// The block is padded to the cipher block size, which is 8 without a cipher
+	for i := byte(1); len(privateKeyBlock)%8 != 0; i++ {
+		privateKeyBlock = append(privateKeyBlock, i)
+	}
+
+	encoded := ssh.Marshal(struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{
+		CipherName:   "none",
+		KdfName:      "none",
+		NumKeys:      1,
+		PubKey:       publicKey.Marshal(),
+		PrivKeyBlock: privateKeyBlock,
+	})
+
+	return append([]byte("openssh-key-v1\x00"), encoded...), nil
+}
+
+// Creates a new key pair of the given type and length for dynamic keys. The
+// private key will be of pem format and the public key will be of OpenSSH
+// format.
+func generateDynamicKeys(keyType string, keyBits int) (publicKey string, privateKey string, err error) {
+	sshPublicKey, privateKey, err := generateSSHKey(keyType, keyBits)
+	if err != nil {
+		return "", "", err
+	}
+	publicKey = sshPublicKey.Type() + " " + base64.StdEncoding.EncodeToString(sshPublicKey.Marshal())
 	return
 }
 
@@ -105,6 +258,22 @@ func (b *backend) installPublicKeyInTarget(ctx context.Context, adminUser, usern
 	return nil
 }
 
+// Checks that an install script references each of the arguments it is run
+// with by installPublicKeyInTarget. Scripts passing all of their arguments
+// along with "$@" or "$*" are accepted as is.
+func validateInstallScript(script string) error {
+	if strings.Contains(script, "$@") || strings.Contains(script, "$*") {
+		return nil
+	}
+	for i, arg := range []string{"install option", "public key file", "authorized_keys file"} {
+		n := i + 1
+		if !strings.Contains(script, fmt.Sprintf("$%d", n)) && !strings.Contains(script, fmt.Sprintf("${%d}", n)) {
+			return fmt.Errorf(`"install_script" does not reference the %s argument ($%d)`, arg, n)
+		}
+	}
+	return nil
+}
+
 // Takes an IP address and role name and checks if the IP is part
 // of CIDR blocks belonging to the role.
 func roleContainsIP(ctx context.Context, s logical.Storage, roleName string, ip string) (bool, error) {
@@ -129,6 +298,10 @@ func roleContainsIP(ctx context.Context, s logical.Storage, roleName string, ip
 		return false, fmt.Errorf("error decoding role %q", roleName)
 	}
 
+	if role.AllowZeroAddress {
+		return true, nil
+	}
+
 	if matched, err := cidrListContainsIP(ip, role.CIDRList); err != nil {
 		return false, err
 	} else {
@@ -142,16 +315,47 @@ func cidrListContainsIP(ip, cidrList string) (bool, error) {
 	if len(cidrList) == 0 {
 		return false, fmt.Errorf("IP does not belong to role")
 	}
-	for _, item := range strings.Split(cidrList, ",") {
+	block, err := cidrListMatch(ip, cidrList)
+	if err != nil {
+		return false, err
+	}
+	return block != "", nil
+}
+
+// Returns the first of the comma separated CIDR blocks that contains the IP
+// supplied by the user, or an empty string if none does. Both IPv4 and IPv6
+// addresses and blocks are supported; IPv4 addresses are never matched by IPv6
+// blocks other than the IPv4-mapped ones.
+func cidrListMatch(ip, cidrList string) (string, error) {
+	ipAddr := net.ParseIP(ip)
+	if ipAddr == nil {
+		return "", fmt.Errorf("invalid IP %q", ip)
+	}
+	for _, item := range strutil.ParseStringSlice(cidrList, ",") {
 		_, cidrIPNet, err := net.ParseCIDR(item)
 		if err != nil {
-			return false, fmt.Errorf("invalid CIDR entry %q", item)
+			return "", fmt.Errorf("invalid CIDR entry %q", item)
 		}
-		if cidrIPNet.Contains(net.ParseIP(ip)) {
-			return true, nil
+		if cidrIPNet.Contains(ipAddr) {
+			return item, nil
 		}
 	}
-	return false, nil
+	return "", nil
+}
+
+// Returns the first of the comma separated CIDR blocks that covers every
+// IPv4 or every IPv6 address, such as 0.0.0.0/0 or ::/0, if any.
+func zeroAddressCIDR(cidrList string) string {
+	for _, item := range strutil.ParseStringSlice(cidrList, ",") {
+		_, cidrIPNet, err := net.ParseCIDR(item)
+		if err != nil {
+			continue
+		}
+		if ones, _ := cidrIPNet.Mask.Size(); ones == 0 {
+			return item
+		}
+	}
+	return ""
 }
 
 func createSSHComm(logger log.Logger, username, ip string, port int, hostkey string) (*comm, error) {
@@ -223,3 +427,60 @@ func substQuery(tpl string, data map[string]string) string {
 
 	return tpl
 }
+
+const (
+	minOTPLength = 8
+	maxOTPLength = 128
+
+	defaultOTPCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// Checks that the characters of an OTP character set are distinct, printable
+// and not whitespace, and that there are enough of them to be random.
+func validateOTPCharset(charset string) error {
+	if len(charset) < 2 {
+		return fmt.Errorf(`"otp_charset" must contain at least two characters`)
+	}
+	seen := make(map[rune]bool, len(charset))
+	for _, c := range charset {
+		if c < '!' || c > '~' {
+			return fmt.Errorf(`"otp_charset" contains invalid character %q; only printable ASCII characters other than space are allowed`, c)
+		}
+		if seen[c] {
+			return fmt.Errorf(`"otp_charset" contains duplicate character %q`, c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// Generates a random string of the given length using characters from the
+// given set. Random bytes that would bias the result towards the start of the
+// set are discarded.
+func generateOTP(length int, charset string) (string, error) {
+	if length <= 0 || len(charset) == 0 {
+		return "", fmt.Errorf("invalid OTP length or character set")
+	}
+
+	// Largest multiple of len(charset) that fits in a byte
+	limit := 256 - 256%len(charset)
+
+	otp := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(otp) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", errwrap.Wrapf("error generating OTP: {{err}}", err)
+		}
+		for _, r := range buf {
+			if int(r) >= limit {
+				continue
+			}
+			otp = append(otp, charset[int(r)%len(charset)])
+			if len(otp) == length {
+				break
+			}
+		}
+	}
+
+	return string(otp), nil
+}
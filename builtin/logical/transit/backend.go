@@ -2,18 +2,35 @@ package transit
 
 import (
 	"context"
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// minAutoRotatePeriod is the smallest non-zero automatic rotation period that
+// can be configured on a key
+const minAutoRotatePeriod = time.Hour
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 	b := Backend(conf)
 	if err := b.Setup(ctx, conf); err != nil {
 		return nil, err
 	}
+
+	// Apply any previously configured cache size
+	if conf.StorageView != nil {
+		if err := b.applyCacheConfig(ctx, conf.StorageView); err != nil {
+			return nil, err
+		}
+	}
+
 	return b, nil
 }
 
@@ -23,6 +40,7 @@ func Backend(conf *logical.BackendConfig) *backend {
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"archive/",
+				"import/",
 				"policy/",
 			},
 		},
@@ -31,8 +49,14 @@ func Backend(conf *logical.BackendConfig) *backend {
 			// Rotate/Config needs to come before Keys
 			// as the handler is greedy
 			b.pathConfig(),
+			b.pathConfigKeys(),
+			b.pathCacheConfig(),
 			b.pathRotate(),
 			b.pathRewrap(),
+			b.pathImport(),
+			b.pathImportVersion(),
+			b.pathWrappingKey(),
+			b.pathUsage(),
 			b.pathKeys(),
 			b.pathListKeys(),
 			b.pathExportKeys(),
@@ -49,12 +73,15 @@ func Backend(conf *logical.BackendConfig) *backend {
 			b.pathTrim(),
 		},
 
-		Secrets:     []*framework.Secret{},
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Secrets:      []*framework.Secret{},
+		Invalidate:   b.invalidate,
+		PeriodicFunc: b.periodicFunc,
+		BackendType:  logical.TypeLogical,
 	}
 
+	b.storage = conf.StorageView
 	b.lm = keysutil.NewLockManager(conf.System.CachingDisabled())
+	b.usage = newUsageTracker()
 
 	return &b
 }
@@ -62,9 +89,24 @@ func Backend(conf *logical.BackendConfig) *backend {
 type backend struct {
 	*framework.Backend
 	lm *keysutil.LockManager
+
+	// storage is the mount's storage, for use outside of requests
+	storage logical.Storage
+
+	// wrappingKeyLock serializes the creation of the key import wrapping key
+	wrappingKeyLock sync.Mutex
+
+	// usage holds key usage that has not been persisted yet; usageLock
+	// serializes writes to the stored usage
+	usage     *usageTracker
+	usageLock sync.Mutex
+
+	// keysConfig caches the mount-wide keys configuration
+	keysConfig     *keysConfig
+	keysConfigLock sync.RWMutex
 }
 
-func (b *backend) invalidate(_ context.Context, key string) {
+func (b *backend) invalidate(ctx context.Context, key string) {
 	if b.Logger().IsDebug() {
 		b.Logger().Debug("invalidating key", "key", key)
 	}
@@ -72,5 +114,156 @@ func (b *backend) invalidate(_ context.Context, key string) {
 	case strings.HasPrefix(key, "policy/"):
 		name := strings.TrimPrefix(key, "policy/")
 		b.lm.InvalidatePolicy(name)
+	case key == keysConfigPath:
+		b.keysConfigLock.Lock()
+		b.keysConfig = nil
+		b.keysConfigLock.Unlock()
+	case key == cacheConfigPath:
+		// Pick up a cache size configured on another node
+		if b.storage == nil {
+			return
+		}
+		if err := b.applyCacheConfig(ctx, b.storage); err != nil {
+			b.Logger().Error("failed to apply cache configuration", "error", err)
+		}
+	}
+}
+
+// applyCacheConfig sizes the key cache according to the stored cache
+// configuration
+func (b *backend) applyCacheConfig(ctx context.Context, s logical.Storage) error {
+	if !b.lm.CacheActive() {
+		return nil
+	}
+
+	config, err := readCacheConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	return b.lm.SetCacheSize(config.Size)
+}
+
+// periodicFunc is invoked by the RollbackManager roughly once a minute. It
+// persists the usage recorded since the last run, and rotates every key whose
+// auto_rotate_period has elapsed since the latest version was created.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if !b.ownsKeys() {
+		return nil
+	}
+
+	var errs *multierror.Error
+	if err := b.flushUsage(ctx, req.Storage); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	names, err := req.Storage.List(ctx, "policy/")
+	if err != nil {
+		errs = multierror.Append(errs, err)
+		return errs.ErrorOrNil()
+	}
+
+	for _, name := range names {
+		if err := b.autoRotateKey(ctx, req.Storage, name); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to auto-rotate key %q: %v", name, err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// ownsKeys reports whether this node is the one that writes the keys of the
+// mount. Only that node persists usage and rotates keys; performance
+// standbys, and performance secondaries for replicated mounts, do neither.
+func (b *backend) ownsKeys() bool {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return false
+	}
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return false
+	}
+	return true
+}
+
+// recordUsage counts count operations of the given type performed with the
+// named key. Usage is only recorded on the node that persists it, so that it
+// does not accumulate in memory on nodes that never flush it.
+func (b *backend) recordUsage(name string, op usageOp, count int) {
+	if !b.ownsKeys() {
+		return
+	}
+	b.usage.record(name, op, count)
+}
+
+// autoRotateKey rotates the named key if its auto_rotate_period has elapsed.
+// The stored key is checked first so that keys which are not due are not
+// loaded into the policy cache.
+func (b *backend) autoRotateKey(ctx context.Context, storage logical.Storage, name string) error {
+	stored, err := keysutil.LoadPolicy(ctx, storage, "policy/"+name)
+	if err != nil {
+		return err
+	}
+	if stored == nil || !autoRotateDue(stored) {
+		return nil
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: storage,
+		Name:    name,
+	})
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	// The key may have changed since it was checked
+	if !autoRotateDue(p) {
+		return nil
+	}
+
+	// The period of a key whose latest version has no known creation time
+	// starts now rather than the key being rotated right away
+	if autoRotateStart(p).IsZero() {
+		p.AutoRotateStartTime = time.Now()
+		return p.Persist(ctx, storage)
+	}
+
+	return p.Rotate(ctx, storage)
+}
+
+// autoRotateDue reports whether the key has auto rotation enabled and either
+// its period has elapsed or the period has yet to be started
+func autoRotateDue(p *keysutil.Policy) bool {
+	if p.AutoRotatePeriod == 0 {
+		return false
+	}
+	start := autoRotateStart(p)
+	return start.IsZero() || time.Since(start) >= p.AutoRotatePeriod
+}
+
+// autoRotateStart returns the time from which the auto rotate period of the
+// key is counted. This is the creation time of the latest version, or, if
+// that is unknown, the time auto rotation first found the key. A zero time
+// means the period has not been started.
+func autoRotateStart(p *keysutil.Policy) time.Time {
+	if start := p.LastRotationTime(); !start.IsZero() {
+		return start
+	}
+	return p.AutoRotateStartTime
+}
+
+func validateAutoRotatePeriod(period time.Duration) error {
+	switch {
+	case period < 0:
+		return fmt.Errorf("auto rotate period cannot be negative")
+	case period != 0 && period < minAutoRotatePeriod:
+		return fmt.Errorf("auto rotate period must be 0 to disable or at least %s", minAutoRotatePeriod)
 	}
+	return nil
 }
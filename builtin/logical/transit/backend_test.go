@@ -205,8 +205,8 @@ func testTransit_RSA(t *testing.T, keyType string) {
 		"hash_algorithm": "invalid",
 	}
 	resp, err = b.HandleRequest(context.Background(), signReq)
-	if err != nil {
-		t.Fatal(err)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request error, got %v", err)
 	}
 	if resp == nil || !resp.IsError() {
 		t.Fatal("expected an error response")
@@ -246,6 +246,35 @@ func testTransit_RSA(t *testing.T, keyType string) {
 	if !resp.Data["valid"].(bool) {
 		t.Fatalf("failed to verify the RSA signature")
 	}
+
+	// Key derivation is not supported for RSA keys
+	keyReq.Path = "keys/rsa-derived"
+	keyReq.Data = map[string]interface{}{
+		"type":    keyType,
+		"derived": true,
+	}
+	resp, err = b.HandleRequest(context.Background(), keyReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an invalid request error creating a derived RSA key; err: %v\nresp: %#v", err, resp)
+	}
+
+	encryptReq.Data = map[string]interface{}{
+		"plaintext": plaintext,
+		"context":   "dGVzdGNvbnRleHQ=",
+	}
+	resp, err = b.HandleRequest(context.Background(), encryptReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an invalid request error encrypting with a context; err: %v\nresp: %#v", err, resp)
+	}
+
+	// Plaintexts larger than RSA-OAEP allows should be rejected
+	encryptReq.Data = map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(make([]byte, 1024)),
+	}
+	resp, err = b.HandleRequest(context.Background(), encryptReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an invalid request error for an oversized plaintext; err: %v\nresp: %#v", err, resp)
+	}
 }
 
 func TestBackend_basic(t *testing.T) {
@@ -1311,6 +1340,121 @@ func TestPolicyFuzzing(t *testing.T) {
 	testPolicyFuzzingCommon(t, be)
 }
 
+// TestTransit_ConcurrentKeyAccess encrypts with many keys, upserting them,
+// while one of them is rotated. It is most useful when run with -race.
+func TestTransit_ConcurrentKeyAccess(t *testing.T) {
+	sysView := logical.TestSystemView()
+	conf := &logical.BackendConfig{
+		System: sysView,
+	}
+
+	be := Backend(conf)
+	be.Setup(context.Background(), conf)
+	testConcurrentKeyAccessCommon(t, be)
+
+	sysView.CachingDisabledVal = true
+	be = Backend(conf)
+	be.Setup(context.Background(), conf)
+	testConcurrentKeyAccessCommon(t, be)
+}
+
+func testConcurrentKeyAccessCommon(t *testing.T, be *backend) {
+	storage := &logical.InmemStorage{}
+	plaintext := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+
+	const numKeys = 16
+	const numWorkers = 8
+	const numRequests = 50
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// Keep rotating the first key while the others are in use
+	rotations := 0
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			resp, err := be.HandleRequest(context.Background(), &logical.Request{
+				Storage:   storage,
+				Operation: logical.UpdateOperation,
+				Path:      "keys/key-0",
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Errorf("resp: %#v\nerr: %v", resp, err)
+				return
+			}
+			resp, err = be.HandleRequest(context.Background(), &logical.Request{
+				Storage:   storage,
+				Operation: logical.UpdateOperation,
+				Path:      "keys/key-0/rotate",
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Errorf("resp: %#v\nerr: %v", resp, err)
+				return
+			}
+			rotations++
+		}
+	}()
+
+	var workers sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		workers.Add(1)
+		go func(w int) {
+			defer workers.Done()
+			for i := 0; i < numRequests; i++ {
+				name := fmt.Sprintf("key-%d", (w+i)%numKeys)
+				resp, err := be.HandleRequest(context.Background(), &logical.Request{
+					Storage:   storage,
+					Operation: logical.CreateOperation,
+					Path:      "encrypt/" + name,
+					Data: map[string]interface{}{
+						"plaintext": plaintext,
+					},
+				})
+				if err != nil || resp == nil || resp.IsError() {
+					t.Errorf("encrypt with %s; resp: %#v\nerr: %v", name, resp, err)
+					return
+				}
+
+				resp, err = be.HandleRequest(context.Background(), &logical.Request{
+					Storage:   storage,
+					Operation: logical.UpdateOperation,
+					Path:      "decrypt/" + name,
+					Data: map[string]interface{}{
+						"ciphertext": resp.Data["ciphertext"],
+					},
+				})
+				if err != nil || resp == nil || resp.IsError() {
+					t.Errorf("decrypt with %s; resp: %#v\nerr: %v", name, resp, err)
+					return
+				}
+				if resp.Data["plaintext"] != plaintext {
+					t.Errorf("bad plaintext for %s: %v", name, resp.Data["plaintext"])
+					return
+				}
+			}
+		}(w)
+	}
+
+	workers.Wait()
+	close(stop)
+	wg.Wait()
+
+	if t.Failed() {
+		return
+	}
+	if rotations == 0 {
+		t.Fatal("expected the key to be rotated while in use")
+	}
+}
+
 func testPolicyFuzzingCommon(t *testing.T, be *backend) {
 	storage := &logical.InmemStorage{}
 	wg := sync.WaitGroup{}
@@ -1471,3 +1615,499 @@ func TestBadInput(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestConvergentEncryption_Immutable(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"derived":               true,
+			"convergent_encryption": true,
+		},
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Writing the same settings again is a no-op
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	req.Data["convergent_encryption"] = false
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error toggling convergent encryption; err:%v resp:%#v", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Data = nil
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !resp.Data["convergent_encryption"].(bool) {
+		t.Fatal("expected convergent encryption to remain enabled")
+	}
+}
+
+func TestKeyType_Immutable(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"type": "chacha20-poly1305",
+		},
+	}
+
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Writing the same type, or no type at all, again is a no-op
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	req.Data = nil
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	req.Data = map[string]interface{}{
+		"type": "aes256-gcm96",
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error changing the key type; err:%v resp:%#v", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Data = nil
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["type"].(string) != "chacha20-poly1305" {
+		t.Fatalf("expected the key type to be unchanged, got %v", resp.Data["type"])
+	}
+}
+
+func TestTransit_AES128(t *testing.T) {
+	testTransitAES128(t, false)
+	testTransitAES128(t, true)
+}
+
+func testTransitAES128(t *testing.T, derived bool) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("path %s: err:%v resp:%#v", path, err, resp)
+		}
+		return resp
+	}
+
+	keyData := map[string]interface{}{
+		"type":       "aes128-gcm96",
+		"exportable": true,
+	}
+	reqData := map[string]interface{}{}
+	if derived {
+		keyData["derived"] = true
+		keyData["convergent_encryption"] = true
+		reqData["context"] = "dGVzdGNvbnRleHQ="
+	}
+	doReq("keys/test", keyData)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/test",
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["type"].(string) != "aes128-gcm96" {
+		t.Fatalf("bad: key type: %v", resp.Data["type"])
+	}
+
+	// The raw key material is 128 bits
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "export/encryption-key/test/1",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	keyBytes, err := base64.StdEncoding.DecodeString(resp.Data["keys"].(map[string]string)["1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyBytes) != 16 {
+		t.Fatalf("bad: expected a 16 byte key, got %d bytes", len(keyBytes))
+	}
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	reqData["plaintext"] = plaintext
+	ciphertext := doReq("encrypt/test", reqData).Data["ciphertext"].(string)
+	delete(reqData, "plaintext")
+
+	if derived {
+		// Convergent encryption must be deterministic
+		reqData["plaintext"] = plaintext
+		if doReq("encrypt/test", reqData).Data["ciphertext"].(string) != ciphertext {
+			t.Fatal("expected convergent ciphertexts to match")
+		}
+		delete(reqData, "plaintext")
+	}
+
+	doReq("keys/test/rotate", nil)
+
+	reqData["ciphertext"] = ciphertext
+	ciphertext = doReq("rewrap/test", reqData).Data["ciphertext"].(string)
+	if !strings.HasPrefix(ciphertext, "vault:v2:") {
+		t.Fatalf("bad: expected rewrapped ciphertext at version 2: %s", ciphertext)
+	}
+
+	reqData["ciphertext"] = ciphertext
+	if doReq("decrypt/test", reqData).Data["plaintext"].(string) != plaintext {
+		t.Fatal("bad: decrypted plaintext mismatch")
+	}
+	delete(reqData, "ciphertext")
+
+	resp = doReq("datakey/plaintext/test", reqData)
+	reqData["ciphertext"] = resp.Data["ciphertext"]
+	if doReq("decrypt/test", reqData).Data["plaintext"].(string) != resp.Data["plaintext"].(string) {
+		t.Fatal("bad: datakey plaintext mismatch")
+	}
+}
+
+func TestTransit_DeletionAllowed(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	keyReq := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+	}
+	resp, err := b.HandleRequest(context.Background(), keyReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	checkDeletionAllowed := func(expected bool) {
+		t.Helper()
+		keyReq.Operation = logical.ReadOperation
+		resp, err := b.HandleRequest(context.Background(), keyReq)
+		if err != nil || resp == nil {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		if resp.Data["deletion_allowed"].(bool) != expected {
+			t.Fatalf("expected deletion_allowed to be %t", expected)
+		}
+	}
+	checkDeletionAllowed(false)
+
+	// Deletion is refused by default
+	keyReq.Operation = logical.DeleteOperation
+	resp, err = b.HandleRequest(context.Background(), keyReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+	checkDeletionAllowed(false)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test/config",
+		Data: map[string]interface{}{
+			"deletion_allowed": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	checkDeletionAllowed(true)
+
+	keyReq.Operation = logical.DeleteOperation
+	resp, err = b.HandleRequest(context.Background(), keyReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Deleting a key that no longer exists is a user error as well
+	resp, err = b.HandleRequest(context.Background(), keyReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+}
+
+func TestTransit_AutoRotate(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	// Periods below the minimum are rejected
+	resp, err := doReq(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"auto_rotate_period": "30m",
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = doReq(logical.UpdateOperation, "keys/test", map[string]interface{}{
+		"auto_rotate_period": "24h",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq(logical.UpdateOperation, "keys/manual", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = doReq(logical.ReadOperation, "keys/test", nil)
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["auto_rotate_period"].(int64) != int64((24 * time.Hour).Seconds()) {
+		t.Fatalf("bad: auto_rotate_period: %v", resp.Data["auto_rotate_period"])
+	}
+	if resp.Data["last_rotation_time"].(time.Time).IsZero() {
+		t.Fatal("expected a last rotation time")
+	}
+
+	// Nothing is due yet, and keys that are not due are not loaded into the
+	// cache
+	b.lm.InvalidatePolicy("test")
+	b.lm.InvalidatePolicy("manual")
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.lm.CacheLen(); n != 0 {
+		t.Fatalf("expected no cached keys, got %d", n)
+	}
+
+	// Backdate the latest version of both keys past the rotation period
+	for _, name := range []string{"test", "manual"} {
+		p, _, err := b.lm.GetPolicy(context.Background(), keysutil.PolicyRequest{
+			Storage: storage,
+			Name:    name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.LatestVersion != 1 {
+			t.Fatalf("bad: expected key %s to be at version 1, got %d", name, p.LatestVersion)
+		}
+		entry := p.Keys["1"]
+		entry.CreationTime = time.Now().Add(-25 * time.Hour)
+		p.Keys["1"] = entry
+		if err := p.Persist(context.Background(), storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkVersion := func(name string, expected int) {
+		t.Helper()
+		resp, err := doReq(logical.ReadOperation, "keys/"+name, nil)
+		if err != nil || resp == nil {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		if resp.Data["latest_version"].(int) != expected {
+			t.Fatalf("bad: expected key %s at version %d, got %v", name, expected, resp.Data["latest_version"])
+		}
+	}
+	checkVersion("test", 2)
+	checkVersion("manual", 1)
+
+	// The freshly rotated key is not rotated again
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion("test", 2)
+
+	// A key whose creation time is unknown, as for keys migrated from the
+	// legacy format, starts its period when it is first checked instead of
+	// being rotated right away
+	resp, err = doReq(logical.UpdateOperation, "keys/legacy", map[string]interface{}{
+		"auto_rotate_period": "24h",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	p, _, err := b.lm.GetPolicy(context.Background(), keysutil.PolicyRequest{
+		Storage: storage,
+		Name:    "legacy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := p.Keys["1"]
+	entry.CreationTime = time.Time{}
+	entry.DeprecatedCreationTime = 0
+	p.Keys["1"] = entry
+	if err := p.Persist(context.Background(), storage); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion("legacy", 1)
+	if time.Since(p.AutoRotateStartTime) > time.Minute {
+		t.Fatalf("expected the rotation period to start now, got %v", p.AutoRotateStartTime)
+	}
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion("legacy", 1)
+
+	p.AutoRotateStartTime = time.Now().Add(-25 * time.Hour)
+	if err := p.Persist(context.Background(), storage); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion("legacy", 2)
+
+	// Auto rotation can be disabled through the config endpoint, but not set
+	// below the minimum
+	resp, err = doReq(logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"auto_rotate_period": 60,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq(logical.UpdateOperation, "keys/test/config", map[string]interface{}{
+		"auto_rotate_period": 0,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq(logical.ReadOperation, "keys/test", nil)
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["auto_rotate_period"].(int64) != 0 {
+		t.Fatalf("bad: auto_rotate_period: %v", resp.Data["auto_rotate_period"])
+	}
+}
+
+func TestTransit_ReadKeyVersions(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	start := time.Now().Add(-time.Second).Unix()
+
+	doReq(logical.UpdateOperation, "keys/aes", nil)
+	doReq(logical.UpdateOperation, "keys/aes/rotate", nil)
+	doReq(logical.UpdateOperation, "keys/aes/rotate", nil)
+
+	resp := doReq(logical.ReadOperation, "keys/aes", nil)
+	if resp.Data["latest_version"].(int) != 3 || resp.Data["min_decryption_version"].(int) != 1 {
+		t.Fatalf("bad: versions: %#v", resp.Data)
+	}
+	if !resp.Data["supports_derivation"].(bool) || resp.Data["convergent_encryption"].(bool) {
+		t.Fatalf("bad: derivation and convergence: %#v", resp.Data)
+	}
+	symKeys := resp.Data["keys"].(map[string]int64)
+	if len(symKeys) != 3 {
+		t.Fatalf("bad: expected 3 versions: %#v", symKeys)
+	}
+	for ver, creationTime := range symKeys {
+		if creationTime < start {
+			t.Fatalf("bad: creation time of version %s: %d", ver, creationTime)
+		}
+	}
+
+	doReq(logical.UpdateOperation, "keys/ecdsa", map[string]interface{}{"type": "ecdsa-p256"})
+	doReq(logical.UpdateOperation, "keys/ecdsa/rotate", nil)
+
+	resp = doReq(logical.ReadOperation, "keys/ecdsa", nil)
+	asymKeys := resp.Data["keys"].(map[string]map[string]interface{})
+	if len(asymKeys) != 2 {
+		t.Fatalf("bad: expected 2 versions: %#v", asymKeys)
+	}
+	for ver, key := range asymKeys {
+		if key["public_key"].(string) == "" {
+			t.Fatalf("bad: missing public key for version %s", ver)
+		}
+		if key["creation_time"].(time.Time).Unix() < start {
+			t.Fatalf("bad: creation time of version %s: %v", ver, key["creation_time"])
+		}
+	}
+
+	// Versions created before creation times were recorded report the zero
+	// time
+	for _, name := range []string{"aes", "ecdsa"} {
+		p, _, err := b.lm.GetPolicy(context.Background(), keysutil.PolicyRequest{
+			Storage: storage,
+			Name:    name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := p.Keys["1"]
+		entry.CreationTime = time.Time{}
+		entry.DeprecatedCreationTime = 0
+		p.Keys["1"] = entry
+		if err := p.Persist(context.Background(), storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp = doReq(logical.ReadOperation, "keys/aes", nil)
+	if creationTime := resp.Data["keys"].(map[string]int64)["1"]; creationTime != 0 {
+		t.Fatalf("bad: expected unknown creation time to be 0, got %d", creationTime)
+	}
+	resp = doReq(logical.ReadOperation, "keys/ecdsa", nil)
+	if creationTime := resp.Data["keys"].(map[string]map[string]interface{})["1"]["creation_time"].(time.Time); !creationTime.IsZero() {
+		t.Fatalf("bad: expected unknown creation time to be zero, got %v", creationTime)
+	}
+}
@@ -3,6 +3,7 @@ package transit
 import (
 	"context"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -29,7 +30,12 @@ func (b *backend) pathBackup() *framework.Path {
 func (b *backend) pathBackupRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	backup, err := b.lm.BackupPolicy(ctx, req.Storage, d.Get("name").(string))
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
 	}
 
 	return &logical.Response{
@@ -2,6 +2,8 @@ package transit
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
@@ -9,6 +11,7 @@ import (
 
 func TestTransit_BackupRestore(t *testing.T) {
 	// Test encryption/decryption after a restore for supported keys
+	testBackupRestore(t, "aes128-gcm96", "encrypt-decrypt")
 	testBackupRestore(t, "aes256-gcm96", "encrypt-decrypt")
 	testBackupRestore(t, "chacha20-poly1305", "encrypt-decrypt")
 	testBackupRestore(t, "rsa-2048", "encrypt-decrypt")
@@ -21,6 +24,7 @@ func TestTransit_BackupRestore(t *testing.T) {
 	testBackupRestore(t, "rsa-4096", "sign-verify")
 
 	// Test HMAC/verification after a restore for all key types
+	testBackupRestore(t, "aes128-gcm96", "hmac-verify")
 	testBackupRestore(t, "aes256-gcm96", "hmac-verify")
 	testBackupRestore(t, "chacha20-poly1305", "hmac-verify")
 	testBackupRestore(t, "ecdsa-p256", "hmac-verify")
@@ -88,11 +92,8 @@ func testBackupRestore(t *testing.T, keyType, feature string) {
 		},
 	}
 	resp, err = b.HandleRequest(context.Background(), restoreReq)
-	if resp != nil && resp.IsError() {
-		t.Fatalf("resp: %#v\nerr: %v", resp, err)
-	}
-	if err == nil {
-		t.Fatalf("expected an error")
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an invalid request error; resp: %#v\nerr: %v", resp, err)
 	}
 
 	plaintextB64 := "dGhlIHF1aWNrIGJyb3duIGZveA==" // "the quick brown fox"
@@ -240,3 +241,184 @@ func testBackupRestore(t *testing.T, keyType, feature string) {
 	// Ensure that the restored key is functional
 	validationFunc("test1")
 }
+
+func TestTransit_BackupRestore_UserErrors(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	// Backing up a key that does not exist should be a user error
+	backupReq := &logical.Request{
+		Path:      "backup/test",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	}
+	resp, err := b.HandleRequest(context.Background(), backupReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Create a key that does not allow plaintext backups
+	keyReq := &logical.Request{
+		Path:      "keys/test",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+	}
+	resp, err = b.HandleRequest(context.Background(), keyReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), backupReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Allow backups and take one
+	configReq := &logical.Request{
+		Path:      "keys/test/config",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"exportable":             true,
+			"allow_plaintext_backup": true,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), configReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	resp, err = b.HandleRequest(context.Background(), backupReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	backup := resp.Data["backup"]
+
+	checkCode := func(data map[string]interface{}) {
+		t.Helper()
+		restoreReq := &logical.Request{
+			Path:      "restore",
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+			Data:      data,
+		}
+		resp, err := b.HandleRequest(context.Background(), restoreReq)
+		if err == nil {
+			t.Fatalf("expected an error; resp: %#v", resp)
+		}
+		if code, _ := logical.RespondErrorCommon(restoreReq, resp, err); code != http.StatusBadRequest {
+			t.Fatalf("expected status code %d, got %d: %v", http.StatusBadRequest, code, err)
+		}
+	}
+
+	// Restoring over an existing key without force is refused
+	checkCode(map[string]interface{}{"backup": backup})
+
+	// Malformed backups are refused
+	checkCode(map[string]interface{}{"backup": "not base64"})
+	checkCode(map[string]interface{}{"backup": "e30="})
+
+	// Forcing the restore succeeds
+	restoreReq := &logical.Request{
+		Path:      "restore",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"backup": backup,
+			"force":  true,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), restoreReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+}
+
+func TestTransit_BackupExportFlags(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	for _, tc := range []struct {
+		exportable           bool
+		allowPlaintextBackup bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		name := fmt.Sprintf("key-%t-%t", tc.exportable, tc.allowPlaintextBackup)
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "keys/" + name,
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+			Data: map[string]interface{}{
+				"exportable":             tc.exportable,
+				"allow_plaintext_backup": tc.allowPlaintextBackup,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+
+		// Both flags are reported on read
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "keys/" + name,
+			Operation: logical.ReadOperation,
+			Storage:   s,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		if resp.Data["exportable"].(bool) != tc.exportable {
+			t.Fatalf("%s: bad exportable; got %v", name, resp.Data["exportable"])
+		}
+		if resp.Data["allow_plaintext_backup"].(bool) != tc.allowPlaintextBackup {
+			t.Fatalf("%s: bad allow_plaintext_backup; got %v", name, resp.Data["allow_plaintext_backup"])
+		}
+
+		// Export is gated only by exportable
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "export/encryption-key/" + name,
+			Operation: logical.ReadOperation,
+			Storage:   s,
+		})
+		exported := err == nil && resp != nil && !resp.IsError()
+		if exported != tc.exportable {
+			t.Fatalf("%s: expected export to succeed: %t; resp: %#v\nerr: %v", name, tc.exportable, resp, err)
+		}
+
+		// Backup is gated only by allow_plaintext_backup
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "backup/" + name,
+			Operation: logical.ReadOperation,
+			Storage:   s,
+		})
+		backedUp := err == nil && resp != nil && !resp.IsError()
+		if backedUp != tc.allowPlaintextBackup {
+			t.Fatalf("%s: expected backup to succeed: %t; resp: %#v\nerr: %v", name, tc.allowPlaintextBackup, resp, err)
+		}
+
+		// Neither flag can be unset once enabled
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "keys/" + name + "/config",
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+			Data: map[string]interface{}{
+				"exportable":             false,
+				"allow_plaintext_backup": false,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "keys/" + name,
+			Operation: logical.ReadOperation,
+			Storage:   s,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		if resp.Data["exportable"].(bool) != tc.exportable || resp.Data["allow_plaintext_backup"].(bool) != tc.allowPlaintextBackup {
+			t.Fatalf("%s: flags changed after creation: %#v", name, resp.Data)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package transit
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const cacheConfigPath = "config/cache"
+
+// cacheConfig holds the configuration of the in-memory key policy cache
+type cacheConfig struct {
+	Size int `json:"size"`
+}
+
+func (b *backend) pathCacheConfig() *framework.Path {
+	return &framework.Path{
+		Pattern: "cache-config",
+		Fields: map[string]*framework.FieldSchema{
+			"size": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The maximum number of keys to keep in the cache.
+Least recently used keys are evicted once the size is exceeded. Defaults to 0,
+which means the cache is unbounded.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathCacheConfigRead,
+			logical.UpdateOperation: b.pathCacheConfigWrite,
+		},
+
+		HelpSynopsis:    pathCacheConfigHelpSyn,
+		HelpDescription: pathCacheConfigHelpDesc,
+	}
+}
+
+func readCacheConfig(ctx context.Context, s logical.Storage) (*cacheConfig, error) {
+	entry, err := s.Get(ctx, cacheConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var result cacheConfig
+	if entry == nil {
+		return &result, nil
+	}
+
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathCacheConfigRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"size":    b.lm.CacheSize(),
+			"entries": b.lm.CacheLen(),
+		},
+	}, nil
+}
+
+func (b *backend) pathCacheConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if !b.lm.CacheActive() {
+		return logical.ErrorResponse("caching is disabled for this mount"), logical.ErrInvalidRequest
+	}
+
+	config, err := readCacheConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if sizeRaw, ok := d.GetOk("size"); ok {
+		config.Size = sizeRaw.(int)
+	}
+
+	if config.Size < 0 {
+		return logical.ErrorResponse("size must be greater or equal to zero"), logical.ErrInvalidRequest
+	}
+
+	entry, err := logical.StorageEntryJSON(cacheConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	// Apply the new size right away; cached keys beyond the new size are
+	// evicted
+	if err := b.lm.SetCacheSize(config.Size); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+const pathCacheConfigHelpSyn = `Configure the in-memory cache of keys`
+
+const pathCacheConfigHelpDesc = `
+This path is used to configure and inspect the in-memory cache of keys. Setting
+'size' bounds the number of cached keys, evicting the least recently used keys
+once it is exceeded; a size of 0 leaves the cache unbounded. Changes take effect
+immediately. Reading this path returns the configured size and the number of
+keys currently cached.
+`
@@ -0,0 +1,94 @@
+package transit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_CacheConfig(t *testing.T) {
+	b, s := createBackendWithSysView(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	checkCache := func(size, entries int) {
+		t.Helper()
+		resp := doReq(logical.ReadOperation, "cache-config", nil)
+		if resp.Data["size"].(int) != size || resp.Data["entries"].(int) != entries {
+			t.Fatalf("expected size %d and %d entries, got %#v", size, entries, resp.Data)
+		}
+	}
+
+	// The cache is unbounded by default
+	for _, name := range []string{"a", "b", "c"} {
+		doReq(logical.UpdateOperation, "keys/"+name, nil)
+	}
+	checkCache(0, 3)
+
+	// Shrinking the cache evicts entries right away
+	doReq(logical.UpdateOperation, "cache-config", map[string]interface{}{"size": 2})
+	checkCache(2, 2)
+
+	// Keys remain usable after being evicted
+	for _, name := range []string{"a", "b", "c"} {
+		doReq(logical.UpdateOperation, "encrypt/"+name, map[string]interface{}{
+			"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		})
+	}
+	checkCache(2, 2)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "cache-config",
+		Data:      map[string]interface{}{"size": -1},
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+	checkCache(2, 2)
+
+	// The configured size is applied when the backend is created
+	nb, err := Factory(context.Background(), &logical.BackendConfig{
+		StorageView: s,
+		System:      logical.TestSystemView(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := nb.(*backend).lm.CacheSize(); size != 2 {
+		t.Fatalf("expected cache size 2 after reload, got %d", size)
+	}
+
+	// A size written by another node is applied when the config is
+	// invalidated
+	entry, err := logical.StorageEntryJSON(cacheConfigPath, &cacheConfig{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+	b.invalidate(context.Background(), cacheConfigPath)
+	checkCache(1, 1)
+
+	// A size of zero makes the cache unbounded again
+	doReq(logical.UpdateOperation, "cache-config", map[string]interface{}{"size": 0})
+	for _, name := range []string{"a", "b", "c"} {
+		doReq(logical.ReadOperation, "keys/"+name, nil)
+	}
+	checkCache(0, 3)
+}
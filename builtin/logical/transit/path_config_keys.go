@@ -0,0 +1,156 @@
+package transit
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const keysConfigPath = "config/keys"
+
+// defaultMaxBatchItems is the number of items accepted in a single batch
+// request when the mount does not configure a limit
+const defaultMaxBatchItems = 1000
+
+// keysConfig holds mount-wide settings that apply to every key in the mount
+type keysConfig struct {
+	DisableUpsert bool `json:"disable_upsert"`
+	MaxBatchItems int  `json:"max_batch_items"`
+}
+
+// maxBatchItems returns the maximum number of items accepted in a single
+// batch request
+func (c *keysConfig) maxBatchItems() int {
+	if c.MaxBatchItems == 0 {
+		return defaultMaxBatchItems
+	}
+	return c.MaxBatchItems
+}
+
+func (b *backend) pathConfigKeys() *framework.Path {
+	return &framework.Path{
+		Pattern: "config/keys",
+		Fields: map[string]*framework.FieldSchema{
+			"disable_upsert": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set to true, encrypting with a key that does
+not exist returns an error instead of creating the key.`,
+			},
+
+			"max_batch_items": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The maximum number of items accepted in a single
+batch request. Defaults to 0, which uses the built-in limit of 1000 items.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigKeysRead,
+			logical.UpdateOperation: b.pathConfigKeysWrite,
+		},
+
+		HelpSynopsis:    pathConfigKeysHelpSyn,
+		HelpDescription: pathConfigKeysHelpDesc,
+	}
+}
+
+// readKeysConfig returns a copy of the mount's keys configuration. The
+// configuration is read on every encrypt and decrypt request, so it is cached
+// until it is written or invalidated.
+func (b *backend) readKeysConfig(ctx context.Context, s logical.Storage) (*keysConfig, error) {
+	b.keysConfigLock.RLock()
+	if b.keysConfig != nil {
+		result := *b.keysConfig
+		b.keysConfigLock.RUnlock()
+		return &result, nil
+	}
+	b.keysConfigLock.RUnlock()
+
+	b.keysConfigLock.Lock()
+	defer b.keysConfigLock.Unlock()
+	if b.keysConfig == nil {
+		config, err := loadKeysConfig(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		b.keysConfig = config
+	}
+
+	result := *b.keysConfig
+	return &result, nil
+}
+
+func loadKeysConfig(ctx context.Context, s logical.Storage) (*keysConfig, error) {
+	entry, err := s.Get(ctx, keysConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var result keysConfig
+	if entry == nil {
+		return &result, nil
+	}
+
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigKeysRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.readKeysConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"disable_upsert":  config.DisableUpsert,
+			"max_batch_items": config.maxBatchItems(),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigKeysWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.keysConfigLock.Lock()
+	defer b.keysConfigLock.Unlock()
+
+	config, err := loadKeysConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if disableUpsertRaw, ok := d.GetOk("disable_upsert"); ok {
+		config.DisableUpsert = disableUpsertRaw.(bool)
+	}
+
+	if maxBatchItemsRaw, ok := d.GetOk("max_batch_items"); ok {
+		config.MaxBatchItems = maxBatchItemsRaw.(int)
+	}
+
+	if config.MaxBatchItems < 0 {
+		return logical.ErrorResponse("max_batch_items must be greater or equal to zero"), logical.ErrInvalidRequest
+	}
+
+	entry, err := logical.StorageEntryJSON(keysConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.keysConfig = config
+
+	return nil, nil
+}
+
+const pathConfigKeysHelpSyn = `Configure settings shared by all keys in the mount`
+
+const pathConfigKeysHelpDesc = `
+This path is used to configure settings that apply to every key in the mount.
+Setting 'disable_upsert' prevents the encrypt endpoint from implicitly creating
+keys that do not exist. Setting 'max_batch_items' bounds the number of items
+accepted in a single batch request.
+`
@@ -0,0 +1,118 @@
+package transit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_ConfigKeys(t *testing.T) {
+	b, s := createBackendWithSysView(t)
+
+	doReq := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	configReq := &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "config/keys",
+	}
+	resp := doReq(configReq)
+	if resp.Data["disable_upsert"].(bool) {
+		t.Fatal("expected upserting keys to be enabled by default")
+	}
+	if resp.Data["max_batch_items"].(int) != defaultMaxBatchItems {
+		t.Fatalf("expected the default batch limit; got %v", resp.Data["max_batch_items"])
+	}
+
+	encData := map[string]interface{}{
+		"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+	}
+
+	// Upserting is allowed by default
+	doReq(&logical.Request{
+		Storage:   s,
+		Operation: logical.CreateOperation,
+		Path:      "encrypt/upserted_key",
+		Data:      encData,
+	})
+
+	configReq.Operation = logical.UpdateOperation
+	configReq.Data = map[string]interface{}{
+		"disable_upsert": true,
+	}
+	doReq(configReq)
+
+	configReq.Operation = logical.ReadOperation
+	configReq.Data = nil
+	resp = doReq(configReq)
+	if !resp.Data["disable_upsert"].(bool) {
+		t.Fatal("expected upserting keys to be disabled")
+	}
+
+	// A negative batch limit is rejected
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "config/keys",
+		Data: map[string]interface{}{
+			"max_batch_items": -1,
+		},
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.CreateOperation,
+		Path:      "encrypt/typo_key",
+		Data:      encData,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	// The key must not have been created
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "keys/typo_key",
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("expected no key; err:%v resp:%#v", err, resp)
+	}
+
+	// Existing keys continue to work
+	doReq(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt/upserted_key",
+		Data:      encData,
+	})
+
+	// The configuration is cached until it is invalidated
+	entry, err := logical.StorageEntryJSON(keysConfigPath, &keysConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+	resp = doReq(configReq)
+	if !resp.Data["disable_upsert"].(bool) {
+		t.Fatal("expected the cached configuration to be used")
+	}
+	b.invalidate(context.Background(), keysConfigPath)
+	resp = doReq(configReq)
+	if resp.Data["disable_upsert"].(bool) {
+		t.Fatal("expected the stored configuration to be read after invalidation")
+	}
+}
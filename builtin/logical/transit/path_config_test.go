@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -82,7 +83,7 @@ func TestTransit_ConfigSettings(t *testing.T) {
 	req.Data["min_encryption_version"] = 7
 	doErrReq(req)
 	// Too low
-	req.Data["min_encryption_version"] = 7
+	req.Data["min_encryption_version"] = -1
 	doErrReq(req)
 
 	// Not allowed, cannot decrypt
@@ -162,6 +163,34 @@ func TestTransit_ConfigSettings(t *testing.T) {
 	testEncryptDecrypt(4, true)
 	testEncryptDecrypt(3, true)
 	testEncryptDecrypt(2, false)
+
+	testDatakey := func(ver int, valid bool) {
+		dkReq := &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "datakey/wrapped/" + key,
+			Data: map[string]interface{}{
+				"context": "abcd",
+			},
+		}
+		if ver != maxKeyVersion {
+			dkReq.Data["key_version"] = ver
+		}
+
+		if !valid {
+			doErrReq(dkReq)
+			return
+		}
+
+		resp := doReq(dkReq)
+		ct := resp.Data["ciphertext"].(string)
+		if strings.Split(ct, ":")[1] != "v"+strconv.Itoa(ver) {
+			t.Fatal("wrong datakey encryption version")
+		}
+	}
+	testDatakey(5, true)
+	testDatakey(3, true)
+	testDatakey(2, false)
 	testHMAC(5, true)
 	testHMAC(4, true)
 	testHMAC(3, true)
@@ -215,3 +244,62 @@ func TestTransit_ConfigSettings(t *testing.T) {
 	testHMAC(3, true)
 	testHMAC(2, false)
 }
+
+func TestTransit_ConfigMinDecryptionVersion(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := doReq("keys/foo", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("encrypt/foo", map[string]interface{}{"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA=="})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	for i := 0; i < 2; i++ {
+		resp, err = doReq("keys/foo/rotate", nil)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	resp, err = doReq("keys/foo/config", map[string]interface{}{"min_decryption_version": 3})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Both decrypt and rewrap must refuse the old version
+	for _, path := range []string{"decrypt/foo", "rewrap/foo"} {
+		resp, err = doReq(path, map[string]interface{}{"ciphertext": ciphertext})
+		if err != logical.ErrInvalidRequest {
+			t.Fatalf("%s: expected invalid request error, got %v", path, err)
+		}
+		if resp == nil || resp.Data["error"].(string) != keysutil.ErrTooOld {
+			t.Fatalf("%s: bad response: %#v", path, resp)
+		}
+	}
+
+	// Lowering the minimum again allows recovering the data
+	resp, err = doReq("keys/foo/config", map[string]interface{}{"min_decryption_version": 1})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("rewrap/foo", map[string]interface{}{"ciphertext": ciphertext})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !strings.HasPrefix(resp.Data["ciphertext"].(string), "vault:v3:") {
+		t.Fatalf("bad: expected ciphertext rewrapped to the latest version: %#v", resp.Data)
+	}
+}
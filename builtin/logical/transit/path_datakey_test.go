@@ -0,0 +1,94 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_Datakey(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := doReq("keys/derived", map[string]interface{}{"derived": true})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	keyContext := "dGVzdGNvbnRleHQ="
+
+	for _, bits := range []int{128, 256, 512} {
+		resp, err = doReq("datakey/plaintext/derived", map[string]interface{}{
+			"bits":    bits,
+			"context": keyContext,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bits %d: err:%v resp:%#v", bits, err, resp)
+		}
+		plaintext := resp.Data["plaintext"].(string)
+		plainBytes, err := base64.StdEncoding.DecodeString(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plainBytes)*8 != bits {
+			t.Fatalf("bad: expected %d bits, got %d", bits, len(plainBytes)*8)
+		}
+
+		// The returned ciphertext must decrypt to the returned key
+		resp, err = doReq("decrypt/derived", map[string]interface{}{
+			"ciphertext": resp.Data["ciphertext"],
+			"context":    keyContext,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bits %d: err:%v resp:%#v", bits, err, resp)
+		}
+		if resp.Data["plaintext"].(string) != plaintext {
+			t.Fatalf("bad: plaintext mismatch for %d bits", bits)
+		}
+	}
+
+	// The wrapped variant never returns the key material
+	resp, err = doReq("datakey/wrapped/derived", map[string]interface{}{
+		"context": keyContext,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if _, ok := resp.Data["plaintext"]; ok {
+		t.Fatalf("bad: plaintext returned from wrapped datakey: %#v", resp.Data)
+	}
+	if resp.Data["ciphertext"].(string) == "" {
+		t.Fatal("expected ciphertext")
+	}
+
+	// Derived keys require a context
+	resp, err = doReq("datakey/wrapped/derived", nil)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	// Unsupported bit lengths and path variants are rejected
+	resp, err = doReq("datakey/wrapped/derived", map[string]interface{}{
+		"bits":    64,
+		"context": keyContext,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("datakey/foobar/derived", map[string]interface{}{
+		"context": keyContext,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+}
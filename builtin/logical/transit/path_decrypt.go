@@ -4,12 +4,10 @@ import (
 	"context"
 	"encoding/base64"
 
-	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
-	"github.com/mitchellh/mapstructure"
 )
 
 func (b *backend) pathDecrypt() *framework.Path {
@@ -41,6 +39,22 @@ Base64 encoded nonce value used during encryption. Must be provided if
 convergent encryption is enabled for this key and the key was generated with
 Vault 0.6.1. Not required for keys created in 0.6.2+.`,
 			},
+
+			"associated_data": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+Base64 encoded additional data that was authenticated during encryption.
+Decryption fails unless this matches the value provided to encrypt.`,
+			},
+
+			"encoding": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "base64",
+				Description: `
+The encoding used for the returned plaintext. Valid values are "base64",
+"base64url" (unpadded) and "hex". Defaults to "base64". Batch items may
+override this with their own 'encoding'.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -53,17 +67,23 @@ Vault 0.6.1. Not required for keys created in 0.6.2+.`,
 }
 
 func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	encoding := d.Get("encoding").(string)
+	if _, err := encodePlaintext(encoding, nil); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// Items are decoded and decrypted one at a time through nextItem, so that
+	// only the responses are accumulated
+	var nextItem func() (*BatchRequestItem, error)
 	batchInputRaw := d.Raw["batch_input"]
-	var batchInputItems []BatchRequestItem
-	var err error
 	if batchInputRaw != nil {
-		err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+		config, err := b.readKeysConfig(ctx, req.Storage)
 		if err != nil {
-			return nil, errwrap.Wrapf("failed to parse batch input: {{err}}", err)
+			return nil, err
 		}
-
-		if len(batchInputItems) == 0 {
-			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		nextItem, err = batchInputIterator(batchInputRaw, config.maxBatchItems())
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 		}
 	} else {
 		ciphertext := d.Get("ciphertext").(string)
@@ -71,44 +91,22 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, d
 			return logical.ErrorResponse("missing ciphertext to decrypt"), logical.ErrInvalidRequest
 		}
 
-		batchInputItems = make([]BatchRequestItem, 1)
-		batchInputItems[0] = BatchRequestItem{
-			Ciphertext: ciphertext,
-			Context:    d.Get("context").(string),
-			Nonce:      d.Get("nonce").(string),
-		}
+		nextItem = batchItemIterator([]BatchRequestItem{
+			BatchRequestItem{
+				Ciphertext:     ciphertext,
+				Context:        d.Get("context").(string),
+				Nonce:          d.Get("nonce").(string),
+				AssociatedData: d.Get("associated_data").(string),
+			},
+		})
 	}
 
-	batchResponseItems := make([]BatchResponseItem, len(batchInputItems))
-	contextSet := len(batchInputItems[0].Context) != 0
-
-	for i, item := range batchInputItems {
-		if (len(item.Context) == 0 && contextSet) || (len(item.Context) != 0 && !contextSet) {
-			return logical.ErrorResponse("context should be set either in all the request blocks or in none"), logical.ErrInvalidRequest
-		}
-
-		if item.Ciphertext == "" {
-			batchResponseItems[i].Error = "missing ciphertext to decrypt"
-			continue
-		}
-
-		// Decode the context
-		if len(item.Context) != 0 {
-			batchInputItems[i].DecodedContext, err = base64.StdEncoding.DecodeString(item.Context)
-			if err != nil {
-				batchResponseItems[i].Error = err.Error()
-				continue
-			}
-		}
-
-		// Decode the nonce
-		if len(item.Nonce) != 0 {
-			batchInputItems[i].DecodedNonce, err = base64.StdEncoding.DecodeString(item.Nonce)
-			if err != nil {
-				batchResponseItems[i].Error = err.Error()
-				continue
-			}
-		}
+	item, err := nextItem()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if item == nil {
+		return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
 	}
 
 	// Get the policy
@@ -126,29 +124,34 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, d
 		p.Lock(false)
 	}
 
-	for i, item := range batchInputItems {
-		if batchResponseItems[i].Error != "" {
-			continue
+	// A missing context on a derived key is reported by the policy when the
+	// item is decrypted, so that it results in an item-level error rather
+	// than failing the entire batch.
+	var batchResponseItems []BatchResponseItem
+	for item != nil {
+		if item.Encoding == "" {
+			item.Encoding = encoding
+		}
+
+		result, err := decryptBatchItem(p, item)
+		if err != nil {
+			p.Unlock()
+			return nil, err
 		}
+		batchResponseItems = append(batchResponseItems, result)
 
-		plaintext, err := p.Decrypt(item.DecodedContext, item.DecodedNonce, item.Ciphertext)
+		item, err = nextItem()
 		if err != nil {
-			switch err.(type) {
-			case errutil.UserError:
-				batchResponseItems[i].Error = err.Error()
-				continue
-			default:
-				p.Unlock()
-				return nil, err
-			}
+			p.Unlock()
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 		}
-		batchResponseItems[i].Plaintext = plaintext
 	}
 
 	resp := &logical.Response{}
 	if batchInputRaw != nil {
 		resp.Data = map[string]interface{}{
-			"batch_results": batchResponseItems,
+			"batch_results":  batchResponseItems,
+			"batch_failures": batchFailureCount(batchResponseItems),
 		}
 	} else {
 		if batchResponseItems[0].Error != "" {
@@ -160,13 +163,95 @@ func (b *backend) pathDecryptWrite(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	b.recordUsage(p.Name, usageDecrypt, len(batchResponseItems)-batchFailureCount(batchResponseItems))
+
 	p.Unlock()
 	return resp, nil
 }
 
+// decryptBatchItem decrypts a single batch request item. Problems with the
+// item itself are reported in the Error field of the returned response item;
+// a returned error aborts the whole request.
+func decryptBatchItem(p *keysutil.Policy, item *BatchRequestItem) (BatchResponseItem, error) {
+	var result BatchResponseItem
+
+	if item.Ciphertext == "" {
+		result.Error = "missing ciphertext to decrypt"
+		return result, nil
+	}
+
+	if _, err := encodePlaintext(item.Encoding, nil); err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	if result.Error = decodeCiphertextItem(item); result.Error != "" {
+		return result, nil
+	}
+
+	plaintext, err := p.DecryptWithAAD(item.DecodedContext, item.DecodedNonce, item.Ciphertext, item.DecodedAssociatedData)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			result.Error = err.Error()
+			return result, nil
+		default:
+			return result, err
+		}
+	}
+
+	if item.Encoding != "base64" {
+		plainBytes, err := base64.StdEncoding.DecodeString(plaintext)
+		if err != nil {
+			return result, err
+		}
+		plaintext, err = encodePlaintext(item.Encoding, plainBytes)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.Plaintext = plaintext
+	return result, nil
+}
+
+// decodeCiphertextItem decodes the base64 encoded context, nonce and
+// associated data of a decrypt or rewrap batch item. It returns the error to
+// report for the item, if any.
+func decodeCiphertextItem(item *BatchRequestItem) string {
+	var err error
+
+	// Decode the context
+	if len(item.Context) != 0 {
+		item.DecodedContext, err = base64.StdEncoding.DecodeString(item.Context)
+		if err != nil {
+			return err.Error()
+		}
+	}
+
+	// Decode the nonce
+	if len(item.Nonce) != 0 {
+		item.DecodedNonce, err = base64.StdEncoding.DecodeString(item.Nonce)
+		if err != nil {
+			return err.Error()
+		}
+	}
+
+	// Decode the associated data
+	if len(item.AssociatedData) != 0 {
+		item.DecodedAssociatedData, err = base64.StdEncoding.DecodeString(item.AssociatedData)
+		if err != nil {
+			return "failed to base64-decode associated data"
+		}
+	}
+
+	return ""
+}
+
 const pathDecryptHelpSyn = `Decrypt a ciphertext value using a named key`
 
 const pathDecryptHelpDesc = `
 This path uses the named key from the request path to decrypt a user
-provided ciphertext. The plaintext is returned base64 encoded.
+provided ciphertext. The plaintext is returned base64 encoded unless a
+different 'encoding' is specified.
 `
@@ -135,3 +135,77 @@ func TestTransit_BatchDecryption_DerivedKey(t *testing.T) {
 		}
 	}
 }
+
+func TestTransit_BatchDecryption_DerivedKey_MissingContext(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	policyReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/existing_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"derived": true,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), policyReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	encReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt/existing_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			"context":   "dGVzdGNvbnRleHQ=",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), encReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	// The second item is missing its context, which should only fail that
+	// item and not the entire batch
+	batchDecryptionInput := []interface{}{
+		map[string]interface{}{"ciphertext": ciphertext, "context": "dGVzdGNvbnRleHQ="},
+		map[string]interface{}{"ciphertext": ciphertext},
+	}
+
+	batchDecryptionReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "decrypt/existing_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"batch_input": batchDecryptionInput,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), batchDecryptionReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	batchDecryptionResponseItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if len(batchDecryptionResponseItems) != 2 {
+		t.Fatalf("bad: expected 2 response items, got %d", len(batchDecryptionResponseItems))
+	}
+
+	if batchDecryptionResponseItems[0].Error != "" {
+		t.Fatalf("bad: unexpected error: %q", batchDecryptionResponseItems[0].Error)
+	}
+	if batchDecryptionResponseItems[0].Plaintext != "dGhlIHF1aWNrIGJyb3duIGZveA==" {
+		t.Fatalf("bad: plaintext: %q", batchDecryptionResponseItems[0].Plaintext)
+	}
+
+	if batchDecryptionResponseItems[1].Error == "" {
+		t.Fatalf("expected an error for the item missing its context")
+	}
+	if batchDecryptionResponseItems[1].Plaintext != "" {
+		t.Fatalf("bad: expected no plaintext, got %q", batchDecryptionResponseItems[1].Plaintext)
+	}
+}
@@ -3,9 +3,11 @@ package transit
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"reflect"
+	"strings"
 
-	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
@@ -35,6 +37,16 @@ type BatchRequestItem struct {
 
 	// DecodedNonce is the base64 decoded version of Nonce
 	DecodedNonce []byte
+
+	// AssociatedData is additional data that is authenticated, but not
+	// encrypted, along with the plaintext
+	AssociatedData string `json:"associated_data" structs:"associated_data" mapstructure:"associated_data"`
+
+	// DecodedAssociatedData is the base64 decoded version of AssociatedData
+	DecodedAssociatedData []byte
+
+	// Encoding of the plaintext; overrides the request-level encoding
+	Encoding string `json:"encoding" structs:"encoding" mapstructure:"encoding"`
 }
 
 // BatchResponseItem represents a response item for batch processing
@@ -52,6 +64,104 @@ type BatchResponseItem struct {
 	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
 }
 
+// batchFailureCount returns the number of batch response items for which the
+// requested operation failed
+func batchFailureCount(items []BatchResponseItem) int {
+	var count int
+	for _, item := range items {
+		if item.Error != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// checkBatchSize returns an error if the raw batch input holds more than
+// maxItems items
+func checkBatchSize(batchInputRaw interface{}, maxItems int) error {
+	v := reflect.ValueOf(batchInputRaw)
+	if v.Kind() == reflect.Slice && v.Len() > maxItems {
+		return fmt.Errorf("batch input exceeds the maximum of %d items", maxItems)
+	}
+	return nil
+}
+
+// batchInputIterator returns a function decoding the items of the raw
+// batch_input one at a time, and nil once they are exhausted, so that the
+// complete list of items is never held in decoded form
+func batchInputIterator(batchInputRaw interface{}, maxItems int) (func() (*BatchRequestItem, error), error) {
+	if err := checkBatchSize(batchInputRaw, maxItems); err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(batchInputRaw)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("failed to parse batch input: expected a list of items")
+	}
+
+	var i int
+	return func() (*BatchRequestItem, error) {
+		if i >= v.Len() {
+			return nil, nil
+		}
+		var item BatchRequestItem
+		if err := mapstructure.Decode(v.Index(i).Interface(), &item); err != nil {
+			return nil, fmt.Errorf("failed to parse batch input: %v", err)
+		}
+		i++
+		return &item, nil
+	}, nil
+}
+
+// batchItemIterator returns a function yielding the given items in order,
+// and nil once they are exhausted
+func batchItemIterator(items []BatchRequestItem) func() (*BatchRequestItem, error) {
+	var i int
+	return func() (*BatchRequestItem, error) {
+		if i >= len(items) {
+			return nil, nil
+		}
+		i++
+		return &items[i-1], nil
+	}
+}
+
+// decodePlaintext decodes a caller-supplied plaintext using the given encoding
+func decodePlaintext(encoding, value string) ([]byte, error) {
+	var plaintext []byte
+	var err error
+	switch encoding {
+	case "base64":
+		plaintext, err = base64.StdEncoding.DecodeString(value)
+	case "base64url":
+		// Accept both padded and unpadded input
+		plaintext, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	case "hex":
+		plaintext, err = hex.DecodeString(value)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode plaintext as %s: %v", encoding, err)
+	}
+
+	return plaintext, nil
+}
+
+// encodePlaintext encodes a plaintext for return to the caller using the
+// given encoding
+func encodePlaintext(encoding string, plaintext []byte) (string, error) {
+	switch encoding {
+	case "base64":
+		return base64.StdEncoding.EncodeToString(plaintext), nil
+	case "base64url":
+		return base64.RawURLEncoding.EncodeToString(plaintext), nil
+	case "hex":
+		return hex.EncodeToString(plaintext), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
 func (b *backend) pathEncrypt() *framework.Path {
 	return &framework.Path{
 		Pattern: "encrypt/" + framework.GenericNameRegex("name"),
@@ -78,18 +188,36 @@ Base64 encoded nonce value. Must be provided if convergent encryption is
 enabled for this key and the key was generated with Vault 0.6.1. Not required
 for keys created in 0.6.2+. The value must be exactly 96 bits (12 bytes) long
 and the user must ensure that for any given context (and thus, any given
-encryption key) this nonce value is **never reused**.
+encryption key) this nonce value is **never reused**. Providing a nonce for a
+key that does not use convergent encryption is an error.
 `,
 			},
 
+			"associated_data": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+Base64 encoded additional data to authenticate along with the plaintext. The
+data is not encrypted or stored in the ciphertext; the same value must be
+provided on decryption. Only supported by AEAD key types.`,
+			},
+
+			"encoding": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "base64",
+				Description: `
+The encoding of the plaintext. Valid values are "base64", "base64url" (padding
+optional) and "hex". Defaults to "base64". Batch items may override this with
+their own 'encoding'.`,
+			},
+
 			"type": &framework.FieldSchema{
 				Type:    framework.TypeString,
 				Default: "aes256-gcm96",
 				Description: `
 This parameter is required when encryption key is expected to be created.
 When performing an upsert operation, the type of key to create. Currently,
-"aes256-gcm96" (symmetric) is the only type supported. Defaults to
-"aes256-gcm96".`,
+"aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric) and
+"chacha20-poly1305" (symmetric) are supported. Defaults to "aes256-gcm96".`,
 			},
 
 			"convergent_encryption": &framework.FieldSchema{
@@ -134,8 +262,8 @@ func (b *backend) pathEncryptExistenceCheck(ctx context.Context, req *logical.Re
 	if err != nil {
 		return false, err
 	}
-	if p != nil && b.System().CachingDisabled() {
-		p.Unlock()
+	if p != nil {
+		p.Release()
 	}
 
 	return p != nil, nil
@@ -145,74 +273,88 @@ func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, d
 	name := d.Get("name").(string)
 	var err error
 
-	batchInputRaw := d.Raw["batch_input"]
-	var batchInputItems []BatchRequestItem
-	if batchInputRaw != nil {
-		err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+	encoding := d.Get("encoding").(string)
+	if _, err := encodePlaintext(encoding, nil); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// Items are consumed one at a time through nextItem, so that batch input
+	// is decoded as it is processed rather than all at once
+	var nextItem func() (*BatchRequestItem, error)
+	var isBatch bool
+	if batchInputRaw := d.Raw["batch_input"]; batchInputRaw != nil {
+		config, err := b.readKeysConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		nextItem, err = batchInputIterator(batchInputRaw, config.maxBatchItems())
 		if err != nil {
-			return nil, errwrap.Wrapf("failed to parse batch input: {{err}}", err)
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 		}
 
-		if len(batchInputItems) == 0 {
-			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		// If the policy is supposed to be upserted, then 'derived' is
+		// determined by the presence of the 'context' field, so it must be
+		// consistent across all the input items. Only the context of each
+		// item is decoded here.
+		var contextSet bool
+		items := reflect.ValueOf(batchInputRaw)
+		for i := 0; i < items.Len(); i++ {
+			var item struct {
+				Context string `mapstructure:"context"`
+			}
+			if err := mapstructure.Decode(items.Index(i).Interface(), &item); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("failed to parse batch input: %v", err)), logical.ErrInvalidRequest
+			}
+			if i == 0 {
+				contextSet = len(item.Context) != 0
+			}
+			if (len(item.Context) == 0 && contextSet) || (len(item.Context) != 0 && !contextSet) {
+				return logical.ErrorResponse("context should be set either in all the request blocks or in none"), logical.ErrInvalidRequest
+			}
 		}
+
+		isBatch = true
 	} else {
 		valueRaw, ok := d.GetOk("plaintext")
 		if !ok {
 			return logical.ErrorResponse("missing plaintext to encrypt"), logical.ErrInvalidRequest
 		}
 
-		batchInputItems = make([]BatchRequestItem, 1)
-		batchInputItems[0] = BatchRequestItem{
-			Plaintext:  valueRaw.(string),
-			Context:    d.Get("context").(string),
-			Nonce:      d.Get("nonce").(string),
-			KeyVersion: d.Get("key_version").(int),
-		}
+		nextItem = batchItemIterator([]BatchRequestItem{
+			BatchRequestItem{
+				Plaintext:      valueRaw.(string),
+				Context:        d.Get("context").(string),
+				Nonce:          d.Get("nonce").(string),
+				AssociatedData: d.Get("associated_data").(string),
+				KeyVersion:     d.Get("key_version").(int),
+			},
+		})
 	}
 
-	batchResponseItems := make([]BatchResponseItem, len(batchInputItems))
-	contextSet := len(batchInputItems[0].Context) != 0
-
-	// Before processing the batch request items, get the policy. If the
-	// policy is supposed to be upserted, then determine if 'derived' is to
-	// be set or not, based on the presence of 'context' field in all the
-	// input items.
-	for i, item := range batchInputItems {
-		if (len(item.Context) == 0 && contextSet) || (len(item.Context) != 0 && !contextSet) {
-			return logical.ErrorResponse("context should be set either in all the request blocks or in none"), logical.ErrInvalidRequest
-		}
-
-		_, err := base64.StdEncoding.DecodeString(item.Plaintext)
-		if err != nil {
-			batchResponseItems[i].Error = err.Error()
-			continue
-		}
-
-		// Decode the context
-		if len(item.Context) != 0 {
-			batchInputItems[i].DecodedContext, err = base64.StdEncoding.DecodeString(item.Context)
-			if err != nil {
-				batchResponseItems[i].Error = err.Error()
-				continue
-			}
-		}
-
-		// Decode the nonce
-		if len(item.Nonce) != 0 {
-			batchInputItems[i].DecodedNonce, err = base64.StdEncoding.DecodeString(item.Nonce)
-			if err != nil {
-				batchResponseItems[i].Error = err.Error()
-				continue
-			}
-		}
+	// The first item decides whether a key created by this request is
+	// derived
+	item, err := nextItem()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
+	if item == nil {
+		return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+	}
+	contextSet := len(item.Context) != 0
 
 	// Get the policy
 	var p *keysutil.Policy
 	var upserted bool
 	var polReq keysutil.PolicyRequest
 	if req.Operation == logical.CreateOperation {
+		config, err := b.readKeysConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if config.DisableUpsert {
+			return logical.ErrorResponse("encryption key not found and upserting keys is disabled for this mount"), logical.ErrInvalidRequest
+		}
+
 		convergent := d.Get("convergent_encryption").(bool)
 		if convergent && !contextSet {
 			return logical.ErrorResponse("convergent encryption requires derivation to be enabled, so context is required"), nil
@@ -228,6 +370,8 @@ func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, d
 
 		keyType := d.Get("type").(string)
 		switch keyType {
+		case "aes128-gcm96":
+			polReq.KeyType = keysutil.KeyType_AES128_GCM96
 		case "aes256-gcm96":
 			polReq.KeyType = keysutil.KeyType_AES256_GCM96
 		case "chacha20-poly1305":
@@ -257,35 +401,40 @@ func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, d
 	// Process batch request items. If encryption of any request
 	// item fails, respectively mark the error in the response
 	// collection and continue to process other items.
-	for i, item := range batchInputItems {
-		if batchResponseItems[i].Error != "" {
-			continue
+	var batchResponseItems []BatchResponseItem
+	for i := 0; item != nil; i++ {
+		if (len(item.Context) == 0 && contextSet) || (len(item.Context) != 0 && !contextSet) {
+			p.Unlock()
+			return logical.ErrorResponse("context should be set either in all the request blocks or in none"), logical.ErrInvalidRequest
 		}
 
-		ciphertext, err := p.Encrypt(item.KeyVersion, item.DecodedContext, item.DecodedNonce, item.Plaintext)
-		if err != nil {
-			switch err.(type) {
-			case errutil.UserError:
-				batchResponseItems[i].Error = err.Error()
-				continue
-			default:
-				p.Unlock()
-				return nil, err
-			}
+		if item.Encoding == "" {
+			item.Encoding = encoding
 		}
 
-		if ciphertext == "" {
+		result, err := encryptBatchItem(p, item)
+		if err != nil {
+			p.Unlock()
+			return nil, err
+		}
+		if result.Error == "" && result.Ciphertext == "" {
 			p.Unlock()
 			return nil, fmt.Errorf("empty ciphertext returned for input item %d", i)
 		}
+		batchResponseItems = append(batchResponseItems, result)
 
-		batchResponseItems[i].Ciphertext = ciphertext
+		item, err = nextItem()
+		if err != nil {
+			p.Unlock()
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
 	}
 
 	resp := &logical.Response{}
-	if batchInputRaw != nil {
+	if isBatch {
 		resp.Data = map[string]interface{}{
-			"batch_results": batchResponseItems,
+			"batch_results":  batchResponseItems,
+			"batch_failures": batchFailureCount(batchResponseItems),
 		}
 	} else {
 		if batchResponseItems[0].Error != "" {
@@ -301,14 +450,79 @@ func (b *backend) pathEncryptWrite(ctx context.Context, req *logical.Request, d
 		resp.AddWarning("Attempted creation of the key during the encrypt operation, but it was created beforehand")
 	}
 
+	b.recordUsage(p.Name, usageEncrypt, len(batchResponseItems)-batchFailureCount(batchResponseItems))
+
 	p.Unlock()
 	return resp, nil
 }
 
+// encryptBatchItem encrypts a single batch request item. Problems with the
+// item itself are reported in the Error field of the returned response item;
+// a returned error aborts the whole request.
+func encryptBatchItem(p *keysutil.Policy, item *BatchRequestItem) (BatchResponseItem, error) {
+	var result BatchResponseItem
+
+	// Normalize the plaintext to the standard base64 expected by the policy
+	plaintext, err := decodePlaintext(item.Encoding, item.Plaintext)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	// Decode the context
+	if len(item.Context) != 0 {
+		item.DecodedContext, err = base64.StdEncoding.DecodeString(item.Context)
+		if err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+	}
+
+	// Decode the nonce
+	if len(item.Nonce) != 0 {
+		item.DecodedNonce, err = base64.StdEncoding.DecodeString(item.Nonce)
+		if err != nil {
+			result.Error = err.Error()
+			return result, nil
+		}
+	}
+
+	// Decode the associated data
+	if len(item.AssociatedData) != 0 {
+		item.DecodedAssociatedData, err = base64.StdEncoding.DecodeString(item.AssociatedData)
+		if err != nil {
+			result.Error = "failed to base64-decode associated data"
+			return result, nil
+		}
+	}
+
+	// A caller-supplied nonce is only meaningful for convergent keys;
+	// everywhere else the nonce must be random to keep the AEAD secure
+	if len(item.DecodedNonce) != 0 && !p.ConvergentEncryption {
+		result.Error = "provided nonce is not allowed for keys that do not use convergent encryption"
+		return result, nil
+	}
+
+	ciphertext, err := p.EncryptWithAAD(item.KeyVersion, item.DecodedContext, item.DecodedNonce, base64.StdEncoding.EncodeToString(plaintext), item.DecodedAssociatedData)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			result.Error = err.Error()
+			return result, nil
+		default:
+			return result, err
+		}
+	}
+
+	result.Ciphertext = ciphertext
+	return result, nil
+}
+
 const pathEncryptHelpSyn = `Encrypt a plaintext value or a batch of plaintext
 blocks using a named key`
 
 const pathEncryptHelpDesc = `
 This path uses the named key from the request path to encrypt a user provided
-plaintext or a batch of plaintext blocks. The plaintext must be base64 encoded.
+plaintext or a batch of plaintext blocks. The plaintext must be base64 encoded
+unless a different 'encoding' is specified.
 `
@@ -2,6 +2,9 @@ package transit
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
@@ -496,8 +499,10 @@ func TestTransit_BatchEncryptionCase10(t *testing.T) {
 	}
 }
 
-// Case11: Incorrect inputs for context and nonce should not fail the operation
+// Case11: Incorrect inputs for context and nonce should not fail the
+// operation, but should be reported on the corresponding item
 func TestTransit_BatchEncryptionCase11(t *testing.T) {
+	var resp *logical.Response
 	var err error
 
 	b, s := createBackendWithStorage(t)
@@ -516,9 +521,21 @@ func TestTransit_BatchEncryptionCase11(t *testing.T) {
 		Storage:   s,
 		Data:      batchData,
 	}
-	_, err = b.HandleRequest(context.Background(), batchReq)
-	if err != nil {
-		t.Fatal(err)
+	resp, err = b.HandleRequest(context.Background(), batchReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	batchResponseItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if batchResponseItems[0].Error != "" || batchResponseItems[0].Ciphertext == "" {
+		t.Fatalf("bad: expected a ciphertext for the first item: %#v", batchResponseItems[0])
+	}
+	if batchResponseItems[1].Error == "" || batchResponseItems[1].Ciphertext != "" {
+		t.Fatalf("bad: expected an error for the second item: %#v", batchResponseItems[1])
+	}
+
+	if resp.Data["batch_failures"].(int) != 1 {
+		t.Fatalf("bad: batch_failures: expected: 1, actual: %v", resp.Data["batch_failures"])
 	}
 }
 
@@ -546,3 +563,574 @@ func TestTransit_BatchEncryptionCase12(t *testing.T) {
 		t.Fatalf("expected an error")
 	}
 }
+
+// Case13: Batch results should marshal directly as a JSON array of items,
+// without any further encoding
+func TestTransit_BatchEncryptionCase13(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, s := createBackendWithStorage(t)
+
+	batchInput := []interface{}{
+		map[string]interface{}{"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA=="},
+		map[string]interface{}{"plaintext": "Cg=="},
+	}
+
+	batchReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "encrypt/upserted_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"batch_input": batchInput,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), batchReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	jsonResp, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		BatchResults []map[string]interface{} `json:"batch_results"`
+	}
+	if err := json.Unmarshal(jsonResp, &decoded); err != nil {
+		t.Fatalf("batch results did not decode as a JSON array: %v", err)
+	}
+
+	if len(decoded.BatchResults) != len(batchInput) {
+		t.Fatalf("bad: expected %d batch results, got %d", len(batchInput), len(decoded.BatchResults))
+	}
+
+	for _, item := range decoded.BatchResults {
+		if _, ok := item["ciphertext"].(string); !ok {
+			t.Fatalf("bad: missing ciphertext in batch result item: %#v", item)
+		}
+	}
+}
+
+// Case15: Batch encryption honors key_version per item, failing only the
+// items requesting unusable versions
+func TestTransit_BatchEncryptionCase15(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	doReq("keys/existing_key", nil)
+	doReq("keys/existing_key/rotate", nil)
+	doReq("keys/existing_key/rotate", nil)
+	doReq("keys/existing_key/config", map[string]interface{}{
+		"min_encryption_version": 2,
+	})
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	batchInput := []interface{}{
+		map[string]interface{}{"plaintext": plaintext},
+		map[string]interface{}{"plaintext": plaintext, "key_version": 2},
+		map[string]interface{}{"plaintext": plaintext, "key_version": 1},
+		map[string]interface{}{"plaintext": plaintext, "key_version": 4},
+	}
+
+	resp = doReq("encrypt/existing_key", map[string]interface{}{
+		"batch_input": batchInput,
+	})
+
+	batchResponseItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if len(batchResponseItems) != 4 {
+		t.Fatalf("bad: expected 4 batch results, got %d", len(batchResponseItems))
+	}
+	if !strings.HasPrefix(batchResponseItems[0].Ciphertext, "vault:v3:") {
+		t.Fatalf("bad: expected latest version: %#v", batchResponseItems[0])
+	}
+	if !strings.HasPrefix(batchResponseItems[1].Ciphertext, "vault:v2:") {
+		t.Fatalf("bad: expected version 2: %#v", batchResponseItems[1])
+	}
+	if batchResponseItems[2].Error == "" || batchResponseItems[2].Ciphertext != "" {
+		t.Fatalf("bad: expected an error below min_encryption_version: %#v", batchResponseItems[2])
+	}
+	if batchResponseItems[3].Error == "" || batchResponseItems[3].Ciphertext != "" {
+		t.Fatalf("bad: expected an error for a nonexistent version: %#v", batchResponseItems[3])
+	}
+	if resp.Data["batch_failures"].(int) != 2 {
+		t.Fatalf("bad: expected 2 batch failures, got %v", resp.Data["batch_failures"])
+	}
+
+	// Outside of batch mode an unusable version fails the request
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt/existing_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"plaintext":   plaintext,
+			"key_version": 1,
+		},
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+}
+
+// Case16: Caller-supplied nonces are rejected per item for keys that do not
+// use convergent encryption
+func TestTransit_BatchEncryptionCase16(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+
+	resp, err := doReq("keys/derived", map[string]interface{}{"derived": true})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("keys/convergent", map[string]interface{}{
+		"derived":               true,
+		"convergent_encryption": true,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	keyContext := "dGVzdGNvbnRleHQ="
+	nonce := "b25ldHdvdGhyZWVl"
+
+	resp, err = doReq("encrypt/derived", map[string]interface{}{
+		"plaintext": plaintext,
+		"context":   keyContext,
+		"nonce":     nonce,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = doReq("encrypt/derived", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"plaintext": plaintext, "context": keyContext},
+			map[string]interface{}{"plaintext": plaintext, "context": keyContext, "nonce": nonce},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	batchResponseItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if batchResponseItems[0].Error != "" || batchResponseItems[0].Ciphertext == "" {
+		t.Fatalf("bad: expected the item without a nonce to succeed: %#v", batchResponseItems[0])
+	}
+	if batchResponseItems[1].Error == "" || batchResponseItems[1].Ciphertext != "" {
+		t.Fatalf("bad: expected the item with a nonce to fail: %#v", batchResponseItems[1])
+	}
+
+	// Convergent keys still accept a nonce
+	resp, err = doReq("encrypt/convergent", map[string]interface{}{
+		"plaintext": plaintext,
+		"context":   keyContext,
+		"nonce":     nonce,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+}
+
+// Case17: Batches larger than the mount's limit are rejected
+func TestTransit_BatchEncryptionCase17(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "config/keys",
+		Data: map[string]interface{}{
+			"max_batch_items": 2,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	item := map[string]interface{}{"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA=="}
+	batchReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "encrypt/upserted_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"batch_input": []interface{}{item, item},
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), batchReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	batchReq.Data["batch_input"] = []interface{}{item, item, item}
+	resp, err = b.HandleRequest(context.Background(), batchReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	// Items that cannot be decoded are rejected
+	batchReq.Data = map[string]interface{}{
+		"batch_input": []interface{}{item, "not an item"},
+	}
+	resp, err = b.HandleRequest(context.Background(), batchReq)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "decrypt/upserted_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"batch_input": []interface{}{
+				map[string]interface{}{"ciphertext": "vault:v1:aaaa"},
+				map[string]interface{}{"ciphertext": "vault:v1:aaaa"},
+				map[string]interface{}{"ciphertext": "vault:v1:aaaa"},
+			},
+		},
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+}
+
+// Test that associated data is authenticated on decryption, both for single
+// requests and for batch items
+func TestTransit_AssociatedData(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	aad := base64.StdEncoding.EncodeToString([]byte("row-1"))
+	otherAAD := base64.StdEncoding.EncodeToString([]byte("row-2"))
+
+	resp, err := doReq("keys/aad", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = doReq("encrypt/aad", map[string]interface{}{
+		"plaintext":       plaintext,
+		"associated_data": aad,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	resp, err = doReq("decrypt/aad", map[string]interface{}{
+		"ciphertext":      ciphertext,
+		"associated_data": aad,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["plaintext"].(string) != plaintext {
+		t.Fatalf("bad: plaintext mismatch: %#v", resp.Data)
+	}
+
+	// Missing, mismatched and malformed associated data must be rejected
+	for _, badAAD := range []string{"", otherAAD, "not base64!"} {
+		resp, err = doReq("decrypt/aad", map[string]interface{}{
+			"ciphertext":      ciphertext,
+			"associated_data": badAAD,
+		})
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("associated data %q: expected invalid request error; err:%v resp:%#v", badAAD, err, resp)
+		}
+	}
+
+	// Rewrapping preserves the binding to the associated data
+	resp, err = doReq("rewrap/aad", map[string]interface{}{
+		"ciphertext":      ciphertext,
+		"associated_data": aad,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("decrypt/aad", map[string]interface{}{
+		"ciphertext": resp.Data["ciphertext"],
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	// Batch items carry their own associated data
+	resp, err = doReq("encrypt/aad", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"plaintext": plaintext, "associated_data": aad},
+			map[string]interface{}{"plaintext": plaintext, "associated_data": otherAAD},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	encItems := resp.Data["batch_results"].([]BatchResponseItem)
+
+	resp, err = doReq("decrypt/aad", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"ciphertext": encItems[0].Ciphertext, "associated_data": aad},
+			map[string]interface{}{"ciphertext": encItems[1].Ciphertext, "associated_data": aad},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	decItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if decItems[0].Error != "" || decItems[0].Plaintext != plaintext {
+		t.Fatalf("bad: expected the first item to decrypt: %#v", decItems[0])
+	}
+	if decItems[1].Error == "" || decItems[1].Plaintext != "" {
+		t.Fatalf("bad: expected the second item to fail: %#v", decItems[1])
+	}
+	if resp.Data["batch_failures"].(int) != 1 {
+		t.Fatalf("bad: batch_failures: %#v", resp.Data["batch_failures"])
+	}
+
+	// With convergent encryption, the associated data is part of the nonce
+	// derivation so the same plaintext under different associated data does
+	// not produce the same ciphertext
+	resp, err = doReq("keys/convergent", map[string]interface{}{
+		"derived":               true,
+		"convergent_encryption": true,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	keyContext := "dGVzdGNvbnRleHQ="
+	var convergentCiphertexts []string
+	for _, itemAAD := range []string{aad, otherAAD} {
+		resp, err = doReq("encrypt/convergent", map[string]interface{}{
+			"plaintext":       plaintext,
+			"context":         keyContext,
+			"associated_data": itemAAD,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		convergentCiphertexts = append(convergentCiphertexts, resp.Data["ciphertext"].(string))
+	}
+	if convergentCiphertexts[0] == convergentCiphertexts[1] {
+		t.Fatal("bad: expected different ciphertexts for different associated data")
+	}
+
+	// RSA keys do not support associated data
+	resp, err = doReq("keys/rsa", map[string]interface{}{"type": "rsa-2048"})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("encrypt/rsa", map[string]interface{}{
+		"plaintext":       plaintext,
+		"associated_data": aad,
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+}
+
+// Test that plaintexts can be provided and returned in alternate encodings
+func TestTransit_Encoding(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+
+	resp, err := doReq("keys/encoding", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Chosen so that the standard and URL-safe base64 encodings differ
+	raw := []byte{0xfb, 0xff, 0xbf, 0x01}
+	encodings := map[string]string{
+		"base64":    "+/+/AQ==",
+		"base64url": "-_-_AQ",
+		"hex":       "fbffbf01",
+	}
+
+	for encoding, value := range encodings {
+		resp, err = doReq("encrypt/encoding", map[string]interface{}{
+			"plaintext": value,
+			"encoding":  encoding,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", encoding, err, resp)
+		}
+		ciphertext := resp.Data["ciphertext"].(string)
+
+		// The default encoding of the result is standard base64
+		resp, err = doReq("decrypt/encoding", map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", encoding, err, resp)
+		}
+		if resp.Data["plaintext"].(string) != base64.StdEncoding.EncodeToString(raw) {
+			t.Fatalf("%s: bad: plaintext: %#v", encoding, resp.Data)
+		}
+
+		resp, err = doReq("decrypt/encoding", map[string]interface{}{
+			"ciphertext": ciphertext,
+			"encoding":   encoding,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", encoding, err, resp)
+		}
+		if resp.Data["plaintext"].(string) != value {
+			t.Fatalf("%s: bad: plaintext: %#v", encoding, resp.Data)
+		}
+	}
+
+	// Padded base64url input is accepted as well
+	resp, err = doReq("encrypt/encoding", map[string]interface{}{
+		"plaintext": "-_-_AQ==",
+		"encoding":  "base64url",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Errors name the encoding that was attempted
+	resp, err = doReq("encrypt/encoding", map[string]interface{}{
+		"plaintext": "-_-_AQ",
+		"encoding":  "hex",
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+	if !strings.Contains(resp.Data["error"].(string), "hex") {
+		t.Fatalf("bad: expected the error to name the encoding: %#v", resp.Data)
+	}
+
+	resp, err = doReq("encrypt/encoding", map[string]interface{}{
+		"plaintext": "+/+/AQ==",
+		"encoding":  "base32",
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("decrypt/encoding", map[string]interface{}{
+		"ciphertext": "vault:v1:abcd",
+		"encoding":   "base32",
+	})
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+	}
+
+	// Batch items may override the request-level encoding
+	resp, err = doReq("encrypt/encoding", map[string]interface{}{
+		"encoding": "hex",
+		"batch_input": []interface{}{
+			map[string]interface{}{"plaintext": "fbffbf01"},
+			map[string]interface{}{"plaintext": "-_-_AQ", "encoding": "base64url"},
+			map[string]interface{}{"plaintext": "-_-_AQ"},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	encItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if encItems[0].Error != "" || encItems[1].Error != "" {
+		t.Fatalf("bad: expected the first two items to succeed: %#v", encItems)
+	}
+	if !strings.Contains(encItems[2].Error, "hex") {
+		t.Fatalf("bad: expected the third item to fail decoding as hex: %#v", encItems[2])
+	}
+
+	resp, err = doReq("decrypt/encoding", map[string]interface{}{
+		"encoding": "hex",
+		"batch_input": []interface{}{
+			map[string]interface{}{"ciphertext": encItems[0].Ciphertext},
+			map[string]interface{}{"ciphertext": encItems[1].Ciphertext, "encoding": "base64url"},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	decItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if decItems[0].Plaintext != "fbffbf01" || decItems[1].Plaintext != "-_-_AQ" {
+		t.Fatalf("bad: plaintexts: %#v", decItems)
+	}
+}
+
+// BenchmarkTransit_BatchInputDecoding compares decoding the whole batch_input
+// list up front, as was done before items were decoded as they are processed,
+// with decoding one item at a time
+func BenchmarkTransit_BatchInputDecoding(b *testing.B) {
+	// The list as decoded from the JSON request body by the HTTP layer
+	batchInput := make([]interface{}, defaultMaxBatchItems)
+	for i := range batchInput {
+		batchInput[i] = map[string]interface{}{
+			"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			"context":   "dGVzdGNvbnRleHQ=",
+		}
+	}
+
+	b.Run("upfront", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var batchInputItems []BatchRequestItem
+			if err := mapstructure.Decode(batchInput, &batchInputItems); err != nil {
+				b.Fatal(err)
+			}
+			for j := range batchInputItems {
+				_ = batchInputItems[j]
+			}
+		}
+	})
+
+	b.Run("iterator", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			nextItem, err := batchInputIterator(batchInput, defaultMaxBatchItems)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for {
+				item, err := nextItem()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if item == nil {
+					break
+				}
+			}
+		}
+	})
+}
@@ -3,6 +3,7 @@ package transit
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"reflect"
 	"strconv"
 	"testing"
@@ -11,10 +12,12 @@ import (
 )
 
 func TestTransit_Export_KeyVersion_ExportsCorrectVersion(t *testing.T) {
+	verifyExportsCorrectVersion(t, "encryption-key", "aes128-gcm96")
 	verifyExportsCorrectVersion(t, "encryption-key", "aes256-gcm96")
 	verifyExportsCorrectVersion(t, "encryption-key", "chacha20-poly1305")
 	verifyExportsCorrectVersion(t, "signing-key", "ecdsa-p256")
 	verifyExportsCorrectVersion(t, "signing-key", "ed25519")
+	verifyExportsCorrectVersion(t, "hmac-key", "aes128-gcm96")
 	verifyExportsCorrectVersion(t, "hmac-key", "aes256-gcm96")
 	verifyExportsCorrectVersion(t, "hmac-key", "chacha20-poly1305")
 	verifyExportsCorrectVersion(t, "hmac-key", "ecdsa-p256")
@@ -239,6 +242,11 @@ func TestTransit_Export_KeysNotMarkedExportable_ReturnsError(t *testing.T) {
 	if !rsp.IsError() {
 		t.Fatal("Key not marked as exportable but was exported.")
 	}
+
+	// This must be distinguishable from a key that does not exist
+	if code, _ := logical.RespondErrorCommon(req, rsp, err); code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, code)
+	}
 }
 
 func TestTransit_Export_SigningDoesNotSupportSigning_ReturnsError(t *testing.T) {
@@ -315,6 +323,10 @@ func TestTransit_Export_KeysDoesNotExist_ReturnsNotFound(t *testing.T) {
 	if !(rsp == nil && err == nil) {
 		t.Fatal("Key does not exist but does not return not found")
 	}
+
+	if code, _ := logical.RespondErrorCommon(req, rsp, err); code != http.StatusNotFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotFound, code)
+	}
 }
 
 func TestTransit_Export_EncryptionKey_DoesNotExportHMACKey(t *testing.T) {
@@ -73,7 +73,7 @@ func (b *backend) pathHashWrite(ctx context.Context, req *logical.Request, d *fr
 	case "hex":
 	case "base64":
 	default:
-		return logical.ErrorResponse(fmt.Sprintf("unsupported encoding format %s; must be \"hex\" or \"base64\"", format)), nil
+		return logical.ErrorResponse(fmt.Sprintf("unsupported encoding format %s; must be \"hex\" or \"base64\"", format)), logical.ErrInvalidRequest
 	}
 
 	var hf hash.Hash
@@ -87,7 +87,7 @@ func (b *backend) pathHashWrite(ctx context.Context, req *logical.Request, d *fr
 	case "sha2-512":
 		hf = sha512.New()
 	default:
-		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), logical.ErrInvalidRequest
 	}
 	hf.Write(input)
 	retBytes := hf.Sum(nil)
@@ -31,6 +31,9 @@ func TestTransit_Hash(t *testing.T) {
 			if !resp.IsError() {
 				t.Fatalf("bad: got error response: %#v", *resp)
 			}
+			if err != logical.ErrInvalidRequest {
+				t.Fatalf("expected invalid request error, got %v", err)
+			}
 			return
 		}
 		if resp.IsError() {
@@ -8,14 +8,33 @@ import (
 	"encoding/base64"
 	"fmt"
 	"hash"
+	"reflect"
 	"strconv"
 	"strings"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
 )
 
+// batchRequestHMACItem represents a request item for batch HMAC verification,
+// containing the base64 encoded 'input' and the 'hmac' to verify
+type batchRequestHMACItem map[string]string
+
+// batchResponseHMACItem represents a response item for batch HMAC
+// verification
+type batchResponseHMACItem struct {
+	// Valid indicates whether the HMAC of the corresponding request item
+	// matched
+	Valid bool `json:"valid" structs:"valid" mapstructure:"valid"`
+
+	// Error, if set represents a failure encountered while verifying the
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
 func (b *backend) pathHMAC() *framework.Path {
 	return &framework.Path{
 		Pattern: "hmac/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("urlalgorithm"),
@@ -128,7 +147,7 @@ func (b *backend) pathHMACWrite(ctx context.Context, req *logical.Request, d *fr
 		hf = hmac.New(sha512.New, key)
 	default:
 		p.Unlock()
-		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), logical.ErrInvalidRequest
 	}
 	hf.Write(input)
 	retBytes := hf.Sum(nil)
@@ -149,70 +168,161 @@ func (b *backend) pathHMACWrite(ctx context.Context, req *logical.Request, d *fr
 
 func (b *backend) pathHMACVerify(ctx context.Context, req *logical.Request, d *framework.FieldData, verificationHMAC string) (*logical.Response, error) {
 	name := d.Get("name").(string)
-	inputB64 := d.Get("input").(string)
 	algorithm := d.Get("urlalgorithm").(string)
 	if algorithm == "" {
 		algorithm = d.Get("algorithm").(string)
 	}
 
+	switch algorithm {
+	case "sha2-224", "sha2-256", "sha2-384", "sha2-512":
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), logical.ErrInvalidRequest
+	}
+
+	// Batch items are decoded one at a time as they are verified, so that
+	// only the responses are accumulated
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInput reflect.Value
+	if batchInputRaw != nil {
+		config, err := b.readKeysConfig(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkBatchSize(batchInputRaw, config.maxBatchItems()); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		batchInput = reflect.ValueOf(batchInputRaw)
+		if batchInput.Kind() != reflect.Slice {
+			return logical.ErrorResponse("failed to parse batch input: expected a list of items"), logical.ErrInvalidRequest
+		}
+		if batchInput.Len() == 0 {
+			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+	} else {
+		batchInput = reflect.ValueOf([]batchRequestHMACItem{
+			{
+				"input": d.Get("input").(string),
+				"hmac":  verificationHMAC,
+			},
+		})
+	}
+
+	// Get the policy
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+
+	// Verify each item, marking the error in the response collection and
+	// continuing if the verification of a particular item fails
+	batchResponseItems := make([]batchResponseHMACItem, batchInput.Len())
+	for i := range batchResponseItems {
+		var item batchRequestHMACItem
+		if err := mapstructure.Decode(batchInput.Index(i).Interface(), &item); err != nil {
+			p.Unlock()
+			return logical.ErrorResponse(fmt.Sprintf("failed to parse batch input: %v", err)), logical.ErrInvalidRequest
+		}
+
+		valid, err := verifyHMAC(p, algorithm, item["input"], item["hmac"])
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				batchResponseItems[i].Error = err.Error()
+				continue
+			default:
+				p.Unlock()
+				return nil, err
+			}
+		}
+		batchResponseItems[i].Valid = valid
+	}
+
+	var verified int
+	for _, item := range batchResponseItems {
+		if item.Error == "" {
+			verified++
+		}
+	}
+	b.recordUsage(p.Name, usageVerify, verified)
+
+	p.Unlock()
+
+	if batchInputRaw != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": batchResponseItems,
+			},
+		}, nil
+	}
+
+	if batchResponseItems[0].Error != "" {
+		return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": batchResponseItems[0].Valid,
+		},
+	}, nil
+}
+
+// verifyHMAC checks the given versioned HMAC against the HMAC of the base64
+// encoded input, computed using the matching version of the policy's key.
+// The caller must hold the policy lock.
+func verifyHMAC(p *keysutil.Policy, algorithm, inputB64, verificationHMAC string) (bool, error) {
 	input, err := base64.StdEncoding.DecodeString(inputB64)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: fmt.Sprintf("unable to decode input as base64: %s", err)}
+	}
+
+	if verificationHMAC == "" {
+		return false, errutil.UserError{Err: "missing HMAC to verify"}
 	}
 
 	// Verify the prefix
 	if !strings.HasPrefix(verificationHMAC, "vault:v") {
-		return logical.ErrorResponse("invalid HMAC to verify: no prefix"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC to verify: no prefix"}
 	}
 
 	splitVerificationHMAC := strings.SplitN(strings.TrimPrefix(verificationHMAC, "vault:v"), ":", 2)
 	if len(splitVerificationHMAC) != 2 {
-		return logical.ErrorResponse("invalid HMAC: wrong number of fields"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC: wrong number of fields"}
 	}
 
 	ver, err := strconv.Atoi(splitVerificationHMAC[0])
 	if err != nil {
-		return logical.ErrorResponse("invalid HMAC: version number could not be decoded"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC: version number could not be decoded"}
 	}
 
 	verBytes, err := base64.StdEncoding.DecodeString(splitVerificationHMAC[1])
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode verification HMAC as base64: %s", err)), logical.ErrInvalidRequest
-	}
-
-	// Get the policy
-	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
-		Storage: req.Storage,
-		Name:    name,
-	})
-	if err != nil {
-		return nil, err
-	}
-	if p == nil {
-		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
-	}
-	if !b.System().CachingDisabled() {
-		p.Lock(false)
+		return false, errutil.UserError{Err: fmt.Sprintf("unable to decode verification HMAC as base64: %s", err)}
 	}
 
 	if ver > p.LatestVersion {
-		p.Unlock()
-		return logical.ErrorResponse("invalid HMAC: version is too new"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC: version is too new"}
 	}
 
 	if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
-		p.Unlock()
-		return logical.ErrorResponse("cannot verify HMAC: version is too old (disallowed by policy)"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "cannot verify HMAC: version is too old (disallowed by policy)"}
 	}
 
 	key, err := p.HMACKey(ver)
 	if err != nil {
-		p.Unlock()
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: err.Error()}
 	}
 	if key == nil {
-		p.Unlock()
-		return nil, fmt.Errorf("HMAC key value could not be computed")
+		return false, fmt.Errorf("HMAC key value could not be computed")
 	}
 
 	var hf hash.Hash
@@ -226,18 +336,12 @@ func (b *backend) pathHMACVerify(ctx context.Context, req *logical.Request, d *f
 	case "sha2-512":
 		hf = hmac.New(sha512.New, key)
 	default:
-		p.Unlock()
-		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
+		return false, errutil.UserError{Err: fmt.Sprintf("unsupported algorithm %s", algorithm)}
 	}
 	hf.Write(input)
 	retBytes := hf.Sum(nil)
 
-	p.Unlock()
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"valid": hmac.Equal(retBytes, verBytes),
-		},
-	}, nil
+	return hmac.Equal(retBytes, verBytes), nil
 }
 
 const pathHMACHelpSyn = `Generate an HMAC for input data using the named key`
@@ -137,6 +137,15 @@ func TestTransit_HMAC(t *testing.T) {
 
 	doRequest(req, false, "vault:v2:Dt+mO/B93kuWUbGMMobwUNX5Wodr6dL3JH4DMfpQ0kw=")
 
+	// Generate an HMAC with a specific key version
+	req.Data["key_version"] = 1
+	doRequest(req, false, "vault:v1:UcBvm5VskkukzZHlPgm3p5P/Yr/PV6xpuOGZISya3A4=")
+
+	// A version that does not exist yet should fail
+	req.Data["key_version"] = 3
+	doRequest(req, true, "")
+	delete(req.Data, "key_version")
+
 	// Verify a previous version
 	req.Path = "verify/foo"
 
@@ -180,3 +189,59 @@ func TestTransit_HMAC(t *testing.T) {
 		t.Fatalf("expected invalid request error, got %v", err)
 	}
 }
+
+func TestTransit_BatchHMACVerification(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo",
+	}
+	_, err := b.HandleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "hmac/foo"
+	req.Data = map[string]interface{}{
+		"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+	}
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	hmac := resp.Data["hmac"].(string)
+
+	req.Path = "verify/foo"
+	req.Data = map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA==", "hmac": hmac},
+			map[string]interface{}{"input": "Cg==", "hmac": hmac},
+			map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA==", "hmac": "vault:v3:" + strings.TrimPrefix(hmac, "vault:v1:")},
+			map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA=="},
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	batchResponseItems := resp.Data["batch_results"].([]batchResponseHMACItem)
+	if len(batchResponseItems) != 4 {
+		t.Fatalf("bad: expected 4 response items, got %d", len(batchResponseItems))
+	}
+
+	if !batchResponseItems[0].Valid || batchResponseItems[0].Error != "" {
+		t.Fatalf("bad: expected a valid HMAC: %#v", batchResponseItems[0])
+	}
+	if batchResponseItems[1].Valid || batchResponseItems[1].Error != "" {
+		t.Fatalf("bad: expected an invalid HMAC: %#v", batchResponseItems[1])
+	}
+	if batchResponseItems[2].Valid || batchResponseItems[2].Error == "" {
+		t.Fatalf("bad: expected an error for a too new version: %#v", batchResponseItems[2])
+	}
+	if batchResponseItems[3].Valid || batchResponseItems[3].Error == "" {
+		t.Fatalf("bad: expected an error for a missing HMAC: %#v", batchResponseItems[3])
+	}
+}
@@ -0,0 +1,294 @@
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// ephemeralKeySize is the size of the AES key used to wrap imported key
+// material with KWP
+const ephemeralKeySize = 32
+
+func (b *backend) pathImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+The base64 encoded wrapped key material. This is the RSA-OAEP encryption of an
+ephemeral 256-bit AES key under the mount's wrapping key, followed by the key
+material wrapped with the ephemeral key using AES-KWP (RFC 5649).`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `
+The hash function used for RSA-OAEP when encrypting the ephemeral key. Valid
+values are "SHA1", "SHA256", "SHA384" and "SHA512". Defaults to "SHA256".`,
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "aes256-gcm96",
+				Description: `
+The type of key being imported. Currently, "aes128-gcm96", "aes256-gcm96" and
+"chacha20-poly1305" are supported. Defaults to "aes256-gcm96".`,
+			},
+
+			"derived": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables key derivation mode. This
+allows for per-transaction unique
+keys for encryption operations.`,
+			},
+
+			"convergent_encryption": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether to support convergent encryption.
+This requires key derivation to be enabled.`,
+			},
+
+			"exportable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables keys to be exportable.
+This allows for all the valid keys
+in the key ring to be exported.`,
+			},
+
+			"allow_plaintext_backup": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables taking a backup of the named
+key in plaintext format. Once set,
+this cannot be disabled.`,
+			},
+
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The period after which the key is rotated
+automatically. Defaults to 0, which disables automatic rotation.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathImportVersion() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import_version",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+The base64 encoded wrapped key material, in the same format accepted by the
+import path.`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `
+The hash function used for RSA-OAEP when encrypting the ephemeral key. Valid
+values are "SHA1", "SHA256", "SHA384" and "SHA512". Defaults to "SHA256".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportVersionWrite,
+		},
+
+		HelpSynopsis:    pathImportVersionHelpSyn,
+		HelpDescription: pathImportVersionHelpDesc,
+	}
+}
+
+// unwrapImportedKey decrypts key material wrapped for the mount's wrapping
+// key. Failures caused by the request are returned as user errors.
+func (b *backend) unwrapImportedKey(ctx context.Context, s logical.Storage, ciphertext, hashFunction string) ([]byte, error) {
+	if ciphertext == "" {
+		return nil, errutil.UserError{Err: "missing ciphertext to import"}
+	}
+
+	var hashFn hash.Hash
+	switch strings.ToUpper(hashFunction) {
+	case "SHA1":
+		hashFn = sha1.New()
+	case "SHA256":
+		hashFn = sha256.New()
+	case "SHA384":
+		hashFn = sha512.New384()
+	case "SHA512":
+		hashFn = sha512.New()
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported hash function %q", hashFunction)}
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to base64-decode ciphertext"}
+	}
+
+	wrappingKey, err := b.getWrappingKey(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ciphertext starts with the RSA-OAEP encrypted ephemeral key, which
+	// is exactly as long as the wrapping key's modulus
+	rsaLen := wrappingKey.Size()
+	if len(wrapped) <= rsaLen {
+		return nil, errutil.UserError{Err: "ciphertext is too short to contain a wrapped key"}
+	}
+
+	ephemeralKey, err := rsa.DecryptOAEP(hashFn, rand.Reader, wrappingKey, wrapped[:rsaLen], nil)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to decrypt the ephemeral key"}
+	}
+	if len(ephemeralKey) != ephemeralKeySize {
+		return nil, errutil.UserError{Err: fmt.Sprintf("ephemeral key must be %d bytes long", ephemeralKeySize)}
+	}
+
+	key, err := keysutil.KWPUnwrap(ephemeralKey, wrapped[rsaLen:])
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("failed to unwrap the key: %v", err)}
+	}
+
+	return key, nil
+}
+
+func (b *backend) pathImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	derived := d.Get("derived").(bool)
+	convergent := d.Get("convergent_encryption").(bool)
+	keyType := d.Get("type").(string)
+	autoRotatePeriod := time.Duration(d.Get("auto_rotate_period").(int)) * time.Second
+
+	if err := validateAutoRotatePeriod(autoRotatePeriod); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	polReq := keysutil.PolicyRequest{
+		Storage:              req.Storage,
+		Name:                 name,
+		Derived:              derived,
+		Convergent:           convergent,
+		Exportable:           d.Get("exportable").(bool),
+		AllowPlaintextBackup: d.Get("allow_plaintext_backup").(bool),
+		AutoRotatePeriod:     autoRotatePeriod,
+	}
+	switch keyType {
+	case "aes128-gcm96":
+		polReq.KeyType = keysutil.KeyType_AES128_GCM96
+	case "aes256-gcm96":
+		polReq.KeyType = keysutil.KeyType_AES256_GCM96
+	case "chacha20-poly1305":
+		polReq.KeyType = keysutil.KeyType_ChaCha20_Poly1305
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("key type %v not supported for import", keyType)), logical.ErrInvalidRequest
+	}
+
+	key, err := b.unwrapImportedKey(ctx, req.Storage, d.Get("ciphertext").(string), d.Get("hash_function").(string))
+	if err == nil {
+		err = b.lm.ImportPolicy(ctx, polReq, key)
+	}
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathImportVersionWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	key, err := b.unwrapImportedKey(ctx, req.Storage, d.Get("ciphertext").(string), d.Get("hash_function").(string))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if err := p.ImportKey(ctx, req.Storage, key); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+const pathImportHelpSyn = `Imports an externally generated key into a new transit key`
+
+const pathImportHelpDesc = `
+This path is used to import an externally generated key as version 1 of a new
+transit key. The key material must be wrapped for the public key returned by
+the 'wrapping_key' path: an ephemeral 256-bit AES key is encrypted with
+RSA-OAEP, and the key material is wrapped with the ephemeral key using AES-KWP
+(RFC 5649). The two results are concatenated and base64 encoded. Once imported,
+the key behaves exactly like a key generated by Vault.
+`
+
+const pathImportVersionHelpSyn = `Imports an externally generated key as a new version of an existing key`
+
+const pathImportVersionHelpDesc = `
+This path is used to import an externally generated key as the newest version
+of an existing transit key. The key material must be wrapped in the same way as
+for the 'import' path.
+`
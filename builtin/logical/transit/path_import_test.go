@@ -0,0 +1,203 @@
+package transit
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// wrapKeyForImport wraps the given key material for the given wrapping key
+// the way an external client would
+func wrapKeyForImport(t *testing.T, wrappingKey *rsa.PublicKey, key []byte) string {
+	t.Helper()
+
+	ephemeralKey := make([]byte, 32)
+	if _, err := rand.Read(ephemeralKey); err != nil {
+		t.Fatal(err)
+	}
+
+	wrappedEphemeralKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, wrappingKey, ephemeralKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrappedKey, err := keysutil.KWPWrap(ephemeralKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(append(wrappedEphemeralKey, wrappedKey...))
+}
+
+func TestTransit_Import(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   s,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := doReq(logical.ReadOperation, "wrapping_key", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	publicKeyPEM := resp.Data["public_key"].(string)
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		t.Fatalf("failed to decode wrapping key: %q", publicKeyPEM)
+	}
+	publicKeyRaw, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappingKey := publicKeyRaw.(*rsa.PublicKey)
+
+	// The wrapping key is stable for the mount
+	resp, err = doReq(logical.ReadOperation, "wrapping_key", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["public_key"].(string) != publicKeyPEM {
+		t.Fatal("expected the same wrapping key on every read")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = doReq(logical.UpdateOperation, "keys/imported/import", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key),
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Ciphertexts from the imported key can be decrypted with the original
+	// key material
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	resp, err = doReq(logical.UpdateOperation, "encrypt/imported", map[string]interface{}{
+		"plaintext": plaintext,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("bad: ciphertext: %q", ciphertext)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "vault:v1:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(aesCipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainBytes, err := gcm.Open(nil, decoded[:gcm.NonceSize()], decoded[gcm.NonceSize():], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base64.StdEncoding.EncodeToString(plainBytes) != plaintext {
+		t.Fatalf("bad: plaintext: %q", plainBytes)
+	}
+
+	// Imported keys can be rotated and have further versions imported
+	resp, err = doReq(logical.UpdateOperation, "keys/imported/rotate", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq(logical.UpdateOperation, "keys/imported/import_version", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key),
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq(logical.ReadOperation, "keys/imported", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["latest_version"].(int) != 3 {
+		t.Fatalf("bad: latest_version: %#v", resp.Data["latest_version"])
+	}
+
+	// Every version can still decrypt
+	resp, err = doReq(logical.UpdateOperation, "decrypt/imported", map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["plaintext"].(string) != plaintext {
+		t.Fatalf("bad: plaintext: %#v", resp.Data)
+	}
+
+	expectInvalid := func(path string, data map[string]interface{}) {
+		t.Helper()
+		resp, err := doReq(logical.UpdateOperation, path, data)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected invalid request error; err:%v resp:%#v", err, resp)
+		}
+	}
+
+	// Importing over an existing key is not allowed
+	expectInvalid("keys/imported/import", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key),
+	})
+
+	// Versions can only be imported into existing keys
+	expectInvalid("keys/missing/import_version", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key),
+	})
+
+	// The key material must match the key type
+	expectInvalid("keys/short/import", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key[:16]),
+	})
+	expectInvalid("keys/rsa/import", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key),
+		"type":       "rsa-2048",
+	})
+
+	// Malformed or tampered ciphertexts are rejected
+	expectInvalid("keys/bad/import", map[string]interface{}{
+		"ciphertext": "not base64!",
+	})
+	tampered, _ := base64.StdEncoding.DecodeString(wrapKeyForImport(t, wrappingKey, key))
+	tampered[len(tampered)-1] ^= 0x01
+	expectInvalid("keys/bad/import", map[string]interface{}{
+		"ciphertext": base64.StdEncoding.EncodeToString(tampered),
+	})
+	expectInvalid("keys/bad/import", map[string]interface{}{
+		"ciphertext":    wrapKeyForImport(t, wrappingKey, key),
+		"hash_function": "SHA512",
+	})
+
+	// A 128-bit key can be imported as an aes128-gcm96 key
+	resp, err = doReq(logical.UpdateOperation, "keys/short/import", map[string]interface{}{
+		"ciphertext": wrapKeyForImport(t, wrappingKey, key[:16]),
+		"type":       "aes128-gcm96",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/fatih/structs"
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -45,9 +46,10 @@ func (b *backend) pathKeys() *framework.Path {
 				Type:    framework.TypeString,
 				Default: "aes256-gcm96",
 				Description: `
-The type of key to create. Currently, "aes256-gcm96" (symmetric), "ecdsa-p256"
-(asymmetric), 'ed25519' (asymmetric), 'rsa-2048' (asymmetric), 'rsa-4096'
-(asymmetric) are supported.  Defaults to "aes256-gcm96".
+The type of key to create. Currently, "aes128-gcm96" (symmetric),
+"aes256-gcm96" (symmetric), "ecdsa-p256" (asymmetric), 'ed25519' (asymmetric),
+'rsa-2048' (asymmetric), 'rsa-4096' (asymmetric) are supported.  Defaults to
+"aes256-gcm96".
 `,
 			},
 
@@ -88,6 +90,15 @@ key in plaintext format. Once set,
 this cannot be disabled.`,
 			},
 
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Amount of time after which the key
+is rotated automatically. A value of
+0 (the default) disables automatic
+rotation; otherwise it must be at
+least one hour.`,
+			},
+
 			"context": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `Base64 encoded context for key derivation.
@@ -124,11 +135,16 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	keyType := d.Get("type").(string)
 	exportable := d.Get("exportable").(bool)
 	allowPlaintextBackup := d.Get("allow_plaintext_backup").(bool)
+	autoRotatePeriod := time.Duration(d.Get("auto_rotate_period").(int)) * time.Second
 
 	if !derived && convergent {
 		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
 	}
 
+	if err := validateAutoRotatePeriod(autoRotatePeriod); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
 	polReq := keysutil.PolicyRequest{
 		Upsert:               true,
 		Storage:              req.Storage,
@@ -137,8 +153,11 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 		Convergent:           convergent,
 		Exportable:           exportable,
 		AllowPlaintextBackup: allowPlaintextBackup,
+		AutoRotatePeriod:     autoRotatePeriod,
 	}
 	switch keyType {
+	case "aes128-gcm96":
+		polReq.KeyType = keysutil.KeyType_AES128_GCM96
 	case "aes256-gcm96":
 		polReq.KeyType = keysutil.KeyType_AES256_GCM96
 	case "chacha20-poly1305":
@@ -157,17 +176,32 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 
 	p, upserted, err := b.lm.GetPolicy(ctx, polReq)
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
 	}
 	if p == nil {
 		return nil, fmt.Errorf("error generating key: returned policy was nil")
 	}
-	if b.System().CachingDisabled() {
-		p.Unlock()
-	}
+	p.Release()
 
 	resp := &logical.Response{}
 	if !upserted {
+		// Convergence is fixed when the key is created, since toggling it
+		// would change how nonces are derived for existing ciphertexts
+		if convergentRaw, ok := d.GetOk("convergent_encryption"); ok && convergentRaw.(bool) != p.ConvergentEncryption {
+			return logical.ErrorResponse("convergent encryption cannot be changed after key creation"), logical.ErrInvalidRequest
+		}
+
+		// Likewise the key type determines how every existing version is
+		// used, so it cannot be switched out from under stored ciphertexts
+		if _, ok := d.GetOk("type"); ok && polReq.KeyType != p.Type {
+			return logical.ErrorResponse(fmt.Sprintf("key type cannot be changed after key creation; key %s is of type %s", name, p.Type)), logical.ErrInvalidRequest
+		}
+
 		resp.AddWarning(fmt.Sprintf("key %s already existed", name))
 	}
 
@@ -212,10 +246,13 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 			"latest_version":         p.LatestVersion,
 			"exportable":             p.Exportable,
 			"allow_plaintext_backup": p.AllowPlaintextBackup,
+			"auto_rotate_period":     int64(p.AutoRotatePeriod.Seconds()),
+			"last_rotation_time":     p.LastRotationTime(),
 			"supports_encryption":    p.Type.EncryptionSupported(),
 			"supports_decryption":    p.Type.DecryptionSupported(),
 			"supports_signing":       p.Type.SigningSupported(),
 			"supports_derivation":    p.Type.DerivationSupported(),
+			"convergent_encryption":  p.ConvergentEncryption,
 		},
 	}
 
@@ -240,7 +277,6 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 		case keysutil.Kdf_hkdf_sha256:
 			resp.Data["kdf"] = "hkdf_sha256"
 		}
-		resp.Data["convergent_encryption"] = p.ConvergentEncryption
 		if p.ConvergentEncryption {
 			resp.Data["convergent_encryption_version"] = p.ConvergentVersion
 		}
@@ -256,10 +292,15 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 	}
 
 	switch p.Type {
-	case keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+		// Versions without a recorded creation time are reported as 0
 		retKeys := map[string]int64{}
 		for k, v := range p.Keys {
-			retKeys[k] = v.DeprecatedCreationTime
+			var creationTime int64
+			if t := v.GetCreationTime(); !t.IsZero() {
+				creationTime = t.Unix()
+			}
+			retKeys[k] = creationTime
 		}
 		resp.Data["keys"] = retKeys
 
@@ -268,10 +309,7 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 		for k, v := range p.Keys {
 			key := asymKey{
 				PublicKey:    v.FormattedPublicKey,
-				CreationTime: v.CreationTime,
-			}
-			if key.CreationTime.IsZero() {
-				key.CreationTime = time.Unix(v.DeprecatedCreationTime, 0)
+				CreationTime: v.GetCreationTime(),
 			}
 
 			switch p.Type {
@@ -332,7 +370,16 @@ func (b *backend) pathPolicyDelete(ctx context.Context, req *logical.Request, d
 	// Delete does its own locking
 	err := b.lm.DeletePolicy(ctx, req.Storage, name)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("error deleting policy %s: %s", name, err)), err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("error deleting policy %s: %s", name, err)), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	if err := b.deleteUsage(ctx, req.Storage, name); err != nil {
+		return nil, err
 	}
 
 	return nil, nil
@@ -75,3 +75,58 @@ func TestTransit_Issue_2958(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestTransit_ListKeys(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"transit": transit.Factory,
+		},
+	}
+
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	cores := cluster.Cores
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	client := cores[0].Client
+
+	err := client.Sys().Mount("transit", &api.MountInput{
+		Type: "transit",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty mount returns nothing rather than an error
+	secret, err := client.Logical().List("transit/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != nil {
+		t.Fatalf("expected no keys, got %#v", secret)
+	}
+
+	for _, name := range []string{"foo", "bar"} {
+		_, err = client.Logical().Write("transit/keys/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secret, err = client.Logical().List("transit/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil {
+		t.Fatal("expected a list of keys")
+	}
+	keys := secret.Data["keys"].([]interface{})
+	if len(keys) != 2 || keys[0].(string) != "bar" || keys[1].(string) != "foo" {
+		t.Fatalf("bad: keys: %#v", keys)
+	}
+}
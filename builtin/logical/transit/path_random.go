@@ -12,6 +12,10 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// maxRandomBytes is the upper bound on the number of random bytes that can be
+// requested in a single call
+const maxRandomBytes = 128 * 1024
+
 func (b *backend) pathRandom() *framework.Path {
 	return &framework.Path{
 		Pattern: "random" + framework.OptionalParamRegex("urlbytes"),
@@ -61,6 +65,10 @@ func (b *backend) pathRandomWrite(ctx context.Context, req *logical.Request, d *
 		return logical.ErrorResponse(`"bytes" cannot be less than 1`), nil
 	}
 
+	if bytes > maxRandomBytes {
+		return logical.ErrorResponse(fmt.Sprintf(`"bytes" cannot be greater than %d`, maxRandomBytes)), nil
+	}
+
 	switch format {
 	case "hex":
 	case "base64":
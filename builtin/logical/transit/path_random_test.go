@@ -96,4 +96,10 @@ func TestTransit_Random(t *testing.T) {
 	req.Data["format"] = "hex"
 	req.Data["bytes"] = -1
 	doRequest(req, true, "", 0)
+
+	req.Data["bytes"] = maxRandomBytes + 1
+	doRequest(req, true, "", 0)
+
+	req.Data["bytes"] = maxRandomBytes
+	doRequest(req, false, "hex", maxRandomBytes)
 }
@@ -3,6 +3,7 @@ package transit
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/vault/helper/testhelpers"
@@ -168,19 +169,16 @@ func TestTransit_Restore(t *testing.T) {
 			}
 
 			resp, err = b.HandleRequest(context.Background(), restoreReq)
-			if resp != nil && resp.IsError() {
-				t.Fatalf("resp: %#v\nerr: %v", resp, err)
-			}
-			if err == nil && tc.ExpectedErr != nil {
-				t.Fatalf("expected an error, but got none")
-			}
-			if err != nil && tc.ExpectedErr == nil {
-				t.Fatalf("unexpected error:%s", err)
-			}
-
-			if err != nil && tc.ExpectedErr != nil {
-				if err.Error() != tc.ExpectedErr.Error() {
-					t.Fatalf("expected error: (%s), got: (%s)", tc.ExpectedErr.Error(), err.Error())
+			if tc.ExpectedErr == nil {
+				if err != nil || (resp != nil && resp.IsError()) {
+					t.Fatalf("resp: %#v\nerr: %v", resp, err)
+				}
+			} else {
+				if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+					t.Fatalf("expected an invalid request error; resp: %#v\nerr: %v", resp, err)
+				}
+				if resp.Data["error"] != tc.ExpectedErr.Error() {
+					t.Fatalf("expected error: (%s), got: (%s)", tc.ExpectedErr.Error(), resp.Data["error"])
 				}
 			}
 
@@ -193,3 +191,98 @@ func TestTransit_Restore(t *testing.T) {
 		})
 	}
 }
+
+func TestTransit_RestoreRenamed(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		req.Storage = s
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("resp: %#v\nerr: %v", resp, err)
+		}
+		return resp
+	}
+
+	doReq(&logical.Request{
+		Path:      "keys/prod",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"exportable":             true,
+			"allow_plaintext_backup": true,
+		},
+	})
+
+	// Encrypt with two versions of the key so that the restored key must keep
+	// the version numbering of the original
+	encryptReq := &logical.Request{
+		Path:      "encrypt/prod",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		},
+	}
+	ciphertexts := []string{doReq(encryptReq).Data["ciphertext"].(string)}
+	doReq(&logical.Request{
+		Path:      "keys/prod/rotate",
+		Operation: logical.UpdateOperation,
+	})
+	ciphertexts = append(ciphertexts, doReq(encryptReq).Data["ciphertext"].(string))
+
+	backup := doReq(&logical.Request{
+		Path:      "backup/prod",
+		Operation: logical.ReadOperation,
+	}).Data["backup"].(string)
+
+	restoreReq := &logical.Request{
+		Path:      "restore/staging",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"backup": backup,
+		},
+	}
+	doReq(restoreReq)
+
+	// The original key is untouched and the restored key has its versions
+	resp := doReq(&logical.Request{
+		Path:      "keys/staging",
+		Operation: logical.ReadOperation,
+	})
+	if resp.Data["name"].(string) != "staging" {
+		t.Fatalf("bad: restored key name; got %v", resp.Data["name"])
+	}
+	if resp.Data["latest_version"].(int) != 2 {
+		t.Fatalf("bad: restored key latest version; got %v", resp.Data["latest_version"])
+	}
+	doReq(&logical.Request{
+		Path:      "keys/prod",
+		Operation: logical.ReadOperation,
+	})
+
+	for _, ciphertext := range ciphertexts {
+		resp = doReq(&logical.Request{
+			Path:      "decrypt/staging",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"ciphertext": ciphertext,
+			},
+		})
+		if resp.Data["plaintext"].(string) != "dGhlIHF1aWNrIGJyb3duIGZveA==" {
+			t.Fatalf("bad: decrypted plaintext for %s; got %v", ciphertext, resp.Data["plaintext"])
+		}
+	}
+
+	encryptReq.Path = "encrypt/staging"
+	if ciphertext := doReq(encryptReq).Data["ciphertext"].(string); !strings.HasPrefix(ciphertext, "vault:v2:") {
+		t.Fatalf("bad: expected the restored key to encrypt with version 2; got %s", ciphertext)
+	}
+
+	// Restoring over the renamed key again requires force
+	resp, err := b.HandleRequest(context.Background(), restoreReq)
+	if err == nil {
+		t.Fatalf("expected an error restoring over an existing key; resp: %#v", resp)
+	}
+	restoreReq.Data["force"] = true
+	doReq(restoreReq)
+}
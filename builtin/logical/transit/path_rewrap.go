@@ -2,15 +2,12 @@ package transit
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 
-	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
-	"github.com/mitchellh/mapstructure"
 )
 
 func (b *backend) pathRewrap() *framework.Path {
@@ -37,6 +34,13 @@ func (b *backend) pathRewrap() *framework.Path {
 				Description: "Nonce for when convergent encryption is used",
 			},
 
+			"associated_data": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+Base64 encoded additional data that was authenticated during encryption. The
+same value is used to authenticate the rewrapped ciphertext.`,
+			},
+
 			"key_version": &framework.FieldSchema{
 				Type: framework.TypeInt,
 				Description: `The version of the key to use for encryption.
@@ -55,17 +59,18 @@ to the min_encryption_version configured on the key.`,
 }
 
 func (b *backend) pathRewrapWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// Items are decoded and rewrapped one at a time through nextItem, so that
+	// only the responses are accumulated
+	var nextItem func() (*BatchRequestItem, error)
 	batchInputRaw := d.Raw["batch_input"]
-	var batchInputItems []BatchRequestItem
-	var err error
 	if batchInputRaw != nil {
-		err = mapstructure.Decode(batchInputRaw, &batchInputItems)
+		config, err := b.readKeysConfig(ctx, req.Storage)
 		if err != nil {
-			return nil, errwrap.Wrapf("failed to parse batch input: {{err}}", err)
+			return nil, err
 		}
-
-		if len(batchInputItems) == 0 {
-			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		nextItem, err = batchInputIterator(batchInputRaw, config.maxBatchItems())
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 		}
 	} else {
 		ciphertext := d.Get("ciphertext").(string)
@@ -73,45 +78,23 @@ func (b *backend) pathRewrapWrite(ctx context.Context, req *logical.Request, d *
 			return logical.ErrorResponse("missing ciphertext to decrypt"), logical.ErrInvalidRequest
 		}
 
-		batchInputItems = make([]BatchRequestItem, 1)
-		batchInputItems[0] = BatchRequestItem{
-			Ciphertext: ciphertext,
-			Context:    d.Get("context").(string),
-			Nonce:      d.Get("nonce").(string),
-			KeyVersion: d.Get("key_version").(int),
-		}
+		nextItem = batchItemIterator([]BatchRequestItem{
+			BatchRequestItem{
+				Ciphertext:     ciphertext,
+				Context:        d.Get("context").(string),
+				Nonce:          d.Get("nonce").(string),
+				AssociatedData: d.Get("associated_data").(string),
+				KeyVersion:     d.Get("key_version").(int),
+			},
+		})
 	}
 
-	batchResponseItems := make([]BatchResponseItem, len(batchInputItems))
-	contextSet := len(batchInputItems[0].Context) != 0
-
-	for i, item := range batchInputItems {
-		if (len(item.Context) == 0 && contextSet) || (len(item.Context) != 0 && !contextSet) {
-			return logical.ErrorResponse("context should be set either in all the request blocks or in none"), logical.ErrInvalidRequest
-		}
-
-		if item.Ciphertext == "" {
-			batchResponseItems[i].Error = "missing ciphertext to decrypt"
-			continue
-		}
-
-		// Decode the context
-		if len(item.Context) != 0 {
-			batchInputItems[i].DecodedContext, err = base64.StdEncoding.DecodeString(item.Context)
-			if err != nil {
-				batchResponseItems[i].Error = err.Error()
-				continue
-			}
-		}
-
-		// Decode the nonce
-		if len(item.Nonce) != 0 {
-			batchInputItems[i].DecodedNonce, err = base64.StdEncoding.DecodeString(item.Nonce)
-			if err != nil {
-				batchResponseItems[i].Error = err.Error()
-				continue
-			}
-		}
+	item, err := nextItem()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if item == nil {
+		return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
 	}
 
 	// Get the policy
@@ -129,50 +112,33 @@ func (b *backend) pathRewrapWrite(ctx context.Context, req *logical.Request, d *
 		p.Lock(false)
 	}
 
-	for i, item := range batchInputItems {
-		if batchResponseItems[i].Error != "" {
-			continue
-		}
-
-		plaintext, err := p.Decrypt(item.DecodedContext, item.DecodedNonce, item.Ciphertext)
-		if err != nil {
-			switch err.(type) {
-			case errutil.UserError:
-				batchResponseItems[i].Error = err.Error()
-				continue
-			default:
-				p.Unlock()
-				return nil, err
-			}
-		}
-
-		ciphertext, err := p.Encrypt(item.KeyVersion, item.DecodedContext, item.DecodedNonce, plaintext)
+	// As with decryption, a missing context on a derived key is reported as
+	// an item-level error by the policy rather than failing the entire batch.
+	var batchResponseItems []BatchResponseItem
+	for i := 0; item != nil; i++ {
+		result, err := rewrapBatchItem(p, item)
 		if err != nil {
-			switch err.(type) {
-			case errutil.UserError:
-				batchResponseItems[i].Error = err.Error()
-				continue
-			case errutil.InternalError:
-				p.Unlock()
-				return nil, err
-			default:
-				p.Unlock()
-				return nil, err
-			}
+			p.Unlock()
+			return nil, err
 		}
-
-		if ciphertext == "" {
+		if result.Error == "" && result.Ciphertext == "" {
 			p.Unlock()
 			return nil, fmt.Errorf("empty ciphertext returned for input item %d", i)
 		}
+		batchResponseItems = append(batchResponseItems, result)
 
-		batchResponseItems[i].Ciphertext = ciphertext
+		item, err = nextItem()
+		if err != nil {
+			p.Unlock()
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
 	}
 
 	resp := &logical.Response{}
 	if batchInputRaw != nil {
 		resp.Data = map[string]interface{}{
-			"batch_results": batchResponseItems,
+			"batch_results":  batchResponseItems,
+			"batch_failures": batchFailureCount(batchResponseItems),
 		}
 	} else {
 		if batchResponseItems[0].Error != "" {
@@ -184,10 +150,53 @@ func (b *backend) pathRewrapWrite(ctx context.Context, req *logical.Request, d *
 		}
 	}
 
+	b.recordUsage(p.Name, usageRewrap, len(batchResponseItems)-batchFailureCount(batchResponseItems))
+
 	p.Unlock()
 	return resp, nil
 }
 
+// rewrapBatchItem rewraps a single batch request item. Problems with the item
+// itself are reported in the Error field of the returned response item; a
+// returned error aborts the whole request.
+func rewrapBatchItem(p *keysutil.Policy, item *BatchRequestItem) (BatchResponseItem, error) {
+	var result BatchResponseItem
+
+	if item.Ciphertext == "" {
+		result.Error = "missing ciphertext to decrypt"
+		return result, nil
+	}
+
+	if result.Error = decodeCiphertextItem(item); result.Error != "" {
+		return result, nil
+	}
+
+	plaintext, err := p.DecryptWithAAD(item.DecodedContext, item.DecodedNonce, item.Ciphertext, item.DecodedAssociatedData)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			result.Error = err.Error()
+			return result, nil
+		default:
+			return result, err
+		}
+	}
+
+	ciphertext, err := p.EncryptWithAAD(item.KeyVersion, item.DecodedContext, item.DecodedNonce, plaintext, item.DecodedAssociatedData)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			result.Error = err.Error()
+			return result, nil
+		default:
+			return result, err
+		}
+	}
+
+	result.Ciphertext = ciphertext
+	return result, nil
+}
+
 const pathRewrapHelpSyn = `Rewrap ciphertext`
 
 const pathRewrapHelpDesc = `
@@ -293,3 +293,87 @@ func TestTransit_BatchRewrapCase3(t *testing.T) {
 		}
 	}
 }
+
+// Batch rewrap should report ciphertexts that are disallowed by the key's
+// min_decryption_version per item without failing the others
+func TestTransit_BatchRewrapCase4(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, s := createBackendWithStorage(t)
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+
+	encReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "encrypt/upserted_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"plaintext": plaintext,
+		},
+	}
+
+	// Encrypt once under each of the first two key versions
+	var ciphertexts []string
+	for i := 0; i < 2; i++ {
+		resp, err = b.HandleRequest(context.Background(), encReq)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		ciphertexts = append(ciphertexts, resp.Data["ciphertext"].(string))
+
+		rotateReq := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "keys/upserted_key/rotate",
+			Storage:   s,
+		}
+		resp, err = b.HandleRequest(context.Background(), rotateReq)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	configReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/upserted_key/config",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"min_decryption_version": 2,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), configReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	rewrapReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rewrap/upserted_key",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"batch_input": []interface{}{
+				map[string]interface{}{"ciphertext": ciphertexts[0]},
+				map[string]interface{}{"ciphertext": ciphertexts[1]},
+			},
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), rewrapReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	batchResponseItems := resp.Data["batch_results"].([]BatchResponseItem)
+	if len(batchResponseItems) != 2 {
+		t.Fatalf("bad: expected 2 response items, got %d", len(batchResponseItems))
+	}
+
+	if batchResponseItems[0].Error == "" || batchResponseItems[0].Ciphertext != "" {
+		t.Fatalf("expected an error for the item below min_decryption_version: %#v", batchResponseItems[0])
+	}
+
+	if batchResponseItems[1].Error != "" {
+		t.Fatalf("bad: unexpected error: %q", batchResponseItems[1].Error)
+	}
+	if !strings.HasPrefix(batchResponseItems[1].Ciphertext, "vault:v3") {
+		t.Fatalf("bad: ciphertext version: expected: 'vault:v3', actual: %s", batchResponseItems[1].Ciphertext)
+	}
+}
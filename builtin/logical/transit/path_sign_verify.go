@@ -14,6 +14,23 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// signatureHash returns the hash for the given signature hash algorithm, or
+// nil if the algorithm is not supported
+func signatureHash(hashAlgorithm string) hash.Hash {
+	switch hashAlgorithm {
+	case "sha2-224":
+		return sha256.New224()
+	case "sha2-256":
+		return sha256.New()
+	case "sha2-384":
+		return sha512.New384()
+	case "sha2-512":
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
 func (b *backend) pathSign() *framework.Path {
 	return &framework.Path{
 		Pattern: "sign/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("urlalgorithm"),
@@ -68,7 +85,7 @@ to the min_encryption_version configured on the key.`,
 
 			"prehashed": &framework.FieldSchema{
 				Type:        framework.TypeBool,
-				Description: `Set to 'true' when the input is already hashed. If the key type is 'rsa-2048' or 'rsa-4096', then the algorithm used to hash the input should be indicated by the 'algorithm' parameter.`,
+				Description: `Set to 'true' when the input is already hashed. The input must then be a digest of the algorithm given by 'hash_algorithm'. Ignored for ed25519 keys.`,
 			},
 			"signature_algorithm": &framework.FieldSchema{
 				Type: framework.TypeString,
@@ -141,13 +158,21 @@ Defaults to "sha2-256". Not valid for all key types.`,
 
 			"prehashed": &framework.FieldSchema{
 				Type:        framework.TypeBool,
-				Description: `Set to 'true' when the input is already hashed. If the key type is 'rsa-2048' or 'rsa-4096', then the algorithm used to hash the input should be indicated by the 'algorithm' parameter.`,
+				Description: `Set to 'true' when the input is already hashed. The input must then be a digest of the algorithm given by 'hash_algorithm'. Ignored for ed25519 keys.`,
 			},
 			"signature_algorithm": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `The signature algorithm to use for signature verification. Currently only applies to RSA key types. 
 Options are 'pss' or 'pkcs1v15'. Defaults to 'pss'`,
 			},
+
+			"batch_input": &framework.FieldSchema{
+				Type: framework.TypeSlice,
+				Description: `
+Specifies a list of items, each containing 'input' and 'hmac', to be verified
+in a single batch. Currently only supported for HMAC verification. When this
+parameter is set, the 'input', 'hmac' and 'signature' parameters are ignored.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -208,29 +233,34 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *fr
 		}
 	}
 
-	if p.Type.HashSignatureInput() && !prehashed {
-		var hf hash.Hash
-		switch hashAlgorithm {
-		case "sha2-224":
-			hf = sha256.New224()
-		case "sha2-256":
-			hf = sha256.New()
-		case "sha2-384":
-			hf = sha512.New384()
-		case "sha2-512":
-			hf = sha512.New()
-		default:
+	// Key types that sign the input directly, such as ed25519, ignore
+	// prehashed
+	if p.Type.HashSignatureInput() {
+		hf := signatureHash(hashAlgorithm)
+		if hf == nil {
 			p.Unlock()
-			return logical.ErrorResponse(fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)), nil
+			return logical.ErrorResponse(fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)), logical.ErrInvalidRequest
+		}
+
+		// Prehashed input must already be a digest of the given algorithm
+		if !prehashed {
+			hf.Write(input)
+			input = hf.Sum(nil)
+		} else if len(input) != hf.Size() {
+			p.Unlock()
+			return logical.ErrorResponse(fmt.Sprintf("prehashed input must be a %d byte %s digest; got %d bytes", hf.Size(), hashAlgorithm, len(input))), logical.ErrInvalidRequest
 		}
-		hf.Write(input)
-		input = hf.Sum(nil)
 	}
 
 	sig, err := p.Sign(ver, context, input, hashAlgorithm, sigAlgorithm)
 	if err != nil {
 		p.Unlock()
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
 	}
 	if sig == nil {
 		p.Unlock()
@@ -248,12 +278,19 @@ func (b *backend) pathSignWrite(ctx context.Context, req *logical.Request, d *fr
 		resp.Data["public_key"] = sig.PublicKey
 	}
 
+	b.recordUsage(p.Name, usageSign, 1)
+
 	p.Unlock()
 	return resp, nil
 }
 
 func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 
+	// Batch verification is currently only supported for HMACs
+	if _, ok := d.Raw["batch_input"]; ok {
+		return b.pathHMACVerify(ctx, req, d, "")
+	}
+
 	sig := d.Get("signature").(string)
 	hmac := d.Get("hmac").(string)
 	switch {
@@ -314,23 +351,23 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *
 		}
 	}
 
-	if p.Type.HashSignatureInput() && !prehashed {
-		var hf hash.Hash
-		switch hashAlgorithm {
-		case "sha2-224":
-			hf = sha256.New224()
-		case "sha2-256":
-			hf = sha256.New()
-		case "sha2-384":
-			hf = sha512.New384()
-		case "sha2-512":
-			hf = sha512.New()
-		default:
+	// Key types that sign the input directly, such as ed25519, ignore
+	// prehashed
+	if p.Type.HashSignatureInput() {
+		hf := signatureHash(hashAlgorithm)
+		if hf == nil {
+			p.Unlock()
+			return logical.ErrorResponse(fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)), logical.ErrInvalidRequest
+		}
+
+		// Prehashed input must already be a digest of the given algorithm
+		if !prehashed {
+			hf.Write(input)
+			input = hf.Sum(nil)
+		} else if len(input) != hf.Size() {
 			p.Unlock()
-			return logical.ErrorResponse(fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)), nil
+			return logical.ErrorResponse(fmt.Sprintf("prehashed input must be a %d byte %s digest; got %d bytes", hf.Size(), hashAlgorithm, len(input))), logical.ErrInvalidRequest
 		}
-		hf.Write(input)
-		input = hf.Sum(nil)
 	}
 
 	valid, err := p.VerifySignature(context, input, sig, hashAlgorithm, sigAlgorithm)
@@ -355,6 +392,8 @@ func (b *backend) pathVerifyWrite(ctx context.Context, req *logical.Request, d *
 		},
 	}
 
+	b.recordUsage(p.Name, usageVerify, 1)
+
 	p.Unlock()
 	return resp, nil
 }
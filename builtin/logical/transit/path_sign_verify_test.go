@@ -2,6 +2,7 @@ package transit
 
 import (
 	"context"
+	"crypto/sha512"
 	"encoding/base64"
 	"strconv"
 	"strings"
@@ -161,9 +162,20 @@ func TestTransit_SignVerify_P256(t *testing.T) {
 	sig = signRequest(req, false, "")
 	verifyRequest(req, false, "", sig)
 
+	// Prehashed input must be a digest of the declared algorithm
+	digest := sha512.Sum384([]byte("the quick brown fox"))
 	req.Data["prehashed"] = true
+	req.Data["input"] = base64.StdEncoding.EncodeToString(digest[:])
 	sig = signRequest(req, false, "")
 	verifyRequest(req, false, "", sig)
+
+	req.Data["hash_algorithm"] = "sha2-256"
+	signRequest(req, true, "")
+	verifyRequest(req, true, "", sig)
+
+	req.Data["hash_algorithm"] = "sha2-384"
+	req.Data["input"] = "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	signRequest(req, true, "")
 	delete(req.Data, "prehashed")
 
 	// Test 512 and save sig for later to ensure we can't validate once min
@@ -205,6 +217,18 @@ func TestTransit_SignVerify_P256(t *testing.T) {
 	verifyRequest(req, false, "", sig)
 	// Now try the v1
 	verifyRequest(req, true, "", v1sig)
+
+	// Signing with a version that does not exist should be a user error
+	req.Data["key_version"] = 4
+	req.Path = "sign/foo"
+	resp, err := b.HandleRequest(context.Background(), req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got %#v", resp)
+	}
+	delete(req.Data, "key_version")
 }
 
 func TestTransit_SignVerify_ED25519(t *testing.T) {
@@ -408,4 +432,204 @@ func TestTransit_SignVerify_ED25519(t *testing.T) {
 	sig = signRequest(req, false, "bar")
 	verifyRequest(req, false, "bar", sig)
 	verifyRequest(req, true, "bar", v1sig)
+
+	// Signing and verifying with the derived key requires a context, and its
+	// absence should be reported as a user error
+	delete(req.Data, "context")
+	for _, path := range []string{"sign/bar", "verify/bar"} {
+		req.Path = path
+		req.Data["signature"] = sig
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != logical.ErrInvalidRequest {
+			t.Fatalf("%s: expected invalid request error, got %v", path, err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error response, got %#v", path, resp)
+		}
+	}
+}
+
+func TestTransit_SignVerify_Prehashed(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	for _, keyType := range []string{"ecdsa-p256", "rsa-2048", "ed25519"} {
+		resp, err := doReq("keys/"+keyType, map[string]interface{}{"type": keyType})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	digest := sha512.Sum512([]byte("the quick brown fox"))
+	input := base64.StdEncoding.EncodeToString(digest[:])
+
+	for _, keyType := range []string{"ecdsa-p256", "rsa-2048"} {
+		data := map[string]interface{}{
+			"input":          input,
+			"prehashed":      true,
+			"hash_algorithm": "sha2-512",
+		}
+		resp, err := doReq("sign/"+keyType, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", keyType, err, resp)
+		}
+		data["signature"] = resp.Data["signature"]
+
+		resp, err = doReq("verify/"+keyType, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", keyType, err, resp)
+		}
+		if !resp.Data["valid"].(bool) {
+			t.Fatalf("%s: expected signature to verify", keyType)
+		}
+
+		// Without prehashed the digest is hashed again, so it must not verify
+		delete(data, "prehashed")
+		resp, err = doReq("verify/"+keyType, data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err:%v resp:%#v", keyType, err, resp)
+		}
+		if resp.Data["valid"].(bool) {
+			t.Fatalf("%s: expected signature not to verify against the rehashed input", keyType)
+		}
+
+		// A digest of the wrong length is rejected on both paths
+		data["prehashed"] = true
+		data["hash_algorithm"] = "sha2-256"
+		for _, path := range []string{"sign/", "verify/"} {
+			resp, err = doReq(path+keyType, data)
+			if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+				t.Fatalf("%s: expected invalid request error; err:%v resp:%#v", keyType, err, resp)
+			}
+			if !strings.Contains(resp.Data["error"].(string), "sha2-256") {
+				t.Fatalf("%s: expected the error to name the algorithm: %#v", keyType, resp.Data)
+			}
+		}
+	}
+
+	// ed25519 signs the input directly, so prehashed is ignored
+	resp, err := doReq("sign/ed25519", map[string]interface{}{
+		"input": input,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	sig := resp.Data["signature"]
+	resp, err = doReq("sign/ed25519", map[string]interface{}{
+		"input":     input,
+		"prehashed": true,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["signature"] != sig {
+		t.Fatal("expected prehashed to be ignored for ed25519")
+	}
+	resp, err = doReq("verify/ed25519", map[string]interface{}{
+		"input":     input,
+		"prehashed": true,
+		"signature": sig,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !resp.Data["valid"].(bool) {
+		t.Fatal("expected signature to verify")
+	}
+
+	// Unsupported hash algorithms are invalid requests
+	for _, path := range []string{"sign/", "verify/"} {
+		resp, err = doReq(path+"ecdsa-p256", map[string]interface{}{
+			"input":          input,
+			"hash_algorithm": "md5",
+			"signature":      sig,
+		})
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected invalid request error; err:%v resp:%#v", path, err, resp)
+		}
+	}
+}
+
+func TestTransit_SignVerify_RSASignatureAlgorithm(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := doReq("keys/rsa", map[string]interface{}{"type": "rsa-2048"})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	input := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	sign := func(sigAlgorithm string) string {
+		t.Helper()
+		data := map[string]interface{}{"input": input}
+		if sigAlgorithm != "" {
+			data["signature_algorithm"] = sigAlgorithm
+		}
+		resp, err := doReq("sign/rsa", data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp.Data["signature"].(string)
+	}
+	verify := func(sig, sigAlgorithm string) bool {
+		t.Helper()
+		data := map[string]interface{}{
+			"input":     input,
+			"signature": sig,
+		}
+		if sigAlgorithm != "" {
+			data["signature_algorithm"] = sigAlgorithm
+		}
+		resp, err := doReq("verify/rsa", data)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp.Data["valid"].(bool)
+	}
+
+	// PSS is the default
+	pssSig := sign("")
+	if !verify(pssSig, "") || !verify(pssSig, "pss") {
+		t.Fatal("expected PSS signature to verify as PSS")
+	}
+	if verify(pssSig, "pkcs1v15") {
+		t.Fatal("expected PSS signature not to verify as PKCS#1 v1.5")
+	}
+
+	pkcsSig := sign("pkcs1v15")
+	if !verify(pkcsSig, "pkcs1v15") {
+		t.Fatal("expected PKCS#1 v1.5 signature to verify as PKCS#1 v1.5")
+	}
+	if verify(pkcsSig, "") || verify(pkcsSig, "pss") {
+		t.Fatal("expected PKCS#1 v1.5 signature not to verify as PSS")
+	}
+
+	// Unknown signature algorithms are rejected
+	for _, path := range []string{"sign/rsa", "verify/rsa"} {
+		resp, err = doReq(path, map[string]interface{}{
+			"input":               input,
+			"signature":           pssSig,
+			"signature_algorithm": "foobar",
+		})
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected invalid request error; err:%v resp:%#v", path, err, resp)
+		}
+	}
 }
@@ -0,0 +1,269 @@
+package transit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const usagePrefix = "usage/"
+
+type usageOp int
+
+const (
+	usageEncrypt usageOp = iota
+	usageDecrypt
+	usageSign
+	usageVerify
+	usageRewrap
+)
+
+// keyUsage counts the operations performed with a key
+type keyUsage struct {
+	Encrypt  uint64    `json:"encrypt"`
+	Decrypt  uint64    `json:"decrypt"`
+	Sign     uint64    `json:"sign"`
+	Verify   uint64    `json:"verify"`
+	Rewrap   uint64    `json:"rewrap"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+func (u *keyUsage) add(other *keyUsage) {
+	u.Encrypt += other.Encrypt
+	u.Decrypt += other.Decrypt
+	u.Sign += other.Sign
+	u.Verify += other.Verify
+	u.Rewrap += other.Rewrap
+	if other.LastUsed.After(u.LastUsed) {
+		u.LastUsed = other.LastUsed
+	}
+}
+
+// usageTracker accumulates key usage in memory until the periodic function
+// flushes it to storage, so that counting does not add a storage write to
+// every request
+type usageTracker struct {
+	l       sync.Mutex
+	pending map[string]*keyUsage
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{
+		pending: make(map[string]*keyUsage),
+	}
+}
+
+// record counts count operations of the given type performed with the named
+// key
+func (t *usageTracker) record(name string, op usageOp, count int) {
+	if count <= 0 {
+		return
+	}
+
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	u, ok := t.pending[name]
+	if !ok {
+		u = &keyUsage{}
+		t.pending[name] = u
+	}
+
+	switch op {
+	case usageEncrypt:
+		u.Encrypt += uint64(count)
+	case usageDecrypt:
+		u.Decrypt += uint64(count)
+	case usageSign:
+		u.Sign += uint64(count)
+	case usageVerify:
+		u.Verify += uint64(count)
+	case usageRewrap:
+		u.Rewrap += uint64(count)
+	}
+	u.LastUsed = time.Now().UTC()
+}
+
+// get returns a copy of the usage of the named key that has not been flushed
+// yet
+func (t *usageTracker) get(name string) keyUsage {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	if u, ok := t.pending[name]; ok {
+		return *u
+	}
+	return keyUsage{}
+}
+
+// take removes and returns all the usage that has not been flushed yet
+func (t *usageTracker) take() map[string]*keyUsage {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	pending := t.pending
+	t.pending = make(map[string]*keyUsage)
+	return pending
+}
+
+// restore adds back usage that could not be flushed
+func (t *usageTracker) restore(name string, u *keyUsage) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	if existing, ok := t.pending[name]; ok {
+		existing.add(u)
+		return
+	}
+	t.pending[name] = u
+}
+
+// forget drops the usage of the named key that has not been flushed yet
+func (t *usageTracker) forget(name string) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	delete(t.pending, name)
+}
+
+func readKeyUsage(ctx context.Context, s logical.Storage, name string) (*keyUsage, error) {
+	entry, err := s.Get(ctx, usagePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+
+	var result keyUsage
+	if entry == nil {
+		return &result, nil
+	}
+
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// flushUsage adds the usage recorded in memory to the stored usage of each
+// key. Usage that cannot be stored is kept for the next flush.
+func (b *backend) flushUsage(ctx context.Context, s logical.Storage) error {
+	var errs *multierror.Error
+	for name, u := range b.usage.take() {
+		if err := b.flushKeyUsage(ctx, s, name, u); err != nil {
+			b.usage.restore(name, u)
+			errs = multierror.Append(errs, fmt.Errorf("failed to store usage of key %q: %v", name, err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (b *backend) flushKeyUsage(ctx context.Context, s logical.Storage, name string, u *keyUsage) error {
+	b.usageLock.Lock()
+	defer b.usageLock.Unlock()
+
+	// Usage of keys deleted since it was recorded is dropped
+	entry, err := s.Get(ctx, "policy/"+name)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	stored, err := readKeyUsage(ctx, s, name)
+	if err != nil {
+		return err
+	}
+	stored.add(u)
+
+	entry, err = logical.StorageEntryJSON(usagePrefix+name, stored)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// deleteUsage removes the stored and in-memory usage of the named key
+func (b *backend) deleteUsage(ctx context.Context, s logical.Storage, name string) error {
+	b.usageLock.Lock()
+	defer b.usageLock.Unlock()
+
+	b.usage.forget(name)
+	return s.Delete(ctx, usagePrefix+name)
+}
+
+func (b *backend) pathUsage() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/usage",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathUsageRead,
+		},
+
+		HelpSynopsis:    pathUsageHelpSyn,
+		HelpDescription: pathUsageHelpDesc,
+	}
+}
+
+func (b *backend) pathUsageRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+	p.Release()
+
+	u, err := readKeyUsage(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	pending := b.usage.get(name)
+	u.add(&pending)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"encrypt":   u.Encrypt,
+			"decrypt":   u.Decrypt,
+			"sign":      u.Sign,
+			"verify":    u.Verify,
+			"rewrap":    u.Rewrap,
+			"last_used": nil,
+		},
+	}
+	if !u.LastUsed.IsZero() {
+		resp.Data["last_used"] = u.LastUsed.Format(time.RFC3339Nano)
+	}
+
+	return resp, nil
+}
+
+const pathUsageHelpSyn = `Returns how often the named key has been used`
+
+const pathUsageHelpDesc = `
+This path returns the number of encrypt, decrypt, sign, verify and rewrap
+operations performed with the named key, along with the time it was last used.
+Each item of a batch request counts as one operation, and HMAC verifications
+count as verify operations. Usage is kept in memory and persisted periodically,
+so usage recorded shortly before a restart may be lost. Requests served by
+performance standbys and performance secondaries are not counted.
+`
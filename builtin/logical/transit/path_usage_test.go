@@ -0,0 +1,224 @@
+package transit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_KeyUsage(t *testing.T) {
+	b, s := createBackendWithSysView(t)
+
+	doReq := func(b *backend, req *logical.Request) *logical.Response {
+		t.Helper()
+		req.Storage = s
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	checkUsage := func(b *backend, name string, expected map[string]uint64) {
+		t.Helper()
+		resp := doReq(b, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "keys/" + name + "/usage",
+		})
+		for op, count := range expected {
+			if resp.Data[op].(uint64) != count {
+				t.Fatalf("bad %s count for %s: expected %d, got %v", op, name, count, resp.Data[op])
+			}
+		}
+		if resp.Data["last_used"] == nil {
+			t.Fatalf("expected a last used time for %s", name)
+		}
+	}
+
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/enc",
+	})
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/sig",
+		Data: map[string]interface{}{
+			"type": "ecdsa-p256",
+		},
+	})
+
+	// Unused keys report no usage
+	resp := doReq(b, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "keys/enc/usage",
+	})
+	if resp.Data["encrypt"].(uint64) != 0 || resp.Data["last_used"] != nil {
+		t.Fatalf("expected no usage, got %#v", resp.Data)
+	}
+
+	// Every successful batch item counts as one operation
+	resp = doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt/enc",
+		Data: map[string]interface{}{
+			"batch_input": []interface{}{
+				map[string]interface{}{"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA=="},
+				map[string]interface{}{"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA=="},
+				map[string]interface{}{"plaintext": "not base64"},
+			},
+		},
+	})
+	ciphertext := resp.Data["batch_results"].([]BatchResponseItem)[0].Ciphertext
+
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "decrypt/enc",
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext,
+		},
+	})
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rewrap/enc",
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext,
+		},
+	})
+
+	resp = doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sign/sig",
+		Data: map[string]interface{}{
+			"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		},
+	})
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "verify/sig",
+		Data: map[string]interface{}{
+			"input":     "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			"signature": resp.Data["signature"],
+		},
+	})
+
+	// HMAC verifications count as verify operations
+	resp = doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "hmac/enc",
+		Data: map[string]interface{}{
+			"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		},
+	})
+	hmac := resp.Data["hmac"].(string)
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "verify/enc",
+		Data: map[string]interface{}{
+			"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			"hmac":  hmac,
+		},
+	})
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "verify/enc",
+		Data: map[string]interface{}{
+			"batch_input": []interface{}{
+				map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA==", "hmac": hmac},
+				map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA==", "hmac": "not an hmac"},
+			},
+		},
+	})
+
+	encUsage := map[string]uint64{"encrypt": 2, "decrypt": 1, "rewrap": 1, "verify": 2, "sign": 0}
+	sigUsage := map[string]uint64{"sign": 1, "verify": 1, "encrypt": 0}
+	checkUsage(b, "enc", encUsage)
+	checkUsage(b, "sig", sigUsage)
+
+	// Nothing is written to storage until the periodic function runs
+	entry, err := s.Get(context.Background(), usagePrefix+"enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatal("expected usage to be kept in memory")
+	}
+
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Usage survives a restart once flushed
+	b2, _ := createBackendWithSysView(t)
+	checkUsage(b2, "enc", encUsage)
+	checkUsage(b2, "sig", sigUsage)
+
+	// Flushed and pending usage add up
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "decrypt/enc",
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext,
+		},
+	})
+	encUsage["decrypt"] = 2
+	checkUsage(b, "enc", encUsage)
+
+	// Deleting the key removes its usage
+	doReq(b, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/enc/config",
+		Data: map[string]interface{}{
+			"deletion_allowed": true,
+		},
+	})
+	doReq(b, &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "keys/enc",
+	})
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = s.Get(context.Background(), usagePrefix+"enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry != nil {
+		t.Fatal("expected usage to be deleted with the key")
+	}
+}
+
+func TestTransit_KeyUsagePerfStandby(t *testing.T) {
+	sysView := logical.TestSystemView()
+	sysView.ReplicationStateVal = consts.ReplicationPerformanceStandby
+	storage := &logical.InmemStorage{}
+	conf := &logical.BackendConfig{
+		StorageView: storage,
+		System:      sysView,
+	}
+	b := Backend(conf)
+	if err := b.Backend.Setup(context.Background(), conf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"keys/enc", "encrypt/enc"} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data: map[string]interface{}{
+				"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	// Usage is never flushed on a performance standby, so it isn't kept in
+	// memory either
+	if u := b.usage.get("enc"); u.Encrypt != 0 {
+		t.Fatalf("expected no usage to be recorded, got %#v", u)
+	}
+}
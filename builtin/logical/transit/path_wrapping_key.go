@@ -0,0 +1,104 @@
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	wrappingKeyPath = "import/wrapping_key"
+	wrappingKeyBits = 4096
+)
+
+// wrappingKeyEntry is the stored form of the mount's key import wrapping key
+type wrappingKeyEntry struct {
+	Key *rsa.PrivateKey `json:"key"`
+}
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+// getWrappingKey returns the mount's wrapping key, generating and storing it
+// on first use
+func (b *backend) getWrappingKey(ctx context.Context, s logical.Storage) (*rsa.PrivateKey, error) {
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	entry, err := s.Get(ctx, wrappingKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		var result wrappingKeyEntry
+		if err := entry.DecodeJSON(&result); err != nil {
+			return nil, err
+		}
+		if result.Key == nil {
+			return nil, fmt.Errorf("stored wrapping key is empty")
+		}
+		return result.Key, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, wrappingKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err = logical.StorageEntryJSON(wrappingKeyPath, &wrappingKeyEntry{
+		Key: key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (b *backend) pathWrappingKeyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, err := b.getWrappingKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling wrapping key: %v", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	})
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": string(pemBytes),
+		},
+	}, nil
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to use for wrapping imported keys`
+
+const pathWrappingKeyHelpDesc = `
+This path returns the PEM-encoded public half of an RSA-4096 key that is unique
+to this mount. Keys imported through the 'keys/<name>/import' and
+'keys/<name>/import_version' paths must be wrapped for this key.
+`
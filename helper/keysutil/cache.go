@@ -0,0 +1,222 @@
+package keysutil
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// policyCache is the in-memory cache of policies used by the LockManager. A
+// size of zero means the cache is unbounded; otherwise the least recently
+// used policies are evicted once the size is exceeded.
+//
+// Policies handed out by Acquire and AcquireOrStore are pinned until they are
+// released. A pinned policy that is evicted stays reachable, so that the next
+// request for it gets the same object, and with it the same lock, instead of
+// a second copy loaded from storage.
+type policyCache struct {
+	l    sync.Mutex
+	size int
+
+	// Exactly one of these is set, depending on whether the cache is bounded
+	entries map[string]*Policy
+	lru     *simplelru.LRU
+
+	// pinned holds the policies that are in use, whether or not they have
+	// been evicted
+	pinned map[string]*Policy
+}
+
+func newPolicyCache(size int) (*policyCache, error) {
+	c := &policyCache{
+		pinned: make(map[string]*Policy),
+	}
+	if err := c.Resize(size); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load returns the policy for the name without pinning it
+func (c *policyCache) Load(name string) (*Policy, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.load(name)
+}
+
+// Acquire returns the policy for the name and pins it. The caller must hand
+// it back with release once it is done with it.
+func (c *policyCache) Acquire(name string) (*Policy, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	p, ok := c.load(name)
+	if ok {
+		c.pin(name, p)
+	}
+	return p, ok
+}
+
+// AcquireOrStore returns the policy for the name if there is one; otherwise it
+// caches the given policy and returns it. Either way the returned policy is
+// pinned.
+func (c *policyCache) AcquireOrStore(name string, p *Policy) *Policy {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if existing, ok := c.load(name); ok {
+		c.pin(name, existing)
+		return existing
+	}
+
+	c.store(name, p)
+	c.pin(name, p)
+	return p
+}
+
+func (c *policyCache) Store(name string, p *Policy) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.store(name, p)
+}
+
+func (c *policyCache) Delete(name string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	delete(c.pinned, name)
+
+	if c.lru != nil {
+		c.lru.Remove(name)
+		return
+	}
+
+	delete(c.entries, name)
+}
+
+// release unpins a policy returned by Acquire or AcquireOrStore
+func (c *policyCache) release(p *Policy) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	p.pins--
+	if p.pins == 0 && c.pinned[p.Name] == p {
+		delete(c.pinned, p.Name)
+	}
+}
+
+// load looks up the policy for the name, bringing a pinned policy that has
+// been evicted back into the cache. The cache's lock must be held.
+func (c *policyCache) load(name string) (*Policy, bool) {
+	if c.lru != nil {
+		if pRaw, ok := c.lru.Get(name); ok {
+			return pRaw.(*Policy), true
+		}
+	} else if p, ok := c.entries[name]; ok {
+		return p, true
+	}
+
+	p, ok := c.pinned[name]
+	if ok {
+		c.store(name, p)
+	}
+	return p, ok
+}
+
+// store adds the policy to the cache. The cache's lock must be held.
+func (c *policyCache) store(name string, p *Policy) {
+	// This is set before the policy is visible to other requests and never
+	// changed afterwards, so it can be read without the cache's lock
+	if p.cache == nil {
+		p.cache = c
+	}
+
+	if c.lru != nil {
+		c.lru.Add(name, p)
+		return
+	}
+
+	c.entries[name] = p
+}
+
+// pin marks the policy as in use. The cache's lock must be held.
+func (c *policyCache) pin(name string, p *Policy) {
+	p.pins++
+	c.pinned[name] = p
+}
+
+// Size returns the configured maximum number of entries, or zero if the cache
+// is unbounded
+func (c *policyCache) Size() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.size
+}
+
+// Len returns the number of policies currently cached
+func (c *policyCache) Len() int {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.lru != nil {
+		return c.lru.Len()
+	}
+	return len(c.entries)
+}
+
+// Resize changes the maximum number of cached policies. Cached policies are
+// carried over, evicting the least recently used ones if the new size is
+// smaller than the number of entries.
+func (c *policyCache) Resize(size int) error {
+	if size < 0 {
+		return fmt.Errorf("cache size must be greater or equal to zero")
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	// Collect the current entries, oldest first so that re-adding them to an
+	// LRU preserves their recency
+	var names []string
+	var policies []*Policy
+	switch {
+	case c.lru != nil:
+		for _, nameRaw := range c.lru.Keys() {
+			pRaw, _ := c.lru.Peek(nameRaw)
+			names = append(names, nameRaw.(string))
+			policies = append(policies, pRaw.(*Policy))
+		}
+	default:
+		for name, p := range c.entries {
+			names = append(names, name)
+			policies = append(policies, p)
+		}
+	}
+
+	c.size = size
+	c.entries = nil
+	c.lru = nil
+
+	if size == 0 {
+		c.entries = make(map[string]*Policy, len(names))
+		for i, name := range names {
+			c.entries[name] = policies[i]
+		}
+		return nil
+	}
+
+	lru, err := simplelru.NewLRU(size, nil)
+	if err != nil {
+		return err
+	}
+	for i, name := range names {
+		lru.Add(name, policies[i])
+	}
+	c.lru = lru
+
+	return nil
+}
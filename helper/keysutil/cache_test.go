@@ -0,0 +1,178 @@
+package keysutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPolicyCache_Resize(t *testing.T) {
+	c, err := newPolicyCache(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		c.Store(name, &Policy{Name: name})
+	}
+	if c.Len() != 3 {
+		t.Fatalf("expected 3 entries, got %d", c.Len())
+	}
+
+	if err := c.Resize(3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Use "a" so that it is the most recently used entry
+	if _, ok := c.Load("a"); !ok {
+		t.Fatal("expected entry to be retained")
+	}
+
+	// Shrinking evicts the least recently used entries
+	if err := c.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != 1 || c.Len() != 1 {
+		t.Fatalf("expected size 1 with 1 entry, got size %d with %d entries", c.Size(), c.Len())
+	}
+	if p, ok := c.Load("a"); !ok || p.Name != "a" {
+		t.Fatalf("expected the most recently used entry to be retained, got %#v", p)
+	}
+
+	c.Store("b", &Policy{Name: "b"})
+	if _, ok := c.Load("a"); ok {
+		t.Fatal("expected entry to be evicted")
+	}
+
+	// Growing to unbounded keeps the existing entries
+	if err := c.Resize(0); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := c.Load("b"); !ok || p.Name != "b" {
+		t.Fatalf("expected entry to be retained, got %#v", p)
+	}
+
+	c.Delete("b")
+	if c.Len() != 0 {
+		t.Fatalf("expected no entries, got %d", c.Len())
+	}
+
+	if err := c.Resize(-1); err == nil {
+		t.Fatal("expected error for negative size")
+	}
+}
+
+func TestPolicyCache_Pinning(t *testing.T) {
+	c, err := newPolicyCache(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := c.AcquireOrStore("a", &Policy{Name: "a"})
+	c.Store("b", &Policy{Name: "b"})
+	if c.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d", c.Len())
+	}
+
+	// An evicted policy that is still in use is handed out again
+	if p, ok := c.Acquire("a"); !ok || p != a {
+		t.Fatalf("expected the pinned policy, got %#v", p)
+	}
+	c.release(a)
+	c.release(a)
+
+	// Once released it can be dropped for good
+	c.Store("b", &Policy{Name: "b"})
+	if _, ok := c.Load("a"); ok {
+		t.Fatal("expected released policy to be evicted")
+	}
+	if len(c.pinned) != 0 {
+		t.Fatalf("expected no pinned policies, got %d", len(c.pinned))
+	}
+}
+
+func TestLockManager_EvictWhileRotating(t *testing.T) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+	lm := NewLockManager(false)
+	if err := lm.SetCacheSize(1); err != nil {
+		t.Fatal(err)
+	}
+
+	getPolicy := func(name string) *Policy {
+		p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+			Upsert:  true,
+			Storage: storage,
+			KeyType: KeyType_AES256_GCM96,
+			Name:    name,
+		})
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return p
+	}
+
+	// Evict a key while it is locked for a rotation; loading it again must
+	// return the same policy, so that a second rotation waits for the first
+	// one instead of starting from the stale stored version
+	a := getPolicy("a")
+	a.Lock(true)
+	getPolicy("b").Release()
+	again := getPolicy("a")
+	if again != a {
+		a.Unlock()
+		t.Fatal("expected the policy in use to be returned after eviction")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		again.Lock(true)
+		defer again.Unlock()
+		if err := again.Rotate(ctx, storage); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := a.Rotate(ctx, storage); err != nil {
+		t.Error(err)
+	}
+	a.Unlock()
+	<-done
+
+	// Rotate one key while loading another evicts it over and over; every
+	// rotation must be applied to the same policy
+	const rotations = 50
+	var wg sync.WaitGroup
+	for i := 0; i < rotations; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p := getPolicy("a")
+			if p == nil {
+				return
+			}
+			p.Lock(true)
+			defer p.Unlock()
+			if err := p.Rotate(ctx, storage); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if p := getPolicy("b"); p != nil {
+				p.Release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	p, err := lm.getPolicyFromStorage(ctx, storage, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.LatestVersion != rotations+3 || len(p.Keys) != rotations+3 {
+		t.Fatalf("expected %d versions, got latest version %d with %d keys", rotations+3, p.LatestVersion, len(p.Keys))
+	}
+}
@@ -0,0 +1,84 @@
+package keysutil
+
+import (
+	"sync"
+)
+
+// keyLockMap provides a read/write lock per key name, so that operations on
+// different keys never contend with each other. Entries are reference
+// counted and removed once nothing holds or waits for them, which keeps the
+// map from growing with every name that has ever been requested.
+type keyLockMap struct {
+	l     sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.RWMutex
+
+	// refs is the number of callers holding or waiting for the lock; it is
+	// protected by the keyLockMap's mutex
+	refs int
+}
+
+func newKeyLockMap() *keyLockMap {
+	return &keyLockMap{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+// acquire returns the lock for the given name without locking it. The lock
+// must be handed back with release once the caller no longer uses it.
+func (m *keyLockMap) acquire(name string) *keyLock {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	kl, ok := m.locks[name]
+	if !ok {
+		kl = new(keyLock)
+		m.locks[name] = kl
+	}
+	kl.refs++
+	return kl
+}
+
+// release hands back a lock obtained with acquire
+func (m *keyLockMap) release(name string, kl *keyLock) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	kl.refs--
+	if kl.refs == 0 {
+		delete(m.locks, name)
+	}
+}
+
+// lock takes the exclusive lock for the given name and returns the function
+// that unlocks it
+func (m *keyLockMap) lock(name string) func() {
+	kl := m.acquire(name)
+	kl.Lock()
+	return func() {
+		kl.Unlock()
+		m.release(name, kl)
+	}
+}
+
+// rlock takes the shared lock for the given name and returns the function
+// that unlocks it
+func (m *keyLockMap) rlock(name string) func() {
+	kl := m.acquire(name)
+	kl.RLock()
+	return func() {
+		kl.RUnlock()
+		m.release(name, kl)
+	}
+}
+
+// len returns the number of names with a lock currently in use
+func (m *keyLockMap) len() int {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	return len(m.locks)
+}
@@ -0,0 +1,81 @@
+package keysutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestKeyLockMap(t *testing.T) {
+	testKeyLockMapCommon(t, NewLockManager(false))
+	testKeyLockMapCommon(t, NewLockManager(true))
+}
+
+func testKeyLockMapCommon(t *testing.T, lm *LockManager) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	getPolicy := func(name string) *Policy {
+		t.Helper()
+		p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+			Upsert:  true,
+			Storage: storage,
+			KeyType: KeyType_AES256_GCM96,
+			Name:    name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil {
+			t.Fatalf("expected a policy for %q", name)
+		}
+		return p
+	}
+
+	// Create both keys and drop them from the cache so that they are loaded
+	// from storage again
+	for _, name := range []string{"a", "b"} {
+		p := getPolicy(name)
+		if !lm.CacheActive() {
+			p.Unlock()
+		}
+		lm.InvalidatePolicy(name)
+	}
+
+	// An exclusive lock on one key must not block loading another
+	unlockB := lm.keyLocks.lock("b")
+	done := make(chan *Policy)
+	go func() {
+		done <- getPolicy("a")
+	}()
+	select {
+	case p := <-done:
+		if !lm.CacheActive() {
+			p.Unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("loading a key blocked on the lock of another key")
+	}
+
+	// Loading the locked key waits for the lock
+	go func() {
+		done <- getPolicy("b")
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected loading a locked key to wait for its lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlockB()
+	p := <-done
+	if !lm.CacheActive() {
+		p.Unlock()
+	}
+
+	// Locks are dropped once nothing holds them
+	if n := lm.keyLocks.len(); n != 0 {
+		t.Fatalf("expected no locks in use, got %d", n)
+	}
+}
@@ -0,0 +1,117 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// kwpAIVPrefix is the constant half of the alternative initial value defined
+// in RFC 5649
+var kwpAIVPrefix = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+var errKWPInvalidCiphertext = errors.New("invalid wrapped key: unable to unwrap")
+
+// KWPWrap wraps the given key material with the given key encryption key
+// using AES key wrap with padding, as specified in RFC 5649
+func KWPWrap(kek, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 || uint64(len(plaintext)) > 0xffffffff {
+		return nil, errors.New("invalid key length for wrapping")
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pad the plaintext with zeros to a multiple of the semiblock size
+	n := (len(plaintext) + 7) / 8
+	padded := make([]byte, 8*n)
+	copy(padded, plaintext)
+
+	aiv := make([]byte, 8)
+	copy(aiv, kwpAIVPrefix)
+	binary.BigEndian.PutUint32(aiv[4:], uint32(len(plaintext)))
+
+	// A single semiblock is encrypted directly as one AES block
+	if n == 1 {
+		out := make([]byte, 16)
+		block.Encrypt(out, append(aiv, padded...))
+		return out, nil
+	}
+
+	// Otherwise use the RFC 3394 wrapping process with the alternative
+	// initial value
+	a := aiv
+	r := padded
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(b, a)
+			copy(b[8:], r[8*i:8*i+8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(r[8*i:8*i+8], b[8:])
+		}
+	}
+
+	return append(a, r...), nil
+}
+
+// KWPUnwrap unwraps key material that was wrapped with KWPWrap, verifying its
+// integrity
+func KWPUnwrap(kek, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 16 || len(ciphertext)%8 != 0 {
+		return nil, errKWPInvalidCiphertext
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(ciphertext)/8 - 1
+	a := make([]byte, 8)
+	r := make([]byte, 8*n)
+
+	if n == 1 {
+		out := make([]byte, 16)
+		block.Decrypt(out, ciphertext)
+		copy(a, out[:8])
+		copy(r, out[8:])
+	} else {
+		copy(a, ciphertext[:8])
+		copy(r, ciphertext[8:])
+		b := make([]byte, 16)
+		for j := 5; j >= 0; j-- {
+			for i := n - 1; i >= 0; i-- {
+				t := uint64(n*j + i + 1)
+				binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+				copy(b[8:], r[8*i:8*i+8])
+				block.Decrypt(b, b)
+
+				copy(a, b[:8])
+				copy(r[8*i:8*i+8], b[8:])
+			}
+		}
+	}
+
+	// Verify the alternative initial value and the padding
+	if subtle.ConstantTimeCompare(a[:4], kwpAIVPrefix) != 1 {
+		return nil, errKWPInvalidCiphertext
+	}
+	mli := int(binary.BigEndian.Uint32(a[4:]))
+	if mli <= 8*(n-1) || mli > 8*n {
+		return nil, errKWPInvalidCiphertext
+	}
+	for _, p := range r[mli:] {
+		if p != 0 {
+			return nil, errKWPInvalidCiphertext
+		}
+	}
+
+	return r[:mli], nil
+}
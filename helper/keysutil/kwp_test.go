@@ -0,0 +1,56 @@
+package keysutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKWP(t *testing.T) {
+	// Test vectors from RFC 5649 section 6
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	cases := []struct {
+		key     string
+		wrapped string
+	}{
+		{
+			key:     "c37b7e6492584340bed12207808941155068f738",
+			wrapped: "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+		},
+		{
+			key:     "466f7250617369",
+			wrapped: "afbeb0f07dfbf5419200f2ccb50bb24f",
+		},
+	}
+
+	for _, tc := range cases {
+		key, _ := hex.DecodeString(tc.key)
+		expected, _ := hex.DecodeString(tc.wrapped)
+
+		wrapped, err := KWPWrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Fatalf("bad wrapped key for %s: got %x", tc.key, wrapped)
+		}
+
+		unwrapped, err := KWPUnwrap(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("bad unwrapped key for %s: got %x", tc.key, unwrapped)
+		}
+
+		// Any modification must be detected
+		wrapped[len(wrapped)-1] ^= 0x01
+		if _, err := KWPUnwrap(kek, wrapped); err == nil {
+			t.Fatalf("expected error unwrapping modified key for %s", tc.key)
+		}
+	}
+
+	if _, err := KWPUnwrap(kek, []byte("too short")); err == nil {
+		t.Fatal("expected error unwrapping invalid ciphertext")
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
-	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -51,20 +51,28 @@ type PolicyRequest struct {
 
 	// Whether to allow plaintext backup
 	AllowPlaintextBackup bool
+
+	// The period after which the key is rotated automatically
+	AutoRotatePeriod time.Duration
 }
 
 type LockManager struct {
 	useCache bool
-	// If caching is enabled, the map of name to in-memory policy cache
-	cache sync.Map
+	// If caching is enabled, the in-memory policy cache
+	cache *policyCache
 
-	keyLocks []*locksutil.LockEntry
+	// Locks serializing operations that load, create, replace or remove
+	// the stored policy of a key
+	keyLocks *keyLockMap
 }
 
 func NewLockManager(cacheDisabled bool) *LockManager {
+	// An unbounded cache cannot fail to be created
+	cache, _ := newPolicyCache(0)
 	lm := &LockManager{
 		useCache: !cacheDisabled,
-		keyLocks: locksutil.CreateLocks(),
+		cache:    cache,
+		keyLocks: newKeyLockMap(),
 	}
 	return lm
 }
@@ -73,6 +81,27 @@ func (lm *LockManager) CacheActive() bool {
 	return lm.useCache
 }
 
+// CacheSize returns the maximum number of cached policies, or zero if the
+// cache is unbounded
+func (lm *LockManager) CacheSize() int {
+	return lm.cache.Size()
+}
+
+// CacheLen returns the number of policies currently cached
+func (lm *LockManager) CacheLen() int {
+	return lm.cache.Len()
+}
+
+// SetCacheSize changes the maximum number of cached policies, evicting the
+// least recently used policies if needed. A size of zero makes the cache
+// unbounded.
+func (lm *LockManager) SetCacheSize(size int) error {
+	if err := lm.cache.Resize(size); err != nil {
+		return errutil.UserError{Err: err.Error()}
+	}
+	return nil
+}
+
 func (lm *LockManager) InvalidatePolicy(name string) {
 	lm.cache.Delete(name)
 }
@@ -82,13 +111,16 @@ func (lm *LockManager) InvalidatePolicy(name string) {
 func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storage, name, backup string, force bool) error {
 	backupBytes, err := base64.StdEncoding.DecodeString(backup)
 	if err != nil {
-		return err
+		return errutil.UserError{Err: fmt.Sprintf("failed to decode backup: %v", err)}
 	}
 
 	var keyData KeyData
 	err = jsonutil.DecodeJSON(backupBytes, &keyData)
 	if err != nil {
-		return err
+		return errutil.UserError{Err: fmt.Sprintf("failed to parse backup: %v", err)}
+	}
+	if keyData.Policy == nil {
+		return errutil.UserError{Err: "backup does not contain a key"}
 	}
 
 	// Set a different name if desired
@@ -99,16 +131,15 @@ func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storag
 	name = keyData.Policy.Name
 
 	// Grab the exclusive lock as we'll be modifying disk
-	lock := locksutil.LockForKey(lm.keyLocks, name)
-	lock.Lock()
-	defer lock.Unlock()
+	unlock := lm.keyLocks.lock(name)
+	defer unlock()
 
 	// If the policy is in cache and 'force' is not specified, error out. Anywhere
 	// that would put it in the cache will also be protected by the mutex above,
 	// so we don't need to re-check the cache later.
 	pRaw, ok := lm.cache.Load(name)
 	if ok && !force {
-		return fmt.Errorf("key %q already exists", name)
+		return errutil.UserError{Err: fmt.Sprintf("key %q already exists", name)}
 	}
 
 	// Conditionally look up the policy from storage, depending on the use of
@@ -129,7 +160,7 @@ func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storag
 			return err
 		}
 		if p != nil && !force {
-			return fmt.Errorf("key %q already exists", name)
+			return errutil.UserError{Err: fmt.Sprintf("key %q already exists", name)}
 		}
 	}
 
@@ -138,7 +169,7 @@ func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storag
 	// will be no races as nothing else has this pointer. If 'force' was not used,
 	// an error would have been returned by now if the policy already existed
 	if pRaw != nil {
-		p = pRaw.(*Policy)
+		p = pRaw
 	}
 	if p != nil {
 		p.l.Lock()
@@ -179,13 +210,12 @@ func (lm *LockManager) BackupPolicy(ctx context.Context, storage logical.Storage
 
 	// Backup writes information about when the bacup took place, so we get an
 	// exclusive lock here
-	lock := locksutil.LockForKey(lm.keyLocks, name)
-	lock.Lock()
-	defer lock.Unlock()
+	unlock := lm.keyLocks.lock(name)
+	defer unlock()
 
 	pRaw, ok := lm.cache.Load(name)
 	if ok {
-		p = pRaw.(*Policy)
+		p = pRaw
 		p.l.Lock()
 		defer p.l.Unlock()
 	} else {
@@ -195,12 +225,12 @@ func (lm *LockManager) BackupPolicy(ctx context.Context, storage logical.Storage
 			return "", err
 		}
 		if p == nil {
-			return "", fmt.Errorf(fmt.Sprintf("key %q not found", name))
+			return "", errutil.UserError{Err: fmt.Sprintf("key %q not found", name)}
 		}
 	}
 
 	if atomic.LoadUint32(&p.deleted) == 1 {
-		return "", fmt.Errorf(fmt.Sprintf("key %q not found", name))
+		return "", errutil.UserError{Err: fmt.Sprintf("key %q not found", name)}
 	}
 
 	backup, err := p.Backup(ctx, storage)
@@ -212,25 +242,41 @@ func (lm *LockManager) BackupPolicy(ctx context.Context, storage logical.Storage
 }
 
 // When the function returns, if caching was disabled, the Policy's lock must
-// be unlocked when the caller is done (and it should not be re-locked).
+// be unlocked when the caller is done (and it should not be re-locked). If
+// caching is enabled, the policy stays pinned in the cache until the caller
+// unlocks it, or calls Release if it does not lock it.
 func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *Policy, retUpserted bool, retErr error) {
 	var p *Policy
 	var err error
 
 	// Check if it's in our cache. If so, return right away.
-	pRaw, ok := lm.cache.Load(req.Name)
+	pRaw, ok := lm.cache.Acquire(req.Name)
 	if ok {
-		p = pRaw.(*Policy)
+		p = pRaw
 		if atomic.LoadUint32(&p.deleted) == 1 {
+			lm.cache.release(p)
 			return nil, false, nil
 		}
 		return p, false, nil
 	}
 
-	// We're not using the cache, or it wasn't found; get an exclusive lock.
-	// This ensures that any other process writing the actual storage will be
-	// finished before we load from storage.
-	lock := locksutil.LockForKey(lm.keyLocks, req.Name)
+	// Most cache misses are for keys that exist in storage, which only need
+	// a shared lock to load
+	if lm.useCache {
+		p, ok, err := lm.loadPolicyShared(ctx, req)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return p, false, nil
+		}
+	}
+
+	// We're not using the cache, or the policy needs to be created or
+	// upgraded; get an exclusive lock. This ensures that any other process
+	// writing the actual storage will be finished before we load from
+	// storage.
+	lock := lm.keyLocks.acquire(req.Name)
 	lock.Lock()
 
 	// If we are using the cache, defer the lock unlock; otherwise we will
@@ -241,18 +287,21 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 		// themselves
 		case lm.useCache:
 			lock.Unlock()
+			lm.keyLocks.release(req.Name, lock)
 			// If not using the cache, if we aren't returning a policy the caller
 			// doesn't have a lock, so we must unlock
 		case retP == nil:
 			lock.Unlock()
+			lm.keyLocks.release(req.Name, lock)
 		}
 	}
 
 	// Check the cache again
-	pRaw, ok = lm.cache.Load(req.Name)
+	pRaw, ok = lm.cache.Acquire(req.Name)
 	if ok {
-		p = pRaw.(*Policy)
+		p = pRaw
 		if atomic.LoadUint32(&p.deleted) == 1 {
+			lm.cache.release(p)
 			cleanup()
 			return nil, false, nil
 		}
@@ -271,8 +320,9 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 	// the pointer
 
 	if p == nil {
-		// This is the only place we upsert a new policy, so if upsert is not
-		// specified, or the lock type is wrong, unlock before returning
+		// Apart from imports, this is the only place we create a new policy,
+		// so if upsert is not specified, or the lock type is wrong, unlock
+		// before returning
 		if !req.Upsert {
 			cleanup()
 			return nil, false, nil
@@ -283,56 +333,10 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 		// to the user to let them know that their request can't be satisfied
 		// because we don't know if the parameters match.
 
-		switch req.KeyType {
-		case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
-			if req.Convergent && !req.Derived {
-				cleanup()
-				return nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
-			}
-
-		case KeyType_ECDSA_P256:
-			if req.Derived || req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		case KeyType_ED25519:
-			if req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		case KeyType_RSA2048, KeyType_RSA4096:
-			if req.Derived || req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		default:
+		p, err = newPolicy(req)
+		if err != nil {
 			cleanup()
-			return nil, false, fmt.Errorf("unsupported key type %v", req.KeyType)
-		}
-
-		p = &Policy{
-			l:                    new(sync.RWMutex),
-			Name:                 req.Name,
-			Type:                 req.KeyType,
-			Derived:              req.Derived,
-			Exportable:           req.Exportable,
-			AllowPlaintextBackup: req.AllowPlaintextBackup,
-		}
-
-		if req.Derived {
-			p.KDF = Kdf_hkdf_sha256
-			if req.Convergent {
-				p.ConvergentEncryption = true
-				// As of version 3 we store the version within each key, so we
-				// set to -1 to indicate that the value in the policy has no
-				// meaning. We still, for backwards compatibility, fall back to
-				// this value if the key doesn't have one, which means it will
-				// only be -1 in the case where every key version is >= 3
-				p.ConvergentVersion = -1
-			}
+			return nil, false, err
 		}
 
 		// Performs the actual persist and does setup
@@ -343,10 +347,11 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 		}
 
 		if lm.useCache {
-			lm.cache.Store(req.Name, p)
+			p = lm.cache.AcquireOrStore(req.Name, p)
 		} else {
 			p.l = &lock.RWMutex
 			p.writeLocked = true
+			p.release = func() { lm.keyLocks.release(req.Name, lock) }
 		}
 
 		// We don't need to worry about upgrading since it will be a new policy
@@ -364,10 +369,11 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 	}
 
 	if lm.useCache {
-		lm.cache.Store(req.Name, p)
+		p = lm.cache.AcquireOrStore(req.Name, p)
 	} else {
 		p.l = &lock.RWMutex
 		p.writeLocked = true
+		p.release = func() { lm.keyLocks.release(req.Name, lock) }
 	}
 
 	retP = p
@@ -375,6 +381,72 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 	return
 }
 
+// loadPolicyShared loads an existing policy into the cache while holding only
+// a shared lock on its name, so that concurrent loads do not serialize. It
+// returns false if the exclusive lock is needed instead, because the policy
+// has to be created or upgraded.
+func (lm *LockManager) loadPolicyShared(ctx context.Context, req PolicyRequest) (*Policy, bool, error) {
+	unlock := lm.keyLocks.rlock(req.Name)
+	defer unlock()
+
+	p, err := lm.getPolicyFromStorage(ctx, req.Storage, req.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case p == nil && !req.Upsert:
+		return nil, true, nil
+	case p == nil, p.NeedsUpgrade():
+		return nil, false, nil
+	}
+
+	// Another request may have loaded the policy in the meantime, in which
+	// case its copy is the one everyone must share
+	p = lm.cache.AcquireOrStore(req.Name, p)
+	if atomic.LoadUint32(&p.deleted) == 1 {
+		lm.cache.release(p)
+		return nil, true, nil
+	}
+	return p, true, nil
+}
+
+// ImportPolicy creates a new policy whose first version uses the given key
+// material instead of a generated key. It is an error for the policy to
+// already exist.
+func (lm *LockManager) ImportPolicy(ctx context.Context, req PolicyRequest, key []byte) error {
+	// Grab the exclusive lock as we'll be modifying disk
+	unlock := lm.keyLocks.lock(req.Name)
+	defer unlock()
+
+	if _, ok := lm.cache.Load(req.Name); ok {
+		return errutil.UserError{Err: fmt.Sprintf("key %q already exists", req.Name)}
+	}
+
+	existing, err := lm.getPolicyFromStorage(ctx, req.Storage, req.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errutil.UserError{Err: fmt.Sprintf("key %q already exists", req.Name)}
+	}
+
+	p, err := newPolicy(req)
+	if err != nil {
+		return err
+	}
+
+	// Performs the actual persist
+	if err := p.ImportKey(ctx, req.Storage, key); err != nil {
+		return err
+	}
+
+	if lm.useCache {
+		lm.cache.Store(req.Name, p)
+	}
+
+	return nil
+}
+
 func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage, name string) error {
 	var p *Policy
 	var err error
@@ -382,13 +454,12 @@ func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage
 	// We may be writing to disk, so grab an exclusive lock. This prevents bad
 	// behavior when the cache is turned off. We also lock the shared policy
 	// object to make sure no requests are in flight.
-	lock := locksutil.LockForKey(lm.keyLocks, name)
-	lock.Lock()
-	defer lock.Unlock()
+	unlock := lm.keyLocks.lock(name)
+	defer unlock()
 
 	pRaw, ok := lm.cache.Load(name)
 	if ok {
-		p = pRaw.(*Policy)
+		p = pRaw
 		p.l.Lock()
 		defer p.l.Unlock()
 	}
@@ -399,12 +470,12 @@ func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage
 			return err
 		}
 		if p == nil {
-			return fmt.Errorf("could not delete key; not found")
+			return errutil.UserError{Err: "could not delete key; not found"}
 		}
 	}
 
 	if !p.DeletionAllowed {
-		return fmt.Errorf("deletion is not allowed for this key")
+		return errutil.UserError{Err: "deletion is not allowed for this key"}
 	}
 
 	atomic.StoreUint32(&p.deleted, 1)
@@ -424,6 +495,60 @@ func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage
 	return nil
 }
 
+// newPolicy validates the parameters of the request and returns a new policy
+// without any key versions
+func newPolicy(req PolicyRequest) (*Policy, error) {
+	switch req.KeyType {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		if req.Convergent && !req.Derived {
+			return nil, errutil.UserError{Err: "convergent encryption requires derivation to be enabled"}
+		}
+
+	case KeyType_ECDSA_P256:
+		if req.Derived || req.Convergent {
+			return nil, errutil.UserError{Err: fmt.Sprintf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)}
+		}
+
+	case KeyType_ED25519:
+		if req.Convergent {
+			return nil, errutil.UserError{Err: fmt.Sprintf("convergent encryption not supported for keys of type %v", req.KeyType)}
+		}
+
+	case KeyType_RSA2048, KeyType_RSA4096:
+		if req.Derived || req.Convergent {
+			return nil, errutil.UserError{Err: fmt.Sprintf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)}
+		}
+
+	default:
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported key type %v", req.KeyType)}
+	}
+
+	p := &Policy{
+		l:                    new(sync.RWMutex),
+		Name:                 req.Name,
+		Type:                 req.KeyType,
+		Derived:              req.Derived,
+		Exportable:           req.Exportable,
+		AllowPlaintextBackup: req.AllowPlaintextBackup,
+		AutoRotatePeriod:     req.AutoRotatePeriod,
+	}
+
+	if req.Derived {
+		p.KDF = Kdf_hkdf_sha256
+		if req.Convergent {
+			p.ConvergentEncryption = true
+			// As of version 3 we store the version within each key, so we
+			// set to -1 to indicate that the value in the policy has no
+			// meaning. We still, for backwards compatibility, fall back to
+			// this value if the key doesn't have one, which means it will
+			// only be -1 in the case where every key version is >= 3
+			p.ConvergentVersion = -1
+		}
+	}
+
+	return p, nil
+}
+
 func (lm *LockManager) getPolicyFromStorage(ctx context.Context, storage logical.Storage, name string) (*Policy, error) {
 	return LoadPolicy(ctx, storage, "policy/"+name)
 }
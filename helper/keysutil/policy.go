@@ -15,6 +15,7 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -55,6 +56,7 @@ const (
 	KeyType_RSA2048
 	KeyType_RSA4096
 	KeyType_ChaCha20_Poly1305
+	KeyType_AES128_GCM96
 )
 
 const (
@@ -89,7 +91,7 @@ type KeyType int
 
 func (kt KeyType) EncryptionSupported() bool {
 	switch kt {
-	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_RSA2048, KeyType_RSA4096:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_RSA2048, KeyType_RSA4096:
 		return true
 	}
 	return false
@@ -97,7 +99,7 @@ func (kt KeyType) EncryptionSupported() bool {
 
 func (kt KeyType) DecryptionSupported() bool {
 	switch kt {
-	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_RSA2048, KeyType_RSA4096:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_RSA2048, KeyType_RSA4096:
 		return true
 	}
 	return false
@@ -121,7 +123,7 @@ func (kt KeyType) HashSignatureInput() bool {
 
 func (kt KeyType) DerivationSupported() bool {
 	switch kt {
-	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519:
 		return true
 	}
 	return false
@@ -129,6 +131,8 @@ func (kt KeyType) DerivationSupported() bool {
 
 func (kt KeyType) String() string {
 	switch kt {
+	case KeyType_AES128_GCM96:
+		return "aes128-gcm96"
 	case KeyType_AES256_GCM96:
 		return "aes256-gcm96"
 	case KeyType_ChaCha20_Poly1305:
@@ -146,6 +150,15 @@ func (kt KeyType) String() string {
 	return "[unknown]"
 }
 
+// symmetricKeySize returns the size in bytes of the key used by symmetric key
+// types
+func (kt KeyType) symmetricKeySize() int {
+	if kt == KeyType_AES128_GCM96 {
+		return 16
+	}
+	return 32
+}
+
 type KeyData struct {
 	Policy       *Policy       `json:"policy"`
 	ArchivedKeys *archivedKeys `json:"archived_keys"`
@@ -180,6 +193,16 @@ type KeyEntry struct {
 	DeprecatedCreationTime int64 `json:"creation_time"`
 }
 
+// GetCreationTime returns the time the key version was created, falling back
+// to the deprecated creation time. Versions that predate the recording of
+// creation times return the zero time.
+func (ke KeyEntry) GetCreationTime() time.Time {
+	if ke.CreationTime.IsZero() && ke.DeprecatedCreationTime != 0 {
+		return time.Unix(ke.DeprecatedCreationTime, 0)
+	}
+	return ke.CreationTime
+}
+
 // deprecatedKeyEntryMap is used to allow JSON marshal/unmarshal
 type deprecatedKeyEntryMap map[int]KeyEntry
 
@@ -294,6 +317,15 @@ type Policy struct {
 	l *sync.RWMutex
 	// writeLocked allows us to implement Lock() and Unlock()
 	writeLocked bool
+	// release, if set, is called by Unlock() to hand back a lock borrowed
+	// from the LockManager when caching is disabled
+	release func()
+	// cache is the policy cache holding this policy, if caching is enabled.
+	// Unlock() hands the policy back to it so that it can be evicted again.
+	cache *policyCache
+	// pins is the number of requests using the policy; it is protected by
+	// the cache's lock
+	pins int
 	// Stores whether it's been deleted. This acts as a guard for operations
 	// that may write data, e.g. if one request rotates and that request is
 	// served after a delete.
@@ -336,6 +368,15 @@ type Policy struct {
 	// Whether the key is allowed to be deleted
 	DeletionAllowed bool `json:"deletion_allowed"`
 
+	// AutoRotatePeriod is the period after which the key is rotated
+	// automatically. A value of zero disables automatic rotation.
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
+
+	// AutoRotateStartTime is the time from which the auto rotate period is
+	// counted when the creation time of the latest version is unknown, as for
+	// keys migrated from the legacy single-key format
+	AutoRotateStartTime time.Time `json:"auto_rotate_start_time"`
+
 	// The version of the convergent nonce to use
 	ConvergentVersion int `json:"convergent_version"`
 
@@ -383,6 +424,34 @@ func (p *Policy) Unlock() {
 	} else {
 		p.l.RUnlock()
 	}
+
+	if p.release != nil {
+		release := p.release
+		p.release = nil
+		release()
+	}
+
+	if p.cache != nil {
+		p.cache.release(p)
+	}
+}
+
+// Release hands back a policy returned by the LockManager's GetPolicy when the
+// caller does not lock it. With caching disabled GetPolicy returns the policy
+// locked, so this unlocks it.
+func (p *Policy) Release() {
+	switch {
+	case p.release != nil:
+		p.Unlock()
+	case p.cache != nil:
+		p.cache.release(p)
+	}
+}
+
+// LastRotationTime returns the time at which the latest version of the key
+// was created
+func (p *Policy) LastRotationTime() time.Time {
+	return p.Keys[strconv.Itoa(p.LatestVersion)].GetCreationTime()
 }
 
 // ArchivedKeys stores old keys. This is used to keep the key loading time sane
@@ -723,7 +792,7 @@ func (p *Policy) DeriveKey(context []byte, ver, numBytes int) ([]byte, error) {
 		}
 
 		switch p.Type {
-		case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
 			n, err := derBytes.ReadFrom(limReader)
 			if err != nil {
 				return nil, errutil.InternalError{Err: fmt.Sprintf("error reading returned derived bytes: %v", err)}
@@ -770,6 +839,13 @@ func (p *Policy) convergentVersion(ver int) int {
 }
 
 func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string, error) {
+	return p.EncryptWithAAD(ver, context, nonce, value, nil)
+}
+
+// EncryptWithAAD encrypts the given base64-encoded value, binding the
+// ciphertext to the given additional authenticated data. The same data must
+// be supplied to DecryptWithAAD for decryption to succeed.
+func (p *Policy) EncryptWithAAD(ver int, context, nonce []byte, value string, aad []byte) (string, error) {
 	if !p.Type.EncryptionSupported() {
 		return "", errutil.UserError{Err: fmt.Sprintf("message encryption not supported for key type %v", p.Type)}
 	}
@@ -794,17 +870,18 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 	var ciphertext []byte
 
 	switch p.Type {
-	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
 		hmacKey := context
 
 		var aead cipher.AEAD
 		var encKey []byte
 		var deriveHMAC bool
 
-		numBytes := 32
+		encBytes := p.Type.symmetricKeySize()
+		numBytes := encBytes
 		if p.convergentVersion(ver) > 2 {
 			deriveHMAC = true
-			numBytes = 64
+			numBytes += 32
 		}
 		key, err := p.DeriveKey(context, ver, numBytes)
 		if err != nil {
@@ -815,19 +892,19 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 			return "", errutil.InternalError{Err: "could not derive key, length too small"}
 		}
 
-		encKey = key[:32]
-		if len(encKey) != 32 {
+		encKey = key[:encBytes]
+		if len(encKey) != encBytes {
 			return "", errutil.InternalError{Err: "could not derive enc key, length not correct"}
 		}
 		if deriveHMAC {
-			hmacKey = key[32:]
+			hmacKey = key[encBytes:]
 			if len(hmacKey) != 32 {
 				return "", errutil.InternalError{Err: "could not derive hmac key, length not correct"}
 			}
 		}
 
 		switch p.Type {
-		case KeyType_AES256_GCM96:
+		case KeyType_AES128_GCM96, KeyType_AES256_GCM96:
 			// Setup the cipher
 			aesCipher, err := aes.NewCipher(encKey)
 			if err != nil {
@@ -864,6 +941,16 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 				}
 				nonceHmac := hmac.New(sha256.New, hmacKey)
 				nonceHmac.Write(plaintext)
+				if len(aad) != 0 {
+					// Mix the associated data into the nonce so the same
+					// plaintext under different associated data does not
+					// reuse a nonce; the length suffix keeps the input
+					// unambiguous
+					nonceHmac.Write(aad)
+					aadLen := make([]byte, 8)
+					binary.BigEndian.PutUint64(aadLen, uint64(len(aad)))
+					nonceHmac.Write(aadLen)
+				}
 				nonceSum := nonceHmac.Sum(nil)
 				nonce = nonceSum[:aead.NonceSize()]
 			default:
@@ -878,7 +965,7 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 		}
 
 		// Encrypt and tag with AEAD
-		ciphertext = aead.Seal(nil, nonce, plaintext, nil)
+		ciphertext = aead.Seal(nil, nonce, plaintext, aad)
 
 		// Place the encrypted data after the nonce
 		if !p.ConvergentEncryption || p.convergentVersion(ver) > 1 {
@@ -886,7 +973,23 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 		}
 
 	case KeyType_RSA2048, KeyType_RSA4096:
+		if len(context) != 0 {
+			return "", errutil.UserError{Err: fmt.Sprintf("key derivation is not supported for keys of type %v; context must not be provided", p.Type)}
+		}
+
+		if len(aad) != 0 {
+			return "", errutil.UserError{Err: fmt.Sprintf("associated data is not supported for keys of type %v", p.Type)}
+		}
+
 		key := p.Keys[strconv.Itoa(ver)].RSAKey
+
+		// OAEP with SHA-256 limits the size of the message that can be
+		// encrypted based on the size of the modulus
+		maxPlaintextLen := key.Size() - 2*sha256.Size - 2
+		if len(plaintext) > maxPlaintextLen {
+			return "", errutil.UserError{Err: fmt.Sprintf("plaintext is too large for keys of type %v; the maximum length is %d bytes", p.Type, maxPlaintextLen)}
+		}
+
 		ciphertext, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, plaintext, nil)
 		if err != nil {
 			return "", errutil.InternalError{Err: fmt.Sprintf("failed to RSA encrypt the plaintext: %v", err)}
@@ -906,6 +1009,12 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 }
 
 func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
+	return p.DecryptWithAAD(context, nonce, value, nil)
+}
+
+// DecryptWithAAD decrypts the given ciphertext, verifying it against the
+// additional authenticated data that was supplied at encryption time.
+func (p *Policy) DecryptWithAAD(context, nonce []byte, value string, aad []byte) (string, error) {
 	if !p.Type.DecryptionSupported() {
 		return "", errutil.UserError{Err: fmt.Sprintf("message decryption not supported for key type %v", p.Type)}
 	}
@@ -958,20 +1067,21 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 	var plain []byte
 
 	switch p.Type {
-	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
 		var aead cipher.AEAD
 
-		encKey, err := p.DeriveKey(context, ver, 32)
+		encBytes := p.Type.symmetricKeySize()
+		encKey, err := p.DeriveKey(context, ver, encBytes)
 		if err != nil {
 			return "", err
 		}
 
-		if len(encKey) != 32 {
+		if len(encKey) != encBytes {
 			return "", errutil.InternalError{Err: "could not derive enc key, length not correct"}
 		}
 
 		switch p.Type {
-		case KeyType_AES256_GCM96:
+		case KeyType_AES128_GCM96, KeyType_AES256_GCM96:
 			// Setup the cipher
 			aesCipher, err := aes.NewCipher(encKey)
 			if err != nil {
@@ -1009,16 +1119,24 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 		}
 
 		// Verify and Decrypt
-		plain, err = aead.Open(nil, nonce, ciphertext, nil)
+		plain, err = aead.Open(nil, nonce, ciphertext, aad)
 		if err != nil {
 			return "", errutil.UserError{Err: "invalid ciphertext: unable to decrypt"}
 		}
 
 	case KeyType_RSA2048, KeyType_RSA4096:
+		if len(context) != 0 {
+			return "", errutil.UserError{Err: fmt.Sprintf("key derivation is not supported for keys of type %v; context must not be provided", p.Type)}
+		}
+
+		if len(aad) != 0 {
+			return "", errutil.UserError{Err: fmt.Sprintf("associated data is not supported for keys of type %v", p.Type)}
+		}
+
 		key := p.Keys[strconv.Itoa(ver)].RSAKey
 		plain, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, decoded, nil)
 		if err != nil {
-			return "", errutil.InternalError{Err: fmt.Sprintf("failed to RSA decrypt the ciphertext: %v", err)}
+			return "", errutil.UserError{Err: "invalid ciphertext: unable to decrypt"}
 		}
 
 	default:
@@ -1045,7 +1163,7 @@ func (p *Policy) HMACKey(version int) ([]byte, error) {
 
 func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm, sigAlgorithm string) (*SigningResult, error) {
 	if !p.Type.SigningSupported() {
-		return nil, fmt.Errorf("message signing not supported for key type %v", p.Type)
+		return nil, errutil.UserError{Err: fmt.Sprintf("message signing not supported for key type %v", p.Type)}
 	}
 
 	switch {
@@ -1094,6 +1212,9 @@ func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm, sigAlgorith
 			var err error
 			key, err = p.DeriveKey(context, ver, 32)
 			if err != nil {
+				if _, ok := err.(errutil.UserError); ok {
+					return nil, err
+				}
 				return nil, errutil.InternalError{Err: fmt.Sprintf("error deriving key: %v", err)}
 			}
 			pubKey = key.Public().(ed25519.PublicKey)
@@ -1122,7 +1243,7 @@ func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm, sigAlgorith
 		case "sha2-512":
 			algo = crypto.SHA512
 		default:
-			return nil, errutil.InternalError{Err: fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)}
+			return nil, errutil.UserError{Err: fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)}
 		}
 
 		if sigAlgorithm == "" {
@@ -1141,7 +1262,7 @@ func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm, sigAlgorith
 				return nil, err
 			}
 		default:
-			return nil, errutil.InternalError{Err: fmt.Sprintf("unsupported rsa signature algorithm %s", sigAlgorithm)}
+			return nil, errutil.UserError{Err: fmt.Sprintf("unsupported rsa signature algorithm %s", sigAlgorithm)}
 		}
 
 	default:
@@ -1224,6 +1345,9 @@ func (p *Policy) VerifySignature(context, input []byte, sig, hashAlgorithm strin
 			var err error
 			key, err = p.DeriveKey(context, ver, 32)
 			if err != nil {
+				if _, ok := err.(errutil.UserError); ok {
+					return false, err
+				}
 				return false, errutil.InternalError{Err: fmt.Sprintf("error deriving key: %v", err)}
 			}
 		} else {
@@ -1246,7 +1370,7 @@ func (p *Policy) VerifySignature(context, input []byte, sig, hashAlgorithm strin
 		case "sha2-512":
 			algo = crypto.SHA512
 		default:
-			return false, errutil.InternalError{Err: fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)}
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)}
 		}
 
 		if sigAlgorithm == "" {
@@ -1259,7 +1383,7 @@ func (p *Policy) VerifySignature(context, input []byte, sig, hashAlgorithm strin
 		case "pkcs1v15":
 			err = rsa.VerifyPKCS1v15(&key.PublicKey, algo, input, sigBytes)
 		default:
-			return false, errutil.InternalError{Err: fmt.Sprintf("unsupported rsa signature algorithm %s", sigAlgorithm)}
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported rsa signature algorithm %s", sigAlgorithm)}
 		}
 
 		return err == nil, nil
@@ -1269,7 +1393,29 @@ func (p *Policy) VerifySignature(context, input []byte, sig, hashAlgorithm strin
 	}
 }
 
-func (p *Policy) Rotate(ctx context.Context, storage logical.Storage) (retErr error) {
+func (p *Policy) Rotate(ctx context.Context, storage logical.Storage) error {
+	return p.rotate(ctx, storage, nil)
+}
+
+// ImportKey adds a new key version that uses the given key material instead of
+// a generated key. Only symmetric key types can be imported.
+func (p *Policy) ImportKey(ctx context.Context, storage logical.Storage, key []byte) error {
+	switch p.Type {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		if len(key) != p.Type.symmetricKeySize() {
+			return errutil.UserError{Err: fmt.Sprintf("imported key must be %d bytes long for keys of type %v", p.Type.symmetricKeySize(), p.Type)}
+		}
+	default:
+		return errutil.UserError{Err: fmt.Sprintf("importing keys of type %v is not supported", p.Type)}
+	}
+
+	return p.rotate(ctx, storage, key)
+}
+
+// rotate adds a new key version and persists the policy. If importedKey is
+// set it is used as the key material of a symmetric key; otherwise a new key
+// is generated.
+func (p *Policy) rotate(ctx context.Context, storage logical.Storage, importedKey []byte) (retErr error) {
 	priorLatestVersion := p.LatestVersion
 	priorMinDecryptionVersion := p.MinDecryptionVersion
 	var priorKeys keyEntryMap
@@ -1310,9 +1456,14 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage) (retErr er
 	entry.HMACKey = hmacKey
 
 	switch p.Type {
-	case KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
-		// Generate a 256bit key
-		newKey, err := uuid.GenerateRandomBytes(32)
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		if importedKey != nil {
+			entry.Key = importedKey
+			break
+		}
+
+		// Generate a key of the size required by the cipher
+		newKey, err := uuid.GenerateRandomBytes(p.Type.symmetricKeySize())
 		if err != nil {
 			return err
 		}
@@ -1379,12 +1530,11 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage) (retErr er
 }
 
 func (p *Policy) MigrateKeyToKeysMap() {
-	now := time.Now()
+	// The creation time of the original key was never recorded, so it is left
+	// as the zero time rather than claiming the key was created now
 	p.Keys = keyEntryMap{
 		"1": KeyEntry{
-			Key:                    p.Key,
-			CreationTime:           now,
-			DeprecatedCreationTime: now.Unix(),
+			Key: p.Key,
 		},
 	}
 	p.Key = nil
@@ -1392,12 +1542,8 @@ func (p *Policy) MigrateKeyToKeysMap() {
 
 // Backup should be called with an exclusive lock held on the policy
 func (p *Policy) Backup(ctx context.Context, storage logical.Storage) (out string, retErr error) {
-	if !p.Exportable {
-		return "", fmt.Errorf("exporting is disallowed on the policy")
-	}
-
 	if !p.AllowPlaintextBackup {
-		return "", fmt.Errorf("plaintext backup is disallowed on the policy")
+		return "", errutil.UserError{Err: "plaintext backup is disallowed on the policy"}
 	}
 
 	priorBackupInfo := p.BackupInfo
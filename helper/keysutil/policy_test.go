@@ -94,6 +94,9 @@ func testKeyUpgradeCommon(t *testing.T, lm *LockManager) {
 	if !reflect.DeepEqual(testBytes, p.Keys["1"].Key) {
 		t.Fatal("key mismatch")
 	}
+	if !p.Keys["1"].GetCreationTime().IsZero() {
+		t.Fatalf("expected unknown creation time to be zero, got %v", p.Keys["1"].GetCreationTime())
+	}
 }
 
 func Test_ArchivingUpgrade(t *testing.T) {
@@ -418,6 +421,84 @@ func checkKeys(t *testing.T,
 	}
 }
 
+func Test_ArchivingDecrypt(t *testing.T) {
+	testArchivingDecryptCommon(t, NewLockManager(false))
+	testArchivingDecryptCommon(t, NewLockManager(true))
+}
+
+func testArchivingDecryptCommon(t *testing.T, lm *LockManager) {
+	ctx := context.Background()
+
+	storage := &logical.InmemStorage{}
+	p, _, err := lm.GetPolicy(ctx, PolicyRequest{
+		Upsert:  true,
+		Storage: storage,
+		KeyType: KeyType_AES256_GCM96,
+		Name:    "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil {
+		t.Fatal("nil policy")
+	}
+	if !lm.useCache {
+		p.Unlock()
+	}
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA=="
+	ciphertext, err := p.Encrypt(0, nil, nil, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 2; i <= 5; i++ {
+		if err := p.Rotate(ctx, storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Move version 1 out of the live policy and into the archive
+	p.MinDecryptionVersion = 5
+	if err := p.Persist(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Keys["1"]; ok {
+		t.Fatal("expected version 1 to be archived")
+	}
+	_, err = p.Decrypt(nil, nil, ciphertext)
+	if err == nil || err.Error() != ErrTooOld {
+		t.Fatalf("expected too old error, got %v", err)
+	}
+
+	// Moving the minimum back down must restore the archived version
+	p.MinDecryptionVersion = 1
+	if err := p.Persist(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load the policy fresh from storage to ensure the archive was used
+	p, _, err = NewLockManager(true).GetPolicy(ctx, PolicyRequest{
+		Storage: storage,
+		Name:    "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil {
+		t.Fatal("nil policy")
+	}
+	p.Unlock()
+
+	decrypted, err := p.Decrypt(nil, nil, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != plaintext {
+		t.Fatalf("bad: expected %q, got %q", plaintext, decrypted)
+	}
+}
+
 func Test_StorageErrorSafety(t *testing.T) {
 	ctx := context.Background()
 	lm := NewLockManager(false)
@@ -488,6 +569,8 @@ func Test_BadUpgrade(t *testing.T) {
 		t.Fatal(err)
 	}
 	orig.(*Policy).l = p.l
+	orig.(*Policy).cache = p.cache
+	orig.(*Policy).pins = p.pins
 
 	p.Key = p.Keys["1"].Key
 	p.Keys = nil
@@ -500,6 +583,7 @@ func Test_BadUpgrade(t *testing.T) {
 	k := p.Keys["1"]
 	o := orig.(*Policy).Keys["1"]
 	k.CreationTime = o.CreationTime
+	k.DeprecatedCreationTime = o.DeprecatedCreationTime
 	k.HMACKey = o.HMACKey
 	p.Keys["1"] = k
 	p.versionPrefixCache = sync.Map{}
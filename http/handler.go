@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/textproto"
@@ -444,28 +445,50 @@ func (fs *UIAssetWrapper) Open(name string) (http.File, error) {
 	return nil, err
 }
 
-func parseRequest(r *http.Request, w http.ResponseWriter, out interface{}) error {
-	// Limit the maximum number of bytes to MaxRequestSize to protect
-	// against an indefinite amount of data being read.
+// requestBodyReader returns a reader for the request body that is limited to
+// MaxRequestSize to protect against an indefinite amount of data being read.
+func requestBodyReader(r *http.Request, w http.ResponseWriter) (io.Reader, error) {
 	reader := r.Body
 	ctx := r.Context()
 	maxRequestSize := ctx.Value("max_request_size")
 	if maxRequestSize != nil {
 		max, ok := maxRequestSize.(int64)
 		if !ok {
-			return errors.New("could not parse max_request_size from request context")
+			return nil, errors.New("could not parse max_request_size from request context")
 		}
 		if max > 0 {
 			reader = http.MaxBytesReader(w, r.Body, max)
 		}
 	}
-	err := jsonutil.DecodeJSONFromReader(reader, out)
+	return reader, nil
+}
+
+func parseRequest(r *http.Request, w http.ResponseWriter, out interface{}) error {
+	reader, err := requestBodyReader(r, w)
+	if err != nil {
+		return err
+	}
+	err = jsonutil.DecodeJSONFromReader(reader, out)
 	if err != nil && err != io.EOF {
 		return errwrap.Wrapf("failed to parse JSON input: {{err}}", err)
 	}
 	return err
 }
 
+// parseRawRequest reads the request body without decoding it, for requests
+// whose body is not JSON
+func parseRawRequest(r *http.Request, w http.ResponseWriter) ([]byte, error) {
+	reader, err := requestBodyReader(r, w)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read request body: {{err}}", err)
+	}
+	return body, nil
+}
+
 // handleRequestForwarding determines whether to forward a request or not,
 // falling back on the older behavior of redirecting the client
 func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handler {
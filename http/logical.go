@@ -77,6 +77,19 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 
 	case "POST", "PUT":
 		op = logical.UpdateOperation
+		// OCSP requests are DER encoded rather than JSON, so hand the body to
+		// the backend as is
+		if r.Header.Get("Content-Type") == "application/ocsp-request" {
+			body, err := parseRawRequest(r, w)
+			if err != nil {
+				return nil, http.StatusBadRequest, err
+			}
+			data = map[string]interface{}{
+				logical.HTTPRawBody: body,
+			}
+			break
+		}
+
 		// Parse the request if we can
 		if op == logical.UpdateOperation {
 			err := parseRequest(r, w, &data)
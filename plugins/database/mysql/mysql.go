@@ -28,6 +28,10 @@ const (
 		ALTER USER '{{username}}'@'%' IDENTIFIED BY '{{password}}';
 	`
 
+	defaultMySQLSetCredentialsSQL = `
+		ALTER USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';
+	`
+
 	mySQLTypeName = "mysql"
 )
 
@@ -39,6 +43,7 @@ var (
 )
 
 var _ dbplugin.Database = &MySQL{}
+var _ dbplugin.StaticUserDatabase = &MySQL{}
 
 type MySQL struct {
 	*connutil.SQLConnectionProducer
@@ -315,3 +320,56 @@ func (m *MySQL) RotateRootCredentials(ctx context.Context, statements []string)
 	m.RawConfig["password"] = password
 	return m.RawConfig, nil
 }
+
+func (m *MySQL) SetCredentials(ctx context.Context, statements []string, username, password string) error {
+	if len(username) == 0 {
+		return errors.New("username is required to set credentials")
+	}
+	if len(password) == 0 {
+		return errors.New("password is required to set credentials")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	rotateStmts := statements
+	if len(rotateStmts) == 0 {
+		rotateStmts = []string{defaultMySQLSetCredentialsSQL}
+	}
+
+	db, err := m.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	for _, stmt := range rotateStmts {
+		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
+			query = strings.TrimSpace(query)
+			if len(query) == 0 {
+				continue
+			}
+
+			m := map[string]string{
+				"name":     username,
+				"password": password,
+			}
+			if err := dbtxn.ExecuteTxQuery(ctx, tx, m, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -27,10 +27,14 @@ ALTER ROLE "{{name}}" VALID UNTIL '{{expiration}}';
 `
 	defaultPostgresRotateRootCredentialsSQL = `
 ALTER ROLE "{{username}}" WITH PASSWORD '{{password}}';
+`
+	defaultPostgresSetCredentialsSQL = `
+ALTER ROLE "{{name}}" WITH PASSWORD '{{password}}';
 `
 )
 
 var _ dbplugin.Database = &PostgreSQL{}
+var _ dbplugin.StaticUserDatabase = &PostgreSQL{}
 
 // New implements builtinplugins.BuiltinFactory
 func New() (interface{}, error) {
@@ -425,3 +429,56 @@ func (p *PostgreSQL) RotateRootCredentials(ctx context.Context, statements []str
 	p.RawConfig["password"] = password
 	return p.RawConfig, nil
 }
+
+func (p *PostgreSQL) SetCredentials(ctx context.Context, statements []string, username, password string) error {
+	if len(username) == 0 {
+		return errors.New("username is required to set credentials")
+	}
+	if len(password) == 0 {
+		return errors.New("password is required to set credentials")
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	rotateStmts := statements
+	if len(rotateStmts) == 0 {
+		rotateStmts = []string{defaultPostgresSetCredentialsSQL}
+	}
+
+	db, err := p.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	for _, stmt := range rotateStmts {
+		for _, query := range strutil.ParseArbitraryStringSlice(stmt, ";") {
+			query = strings.TrimSpace(query)
+			if len(query) == 0 {
+				continue
+			}
+
+			m := map[string]string{
+				"name":     username,
+				"password": password,
+			}
+			if err := dbtxn.ExecuteTxQuery(ctx, tx, m, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
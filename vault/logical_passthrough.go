@@ -2,12 +2,17 @@ package vault
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/errwrap"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/wrapping"
 	"github.com/hashicorp/vault/logical"
@@ -29,8 +34,20 @@ func LeasedPassthroughBackendFactory(ctx context.Context, conf *logical.BackendC
 // LeaseSwitchedPassthroughBackend returns a PassthroughBackend
 // with leases switched on or off
 func LeaseSwitchedPassthroughBackend(ctx context.Context, conf *logical.BackendConfig, leases bool) (logical.Backend, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("configuration passed into backend is nil")
+	}
+
 	var b PassthroughBackend
 	b.generateLeases = leases
+	b.expireLocks = locksutil.CreateLocks()
+	if maxSizeRaw, ok := conf.Config["max_secret_size"]; ok {
+		maxSize, err := parseutil.ParseInt(maxSizeRaw)
+		if err != nil || maxSize < 0 {
+			return nil, fmt.Errorf("invalid max_secret_size %q", maxSizeRaw)
+		}
+		b.maxSecretSize = int(maxSize)
+	}
 	b.Backend = &framework.Backend{
 		Help: strings.TrimSpace(passthroughHelp),
 
@@ -61,6 +78,13 @@ func LeaseSwitchedPassthroughBackend(ctx context.Context, conf *logical.BackendC
 		BackendType: logical.TypeLogical,
 	}
 
+	// Secrets written with delete_on_expire are removed by a periodic sweep
+	// rather than by a lease, so that revoking the token that wrote them
+	// doesn't delete them early
+	if leases {
+		b.Backend.PeriodicFunc = b.handlePeriodic
+	}
+
 	b.Backend.Secrets = []*framework.Secret{
 		&framework.Secret{
 			Type: "kv",
@@ -70,9 +94,6 @@ func LeaseSwitchedPassthroughBackend(ctx context.Context, conf *logical.BackendC
 		},
 	}
 
-	if conf == nil {
-		return nil, fmt.Errorf("configuration passed into backend is nil")
-	}
 	b.Backend.Setup(ctx, conf)
 
 	return &b, nil
@@ -85,13 +106,85 @@ func LeaseSwitchedPassthroughBackend(ctx context.Context, conf *logical.BackendC
 type PassthroughBackend struct {
 	*framework.Backend
 	generateLeases bool
+
+	// expireLocks serialize writes of secrets and their removal once they
+	// expire
+	expireLocks []*locksutil.LockEntry
+
+	// maxSecretSize is the largest encoded secret, in bytes, that can be
+	// written; zero means there is no limit
+	maxSecretSize int
 }
 
+// passthroughExpireTimeKey is the key under which the expiration time of a
+// secret written with delete_on_expire is stored alongside its data.
+const passthroughExpireTimeKey = "expire_time"
+
+// passthroughBinaryFieldsKey is the key under which the binary fields of a
+// secret and their content types are given on writes and stored alongside its
+// data.
+const passthroughBinaryFieldsKey = "binary_fields"
+
 func (b *PassthroughBackend) handleRevoke(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	// This is a no-op
 	return nil, nil
 }
 
+// handlePeriodic deletes the secrets written with delete_on_expire whose TTL
+// has passed. Expired secrets are already unreadable; this reclaims their
+// storage.
+func (b *PassthroughBackend) handlePeriodic(ctx context.Context, req *logical.Request) error {
+	// Only the active node can delete from storage
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	keys, err := logical.CollectKeys(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for _, key := range keys {
+		if err := b.deleteIfExpired(ctx, req.Storage, key); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to delete expired secret %q: %v", key, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// deleteIfExpired deletes the secret at the given path if it was written with
+// delete_on_expire and its TTL has passed.
+func (b *PassthroughBackend) deleteIfExpired(ctx context.Context, storage logical.Storage, path string) error {
+	// Don't remove a secret that is being overwritten
+	lock := locksutil.LockForKey(b.expireLocks, path)
+	lock.Lock()
+	defer lock.Unlock()
+
+	out, err := storage.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+
+	var rawData map[string]interface{}
+	if err := jsonutil.DecodeJSON(out.Value, &rawData); err != nil {
+		return errwrap.Wrapf("json decoding failed: {{err}}", err)
+	}
+
+	expireTime, deleteOnExpire := passthroughExpireTime(rawData)
+	if !deleteOnExpire || time.Now().Before(expireTime) {
+		return nil
+	}
+
+	return storage.Delete(ctx, path)
+}
+
 func (b *PassthroughBackend) handleExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
 	out, err := req.Storage.Get(ctx, req.Path)
 	if err != nil {
@@ -120,6 +213,16 @@ func (b *PassthroughBackend) handleRead(ctx context.Context, req *logical.Reques
 		return nil, errwrap.Wrapf("json decoding failed: {{err}}", err)
 	}
 
+	// A secret that is deleted on expiration is gone as soon as its TTL
+	// lapses, even if the expiration manager has not removed it yet
+	expireTime, deleteOnExpire := passthroughExpireTime(rawData)
+	if deleteOnExpire {
+		delete(rawData, passthroughExpireTimeKey)
+		if !time.Now().Before(expireTime) {
+			return nil, nil
+		}
+	}
+
 	var resp *logical.Response
 	if b.generateLeases {
 		// Generate the response
@@ -143,26 +246,117 @@ func (b *PassthroughBackend) handleRead(ctx context.Context, req *logical.Reques
 
 	// Check if there is a ttl key
 	ttlDuration := b.System().DefaultLeaseTTL()
-	ttlRaw, ok := rawData["ttl"]
-	if !ok {
-		ttlRaw, ok = rawData["lease"]
-	}
-	if ok {
-		dur, err := parseutil.ParseDurationSecond(ttlRaw)
-		if err == nil {
-			ttlDuration = dur
-		}
+	if dur, ok := passthroughTTL(rawData); ok {
+		ttlDuration = dur
 
 		if b.generateLeases {
 			resp.Secret.Renewable = true
 		}
 	}
+	if deleteOnExpire {
+		ttlDuration = time.Until(expireTime).Round(time.Second)
+		resp.Secret.Renewable = false
+	}
 
 	resp.Secret.TTL = ttlDuration
 
 	return resp, nil
 }
 
+// passthroughTTL returns the duration given by the "ttl" or "lease" key of a
+// secret, if it has a valid one.
+func passthroughTTL(data map[string]interface{}) (time.Duration, bool) {
+	ttlRaw, ok := data["ttl"]
+	if !ok {
+		ttlRaw, ok = data["lease"]
+	}
+	if !ok {
+		return 0, false
+	}
+
+	dur, err := parseutil.ParseDurationSecond(ttlRaw)
+	if err != nil {
+		return 0, false
+	}
+	return dur, true
+}
+
+// passthroughBinaryFields parses the "binary_fields" value of a write into a
+// map of field names to content types. It accepts a map from field names to
+// content types, or a list of field names without content types. The name "*"
+// stands for every field of the secret.
+func passthroughBinaryFields(data map[string]interface{}) (map[string]string, error) {
+	raw, ok := data[passthroughBinaryFieldsKey]
+	if !ok {
+		return nil, nil
+	}
+
+	fields := make(map[string]string)
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		for name, contentTypeRaw := range raw {
+			contentType, ok := contentTypeRaw.(string)
+			if !ok {
+				return nil, fmt.Errorf("content type of binary field %q must be a string", name)
+			}
+			fields[name] = contentType
+		}
+	default:
+		names, err := parseutil.ParseCommaStringSlice(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			fields[name] = ""
+		}
+	}
+
+	// Expand the wildcard to every field that isn't reserved
+	if contentType, ok := fields["*"]; ok {
+		delete(fields, "*")
+		for name := range data {
+			switch name {
+			case passthroughBinaryFieldsKey, "ttl", "lease", "delete_on_expire":
+				continue
+			}
+			if _, ok := fields[name]; !ok {
+				fields[name] = contentType
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// decodeBinaryValue decodes a base64 encoded binary value. Both the standard
+// and the URL-safe alphabets are accepted, with or without padding.
+func decodeBinaryValue(value string) ([]byte, error) {
+	value = strings.TrimRight(value, "=")
+	if strings.ContainsAny(value, "-_") {
+		return base64.RawURLEncoding.DecodeString(value)
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+// passthroughExpireTime returns the time at which a secret written with
+// delete_on_expire expires, and whether it was written with it.
+func passthroughExpireTime(data map[string]interface{}) (time.Time, bool) {
+	deleteOnExpire, err := parseutil.ParseBool(data["delete_on_expire"])
+	if err != nil || !deleteOnExpire {
+		return time.Time{}, false
+	}
+
+	expireTimeRaw, ok := data[passthroughExpireTimeKey].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	expireTime, err := time.Parse(time.RFC3339Nano, expireTimeRaw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expireTime, true
+}
+
 func (b *PassthroughBackend) GeneratesLeases() bool {
 	return b.generateLeases
 }
@@ -177,11 +371,84 @@ func (b *PassthroughBackend) handleWrite(ctx context.Context, req *logical.Reque
 		return logical.ErrorResponse("missing data fields"), nil
 	}
 
+	entryData := req.Data
+
+	binaryFields, err := passthroughBinaryFields(req.Data)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid binary_fields: %s", err)), nil
+	}
+	if len(binaryFields) > 0 {
+		// Normalize the values to padded standard base64 so that every
+		// encoding of a value is stored, and read back, the same way. The
+		// storage entry is JSON, so the values are not stored as raw bytes.
+		entryData = make(map[string]interface{}, len(req.Data))
+		for k, v := range req.Data {
+			entryData[k] = v
+		}
+		for name := range binaryFields {
+			valueRaw, ok := req.Data[name]
+			if !ok {
+				return logical.ErrorResponse(fmt.Sprintf("binary field %q is not set", name)), nil
+			}
+			value, ok := valueRaw.(string)
+			if !ok {
+				return logical.ErrorResponse(fmt.Sprintf("binary field %q must be a base64 encoded string", name)), nil
+			}
+			decoded, err := decodeBinaryValue(value)
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("binary field %q is not valid base64: %s", name, err)), nil
+			}
+			entryData[name] = base64.StdEncoding.EncodeToString(decoded)
+		}
+		entryData[passthroughBinaryFieldsKey] = binaryFields
+	}
+
+	var ttl time.Duration
+	var expireTime string
+	if deleteOnExpireRaw, ok := req.Data["delete_on_expire"]; ok {
+		deleteOnExpire, err := parseutil.ParseBool(deleteOnExpireRaw)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid delete_on_expire: %s", err)), nil
+		}
+		if deleteOnExpire {
+			if !b.generateLeases {
+				return logical.ErrorResponse("delete_on_expire requires a mount that generates leases"), nil
+			}
+
+			ttl, ok = passthroughTTL(req.Data)
+			if !ok || ttl <= 0 {
+				return logical.ErrorResponse("delete_on_expire requires a valid ttl"), nil
+			}
+			if maxTTL := b.System().MaxLeaseTTL(); ttl > maxTTL {
+				ttl = maxTTL
+			}
+
+			// Store the expiration time with the data so that reads report
+			// the remaining TTL
+			expireTime = time.Now().Add(ttl).UTC().Format(time.RFC3339Nano)
+			origData := entryData
+			entryData = make(map[string]interface{}, len(origData)+1)
+			for k, v := range origData {
+				entryData[k] = v
+			}
+			entryData[passthroughExpireTimeKey] = expireTime
+		}
+	}
+
 	// JSON encode the data
-	buf, err := json.Marshal(req.Data)
+	buf, err := json.Marshal(entryData)
 	if err != nil {
 		return nil, errwrap.Wrapf("json encoding failed: {{err}}", err)
 	}
+	if b.maxSecretSize > 0 && len(buf) > b.maxSecretSize {
+		return logical.ErrorResponse(fmt.Sprintf("secret is %d bytes, which exceeds the maximum of %d bytes", len(buf), b.maxSecretSize)), nil
+	}
+
+	// Don't let a secret that has just been overwritten be removed because
+	// the previous version expired
+	lock := locksutil.LockForKey(b.expireLocks, req.Path)
+	lock.Lock()
+	defer lock.Unlock()
 
 	// Write out a new key
 	entry := &logical.StorageEntry{
@@ -249,4 +516,20 @@ can be used as a hint from the writer of a secret to the consumer of a secret
 that the consumer should re-read the value before the TTL has expired.
 However, any revocation must be handled by the user of this backend; the lease
 duration does not affect the provided data in any way.
+
+If the mount generates leases and "delete_on_expire" is also set to true, the
+secret is deleted once the TTL has passed. Deletion is done by a periodic sweep
+of the mount, roughly once a minute, and is not tied to the token that wrote
+the secret. Reads then return the remaining TTL, and the secret can no longer
+be read once it has expired. The expiration time is stored with the secret
+under the "expire_time" key.
+
+Binary values are written base64 encoded and listed in the "binary_fields"
+field, either as a list of field names or as a map of field names to content
+types; the name "*" stands for every field. They are validated and stored as
+padded standard base64, whichever alphabet and padding they were written with,
+and reads return them that way along with "binary_fields".
+
+If the mount was enabled with the "max_secret_size" option, writes of secrets
+whose encoded size exceeds that many bytes are rejected.
 `
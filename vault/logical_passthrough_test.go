@@ -2,8 +2,10 @@ package vault
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -215,6 +217,245 @@ func TestPassthroughBackend_Revoke(t *testing.T) {
 	test(b)
 }
 
+func TestPassthroughBackend_DeleteOnExpire(t *testing.T) {
+	write := func(b logical.Backend, storage logical.Storage, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		req := logical.TestRequest(t, logical.UpdateOperation, "foo")
+		req.Storage = storage
+		req.Data = data
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	read := func(b logical.Backend, storage logical.Storage) *logical.Response {
+		t.Helper()
+		req := logical.TestRequest(t, logical.ReadOperation, "foo")
+		req.Storage = storage
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	revoke := func(b logical.Backend, storage logical.Storage, secret *logical.Secret) {
+		t.Helper()
+		req := logical.TestRequest(t, logical.RevokeOperation, "foo")
+		req.Storage = storage
+		req.Secret = secret
+		if _, err := b.HandleRequest(context.Background(), req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	sweep := func(b logical.Backend, storage logical.Storage) {
+		t.Helper()
+		req := logical.TestRequest(t, logical.RollbackOperation, "")
+		req.Storage = storage
+		// The mount has no WAL, which is reported once the sweep has run
+		if _, err := b.HandleRequest(context.Background(), req); err != nil && err != logical.ErrUnsupportedOperation {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	putExpired := func(storage logical.Storage) {
+		t.Helper()
+		entry, err := logical.StorageEntryJSON("foo", map[string]interface{}{
+			"raw":                    "test",
+			"ttl":                    "1h",
+			"delete_on_expire":       true,
+			passthroughExpireTimeKey: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Put(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	storage := &logical.InmemStorage{}
+	data := map[string]interface{}{
+		"raw":              "test",
+		"ttl":              "1h",
+		"delete_on_expire": true,
+	}
+
+	// Deleting requires leases
+	resp := write(testPassthroughBackend(), storage, data)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got: %#v", resp)
+	}
+
+	b := testPassthroughLeasedBackend()
+	resp = write(b, storage, map[string]interface{}{
+		"raw":              "test",
+		"delete_on_expire": true,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for missing ttl, got: %#v", resp)
+	}
+
+	// Writes don't register a lease, so the secret doesn't depend on the
+	// token that wrote it
+	resp = write(b, storage, data)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = read(b, storage)
+	if resp.Secret.TTL > time.Hour || resp.Secret.TTL < 59*time.Minute || resp.Secret.Renewable {
+		t.Fatalf("bad lease: %#v", resp.Secret)
+	}
+	if _, ok := resp.Data[passthroughExpireTimeKey]; ok || resp.Data["raw"] != "test" {
+		t.Fatalf("bad data: %#v", resp.Data)
+	}
+
+	// Revoking the lease of a read, as happens when the reading token is
+	// revoked, leaves the secret alone
+	revoke(b, storage, resp.Secret)
+	if resp := read(b, storage); resp == nil {
+		t.Fatal("expected secret to survive revocation of a lease")
+	}
+
+	// Secrets that have not expired survive the sweep
+	sweep(b, storage)
+	if resp := read(b, storage); resp == nil {
+		t.Fatal("expected unexpired secret to survive the sweep")
+	}
+
+	// An expired secret can't be read even if it hasn't been deleted yet
+	putExpired(storage)
+	if resp := read(b, storage); resp != nil {
+		t.Fatalf("expected expired secret to be unreadable, got: %#v", resp)
+	}
+
+	// A secret that was overwritten after it expired is kept
+	write(b, storage, data)
+	sweep(b, storage)
+	if resp := read(b, storage); resp == nil {
+		t.Fatal("expected overwritten secret to survive the sweep")
+	}
+
+	putExpired(storage)
+	sweep(b, storage)
+	if out, err := storage.Get(context.Background(), "foo"); err != nil || out != nil {
+		t.Fatalf("expected secret to be deleted, got: %#v, %v", out, err)
+	}
+}
+
+func TestPassthroughBackend_BinaryFields(t *testing.T) {
+	b := testPassthroughBackend()
+	storage := &logical.InmemStorage{}
+	handle := func(op logical.Operation, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		req := logical.TestRequest(t, op, "foo")
+		req.Storage = storage
+		req.Data = data
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+
+	// Unpadded and URL-safe encodings are normalized to padded standard base64
+	der := []byte{0x30, 0x82, 0xfb, 0xff, 0x00}
+	resp := handle(logical.UpdateOperation, map[string]interface{}{
+		"cert":          base64.RawURLEncoding.EncodeToString(der),
+		"keytab":        base64.StdEncoding.EncodeToString([]byte("keytab")),
+		"name":          "test",
+		"binary_fields": map[string]interface{}{"cert": "application/pkix-cert", "keytab": ""},
+	})
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The normalized encoding is what ends up in storage
+	out, err := storage.Get(context.Background(), "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]interface{}
+	if err := out.DecodeJSON(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored["cert"] != base64.StdEncoding.EncodeToString(der) {
+		t.Fatalf("bad: stored cert: %#v", stored["cert"])
+	}
+
+	resp = handle(logical.ReadOperation, nil)
+	expected := map[string]interface{}{
+		"cert":          base64.StdEncoding.EncodeToString(der),
+		"keytab":        base64.StdEncoding.EncodeToString([]byte("keytab")),
+		"name":          "test",
+		"binary_fields": map[string]interface{}{"cert": "application/pkix-cert", "keytab": ""},
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, resp.Data)
+	}
+
+	// Writing back what was read round-trips
+	resp = handle(logical.UpdateOperation, resp.Data)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = handle(logical.ReadOperation, nil)
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, resp.Data)
+	}
+
+	// The wildcard marks every field as binary
+	resp = handle(logical.UpdateOperation, map[string]interface{}{
+		"cert":          base64.StdEncoding.EncodeToString(der),
+		"ttl":           "1h",
+		"binary_fields": "*",
+	})
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = handle(logical.ReadOperation, nil)
+	if !reflect.DeepEqual(resp.Data["binary_fields"], map[string]interface{}{"cert": ""}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"cert": "not base64!", "binary_fields": "cert"},
+		{"cert": 5, "binary_fields": "cert"},
+		{"name": "test", "binary_fields": "cert"},
+		{"cert": "AAAA", "binary_fields": map[string]interface{}{"cert": 5}},
+	} {
+		if resp := handle(logical.UpdateOperation, data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %#v, got: %#v", data, resp)
+		}
+	}
+
+	// Secrets larger than the configured maximum are rejected
+	b, err = PassthroughBackendFactory(context.Background(), &logical.BackendConfig{
+		System: logical.StaticSystemView{},
+		Config: map[string]string{"max_secret_size": "64"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := handle(logical.UpdateOperation, map[string]interface{}{"raw": "test"}); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = handle(logical.UpdateOperation, map[string]interface{}{
+		"cert":          base64.StdEncoding.EncodeToString(make([]byte, 64)),
+		"binary_fields": "cert",
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "exceeds the maximum of 64 bytes") {
+		t.Fatalf("expected size error, got: %#v", resp)
+	}
+
+	if _, err := PassthroughBackendFactory(context.Background(), &logical.BackendConfig{
+		System: logical.StaticSystemView{},
+		Config: map[string]string{"max_secret_size": "-1"},
+	}); err == nil {
+		t.Fatal("expected error for negative max_secret_size")
+	}
+}
+
 func testPassthroughBackend() logical.Backend {
 	b, _ := PassthroughBackendFactory(context.Background(), &logical.BackendConfig{
 		Logger: nil,